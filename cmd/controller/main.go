@@ -20,6 +20,14 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flagsConfig.Command != "" {
+		if err := flags.RunCommand(flagsConfig); err != nil {
+			slog.Error("command failed", "command", flagsConfig.Command, "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	startupManager, err := startup_manager.NewStartupManagerWithController(flagsConfig.ConfigLocation, flagsConfig)
 	if err != nil {
 		slog.Error("failed to create startup manager", "err", err)
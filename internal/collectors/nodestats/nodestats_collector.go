@@ -5,24 +5,41 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
 	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
 	"github.com/kuskoman/logstash-exporter/pkg/config"
 )
 
 const subsystem = "stats"
 
+// startTimeTolerance is the maximum drift of the estimated start time of
+// a Logstash instance that is not considered a restart.
+const startTimeTolerance = 5 * time.Second
+
 var (
 	namespace = config.PrometheusNamespace
 )
 
+// NodeStatsObserver is notified of every node stats response fetched by the NodestatsCollector,
+// so that it can export metrics computed from the response without fetching the node stats again
+type NodeStatsObserver interface {
+	ObserveNodeStats(client logstash_client.Client, nodeStats *responses.NodeStatsResponse, ch chan<- prometheus.Metric)
+}
+
 // NodestatsCollector is a custom collector for the /_node/stats endpoint
 type NodestatsCollector struct {
 	clients              []logstash_client.Client
 	pipelineSubcollector *PipelineSubcollector
+	metricsConfig        config.MetricsConfig
+	observers            []NodeStatsObserver
+
+	startTimes   map[string]time.Time
+	startTimesMu sync.Mutex
 
 	JvmThreadsCount     *prometheus.Desc
 	JvmThreadsPeakCount *prometheus.Desc
@@ -74,15 +91,30 @@ type NodestatsCollector struct {
 	FlowQueueBackpressureLifetime *prometheus.Desc
 	FlowWorkerConcurrencyCurrent  *prometheus.Desc
 	FlowWorkerConcurrencyLifetime *prometheus.Desc
+
+	// Metrics exported by the "v3" naming scheme, replacing
+	// the millisecond durations and the mistyped counters above
+	JvmGcCollectionTimeSeconds     *prometheus.Desc
+	JvmUptimeSeconds               *prometheus.Desc
+	ProcessCpuSecondsTotal         *prometheus.Desc
+	EventsInTotal                  *prometheus.Desc
+	EventsFilteredTotal            *prometheus.Desc
+	EventsOutTotal                 *prometheus.Desc
+	EventsDurationSeconds          *prometheus.Desc
+	EventsQueuePushDurationSeconds *prometheus.Desc
 }
 
-func NewNodestatsCollector(clients []logstash_client.Client) *NodestatsCollector {
+func NewNodestatsCollector(clients []logstash_client.Client, metricsConfig config.MetricsConfig, observers ...NodeStatsObserver) *NodestatsCollector {
 	descHelper := prometheus_helper.SimpleDescHelper{Namespace: namespace, Subsystem: subsystem}
 
 	return &NodestatsCollector{
-		clients: clients,
+		clients:       clients,
+		metricsConfig: metricsConfig,
+		observers:     observers,
+
+		pipelineSubcollector: NewPipelineSubcollector(metricsConfig),
 
-		pipelineSubcollector: NewPipelineSubcollector(),
+		startTimes: make(map[string]time.Time),
 
 		JvmThreadsCount: descHelper.NewDesc("jvm_threads_count",
 			"Number of live threads including both daemon and non-daemon threads."),
@@ -91,24 +123,24 @@ func NewNodestatsCollector(clients []logstash_client.Client) *NodestatsCollector
 
 		JvmMemHeapUsedPercent: descHelper.NewDesc("jvm_mem_heap_used_percent",
 			"Percentage of the heap memory that is used."),
-		JvmMemHeapCommittedBytes: descHelper.NewDesc("jvm_mem_heap_committed_bytes",
+		JvmMemHeapCommittedBytes: descHelper.NewDescWithUnit("jvm_mem_heap_committed_bytes", prometheus_helper.UnitBytes,
 			"Amount of heap memory in bytes that is committed for the Java virtual machine to use."),
-		JvmMemHeapMaxBytes: descHelper.NewDesc("jvm_mem_heap_max_bytes",
+		JvmMemHeapMaxBytes: descHelper.NewDescWithUnit("jvm_mem_heap_max_bytes", prometheus_helper.UnitBytes,
 			"Maximum amount of heap memory in bytes that can be used for memory management."),
-		JvmMemHeapUsedBytes: descHelper.NewDesc("jvm_mem_heap_used_bytes",
+		JvmMemHeapUsedBytes: descHelper.NewDescWithUnit("jvm_mem_heap_used_bytes", prometheus_helper.UnitBytes,
 			"Amount of used heap memory in bytes."),
-		JvmMemNonHeapCommittedBytes: descHelper.NewDesc("jvm_mem_non_heap_committed_bytes",
+		JvmMemNonHeapCommittedBytes: descHelper.NewDescWithUnit("jvm_mem_non_heap_committed_bytes", prometheus_helper.UnitBytes,
 			"Amount of non-heap memory in bytes that is committed for the Java virtual machine to use."),
 
-		JvmMemPoolPeakUsedInBytes: descHelper.NewDesc("jvm_mem_pool_peak_used_bytes",
+		JvmMemPoolPeakUsedInBytes: descHelper.NewDescWithUnit("jvm_mem_pool_peak_used_bytes", prometheus_helper.UnitBytes,
 			"Peak used bytes of a given JVM memory pool.", "pool"),
-		JvmMemPoolUsedInBytes: descHelper.NewDesc("jvm_mem_pool_used_bytes",
+		JvmMemPoolUsedInBytes: descHelper.NewDescWithUnit("jvm_mem_pool_used_bytes", prometheus_helper.UnitBytes,
 			"Currently used bytes of a given JVM memory pool.", "pool"),
-		JvmMemPoolPeakMaxInBytes: descHelper.NewDesc("jvm_mem_pool_peak_max_bytes",
+		JvmMemPoolPeakMaxInBytes: descHelper.NewDescWithUnit("jvm_mem_pool_peak_max_bytes", prometheus_helper.UnitBytes,
 			"Highest value of bytes that were used in a given JVM memory pool.", "pool"),
-		JvmMemPoolMaxInBytes: descHelper.NewDesc("jvm_mem_pool_max_bytes",
+		JvmMemPoolMaxInBytes: descHelper.NewDescWithUnit("jvm_mem_pool_max_bytes", prometheus_helper.UnitBytes,
 			"Maximum amount of bytes that can be used in a given JVM memory pool.", "pool"),
-		JvmMemPoolCommittedInBytes: descHelper.NewDesc("jvm_mem_pool_committed_bytes",
+		JvmMemPoolCommittedInBytes: descHelper.NewDescWithUnit("jvm_mem_pool_committed_bytes", prometheus_helper.UnitBytes,
 			"Amount of bytes that are committed for the Java virtual machine to use in a given JVM memory pool.", "pool"),
 
 		JvmGcCollectionCount: descHelper.NewDesc(
@@ -151,6 +183,20 @@ func NewNodestatsCollector(clients []logstash_client.Client) *NodestatsCollector
 		FlowQueueBackpressureLifetime: descHelper.NewDesc("flow_queue_backpressure_lifetime", "Lifetime number of events in the backpressure queue."),
 		FlowWorkerConcurrencyCurrent:  descHelper.NewDesc("flow_worker_concurrency_current", "Current number of workers."),
 		FlowWorkerConcurrencyLifetime: descHelper.NewDesc("flow_worker_concurrency_lifetime", "Lifetime number of workers."),
+
+		JvmGcCollectionTimeSeconds: descHelper.NewDescWithUnit("jvm_gc_collection_time_seconds_total", prometheus_helper.UnitSeconds,
+			"Total time spent running garbage collection for a given JVM memory pool.", "pool"),
+		JvmUptimeSeconds: descHelper.NewDescWithUnit("jvm_uptime_seconds", prometheus_helper.UnitSeconds,
+			"Uptime of the JVM in seconds."),
+		ProcessCpuSecondsTotal: descHelper.NewDescWithUnit("process_cpu_seconds_total", prometheus_helper.UnitSeconds,
+			"Total CPU time used by the process in seconds."),
+		EventsInTotal:       descHelper.NewDesc("events_in_total", "Number of events received."),
+		EventsFilteredTotal: descHelper.NewDesc("events_filtered_total", "Number of events filtered out."),
+		EventsOutTotal:      descHelper.NewDesc("events_out_total", "Number of events out."),
+		EventsDurationSeconds: descHelper.NewDescWithUnit("events_duration_seconds_total", prometheus_helper.UnitSeconds,
+			"Total time spent processing events in seconds."),
+		EventsQueuePushDurationSeconds: descHelper.NewDescWithUnit("events_queue_push_duration_seconds_total", prometheus_helper.UnitSeconds,
+			"Total time spent pushing events to the queue in seconds."),
 	}
 }
 
@@ -195,9 +241,14 @@ func (collector *NodestatsCollector) collectSingleInstance(client logstash_clien
 		return err
 	}
 
+	for _, observer := range collector.observers {
+		observer.ObserveNodeStats(client, nodeStats, ch)
+	}
+
 	endpoint := client.GetEndpoint()
 	name := client.Name()
-	metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: ch, Labels: []string{}, DefaultLabels: []string{endpoint, name}}
+	startTime := collector.getStartTime(endpoint, nodeStats.Jvm.UptimeInMillis)
+	metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: ch, Labels: []string{}, DefaultLabels: []string{endpoint, name}, CreatedTimestamp: startTime}
 
 	// ************ THREADS ************
 	threadsStats := nodeStats.Jvm.Threads
@@ -247,20 +298,35 @@ func (collector *NodestatsCollector) collectSingleInstance(client logstash_clien
 	//	  ********* YOUNG *********
 	metricsHelper.Labels = []string{"young"}
 	metricsHelper.NewIntMetric(collector.JvmGcCollectionCount, prometheus.CounterValue, nodeStats.Jvm.Gc.Collectors.Young.CollectionCount)
-	metricsHelper.NewIntMetric(collector.JvmGcCollectionTimeInMillis, prometheus.CounterValue, nodeStats.Jvm.Gc.Collectors.Young.CollectionTimeInMillis)
+	if collector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(collector.JvmGcCollectionTimeInMillis, prometheus.CounterValue, nodeStats.Jvm.Gc.Collectors.Young.CollectionTimeInMillis)
+	}
+	if collector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewFloatMetric(collector.JvmGcCollectionTimeSeconds, prometheus.CounterValue, millisToSeconds(nodeStats.Jvm.Gc.Collectors.Young.CollectionTimeInMillis))
+	}
 	//	  *************************
 
 	//	  ********* OLD *********
 	metricsHelper.Labels = []string{"old"}
 	metricsHelper.NewIntMetric(collector.JvmGcCollectionCount, prometheus.CounterValue, nodeStats.Jvm.Gc.Collectors.Old.CollectionCount)
-	metricsHelper.NewIntMetric(collector.JvmGcCollectionTimeInMillis, prometheus.CounterValue, nodeStats.Jvm.Gc.Collectors.Old.CollectionTimeInMillis)
+	if collector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(collector.JvmGcCollectionTimeInMillis, prometheus.CounterValue, nodeStats.Jvm.Gc.Collectors.Old.CollectionTimeInMillis)
+	}
+	if collector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewFloatMetric(collector.JvmGcCollectionTimeSeconds, prometheus.CounterValue, millisToSeconds(nodeStats.Jvm.Gc.Collectors.Old.CollectionTimeInMillis))
+	}
 	//	  *************************
 	// ********************************
 
 	metricsHelper.Labels = []string{}
 
 	// ************ UPTIME ************
-	metricsHelper.NewIntMetric(collector.JvmUptimeMillis, prometheus.GaugeValue, nodeStats.Jvm.UptimeInMillis)
+	if collector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(collector.JvmUptimeMillis, prometheus.GaugeValue, nodeStats.Jvm.UptimeInMillis)
+	}
+	if collector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewFloatMetric(collector.JvmUptimeSeconds, prometheus.GaugeValue, millisToSeconds(nodeStats.Jvm.UptimeInMillis))
+	}
 	// ********************************
 
 	// ************ PROCESS ************
@@ -268,7 +334,12 @@ func (collector *NodestatsCollector) collectSingleInstance(client logstash_clien
 	metricsHelper.NewInt64Metric(collector.ProcessOpenFileDescriptors, prometheus.GaugeValue, procStats.OpenFileDescriptors)
 	metricsHelper.NewInt64Metric(collector.ProcessMaxFileDescriptors, prometheus.GaugeValue, procStats.MaxFileDescriptors)
 	metricsHelper.NewIntMetric(collector.ProcessCpuPercent, prometheus.GaugeValue, procStats.CPU.Percent)
-	metricsHelper.NewInt64Metric(collector.ProcessCpuTotalMillis, prometheus.CounterValue, procStats.CPU.TotalInMillis)
+	if collector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewInt64Metric(collector.ProcessCpuTotalMillis, prometheus.CounterValue, procStats.CPU.TotalInMillis)
+	}
+	if collector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewFloatMetric(collector.ProcessCpuSecondsTotal, prometheus.CounterValue, millisToSeconds(procStats.CPU.TotalInMillis))
+	}
 	metricsHelper.NewFloatMetric(collector.ProcessCpuLoadAverageOneM, prometheus.GaugeValue, procStats.CPU.LoadAverage.OneM)
 	metricsHelper.NewFloatMetric(collector.ProcessCpuLoadAverageFiveM, prometheus.GaugeValue, procStats.CPU.LoadAverage.FiveM)
 	metricsHelper.NewFloatMetric(collector.ProcessCpuLoadAverageFifteenM, prometheus.GaugeValue, procStats.CPU.LoadAverage.FifteenM)
@@ -286,11 +357,20 @@ func (collector *NodestatsCollector) collectSingleInstance(client logstash_clien
 
 	// ************ EVENTS ************
 	eventsStats := nodeStats.Events
-	metricsHelper.NewInt64Metric(collector.EventsIn, prometheus.GaugeValue, eventsStats.In)
-	metricsHelper.NewInt64Metric(collector.EventsFiltered, prometheus.GaugeValue, eventsStats.Filtered)
-	metricsHelper.NewInt64Metric(collector.EventsOut, prometheus.GaugeValue, eventsStats.Out)
-	metricsHelper.NewInt64Metric(collector.EventsDurationInMillis, prometheus.GaugeValue, eventsStats.DurationInMillis)
-	metricsHelper.NewInt64Metric(collector.EventsQueuePushDurationInMillis, prometheus.GaugeValue, eventsStats.QueuePushDurationInMillis)
+	if collector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewInt64Metric(collector.EventsIn, prometheus.GaugeValue, eventsStats.In)
+		metricsHelper.NewInt64Metric(collector.EventsFiltered, prometheus.GaugeValue, eventsStats.Filtered)
+		metricsHelper.NewInt64Metric(collector.EventsOut, prometheus.GaugeValue, eventsStats.Out)
+		metricsHelper.NewInt64Metric(collector.EventsDurationInMillis, prometheus.GaugeValue, eventsStats.DurationInMillis)
+		metricsHelper.NewInt64Metric(collector.EventsQueuePushDurationInMillis, prometheus.GaugeValue, eventsStats.QueuePushDurationInMillis)
+	}
+	if collector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewInt64Metric(collector.EventsInTotal, prometheus.CounterValue, eventsStats.In)
+		metricsHelper.NewInt64Metric(collector.EventsFilteredTotal, prometheus.CounterValue, eventsStats.Filtered)
+		metricsHelper.NewInt64Metric(collector.EventsOutTotal, prometheus.CounterValue, eventsStats.Out)
+		metricsHelper.NewFloatMetric(collector.EventsDurationSeconds, prometheus.CounterValue, millisToSeconds(eventsStats.DurationInMillis))
+		metricsHelper.NewFloatMetric(collector.EventsQueuePushDurationSeconds, prometheus.CounterValue, millisToSeconds(eventsStats.QueuePushDurationInMillis))
+	}
 	// ********************************
 
 	// ************ FLOW ************
@@ -308,8 +388,33 @@ func (collector *NodestatsCollector) collectSingleInstance(client logstash_clien
 	// ******************************
 
 	for pipelineId, pipelineStats := range nodeStats.Pipelines {
-		collector.pipelineSubcollector.Collect(&pipelineStats, pipelineId, ch, endpoint, name)
+		collector.pipelineSubcollector.Collect(&pipelineStats, pipelineId, ch, endpoint, name, startTime)
 	}
 
 	return nil
 }
+
+// getStartTime estimates the moment the Logstash JVM was started, based on its uptime.
+// It is used as the created timestamp of counters, so that resets caused
+// by Logstash restarts can be detected by OpenMetrics consumers.
+// The previous estimate is reused unless it drifted by more than startTimeTolerance,
+// so that the created timestamp stays stable between scrapes.
+func (collector *NodestatsCollector) getStartTime(endpoint string, uptimeInMillis int) time.Time {
+	startTime := time.Now().Add(-time.Duration(uptimeInMillis) * time.Millisecond)
+
+	collector.startTimesMu.Lock()
+	defer collector.startTimesMu.Unlock()
+
+	previousStartTime, ok := collector.startTimes[endpoint]
+	if ok && startTime.Sub(previousStartTime).Abs() < startTimeTolerance {
+		return previousStartTime
+	}
+
+	collector.startTimes[endpoint] = startTime
+	return startTime
+}
+
+// millisToSeconds converts a duration in milliseconds, as reported by Logstash, to seconds.
+func millisToSeconds[T int | int64](millis T) float64 {
+	return float64(millis) / 1000
+}
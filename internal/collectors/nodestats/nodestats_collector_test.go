@@ -14,6 +14,7 @@ import (
 	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
 	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
 	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
 )
 
 type mockClient struct{}
@@ -67,7 +68,7 @@ func TestCollectNotNil(t *testing.T) {
 	t.Parallel()
 
 	clients := []logstash_client.Client{&mockClient{}, &mockClient{}}
-	collector := NewNodestatsCollector(clients)
+	collector := NewNodestatsCollector(clients, config.MetricsConfig{}, NewStallDetector(time.Minute))
 	ch := make(chan prometheus.Metric)
 	ctx := context.Background()
 
@@ -89,6 +90,7 @@ func TestCollectNotNil(t *testing.T) {
 		"logstash_stats_jvm_threads_peak_count",
 		"logstash_stats_jvm_uptime_millis",
 		"logstash_stats_pipeline_up",
+		"logstash_stats_pipeline_stalled",
 		"logstash_stats_pipeline_events_duration",
 		"logstash_stats_pipeline_events_filtered",
 		"logstash_stats_pipeline_events_in",
@@ -157,7 +159,7 @@ func TestCollectsErrors(t *testing.T) {
 	t.Parallel()
 
 	testCollectorForClients := func(clients []logstash_client.Client) {
-		collector := NewNodestatsCollector(clients)
+		collector := NewNodestatsCollector(clients, config.MetricsConfig{})
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 
@@ -192,3 +194,144 @@ func TestCollectsErrors(t *testing.T) {
 		testCollectorForClients([]logstash_client.Client{&errorMockClient{}, &errorMockClient{}})
 	})
 }
+
+func TestGetStartTime(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should keep start time stable between scrapes", func(t *testing.T) {
+		t.Parallel()
+		collector := NewNodestatsCollector(nil, config.MetricsConfig{})
+
+		first := collector.getStartTime("http://localhost:9600", 60000)
+		second := collector.getStartTime("http://localhost:9600", 60010)
+
+		if !first.Equal(second) {
+			t.Errorf("expected start time to be stable, got %v and %v", first, second)
+		}
+	})
+
+	t.Run("should update start time after a restart", func(t *testing.T) {
+		t.Parallel()
+		collector := NewNodestatsCollector(nil, config.MetricsConfig{})
+
+		first := collector.getStartTime("http://localhost:9600", 3600000)
+		second := collector.getStartTime("http://localhost:9600", 1000)
+
+		if second.Sub(first) < time.Hour-time.Minute {
+			t.Errorf("expected start time to move forward after a restart, got %v and %v", first, second)
+		}
+	})
+
+	t.Run("should track start times per endpoint", func(t *testing.T) {
+		t.Parallel()
+		collector := NewNodestatsCollector(nil, config.MetricsConfig{})
+
+		first := collector.getStartTime("http://localhost:9600", 3600000)
+		second := collector.getStartTime("http://localhost:9601", 1000)
+
+		if first.Equal(second) {
+			t.Errorf("expected different start times for different endpoints")
+		}
+	})
+}
+
+func TestCollectMetricsNaming(t *testing.T) {
+	t.Parallel()
+
+	collectMetricNames := func(t *testing.T, metricsConfig config.MetricsConfig) []string {
+		collector := NewNodestatsCollector([]logstash_client.Client{&mockClient{}}, metricsConfig)
+		ch := make(chan prometheus.Metric)
+
+		go func() {
+			err := collector.Collect(context.Background(), ch)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			close(ch)
+		}()
+
+		var names []string
+		for metric := range ch {
+			name, err := prometheus_helper.ExtractFqName(metric.Desc().String())
+			if err != nil {
+				t.Errorf("failed to extract fqName from metric %s", metric.Desc())
+			}
+			names = append(names, name)
+		}
+
+		return names
+	}
+
+	v2Metrics := []string{
+		"logstash_stats_jvm_uptime_millis",
+		"logstash_stats_jvm_gc_collection_time_millis_total",
+		"logstash_stats_process_cpu_total_millis",
+		"logstash_stats_events_in",
+		"logstash_stats_events_duration_millis",
+		"logstash_stats_pipeline_events_in",
+		"logstash_stats_pipeline_events_duration",
+		"logstash_stats_pipeline_reloads_successes",
+		"logstash_stats_pipeline_queue_events_count",
+		"logstash_stats_pipeline_plugin_events_in",
+		"logstash_stats_pipeline_plugin_events_duration",
+		"logstash_stats_pipeline_plugin_events_queue_push_duration",
+	}
+
+	v3Metrics := []string{
+		"logstash_stats_jvm_uptime_seconds",
+		"logstash_stats_jvm_gc_collection_time_seconds_total",
+		"logstash_stats_process_cpu_seconds_total",
+		"logstash_stats_events_in_total",
+		"logstash_stats_events_duration_seconds_total",
+		"logstash_stats_pipeline_events_in_total",
+		"logstash_stats_pipeline_events_duration_seconds_total",
+		"logstash_stats_pipeline_reloads_successes_total",
+		"logstash_stats_pipeline_queue_events",
+		"logstash_stats_pipeline_plugin_events_in_total",
+		"logstash_stats_pipeline_plugin_events_duration_seconds_total",
+		"logstash_stats_pipeline_plugin_events_queue_push_duration_seconds_total",
+	}
+
+	testCases := []struct {
+		name          string
+		metricsConfig config.MetricsConfig
+		expectV2      bool
+		expectV3      bool
+	}{
+		{name: "default naming", metricsConfig: config.MetricsConfig{}, expectV2: true, expectV3: false},
+		{name: "v2 naming", metricsConfig: config.MetricsConfig{Naming: config.MetricsNamingV2}, expectV2: true, expectV3: false},
+		{name: "v3 naming", metricsConfig: config.MetricsConfig{Naming: config.MetricsNamingV3}, expectV2: false, expectV3: true},
+		{name: "v3 naming with legacy names", metricsConfig: config.MetricsConfig{Naming: config.MetricsNamingV3, LegacyNames: true}, expectV2: true, expectV3: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			names := collectMetricNames(t, testCase.metricsConfig)
+
+			for _, metric := range v2Metrics {
+				if slices.Contains(names, metric) != testCase.expectV2 {
+					t.Errorf("expected presence of metric %s to be %v", metric, testCase.expectV2)
+				}
+			}
+
+			for _, metric := range v3Metrics {
+				if slices.Contains(names, metric) != testCase.expectV3 {
+					t.Errorf("expected presence of metric %s to be %v", metric, testCase.expectV3)
+				}
+			}
+		})
+	}
+}
+
+func TestMillisToSeconds(t *testing.T) {
+	t.Parallel()
+
+	if seconds := millisToSeconds(1500); seconds != 1.5 {
+		t.Errorf("expected 1.5, got %f", seconds)
+	}
+
+	if seconds := millisToSeconds(int64(250)); seconds != 0.25 {
+		t.Errorf("expected 0.25, got %f", seconds)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
 	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
 )
 
 const (
@@ -20,6 +21,8 @@ const (
 // pipelines of a logstash node.
 // The collector is created once for each pipeline of the node.
 type PipelineSubcollector struct {
+	metricsConfig config.MetricsConfig
+
 	Up                      *prometheus.Desc
 	EventsOut               *prometheus.Desc
 	EventsFiltered          *prometheus.Desc
@@ -63,11 +66,28 @@ type PipelineSubcollector struct {
 	DeadLetterQueueSizeInBytes    *prometheus.Desc
 	DeadLetterQueueDroppedEvents  *prometheus.Desc
 	DeadLetterQueueExpiredEvents  *prometheus.Desc
+
+	// Metrics exported by the "v3" naming scheme, replacing
+	// the millisecond durations, the mistyped metrics and the counters without the "_total" suffix above
+	EventsOutTotal                               *prometheus.Desc
+	EventsFilteredTotal                          *prometheus.Desc
+	EventsInTotal                                *prometheus.Desc
+	EventsDurationSeconds                        *prometheus.Desc
+	EventsQueuePushDurationSeconds               *prometheus.Desc
+	ReloadsSuccessesTotal                        *prometheus.Desc
+	ReloadsFailuresTotal                         *prometheus.Desc
+	QueueEvents                                  *prometheus.Desc
+	PipelinePluginEventsInTotal                  *prometheus.Desc
+	PipelinePluginEventsOutTotal                 *prometheus.Desc
+	PipelinePluginEventsDurationSeconds          *prometheus.Desc
+	PipelinePluginEventsQueuePushDurationSeconds *prometheus.Desc
 }
 
-func NewPipelineSubcollector() *PipelineSubcollector {
+func NewPipelineSubcollector(metricsConfig config.MetricsConfig) *PipelineSubcollector {
 	descHelper := prometheus_helper.SimpleDescHelper{Namespace: namespace, Subsystem: fmt.Sprintf("%s_pipeline", subsystem)}
 	return &PipelineSubcollector{
+		metricsConfig: metricsConfig,
+
 		Up:                      descHelper.NewDesc("up", "Whether the pipeline is up or not.", "pipeline"),
 		EventsOut:               descHelper.NewDesc("events_out", "Number of events that have been processed by this pipeline.", "pipeline"),
 		EventsFiltered:          descHelper.NewDesc("events_filtered", "Number of events that have been filtered out by this pipeline.", "pipeline"),
@@ -83,7 +103,7 @@ func NewPipelineSubcollector() *PipelineSubcollector {
 
 		QueueEventsCount:         descHelper.NewDesc("queue_events_count", "Number of events in the queue.", "pipeline"),
 		QueueEventsQueueSize:     descHelper.NewDesc("queue_events_queue_size", "Number of events that the queue can accommodate", "pipeline"),
-		QueueMaxQueueSizeInBytes: descHelper.NewDesc("queue_max_size_in_bytes", "Maximum size of given queue in bytes.", "pipeline"),
+		QueueMaxQueueSizeInBytes: descHelper.NewDescWithUnit("queue_max_size_in_bytes", prometheus_helper.UnitBytes, "Maximum size of given queue in bytes.", "pipeline"),
 
 		PipelinePluginEventsIn:                descHelper.NewDesc("plugin_events_in", "Number of events received this pipeline.", "plugin_type", "plugin", "plugin_id", "pipeline"),
 		PipelinePluginEventsOut:               descHelper.NewDesc("plugin_events_out", "Number of events output by this pipeline.", "plugin_type", "plugin", "plugin_id", "pipeline"),
@@ -108,25 +128,54 @@ func NewPipelineSubcollector() *PipelineSubcollector {
 		FlowWorkerUtilizationCurrent:  descHelper.NewDesc("flow_worker_utilization_current", "Current worker utilization.", "pipeline"),
 		FlowWorkerUtilizationLifetime: descHelper.NewDesc("flow_worker_utilization_lifetime", "Lifetime worker utilization.", "pipeline"),
 
-		DeadLetterQueueMaxSizeInBytes: descHelper.NewDesc("dead_letter_queue_max_size_in_bytes", "Maximum size of the dead letter queue in bytes.", "pipeline"),
-		DeadLetterQueueSizeInBytes:    descHelper.NewDesc("dead_letter_queue_size_in_bytes", "Current size of the dead letter queue in bytes.", "pipeline"),
+		DeadLetterQueueMaxSizeInBytes: descHelper.NewDescWithUnit("dead_letter_queue_max_size_in_bytes", prometheus_helper.UnitBytes, "Maximum size of the dead letter queue in bytes.", "pipeline"),
+		DeadLetterQueueSizeInBytes:    descHelper.NewDescWithUnit("dead_letter_queue_size_in_bytes", prometheus_helper.UnitBytes, "Current size of the dead letter queue in bytes.", "pipeline"),
 		DeadLetterQueueDroppedEvents:  descHelper.NewDesc("dead_letter_queue_dropped_events", "Number of events dropped by the dead letter queue.", "pipeline"),
 		DeadLetterQueueExpiredEvents:  descHelper.NewDesc("dead_letter_queue_expired_events", "Number of events expired in the dead letter queue.", "pipeline"),
+
+		EventsOutTotal:                 descHelper.NewDesc("events_out_total", "Number of events that have been processed by this pipeline.", "pipeline"),
+		EventsFilteredTotal:            descHelper.NewDesc("events_filtered_total", "Number of events that have been filtered out by this pipeline.", "pipeline"),
+		EventsInTotal:                  descHelper.NewDesc("events_in_total", "Number of events that have been inputted into this pipeline.", "pipeline"),
+		EventsDurationSeconds:          descHelper.NewDescWithUnit("events_duration_seconds_total", prometheus_helper.UnitSeconds, "Total time spent processing events in seconds.", "pipeline"),
+		EventsQueuePushDurationSeconds: descHelper.NewDescWithUnit("events_queue_push_duration_seconds_total", prometheus_helper.UnitSeconds, "Total time spent pushing events to the queue in seconds.", "pipeline"),
+		ReloadsSuccessesTotal:          descHelper.NewDesc("reloads_successes_total", "Number of successful pipeline reloads.", "pipeline"),
+		ReloadsFailuresTotal:           descHelper.NewDesc("reloads_failures_total", "Number of failed pipeline reloads.", "pipeline"),
+		QueueEvents:                    descHelper.NewDesc("queue_events", "Number of events in the queue.", "pipeline"),
+		PipelinePluginEventsInTotal: descHelper.NewDesc("plugin_events_in_total", "Number of events received this pipeline.",
+			"plugin_type", "plugin", "plugin_id", "pipeline"),
+		PipelinePluginEventsOutTotal: descHelper.NewDesc("plugin_events_out_total", "Number of events output by this pipeline.",
+			"plugin_type", "plugin", "plugin_id", "pipeline"),
+		PipelinePluginEventsDurationSeconds: descHelper.NewDescWithUnit("plugin_events_duration_seconds_total", prometheus_helper.UnitSeconds,
+			"Total time spent processing events in this plugin in seconds.", "plugin_type", "plugin", "plugin_id", "pipeline"),
+		PipelinePluginEventsQueuePushDurationSeconds: descHelper.NewDescWithUnit("plugin_events_queue_push_duration_seconds_total", prometheus_helper.UnitSeconds,
+			"Total time spent pushing events into the input queue in seconds.", "plugin_type", "plugin", "plugin_id", "pipeline"),
 	}
 }
 
-func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePipelineResponse, pipelineID string, ch chan<- prometheus.Metric, endpoint string, name string) {
+// Collect sends the metrics of a single pipeline to the channel.
+// The startTime is the start time of the Logstash instance, used for the created timestamps of counters.
+func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePipelineResponse, pipelineID string, ch chan<- prometheus.Metric, endpoint string, name string, startTime time.Time) {
 	collectingStart := time.Now()
 	slog.Debug("collecting pipeline stats for pipeline", "pipelineID", pipelineID)
 
-	metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: ch, Labels: []string{pipelineID}, DefaultLabels: []string{endpoint, name}}
+	createdTimestamp := getPipelineCreatedTimestamp(pipeStats.Reloads, startTime)
+	metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: ch, Labels: []string{pipelineID}, DefaultLabels: []string{endpoint, name}, CreatedTimestamp: createdTimestamp}
 
 	// ***** EVENTS *****
-	metricsHelper.NewInt64Metric(subcollector.EventsOut, prometheus.CounterValue, pipeStats.Events.Out)
-	metricsHelper.NewInt64Metric(subcollector.EventsFiltered, prometheus.CounterValue, pipeStats.Events.Filtered)
-	metricsHelper.NewInt64Metric(subcollector.EventsIn, prometheus.CounterValue, pipeStats.Events.In)
-	metricsHelper.NewInt64Metric(subcollector.EventsDuration, prometheus.GaugeValue, pipeStats.Events.DurationInMillis)
-	metricsHelper.NewInt64Metric(subcollector.EventsQueuePushDuration, prometheus.GaugeValue, pipeStats.Events.QueuePushDurationInMillis)
+	if subcollector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewInt64Metric(subcollector.EventsOut, prometheus.CounterValue, pipeStats.Events.Out)
+		metricsHelper.NewInt64Metric(subcollector.EventsFiltered, prometheus.CounterValue, pipeStats.Events.Filtered)
+		metricsHelper.NewInt64Metric(subcollector.EventsIn, prometheus.CounterValue, pipeStats.Events.In)
+		metricsHelper.NewInt64Metric(subcollector.EventsDuration, prometheus.GaugeValue, pipeStats.Events.DurationInMillis)
+		metricsHelper.NewInt64Metric(subcollector.EventsQueuePushDuration, prometheus.GaugeValue, pipeStats.Events.QueuePushDurationInMillis)
+	}
+	if subcollector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewInt64Metric(subcollector.EventsOutTotal, prometheus.CounterValue, pipeStats.Events.Out)
+		metricsHelper.NewInt64Metric(subcollector.EventsFilteredTotal, prometheus.CounterValue, pipeStats.Events.Filtered)
+		metricsHelper.NewInt64Metric(subcollector.EventsInTotal, prometheus.CounterValue, pipeStats.Events.In)
+		metricsHelper.NewFloatMetric(subcollector.EventsDurationSeconds, prometheus.CounterValue, millisToSeconds(pipeStats.Events.DurationInMillis))
+		metricsHelper.NewFloatMetric(subcollector.EventsQueuePushDurationSeconds, prometheus.CounterValue, millisToSeconds(pipeStats.Events.QueuePushDurationInMillis))
+	}
 	// ******************
 
 	// ***** UP *****
@@ -134,8 +183,14 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 	// **************
 
 	// ***** RELOADS *****
-	metricsHelper.NewIntMetric(subcollector.ReloadsSuccesses, prometheus.CounterValue, pipeStats.Reloads.Successes)
-	metricsHelper.NewIntMetric(subcollector.ReloadsFailures, prometheus.CounterValue, pipeStats.Reloads.Failures)
+	if subcollector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.ReloadsSuccesses, prometheus.CounterValue, pipeStats.Reloads.Successes)
+		metricsHelper.NewIntMetric(subcollector.ReloadsFailures, prometheus.CounterValue, pipeStats.Reloads.Failures)
+	}
+	if subcollector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.ReloadsSuccessesTotal, prometheus.CounterValue, pipeStats.Reloads.Successes)
+		metricsHelper.NewIntMetric(subcollector.ReloadsFailuresTotal, prometheus.CounterValue, pipeStats.Reloads.Failures)
+	}
 
 	if pipeStats.Reloads.LastSuccessTimestamp != nil {
 		metricsHelper.NewTimestampMetric(subcollector.ReloadsLastSuccessTimestamp, prometheus.GaugeValue, *pipeStats.Reloads.LastSuccessTimestamp)
@@ -146,7 +201,12 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 	// *******************
 
 	// ***** QUEUE *****
-	metricsHelper.NewInt64Metric(subcollector.QueueEventsCount, prometheus.CounterValue, pipeStats.Queue.EventsCount)
+	if subcollector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewInt64Metric(subcollector.QueueEventsCount, prometheus.CounterValue, pipeStats.Queue.EventsCount)
+	}
+	if subcollector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewInt64Metric(subcollector.QueueEvents, prometheus.GaugeValue, pipeStats.Queue.EventsCount)
+	}
 	metricsHelper.NewInt64Metric(subcollector.QueueEventsQueueSize, prometheus.GaugeValue, pipeStats.Queue.QueueSizeInBytes)
 	metricsHelper.NewInt64Metric(subcollector.QueueMaxQueueSizeInBytes, prometheus.GaugeValue, pipeStats.Queue.MaxQueueSizeInBytes)
 	// *****************
@@ -200,8 +260,13 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 		slog.Debug("collecting pipeline plugin stats for pipeline", "plugin type", pluginType, "name", plugin.Name, "id", plugin.ID, "pipelineID", pipelineID, "endpoint", endpoint)
 
 		metricsHelper.Labels = []string{pluginType, plugin.Name, plugin.ID, pipelineID}
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsOut, prometheus.CounterValue, plugin.Events.Out)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsQueuePushDuration, prometheus.GaugeValue, plugin.Events.QueuePushDurationInMillis)
+		subcollector.collectPluginEventsOut(&metricsHelper, plugin.Events.Out)
+		if subcollector.metricsConfig.IsV2NamingEnabled() {
+			metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsQueuePushDuration, prometheus.GaugeValue, plugin.Events.QueuePushDurationInMillis)
+		}
+		if subcollector.metricsConfig.IsV3NamingEnabled() {
+			metricsHelper.NewFloatMetric(subcollector.PipelinePluginEventsQueuePushDurationSeconds, prometheus.CounterValue, millisToSeconds(plugin.Events.QueuePushDurationInMillis))
+		}
 	}
 	// ******************
 
@@ -212,14 +277,14 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 
 		pluginType = "codec:encode"
 		metricsHelper.Labels = []string{pluginType, plugin.Name, plugin.ID, pipelineID}
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsIn, prometheus.CounterValue, plugin.Encode.WritesIn)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsDuration, prometheus.CounterValue, plugin.Encode.DurationInMillis)
+		subcollector.collectPluginEventsIn(&metricsHelper, plugin.Encode.WritesIn)
+		subcollector.collectPluginEventsDuration(&metricsHelper, plugin.Encode.DurationInMillis)
 
 		pluginType = "codec:decode"
 		metricsHelper.Labels = []string{pluginType, plugin.Name, plugin.ID, pipelineID}
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsIn, prometheus.CounterValue, plugin.Decode.WritesIn)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsOut, prometheus.CounterValue, plugin.Decode.Out)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsDuration, prometheus.CounterValue, plugin.Decode.DurationInMillis)
+		subcollector.collectPluginEventsIn(&metricsHelper, plugin.Decode.WritesIn)
+		subcollector.collectPluginEventsOut(&metricsHelper, plugin.Decode.Out)
+		subcollector.collectPluginEventsDuration(&metricsHelper, plugin.Decode.DurationInMillis)
 	}
 	// ******************
 
@@ -229,9 +294,9 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 		slog.Debug("collecting pipeline plugin stats for pipeline", "plugin type", pluginType, "name", plugin.Name, "id", plugin.ID, "pipelineID", pipelineID, "endpoint", endpoint)
 
 		metricsHelper.Labels = []string{pluginType, plugin.Name, plugin.ID, pipelineID}
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsIn, prometheus.CounterValue, plugin.Events.In)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsOut, prometheus.CounterValue, plugin.Events.Out)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsDuration, prometheus.CounterValue, plugin.Events.DurationInMillis)
+		subcollector.collectPluginEventsIn(&metricsHelper, plugin.Events.In)
+		subcollector.collectPluginEventsOut(&metricsHelper, plugin.Events.Out)
+		subcollector.collectPluginEventsDuration(&metricsHelper, plugin.Events.DurationInMillis)
 	}
 	// *******************
 
@@ -241,9 +306,9 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 		slog.Debug("collecting pipeline plugin stats for pipeline", "plugin type", pluginType, "name", plugin.Name, "id", plugin.ID, "pipelineID", pipelineID, "endpoint", endpoint)
 
 		metricsHelper.Labels = []string{pluginType, plugin.Name, plugin.ID, pipelineID}
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsIn, prometheus.CounterValue, plugin.Events.In)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsOut, prometheus.CounterValue, plugin.Events.Out)
-		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsDuration, prometheus.CounterValue, plugin.Events.DurationInMillis)
+		subcollector.collectPluginEventsIn(&metricsHelper, plugin.Events.In)
+		subcollector.collectPluginEventsOut(&metricsHelper, plugin.Events.Out)
+		subcollector.collectPluginEventsDuration(&metricsHelper, plugin.Events.DurationInMillis)
 	}
 	// *******************
 	// ===================
@@ -252,6 +317,50 @@ func (subcollector *PipelineSubcollector) Collect(pipeStats *responses.SinglePip
 	slog.Debug("collected pipeline stats for pipeline", "duration", collectingEnd.Sub(collectingStart), "pipelineID", pipelineID, "endpoint", endpoint)
 }
 
+// collectPluginEventsIn sends the number of events received by a plugin
+// under the names enabled by the naming scheme.
+func (subcollector *PipelineSubcollector) collectPluginEventsIn(metricsHelper *prometheus_helper.SimpleMetricsHelper, eventsIn int) {
+	if subcollector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsIn, prometheus.CounterValue, eventsIn)
+	}
+	if subcollector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsInTotal, prometheus.CounterValue, eventsIn)
+	}
+}
+
+// collectPluginEventsOut sends the number of events output by a plugin
+// under the names enabled by the naming scheme.
+func (subcollector *PipelineSubcollector) collectPluginEventsOut(metricsHelper *prometheus_helper.SimpleMetricsHelper, eventsOut int) {
+	if subcollector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsOut, prometheus.CounterValue, eventsOut)
+	}
+	if subcollector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsOutTotal, prometheus.CounterValue, eventsOut)
+	}
+}
+
+// collectPluginEventsDuration sends the time spent processing events in a plugin
+// under the names enabled by the naming scheme.
+func (subcollector *PipelineSubcollector) collectPluginEventsDuration(metricsHelper *prometheus_helper.SimpleMetricsHelper, durationInMillis int) {
+	if subcollector.metricsConfig.IsV2NamingEnabled() {
+		metricsHelper.NewIntMetric(subcollector.PipelinePluginEventsDuration, prometheus.CounterValue, durationInMillis)
+	}
+	if subcollector.metricsConfig.IsV3NamingEnabled() {
+		metricsHelper.NewFloatMetric(subcollector.PipelinePluginEventsDurationSeconds, prometheus.CounterValue, millisToSeconds(durationInMillis))
+	}
+}
+
+// getPipelineCreatedTimestamp returns the created timestamp for the counters of a pipeline.
+// Pipeline counters are reset on a successful reload, so the last successful reload
+// is used if it happened after the start of the Logstash instance.
+func getPipelineCreatedTimestamp(pipeReloadStats responses.PipelineReloadResponse, startTime time.Time) time.Time {
+	if pipeReloadStats.LastSuccessTimestamp != nil && pipeReloadStats.LastSuccessTimestamp.After(startTime) {
+		return *pipeReloadStats.LastSuccessTimestamp
+	}
+
+	return startTime
+}
+
 // isPipelineHealthy returns 1 if the pipeline is healthy, 0 if it is not
 // A pipeline is considered healthy if:
 //  1. last_failure_timestamp is nil
@@ -5,11 +5,12 @@ import (
 	"time"
 
 	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
 )
 
 func TestIsPipelineHealthy(t *testing.T) {
 	t.Parallel()
-	collector := NewPipelineSubcollector()
+	collector := NewPipelineSubcollector(config.MetricsConfig{})
 
 	now := time.Now()
 	oneHourBefore := now.Add(-1 * time.Hour)
@@ -80,3 +81,35 @@ func TestIsPipelineHealthy(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPipelineCreatedTimestamp(t *testing.T) {
+	t.Parallel()
+
+	startTime := time.Now().Add(-2 * time.Hour)
+	beforeStart := startTime.Add(-time.Hour)
+	afterStart := startTime.Add(time.Hour)
+
+	t.Run("should use start time without reloads", func(t *testing.T) {
+		t.Parallel()
+		result := getPipelineCreatedTimestamp(responses.PipelineReloadResponse{}, startTime)
+		if !result.Equal(startTime) {
+			t.Errorf("expected %v, got %v", startTime, result)
+		}
+	})
+
+	t.Run("should use last successful reload after start", func(t *testing.T) {
+		t.Parallel()
+		result := getPipelineCreatedTimestamp(responses.PipelineReloadResponse{LastSuccessTimestamp: &afterStart}, startTime)
+		if !result.Equal(afterStart) {
+			t.Errorf("expected %v, got %v", afterStart, result)
+		}
+	})
+
+	t.Run("should ignore successful reload before start", func(t *testing.T) {
+		t.Parallel()
+		result := getPipelineCreatedTimestamp(responses.PipelineReloadResponse{LastSuccessTimestamp: &beforeStart}, startTime)
+		if !result.Equal(startTime) {
+			t.Errorf("expected %v, got %v", startTime, result)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package nodestats
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+)
+
+const (
+	PipelineNotStalled = 0
+	PipelineStalled    = 1
+)
+
+// pipelineProgress is the state of a pipeline since its output last changed
+type pipelineProgress struct {
+	eventsOut     int64
+	lastOutChange time.Time
+
+	// the events in and the queued events at the start of the current window
+	windowStart       time.Time
+	windowEventsIn    int64
+	windowQueueEvents int64
+
+	stalled bool
+}
+
+// StallDetector flags pipelines that keep receiving or queueing events
+// while not emitting any for longer than the configured window.
+// A pipeline wedged on an unavailable output is still reported as up,
+// as the up metric only looks at the reloads of the pipeline.
+// It observes the node stats fetched by the NodestatsCollector, and is owned by the CollectorManager,
+// so that the progress of the pipelines survives the regeneration of collectors.
+type StallDetector struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// progress is the progress of the pipelines by endpoint and pipeline ID
+	progress map[string]map[string]*pipelineProgress
+
+	Stalled *prometheus.Desc
+}
+
+func NewStallDetector(window time.Duration) *StallDetector {
+	descHelper := prometheus_helper.SimpleDescHelper{Namespace: namespace, Subsystem: fmt.Sprintf("%s_pipeline", subsystem)}
+	return &StallDetector{
+		window:   window,
+		progress: make(map[string]map[string]*pipelineProgress),
+
+		Stalled: descHelper.NewDesc("stalled", "Whether the pipeline receives or queues events without emitting any.", "pipeline"),
+	}
+}
+
+// ObserveNodeStats sends whether the pipelines of the node stats fetched by the NodestatsCollector are stalled,
+// and forgets the progress of the pipelines the instance no longer runs
+func (detector *StallDetector) ObserveNodeStats(client logstash_client.Client, nodeStats *responses.NodeStatsResponse, ch chan<- prometheus.Metric) {
+	endpoint := client.GetEndpoint()
+	now := time.Now()
+
+	metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: ch, DefaultLabels: []string{endpoint, client.Name()}}
+	for pipelineID, pipeStats := range nodeStats.Pipelines {
+		metricsHelper.Labels = []string{pipelineID}
+		metricsHelper.NewFloatMetric(detector.Stalled, prometheus.GaugeValue, detector.isPipelineStalled(endpoint, pipelineID, &pipeStats, now))
+	}
+
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+
+	for pipelineID := range detector.progress[endpoint] {
+		if _, ok := nodeStats.Pipelines[pipelineID]; !ok {
+			delete(detector.progress[endpoint], pipelineID)
+		}
+	}
+}
+
+// Remove forgets the progress of the pipelines of the endpoint
+func (detector *StallDetector) Remove(endpoint string) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+
+	delete(detector.progress, endpoint)
+}
+
+// isPipelineStalled returns 1 if the pipeline is stalled, 0 if it is not.
+// A pipeline is considered stalled if events.out did not change for the whole window, and
+// during the last window:
+//  1. events.in increased, or
+//  2. the number of events in the queue increased
+//
+// Idle pipelines, which neither receive nor emit events, are not considered stalled,
+// and a stalled pipeline which stops receiving events is no longer considered stalled after a window.
+func (detector *StallDetector) isPipelineStalled(endpoint string, pipelineID string, pipeStats *responses.SinglePipelineResponse, now time.Time) float64 {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+
+	pipelines, ok := detector.progress[endpoint]
+	if !ok {
+		pipelines = make(map[string]*pipelineProgress)
+		detector.progress[endpoint] = pipelines
+	}
+
+	previous, ok := pipelines[pipelineID]
+	if !ok || previous.eventsOut != pipeStats.Events.Out || pipeStats.Events.In < previous.windowEventsIn {
+		if ok && previous.stalled {
+			slog.Info("pipeline is no longer stalled", "pipeline", pipelineID, "endpoint", endpoint)
+		}
+
+		pipelines[pipelineID] = &pipelineProgress{
+			eventsOut:         pipeStats.Events.Out,
+			lastOutChange:     now,
+			windowStart:       now,
+			windowEventsIn:    pipeStats.Events.In,
+			windowQueueEvents: pipeStats.Queue.EventsCount,
+		}
+		return PipelineNotStalled
+	}
+
+	if now.Sub(previous.windowStart) >= detector.window {
+		eventsInGrowth := pipeStats.Events.In - previous.windowEventsIn
+		queueGrowth := pipeStats.Queue.EventsCount - previous.windowQueueEvents
+		stalled := eventsInGrowth > 0 || queueGrowth > 0
+
+		if stalled && !previous.stalled {
+			slog.Warn("pipeline is stalled",
+				"pipeline", pipelineID,
+				"endpoint", endpoint,
+				"stalled_for", now.Sub(previous.lastOutChange),
+				"events_out", pipeStats.Events.Out,
+				"events_in_growth", eventsInGrowth,
+				"queue_growth", queueGrowth,
+			)
+		}
+		if !stalled && previous.stalled {
+			slog.Info("pipeline is no longer stalled", "pipeline", pipelineID, "endpoint", endpoint)
+		}
+
+		previous.stalled = stalled
+		previous.windowStart = now
+		previous.windowEventsIn = pipeStats.Events.In
+		previous.windowQueueEvents = pipeStats.Queue.EventsCount
+	}
+
+	if previous.stalled {
+		return PipelineStalled
+	}
+	return PipelineNotStalled
+}
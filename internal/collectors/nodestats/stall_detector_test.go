@@ -0,0 +1,143 @@
+package nodestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+)
+
+func newStallTestPipeline(in, out, queueEvents int64) *responses.SinglePipelineResponse {
+	pipeline := &responses.SinglePipelineResponse{}
+	pipeline.Events.In = in
+	pipeline.Events.Out = out
+	pipeline.Queue.EventsCount = queueEvents
+	return pipeline
+}
+
+func TestIsPipelineStalled(t *testing.T) {
+	t.Parallel()
+
+	const window = time.Minute
+	start := time.Now()
+
+	type observation struct {
+		pipeline *responses.SinglePipelineResponse
+		after    time.Duration
+		expected float64
+	}
+
+	testCases := []struct {
+		name         string
+		observations []observation
+	}{
+		{
+			name: "events in without events out for the whole window",
+			observations: []observation{
+				{pipeline: newStallTestPipeline(100, 100, 0), after: 0, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(150, 100, 0), after: 30 * time.Second, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(200, 100, 0), after: window, expected: PipelineStalled},
+			},
+		},
+		{
+			name: "growing queue without events out for the whole window",
+			observations: []observation{
+				{pipeline: newStallTestPipeline(100, 100, 10), after: 0, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(100, 100, 50), after: window, expected: PipelineStalled},
+			},
+		},
+		{
+			name: "idle pipeline",
+			observations: []observation{
+				{pipeline: newStallTestPipeline(100, 100, 0), after: 0, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(100, 100, 0), after: 2 * window, expected: PipelineNotStalled},
+			},
+		},
+		{
+			name: "pipeline recovers when events out changes",
+			observations: []observation{
+				{pipeline: newStallTestPipeline(100, 100, 0), after: 0, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(200, 100, 0), after: window, expected: PipelineStalled},
+				{pipeline: newStallTestPipeline(300, 250, 0), after: window + time.Second, expected: PipelineNotStalled},
+			},
+		},
+		{
+			name: "stalled pipeline which stops receiving events",
+			observations: []observation{
+				{pipeline: newStallTestPipeline(100, 100, 0), after: 0, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(200, 100, 0), after: window, expected: PipelineStalled},
+				{pipeline: newStallTestPipeline(200, 100, 0), after: window + 30*time.Second, expected: PipelineStalled},
+				{pipeline: newStallTestPipeline(200, 100, 0), after: 2 * window, expected: PipelineNotStalled},
+			},
+		},
+		{
+			name: "counters reset by a restart",
+			observations: []observation{
+				{pipeline: newStallTestPipeline(100, 100, 0), after: 0, expected: PipelineNotStalled},
+				{pipeline: newStallTestPipeline(10, 100, 0), after: window, expected: PipelineNotStalled},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		localTestCase := testCase
+		t.Run(localTestCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			detector := NewStallDetector(window)
+			for i, observation := range localTestCase.observations {
+				result := detector.isPipelineStalled("http://localhost:9600", "main", observation.pipeline, start.Add(observation.after))
+				if result != observation.expected {
+					t.Errorf("observation %d: expected %v, got %v", i, observation.expected, result)
+				}
+			}
+		})
+	}
+}
+
+type stallTestClient struct {
+	logstash_client.Client
+}
+
+func (client *stallTestClient) GetEndpoint() string {
+	return "http://localhost:9600"
+}
+
+func (client *stallTestClient) Name() string {
+	return "logstash"
+}
+
+func TestStallDetectorObserveNodeStats(t *testing.T) {
+	t.Parallel()
+
+	detector := NewStallDetector(time.Minute)
+	client := &stallTestClient{}
+	ch := make(chan prometheus.Metric, 10)
+
+	detector.ObserveNodeStats(client, &responses.NodeStatsResponse{
+		Pipelines: map[string]responses.SinglePipelineResponse{
+			"main":   *newStallTestPipeline(100, 100, 0),
+			"ingest": *newStallTestPipeline(100, 100, 0),
+		},
+	}, ch)
+	if len(ch) != 2 {
+		t.Errorf("expected the stalled metric of every pipeline, got %d metrics", len(ch))
+	}
+
+	detector.ObserveNodeStats(client, &responses.NodeStatsResponse{
+		Pipelines: map[string]responses.SinglePipelineResponse{
+			"main": *newStallTestPipeline(100, 100, 0),
+		},
+	}, ch)
+	if _, ok := detector.progress[client.GetEndpoint()]["ingest"]; ok {
+		t.Errorf("expected the progress of the removed pipeline to be forgotten")
+	}
+
+	detector.Remove(client.GetEndpoint())
+	if _, ok := detector.progress[client.GetEndpoint()]; ok {
+		t.Errorf("expected the progress of the removed endpoint to be forgotten")
+	}
+}
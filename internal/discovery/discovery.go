@@ -0,0 +1,179 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// InstanceManager is notified of the discovered instances, implemented by the CollectorManager
+type InstanceManager interface {
+	// AddInstance adds or updates the instance with the given id
+	AddInstance(id string, instance *config.LogstashInstance)
+	// RemoveInstance removes the instance with the given id
+	RemoveInstance(id string)
+	// ReplaceInstances removes and adds the instances at once
+	ReplaceInstances(removed []string, added map[string]*config.LogstashInstance)
+}
+
+// Discovery discovers Logstash instances and applies them to the InstanceManager
+type Discovery interface {
+	// Start discovers the instances and keeps them updated, until Stop is called
+	Start(ctx context.Context) error
+	// Stop stops updating the instances, the discovered instances are kept
+	Stop()
+}
+
+// NewDiscoveries creates the service discoveries enabled in the Logstash configuration
+func NewDiscoveries(cfg *config.LogstashConfig, manager InstanceManager) ([]Discovery, error) {
+	var discoveries []Discovery
+
+	for i, fileSDConfig := range cfg.FileSDConfigs {
+		discovery, err := NewFileDiscovery(fmt.Sprintf("file_sd[%d]", i), fileSDConfig, manager)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file discovery: %w", err)
+		}
+		discoveries = append(discoveries, discovery)
+	}
+
+	for i, dnsSDConfig := range cfg.DNSSDConfigs {
+		discoveries = append(discoveries, NewDNSDiscovery(fmt.Sprintf("dns_sd[%d]", i), dnsSDConfig, manager))
+	}
+
+	for i, httpSDConfig := range cfg.HTTPSDConfigs {
+		discovery, err := NewHTTPDiscovery(fmt.Sprintf("http_sd[%d]", i), httpSDConfig, manager)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create http discovery: %w", err)
+		}
+		discoveries = append(discoveries, discovery)
+	}
+
+	return discoveries, nil
+}
+
+// instanceSync applies the instances found by a discovery to the InstanceManager,
+// adding the new and changed instances and removing the instances that disappeared in a single call.
+// The instances are added with the name of the discovery as a prefix of their IDs,
+// so that they do not replace the configured instances or the instances of other discoveries.
+type instanceSync struct {
+	name      string
+	manager   InstanceManager
+	mu        sync.Mutex
+	instances map[string]*config.LogstashInstance
+}
+
+func newInstanceSync(name string, manager InstanceManager) *instanceSync {
+	return &instanceSync{
+		name:      name,
+		manager:   manager,
+		instances: make(map[string]*config.LogstashInstance),
+	}
+}
+
+// sync applies the currently discovered instances, of which only the first one of every ID is kept
+func (s *instanceSync) sync(instances []*config.LogstashInstance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	discovered := make(map[string]*config.LogstashInstance, len(instances))
+	for _, instance := range instances {
+		id := s.name + "/" + instance.ID()
+		if _, exists := discovered[id]; exists {
+			slog.Warn("ignoring duplicate discovered instance", "discovery", s.name, "instance", instance.ID())
+			continue
+		}
+		discovered[id] = instance
+	}
+
+	var removed []string
+	for id := range s.instances {
+		if _, exists := discovered[id]; !exists {
+			slog.Info("removing discovered instance", "discovery", s.name, "id", id)
+			removed = append(removed, id)
+		}
+	}
+
+	added := make(map[string]*config.LogstashInstance)
+	for id, instance := range discovered {
+		if previous, exists := s.instances[id]; exists && reflect.DeepEqual(previous, instance) {
+			continue
+		}
+		slog.Info("adding discovered instance", "discovery", s.name, "id", id, "url", instance.Host)
+		added[id] = instance
+	}
+
+	// every change of the collectors rebuilds them, so the changes are applied at once
+	if len(removed) > 0 || len(added) > 0 {
+		s.manager.ReplaceInstances(removed, added)
+	}
+
+	s.instances = discovered
+}
+
+// newDiscoveredInstance creates an instance with the client configuration of the discovery
+func newDiscoveredInstance(url string, name string, labels map[string]string, instanceConfig config.DiscoveredInstanceConfig) *config.LogstashInstance {
+	instance := &config.LogstashInstance{
+		Host:      url,
+		Name:      name,
+		TLSConfig: instanceConfig.TLSConfig,
+		BasicAuth: instanceConfig.BasicAuth,
+	}
+	if len(labels) > 0 {
+		instance.Labels = labels
+	}
+
+	return instance
+}
+
+// refreshLoop refreshes the instances of a discovery periodically, until it is stopped
+type refreshLoop struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start refreshes the instances once, and then every interval in a separate goroutine
+func (l *refreshLoop) start(ctx context.Context, interval time.Duration, refresh func(context.Context)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+
+	refresh(ctx)
+
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh(ctx)
+			}
+		}
+	}()
+}
+
+// stop stops the refreshes and waits for the running one to finish
+func (l *refreshLoop) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancel == nil {
+		return
+	}
+
+	l.cancel()
+	<-l.done
+	l.cancel = nil
+}
@@ -0,0 +1,112 @@
+package discovery
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// fakeInstanceManager records the instances applied by a discovery
+type fakeInstanceManager struct {
+	mu        sync.Mutex
+	instances map[string]*config.LogstashInstance
+	adds      int
+	replaces  int
+}
+
+func newFakeInstanceManager() *fakeInstanceManager {
+	return &fakeInstanceManager{instances: make(map[string]*config.LogstashInstance)}
+}
+
+func (m *fakeInstanceManager) AddInstance(id string, instance *config.LogstashInstance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[id] = instance
+	m.adds++
+}
+
+func (m *fakeInstanceManager) RemoveInstance(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, id)
+}
+
+func (m *fakeInstanceManager) ReplaceInstances(removed []string, added map[string]*config.LogstashInstance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range removed {
+		delete(m.instances, id)
+	}
+	for id, instance := range added {
+		m.instances[id] = instance
+	}
+	m.adds += len(added)
+	m.replaces++
+}
+
+func (m *fakeInstanceManager) getInstances() map[string]*config.LogstashInstance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	instances := make(map[string]*config.LogstashInstance, len(m.instances))
+	for id, instance := range m.instances {
+		instances[id] = instance
+	}
+	return instances
+}
+
+func (m *fakeInstanceManager) getAdds() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.adds
+}
+
+func (m *fakeInstanceManager) getReplaces() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.replaces
+}
+
+func TestInstanceSync(t *testing.T) {
+	t.Parallel()
+
+	manager := newFakeInstanceManager()
+	instanceSync := newInstanceSync("test", manager)
+
+	instanceSync.sync([]*config.LogstashInstance{
+		{Host: "http://a:9600"},
+		{Host: "http://b:9600", Name: "b"},
+		{Host: "http://other:9600", Name: "b"},
+	})
+
+	instances := manager.getInstances()
+	if len(instances) != 2 || instances["test/b"].Host != "http://b:9600" || instances["test/http://a:9600"] == nil {
+		t.Fatalf("expected the first instance of every id to be added, got %v", instances)
+	}
+
+	instanceSync.sync([]*config.LogstashInstance{
+		{Host: "http://a:9600"},
+		{Host: "http://c:9600"},
+	})
+
+	instances = manager.getInstances()
+	if len(instances) != 2 || instances["test/b"] != nil || instances["test/http://c:9600"] == nil {
+		t.Errorf("expected b to be replaced with c, got %v", instances)
+	}
+	if manager.getAdds() != 3 {
+		t.Errorf("expected the unchanged instance not to be added again, got %d adds", manager.getAdds())
+	}
+	if manager.getReplaces() != 2 {
+		t.Errorf("expected the changes of every sync to be applied at once, got %d replaces", manager.getReplaces())
+	}
+
+	instanceSync.sync([]*config.LogstashInstance{
+		{Host: "http://a:9600"},
+		{Host: "http://c:9600"},
+	})
+
+	if manager.getReplaces() != 2 {
+		t.Errorf("expected an unchanged sync not to replace the instances, got %d replaces", manager.getReplaces())
+	}
+}
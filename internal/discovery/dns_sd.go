@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// dnsLookupTimeout bounds the resolution of a single name
+const dnsLookupTimeout = 10 * time.Second
+
+// dnsResolver resolves the DNS records, implemented by net.Resolver
+type dnsResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// DNSDiscovery discovers instances by periodically resolving DNS names
+type DNSDiscovery struct {
+	name     string
+	config   *config.DNSSDConfig
+	sync     *instanceSync
+	resolver dnsResolver
+	loop     refreshLoop
+
+	mu sync.Mutex
+	// nameInstances are the instances of every name, kept when the resolution of the name fails
+	nameInstances map[string][]*config.LogstashInstance
+}
+
+// NewDNSDiscovery creates a discovery of the instances of the DNS names
+func NewDNSDiscovery(name string, cfg *config.DNSSDConfig, manager InstanceManager) *DNSDiscovery {
+	return &DNSDiscovery{
+		name:          name,
+		config:        cfg,
+		sync:          newInstanceSync(name, manager),
+		resolver:      net.DefaultResolver,
+		nameInstances: make(map[string][]*config.LogstashInstance),
+	}
+}
+
+// Start resolves the names and starts resolving them periodically
+func (d *DNSDiscovery) Start(ctx context.Context) error {
+	d.loop.start(ctx, d.config.RefreshInterval, d.refresh)
+	return nil
+}
+
+// Stop stops resolving the names
+func (d *DNSDiscovery) Stop() {
+	d.loop.stop()
+}
+
+// refresh resolves the names and applies their instances.
+// The instances of a name that cannot be resolved are kept, unless the name does not exist.
+func (d *DNSDiscovery) refresh(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var instances []*config.LogstashInstance
+	for _, name := range d.config.Names {
+		nameInstances, err := d.resolve(ctx, name)
+
+		var dnsError *net.DNSError
+		switch {
+		case errors.As(err, &dnsError) && dnsError.IsNotFound:
+			slog.Debug("dns name not found", "discovery", d.name, "name", name)
+			nameInstances = nil
+		case err != nil:
+			slog.Error("failed to resolve dns name, keeping its previous instances", "discovery", d.name, "name", name, "err", err)
+			nameInstances = d.nameInstances[name]
+		}
+
+		d.nameInstances[name] = nameInstances
+		instances = append(instances, nameInstances...)
+	}
+
+	d.sync.sync(instances)
+}
+
+// resolve returns the instances of the records of the name
+func (d *DNSDiscovery) resolve(ctx context.Context, name string) ([]*config.LogstashInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	var hostPorts []string
+	switch d.config.Type {
+	case config.DNSRecordTypeA, config.DNSRecordTypeAAAA:
+		network := "ip4"
+		if d.config.Type == config.DNSRecordTypeAAAA {
+			network = "ip6"
+		}
+
+		ips, err := d.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			hostPorts = append(hostPorts, net.JoinHostPort(ip.String(), strconv.Itoa(d.config.Port)))
+		}
+	default:
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			hostPorts = append(hostPorts, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+		}
+	}
+
+	instances := make([]*config.LogstashInstance, len(hostPorts))
+	for i, hostPort := range hostPorts {
+		url := fmt.Sprintf("%s://%s", d.config.Scheme, hostPort)
+		instances[i] = newDiscoveredInstance(url, "", nil, d.config.DiscoveredInstanceConfig)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,226 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// dnsServer is an in-process DNS server answering from its records
+type dnsServer struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	srv     map[string][]dnsmessage.SRVResource
+	a       map[string][][4]byte
+	failing bool
+}
+
+func newDNSServer(t *testing.T) *dnsServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	server := &dnsServer{
+		conn: conn,
+		srv:  make(map[string][]dnsmessage.SRVResource),
+		a:    make(map[string][][4]byte),
+	}
+	go server.serve()
+
+	return server
+}
+
+// resolver returns a resolver sending all queries to the server
+func (s *dnsServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *dnsServer) setSRV(name string, records ...dnsmessage.SRVResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srv[name] = records
+}
+
+func (s *dnsServer) setA(name string, addresses ...[4]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.a[name] = addresses
+}
+
+func (s *dnsServer) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *dnsServer) serve() {
+	buffer := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		var request dnsmessage.Message
+		if err := request.Unpack(buffer[:n]); err != nil || len(request.Questions) == 0 {
+			continue
+		}
+
+		answer := s.answer(request)
+		response, err := answer.Pack()
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(response, addr)
+	}
+}
+
+func (s *dnsServer) answer(request dnsmessage.Message) dnsmessage.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	question := request.Questions[0]
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: request.ID, Response: true, Authoritative: true},
+		Questions: request.Questions,
+	}
+
+	if s.failing {
+		response.RCode = dnsmessage.RCodeServerFailure
+		return response
+	}
+
+	name := question.Name.String()
+	header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 1}
+	srvRecords, srvExists := s.srv[name]
+	aRecords, aExists := s.a[name]
+
+	switch {
+	case question.Type == dnsmessage.TypeSRV && srvExists:
+		for _, record := range srvRecords {
+			record := record
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &record})
+		}
+	case question.Type == dnsmessage.TypeA && aExists:
+		for _, address := range aRecords {
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: address}})
+		}
+	case !srvExists && !aExists:
+		response.RCode = dnsmessage.RCodeNameError
+	}
+
+	return response
+}
+
+func newTestDNSDiscovery(server *dnsServer, cfg *config.DNSSDConfig, manager InstanceManager) *DNSDiscovery {
+	discovery := NewDNSDiscovery("dns_sd[0]", cfg, manager)
+	discovery.resolver = server.resolver()
+	return discovery
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	t.Parallel()
+
+	t.Run("applies the membership changes of srv records", func(t *testing.T) {
+		t.Parallel()
+
+		server := newDNSServer(t)
+		server.setSRV("logstash.service.consul.",
+			dnsmessage.SRVResource{Target: dnsmessage.MustNewName("node-1.node.consul."), Port: 9600},
+			dnsmessage.SRVResource{Target: dnsmessage.MustNewName("node-2.node.consul."), Port: 9601},
+		)
+
+		manager := newFakeInstanceManager()
+		discovery := newTestDNSDiscovery(server, &config.DNSSDConfig{
+			Names:           []string{"logstash.service.consul."},
+			Type:            config.DNSRecordTypeSRV,
+			Scheme:          "http",
+			RefreshInterval: 20 * time.Millisecond,
+		}, manager)
+
+		if err := discovery.Start(context.Background()); err != nil {
+			t.Fatalf("failed to start discovery: %v", err)
+		}
+		t.Cleanup(discovery.Stop)
+
+		instances := waitForInstances(t, manager, 2)
+		if instances["dns_sd[0]/http://node-2.node.consul:9601"] == nil {
+			t.Errorf("expected the instance of node-2, got %v", instances)
+		}
+
+		server.setSRV("logstash.service.consul.",
+			dnsmessage.SRVResource{Target: dnsmessage.MustNewName("node-1.node.consul."), Port: 9600},
+		)
+		waitForInstances(t, manager, 1)
+	})
+
+	t.Run("resolves a records with a fixed port", func(t *testing.T) {
+		t.Parallel()
+
+		server := newDNSServer(t)
+		server.setA("logstash.example.", [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2})
+
+		manager := newFakeInstanceManager()
+		discovery := newTestDNSDiscovery(server, &config.DNSSDConfig{
+			Names:           []string{"logstash.example."},
+			Type:            config.DNSRecordTypeA,
+			Port:            9600,
+			Scheme:          "https",
+			RefreshInterval: time.Hour,
+		}, manager)
+
+		if err := discovery.Start(context.Background()); err != nil {
+			t.Fatalf("failed to start discovery: %v", err)
+		}
+		t.Cleanup(discovery.Stop)
+
+		instances := manager.getInstances()
+		if len(instances) != 2 || instances["dns_sd[0]/https://10.0.0.1:9600"] == nil {
+			t.Errorf("expected the instances of the addresses, got %v", instances)
+		}
+	})
+
+	t.Run("keeps the instances when the resolution fails", func(t *testing.T) {
+		t.Parallel()
+
+		server := newDNSServer(t)
+		server.setA("logstash.example.", [4]byte{10, 0, 0, 1})
+
+		manager := newFakeInstanceManager()
+		discovery := newTestDNSDiscovery(server, &config.DNSSDConfig{
+			Names:           []string{"logstash.example.", "missing.example."},
+			Type:            config.DNSRecordTypeA,
+			Port:            9600,
+			Scheme:          "http",
+			RefreshInterval: time.Hour,
+		}, manager)
+
+		discovery.refresh(context.Background())
+		if instances := manager.getInstances(); len(instances) != 1 {
+			t.Fatalf("expected a single instance, got %v", instances)
+		}
+
+		server.setFailing(true)
+		discovery.refresh(context.Background())
+		if instances := manager.getInstances(); len(instances) != 1 {
+			t.Errorf("expected the instance to be kept, got %v", instances)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kuskoman/logstash-exporter/internal/file_watcher"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	// schemeLabel sets the scheme of the targets of a Prometheus target group
+	schemeLabel = "__scheme__"
+	// defaultScheme is used for the targets without a scheme
+	defaultScheme = "http"
+)
+
+// targetGroup is an entry of a target file. It is either a Prometheus target group,
+// with a list of host:port targets, or a single instance with its URL and name.
+type targetGroup struct {
+	Targets []string          `yaml:"targets"`
+	URL     string            `yaml:"url"`
+	Name    string            `yaml:"name"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// FileDiscovery discovers instances from target files, watching them for changes
+type FileDiscovery struct {
+	name    string
+	config  *config.FileSDConfig
+	sync    *instanceSync
+	watcher *file_watcher.FileWatcher
+
+	mu sync.Mutex
+	// fileInstances are the instances of every target file, kept when a file becomes invalid
+	fileInstances map[string][]*config.LogstashInstance
+	cancel        context.CancelFunc
+}
+
+// NewFileDiscovery creates a discovery of the instances of the target files
+func NewFileDiscovery(name string, cfg *config.FileSDConfig, manager InstanceManager) (*FileDiscovery, error) {
+	discovery := &FileDiscovery{
+		name:          name,
+		config:        cfg,
+		sync:          newInstanceSync(name, manager),
+		fileInstances: make(map[string][]*config.LogstashInstance),
+	}
+
+	watcher, err := file_watcher.NewFileSetWatcher(discovery.resolveFiles, discovery.refresh)
+	if err != nil {
+		return nil, err
+	}
+	discovery.watcher = watcher
+
+	// the directories of the patterns are watched for the target files created later
+	for _, pattern := range cfg.Files {
+		dir := filepath.Dir(pattern)
+		if strings.ContainsAny(dir, "*?[") {
+			slog.Warn("not watching directory with a glob pattern for new target files", "discovery", name, "pattern", pattern)
+			continue
+		}
+		if err := watcher.AddDirectory(dir); err != nil {
+			slog.Warn("failed to watch directory of target files", "discovery", name, "dir", dir, "err", err)
+		}
+	}
+
+	return discovery, nil
+}
+
+// Start applies the instances of the target files and starts watching them for changes
+func (d *FileDiscovery) Start(ctx context.Context) error {
+	if err := d.refresh(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.mu.Unlock()
+
+	readyCh, err := d.watcher.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	<-readyCh
+
+	return nil
+}
+
+// Stop stops watching the target files
+func (d *FileDiscovery) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+}
+
+// resolveFiles returns the target files matching the patterns, sorted by name
+func (d *FileDiscovery) resolveFiles() ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	for _, pattern := range d.config.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// refresh reads the target files and applies their instances.
+// The instances of a file that cannot be read are kept, until the file is fixed or removed.
+func (d *FileDiscovery) refresh() error {
+	files, err := d.resolveFiles()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fileInstances := make(map[string][]*config.LogstashInstance, len(files))
+	var instances []*config.LogstashInstance
+
+	for _, file := range files {
+		targets, err := d.readTargetFile(file)
+		if err != nil {
+			slog.Error("failed to read target file, keeping its previous instances", "discovery", d.name, "file", file, "err", err)
+			targets = d.fileInstances[file]
+		}
+
+		fileInstances[file] = targets
+		instances = append(instances, targets...)
+	}
+
+	d.fileInstances = fileInstances
+	d.sync.sync(instances)
+
+	return nil
+}
+
+// readTargetFile returns the instances of a JSON or YAML target file
+func (d *FileDiscovery) readTargetFile(file string) ([]*config.LogstashInstance, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON target files are decoded as YAML, which is a superset of JSON
+	var groups []targetGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+
+	var instances []*config.LogstashInstance
+	for i, group := range groups {
+		groupInstances, err := group.toInstances(d.config.DiscoveredInstanceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target group %d: %w", i, err)
+		}
+		instances = append(instances, groupInstances...)
+	}
+
+	return instances, nil
+}
+
+// toInstances returns the instances of the target group, with its labels
+// except the Prometheus meta labels prefixed with "__"
+func (group *targetGroup) toInstances(instanceConfig config.DiscoveredInstanceConfig) ([]*config.LogstashInstance, error) {
+	if group.URL == "" && len(group.Targets) == 0 {
+		return nil, fmt.Errorf("either url or targets must be specified")
+	}
+	if group.Name != "" && group.URL == "" {
+		return nil, fmt.Errorf("name is only supported with url")
+	}
+
+	scheme := defaultScheme
+	labels := make(map[string]string, len(group.Labels))
+	for name, value := range group.Labels {
+		switch {
+		case name == schemeLabel:
+			scheme = value
+		case strings.HasPrefix(name, "__"):
+			continue
+		default:
+			labels[name] = value
+		}
+	}
+
+	if err := config.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	var instances []*config.LogstashInstance
+	if group.URL != "" {
+		instances = append(instances, newDiscoveredInstance(group.URL, group.Name, labels, instanceConfig))
+	}
+
+	for _, target := range group.Targets {
+		url := target
+		if !strings.Contains(target, "://") {
+			url = scheme + "://" + target
+		}
+		instances = append(instances, newDiscoveredInstance(url, "", labels, instanceConfig))
+	}
+
+	for _, instance := range instances {
+		if err := instance.ValidateURL(); err != nil {
+			return nil, err
+		}
+	}
+
+	return instances, nil
+}
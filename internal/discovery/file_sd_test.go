@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const testTimeout = 2 * time.Second
+
+func writeTargetFile(t *testing.T, location string, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(location, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write target file: %v", err)
+	}
+}
+
+// waitForInstances waits until the manager has the expected number of instances
+func waitForInstances(t *testing.T, manager *fakeInstanceManager, expected int) map[string]*config.LogstashInstance {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		instances := manager.getInstances()
+		if len(instances) == expected {
+			return instances
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d instances, got %v", expected, instances)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTargetGroupToInstances(t *testing.T) {
+	t.Parallel()
+
+	t.Run("converts prometheus target groups", func(t *testing.T) {
+		t.Parallel()
+
+		group := targetGroup{
+			Targets: []string{"logstash-1:9600", "http://logstash-2:9600"},
+			Labels:  map[string]string{"__scheme__": "https", "__meta_ignored": "x", "env": "prod"},
+		}
+
+		instances, err := group.toInstances(config.DiscoveredInstanceConfig{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(instances) != 2 || instances[0].Host != "https://logstash-1:9600" || instances[1].Host != "http://logstash-2:9600" {
+			t.Fatalf("unexpected instances: %v", instances)
+		}
+		if len(instances[0].Labels) != 1 || instances[0].Labels["env"] != "prod" {
+			t.Errorf("expected only the env label, got %v", instances[0].Labels)
+		}
+	})
+
+	t.Run("converts instances with a url and a name", func(t *testing.T) {
+		t.Parallel()
+
+		basicAuth := &config.ClientAuthConfig{Username: "user", Password: "secret"}
+		group := targetGroup{URL: "http://logstash:9600", Name: "main"}
+
+		instances, err := group.toInstances(config.DiscoveredInstanceConfig{BasicAuth: basicAuth})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(instances) != 1 || instances[0].Name != "main" || instances[0].BasicAuth != basicAuth {
+			t.Errorf("unexpected instances: %v", instances)
+		}
+	})
+
+	t.Run("rejects invalid groups", func(t *testing.T) {
+		t.Parallel()
+
+		for _, group := range []targetGroup{
+			{},
+			{Targets: []string{"logstash:9600"}, Name: "main"},
+			{URL: "http://logstash:9600", Labels: map[string]string{"hostname": "x"}},
+			{URL: "logstash:9600"},
+		} {
+			if _, err := group.toInstances(config.DiscoveredInstanceConfig{}); err == nil {
+				t.Errorf("expected an error for %+v", group)
+			}
+		}
+	})
+}
+
+func TestFileDiscovery(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "ansible.json")
+	yamlFile := filepath.Join(dir, "manual.yml")
+
+	writeTargetFile(t, jsonFile, `[{"targets": ["logstash-1:9600", "logstash-2:9600"], "labels": {"env": "prod"}}]`)
+
+	manager := newFakeInstanceManager()
+	discovery, err := NewFileDiscovery("file_sd[0]", &config.FileSDConfig{
+		Files: []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yml")},
+	}, manager)
+	if err != nil {
+		t.Fatalf("failed to create discovery: %v", err)
+	}
+
+	if err := discovery.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start discovery: %v", err)
+	}
+	t.Cleanup(discovery.Stop)
+
+	instances := waitForInstances(t, manager, 2)
+	if instance := instances["file_sd[0]/http://logstash-1:9600"]; instance == nil || instance.Labels["env"] != "prod" {
+		t.Errorf("expected logstash-1 with its labels, got %v", instances)
+	}
+
+	writeTargetFile(t, yamlFile, "- url: http://logstash-3:9600\n  name: logstash-3\n")
+	instances = waitForInstances(t, manager, 3)
+	if instances["file_sd[0]/logstash-3"] == nil {
+		t.Errorf("expected the instance of the new file, got %v", instances)
+	}
+
+	// the instances of an invalid file are kept
+	writeTargetFile(t, jsonFile, `[{"targets": `)
+	time.Sleep(200 * time.Millisecond)
+	waitForInstances(t, manager, 3)
+
+	writeTargetFile(t, jsonFile, `[{"targets": ["logstash-1:9600"]}]`)
+	waitForInstances(t, manager, 2)
+}
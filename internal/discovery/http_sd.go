@@ -0,0 +1,142 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+	"github.com/kuskoman/logstash-exporter/pkg/tls"
+)
+
+const (
+	// authProfileLabel selects the auth profile of the targets of a target group
+	authProfileLabel = "__auth_profile__"
+	// maxHTTPSDResponseSize bounds the size of the response of the endpoint
+	maxHTTPSDResponseSize = 10 << 20
+)
+
+// HTTPDiscovery discovers instances by periodically polling an HTTP service discovery endpoint
+type HTTPDiscovery struct {
+	name   string
+	config *config.HTTPSDConfig
+	sync   *instanceSync
+	client *http.Client
+	loop   refreshLoop
+
+	mu sync.Mutex
+}
+
+// NewHTTPDiscovery creates a discovery of the instances returned by the HTTP endpoint
+func NewHTTPDiscovery(name string, cfg *config.HTTPSDConfig, manager InstanceManager) (*HTTPDiscovery, error) {
+	client, err := tls.ConfigureHTTPClient(&cfg.HTTPClient, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPDiscovery{
+		name:   name,
+		config: cfg,
+		sync:   newInstanceSync(name, manager),
+		client: client,
+	}, nil
+}
+
+// Start polls the endpoint and starts polling it periodically
+func (d *HTTPDiscovery) Start(ctx context.Context) error {
+	d.loop.start(ctx, d.config.RefreshInterval, d.refresh)
+	return nil
+}
+
+// Stop stops polling the endpoint
+func (d *HTTPDiscovery) Stop() {
+	d.loop.stop()
+}
+
+// refresh polls the endpoint and applies its instances.
+// The previous instances are kept when the endpoint fails or returns invalid target groups.
+func (d *HTTPDiscovery) refresh(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	instances, err := d.fetch(ctx)
+	if err != nil {
+		slog.Error("failed to fetch http service discovery targets, keeping the previous instances", "discovery", d.name, "url", d.config.URL, "err", err)
+		return
+	}
+
+	d.sync.sync(instances)
+}
+
+// fetch requests the target groups from the endpoint and returns their instances
+func (d *HTTPDiscovery) fetch(ctx context.Context) ([]*config.LogstashInstance, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, d.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return nil, fmt.Errorf("unexpected content type %q", response.Header.Get("Content-Type"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxHTTPSDResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// the response is decoded as YAML, which is a superset of JSON, like the target files
+	var groups []targetGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+
+	var instances []*config.LogstashInstance
+	for i, group := range groups {
+		instanceConfig, err := d.instanceConfig(group)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target group %d: %w", i, err)
+		}
+
+		groupInstances, err := group.toInstances(instanceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target group %d: %w", i, err)
+		}
+		instances = append(instances, groupInstances...)
+	}
+
+	return instances, nil
+}
+
+// instanceConfig returns the client configuration of the targets of the group,
+// which is the auth profile selected by the group or the default one of the discovery
+func (d *HTTPDiscovery) instanceConfig(group targetGroup) (config.DiscoveredInstanceConfig, error) {
+	profileName, selected := group.Labels[authProfileLabel]
+	if !selected || profileName == "" {
+		return d.config.DiscoveredInstanceConfig, nil
+	}
+
+	profile, exists := d.config.AuthProfiles[profileName]
+	if !exists {
+		return config.DiscoveredInstanceConfig{}, fmt.Errorf("unknown auth profile %q", profileName)
+	}
+
+	return *profile, nil
+}
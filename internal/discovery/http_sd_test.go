@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// httpSDServer serves the configured response as the target groups
+type httpSDServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	body        string
+	status      int
+	contentType string
+	token       string
+}
+
+func newHTTPSDServer(t *testing.T, body string) *httpSDServer {
+	t.Helper()
+
+	server := &httpSDServer{body: body, status: http.StatusOK, contentType: "application/json"}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+
+		if server.token != "" && r.Header.Get("Authorization") != "Bearer "+server.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", server.contentType)
+		w.WriteHeader(server.status)
+		_, _ = w.Write([]byte(server.body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *httpSDServer) setResponse(status int, contentType, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.contentType = contentType
+	s.body = body
+}
+
+func TestHTTPDiscovery(t *testing.T) {
+	t.Parallel()
+
+	t.Run("applies the membership changes of the endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		server := newHTTPSDServer(t, `[{"targets": ["logstash-1:9600", "logstash-2:9600"], "labels": {"env": "prod"}}]`)
+		server.token = "secret-token"
+
+		manager := newFakeInstanceManager()
+		discovery, err := NewHTTPDiscovery("http_sd[0]", &config.HTTPSDConfig{
+			URL:             server.URL,
+			RefreshInterval: 20 * time.Millisecond,
+			Timeout:         time.Second,
+			HTTPClient:      config.HTTPClientConfig{BearerToken: "secret-token"},
+		}, manager)
+		if err != nil {
+			t.Fatalf("failed to create discovery: %v", err)
+		}
+
+		if err := discovery.Start(context.Background()); err != nil {
+			t.Fatalf("failed to start discovery: %v", err)
+		}
+		t.Cleanup(discovery.Stop)
+
+		instances := waitForInstances(t, manager, 2)
+		instance := instances["http_sd[0]/http://logstash-2:9600"]
+		if instance == nil || instance.Labels["env"] != "prod" {
+			t.Errorf("expected the instance of logstash-2 with its labels, got %v", instances)
+		}
+
+		server.setResponse(http.StatusOK, "application/json; charset=utf-8", `[{"targets": ["logstash-1:9600"]}]`)
+		waitForInstances(t, manager, 1)
+	})
+
+	t.Run("selects the auth profiles of the target groups", func(t *testing.T) {
+		t.Parallel()
+
+		server := newHTTPSDServer(t, `[
+			{"targets": ["logstash-1:9600"]},
+			{"targets": ["logstash-2:9600"], "labels": {"__auth_profile__": "secured"}}
+		]`)
+
+		defaultAuth := &config.ClientAuthConfig{Username: "default", Password: "default"}
+		securedAuth := &config.ClientAuthConfig{Username: "secured", Password: "secured"}
+		manager := newFakeInstanceManager()
+		discovery, err := NewHTTPDiscovery("http_sd[0]", &config.HTTPSDConfig{
+			URL:                      server.URL,
+			DiscoveredInstanceConfig: config.DiscoveredInstanceConfig{BasicAuth: defaultAuth},
+			AuthProfiles:             map[string]*config.DiscoveredInstanceConfig{"secured": {BasicAuth: securedAuth}},
+		}, manager)
+		if err != nil {
+			t.Fatalf("failed to create discovery: %v", err)
+		}
+
+		discovery.refresh(context.Background())
+
+		instances := manager.getInstances()
+		if len(instances) != 2 {
+			t.Fatalf("expected two instances, got %v", instances)
+		}
+		if instance := instances["http_sd[0]/http://logstash-1:9600"]; instance.BasicAuth != defaultAuth {
+			t.Errorf("expected the default auth, got %+v", instance.BasicAuth)
+		}
+		if instance := instances["http_sd[0]/http://logstash-2:9600"]; instance.BasicAuth != securedAuth || len(instance.Labels) != 0 {
+			t.Errorf("expected the auth of the profile without labels, got %+v", instance)
+		}
+	})
+
+	t.Run("keeps the instances when the endpoint fails", func(t *testing.T) {
+		t.Parallel()
+
+		server := newHTTPSDServer(t, `[{"targets": ["logstash-1:9600"]}]`)
+
+		manager := newFakeInstanceManager()
+		discovery, err := NewHTTPDiscovery("http_sd[0]", &config.HTTPSDConfig{URL: server.URL}, manager)
+		if err != nil {
+			t.Fatalf("failed to create discovery: %v", err)
+		}
+
+		discovery.refresh(context.Background())
+		if instances := manager.getInstances(); len(instances) != 1 {
+			t.Fatalf("expected a single instance, got %v", instances)
+		}
+
+		for name, response := range map[string]struct {
+			status      int
+			contentType string
+			body        string
+		}{
+			"server error":    {http.StatusInternalServerError, "application/json", `[]`},
+			"wrong type":      {http.StatusOK, "text/html", `[]`},
+			"invalid json":    {http.StatusOK, "application/json", `[{`},
+			"unknown profile": {http.StatusOK, "application/json", `[{"targets": ["a:1"], "labels": {"__auth_profile__": "missing"}}]`},
+		} {
+			server.setResponse(response.status, response.contentType, response.body)
+			discovery.refresh(context.Background())
+			if instances := manager.getInstances(); len(instances) != 1 {
+				t.Errorf("expected the instance to be kept on %s, got %v", name, instances)
+			}
+		}
+
+		server.setResponse(http.StatusOK, "application/json", `[]`)
+		discovery.refresh(context.Background())
+		if instances := manager.getInstances(); len(instances) != 0 {
+			t.Errorf("expected the instance to be removed, got %v", instances)
+		}
+	})
+}
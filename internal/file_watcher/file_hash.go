@@ -51,3 +51,18 @@ func CalculateFileHash(filePath string) (string, error) {
 
 	return encodeHashToString(hashSum), nil
 }
+
+// CalculateFilesHash calculates the SHA-256 hash of the paths and the contents of the files,
+// so that it changes when any of the files is modified, added or removed.
+func CalculateFilesHash(filePaths []string) (string, error) {
+	hash := sha256.New()
+	for _, filePath := range filePaths {
+		fileHash, err := CalculateFileHash(filePath)
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintf(hash, "%s\x00%s\n", filePath, fileHash)
+	}
+
+	return encodeHashToString(hash.Sum(nil)), nil
+}
@@ -10,52 +10,108 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
-// FileWatcher watches the config file for changes and triggers reloads
+// FileWatcher watches the config files for changes and triggers reloads
 type FileWatcher struct {
 	watcher             *fsnotify.Watcher
-	fileName            string
-	filePath            string
+	resolveFiles        func() ([]string, error)
+	filePaths           map[string]bool
+	watchedDirs         map[string]bool
 	previousContentHash string
 	listeners           []func() error
 	mu                  sync.Mutex
 	debounceTime        time.Duration
-	lastEventTime       time.Time
+	eventPending        bool
 }
 
 // NewFileWatcher initializes a file watcher, watching the config file for changes
 func NewFileWatcher(configLocation string, listeners ...func() error) (*FileWatcher, error) {
-	fsWatcher, err := fsnotify.NewWatcher()
+	return NewFileSetWatcher(func() ([]string, error) {
+		return []string{configLocation}, nil
+	}, listeners...)
+}
+
+// NewFileSetWatcher initializes a file watcher, watching a set of config files for changes.
+// The files are resolved again on every change, so that files added to the set,
+// e.g. to a watched config directory, are watched as well.
+func NewFileSetWatcher(resolveFiles func() ([]string, error), listeners ...func() error) (*FileWatcher, error) {
+	filePaths, err := resolveFiles()
 	if err != nil {
 		return nil, err
 	}
 
-	err = fsWatcher.Add(filepath.Dir(configLocation))
+	contentHash, err := CalculateFilesHash(filePaths)
 	if err != nil {
 		return nil, err
 	}
 
-	fileName := filepath.Base(configLocation)
-
-	contentHash, err := CalculateFileHash(configLocation)
+	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
 
 	fileWatcher := &FileWatcher{
 		watcher:             fsWatcher,
-		fileName:            fileName,
-		filePath:            configLocation,
+		resolveFiles:        resolveFiles,
+		watchedDirs:         make(map[string]bool),
 		listeners:           listeners,
 		previousContentHash: contentHash,
 		debounceTime:        50 * time.Millisecond,
 	}
 
+	err = fileWatcher.setFilePaths(filePaths)
+	if err != nil {
+		_ = fsWatcher.Close()
+		return nil, err
+	}
+
 	return fileWatcher, nil
 }
 
+// setFilePaths sets the watched files, watching the directories of the files,
+// since editors often replace files instead of modifying them. Must be called with the lock held.
+func (fw *FileWatcher) setFilePaths(filePaths []string) error {
+	fw.filePaths = make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		fw.filePaths[filepath.Clean(filePath)] = true
+
+		dir := filepath.Dir(filePath)
+		if fw.watchedDirs[dir] {
+			continue
+		}
+		if err := fw.watcher.Add(dir); err != nil {
+			return err
+		}
+		fw.watchedDirs[dir] = true
+	}
+
+	return nil
+}
+
+// AddDirectory watches the directory for files added to the watched set,
+// e.g. for files matching a glob pattern that does not match any file yet
+func (fw *FileWatcher) AddDirectory(dir string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	if fw.watchedDirs[dir] {
+		return nil
+	}
+	if err := fw.watcher.Add(dir); err != nil {
+		return err
+	}
+	fw.watchedDirs[dir] = true
+
+	return nil
+}
+
 // Watch sets up file watching and returns a channel that is closed when watching is ready
 func (fw *FileWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
-	slog.Info("watching file", "file", fw.filePath)
+	fw.mu.Lock()
+	for filePath := range fw.filePaths {
+		slog.Info("watching file", "file", filePath)
+	}
+	fw.mu.Unlock()
 
 	readyCh := make(chan struct{})
 
@@ -76,17 +132,18 @@ func (fw *FileWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
 					continue
 				}
 
+				// the events are processed after the debounce time, so that all changes of
+				// e.g. an editor writing a temporary file and renaming it are processed at once
 				fw.mu.Lock()
-				now := time.Now()
-				if now.Sub(fw.lastEventTime) < fw.debounceTime {
-					slog.Debug("debouncing file event", "file", fw.filePath)
+				if fw.eventPending {
+					slog.Debug("debouncing file event", "file", event.Name)
 					fw.mu.Unlock()
 					continue
 				}
-				fw.lastEventTime = now
+				fw.eventPending = true
 				fw.mu.Unlock()
 
-				go fw.processFileEvent()
+				time.AfterFunc(fw.debounceTime, fw.processFileEvent)
 			}
 		}
 	}()
@@ -95,7 +152,17 @@ func (fw *FileWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
 }
 
 func (fw *FileWatcher) processFileEvent() {
-	contentHash, err := CalculateFileHash(fw.filePath)
+	fw.mu.Lock()
+	fw.eventPending = false
+	fw.mu.Unlock()
+
+	filePaths, err := fw.resolveFiles()
+	if err != nil {
+		slog.Error("failed to resolve watched files", "err", err)
+		return
+	}
+
+	contentHash, err := CalculateFilesHash(filePaths)
 	if err != nil {
 		slog.Error("failed to calculate file hash", "err", err)
 		return
@@ -105,15 +172,20 @@ func (fw *FileWatcher) processFileEvent() {
 	defer fw.mu.Unlock()
 
 	if contentHash == fw.previousContentHash {
-		slog.Debug("file modified, but content hash is unchanged", "file", fw.filePath)
+		slog.Debug("files modified, but content hash is unchanged", "files", filePaths)
 		return
 	}
 
-	slog.Info("file modified", "file", fw.filePath)
-	slog.Info("content hash changed, executing listeners", "file", fw.filePath)
+	slog.Info("files modified", "files", filePaths)
+	slog.Info("content hash changed, executing listeners", "files", filePaths)
 
 	fw.previousContentHash = contentHash
 
+	err = fw.setFilePaths(filePaths)
+	if err != nil {
+		slog.Error("failed to watch files", "err", err)
+	}
+
 	err = fw.executeListeners()
 	if err != nil {
 		slog.Error("failed to execute listeners", "err", err)
@@ -131,19 +203,28 @@ func (fw *FileWatcher) executeListeners() error {
 	return nil
 }
 
-// isRelevantFileEvent checks if the event corresponds to a modification of the watched file
+// isRelevantFileEvent checks if the event corresponds to a modification of a watched file,
+// or to a file created in a watched directory, which might be added to the watched files
 func (fw *FileWatcher) isRelevantFileEvent(event fsnotify.Event) bool {
-	eventFileName := filepath.Base(event.Name)
-	if eventFileName != fw.fileName {
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		slog.Debug("file created in watched directory", "event", event)
+		return true
+	}
+
+	fw.mu.Lock()
+	isWatchedFile := fw.filePaths[filepath.Clean(event.Name)]
+	fw.mu.Unlock()
+
+	if !isWatchedFile {
 		return false
 	}
 
-	if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Rename == fsnotify.Rename {
-		slog.Debug("relevant file event detected", "event", event, "file", fw.fileName)
+	if event.Op&(fsnotify.Write|fsnotify.Rename|fsnotify.Remove) != 0 {
+		slog.Debug("relevant file event detected", "event", event, "file", event.Name)
 		return true
 	}
 
-	slog.Debug("ignoring irrelevant file event", "event", event, "file", fw.fileName)
+	slog.Debug("ignoring irrelevant file event", "event", event, "file", event.Name)
 	return false
 }
 
@@ -3,6 +3,7 @@ package file_watcher
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -165,3 +166,78 @@ func mockListenerWithChannel(called chan struct{}) func() error {
 		return nil
 	}
 }
+
+func TestFileSetWatcher(t *testing.T) {
+	t.Run("should_execute_listener_on_modification_of_any_file", func(t *testing.T) {
+		listenerCalled := make(chan struct{})
+		dname := t.TempDir()
+
+		firstFile := file_utils.CreateTempFileInDir(t, "first content", dname)
+		secondFile := file_utils.CreateTempFileInDir(t, "second content", dname)
+
+		fw, err := NewFileSetWatcher(func() ([]string, error) {
+			return []string{firstFile, secondFile}, nil
+		}, mockListenerWithChannel(listenerCalled))
+		if err != nil {
+			t.Fatalf("failed to create file watcher: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		readyCh, err := fw.Watch(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		<-readyCh
+
+		file_utils.AppendToFilex3(t, secondFile, "new content")
+
+		select {
+		case <-listenerCalled:
+			// Success
+		case <-time.After(testTimeout):
+			t.Errorf("expected listener to be called, but it wasn't")
+		}
+	})
+
+	t.Run("should_execute_listener_when_file_is_added", func(t *testing.T) {
+		listenerCalled := make(chan struct{})
+		dname := t.TempDir()
+
+		firstFile := file_utils.CreateTempFileInDir(t, "first content", dname)
+		addedFile := filepath.Join(dname, "added.yml")
+
+		fw, err := NewFileSetWatcher(func() ([]string, error) {
+			if _, err := os.Stat(addedFile); err == nil {
+				return []string{firstFile, addedFile}, nil
+			}
+			return []string{firstFile}, nil
+		}, mockListenerWithChannel(listenerCalled))
+		if err != nil {
+			t.Fatalf("failed to create file watcher: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		readyCh, err := fw.Watch(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		<-readyCh
+
+		if err := os.WriteFile(addedFile, []byte("added content"), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+
+		select {
+		case <-listenerCalled:
+			// Success
+		case <-time.After(testTimeout):
+			t.Errorf("expected listener to be called, but it wasn't")
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kuskoman/logstash-exporter/pkg/collector_manager"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// runCheckConfig loads the configuration file with strict YAML parsing, runs all validators
+// and optionally tests the connectivity to every Logstash instance.
+// Every problem is written to the writer on a separate line, and an error is returned if any was found.
+func runCheckConfig(configLocation string, checkConnectivity bool, w io.Writer) error {
+	cfg, err := config.GetConfigStrict(configLocation)
+	if err != nil {
+		// the errors of a configuration split into multiple files are reported with the file
+		location := configLocation
+		var fileError *config.FileError
+		if errors.As(err, &fileError) {
+			location, err = fileError.File, fileError.Err
+		}
+
+		var typeError *yaml.TypeError
+		if errors.As(err, &typeError) {
+			for _, message := range typeError.Errors {
+				fmt.Fprintf(w, "%s: %s\n", location, message)
+			}
+			return fmt.Errorf("found %d problems in %s", len(typeError.Errors), location)
+		}
+
+		// joined errors, e.g. of unset environment variables, are printed on separate lines
+		for _, message := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(w, "%s: %s\n", location, message)
+		}
+		return fmt.Errorf("failed to load %s", location)
+	}
+
+	files, err := config.ResolveConfigFiles(configLocation)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", configLocation, err)
+	}
+
+	// deprecated keys are still supported, so they are reported without failing the check
+	for _, file := range files {
+		deprecations, err := config.GetDeprecatedKeys(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for _, deprecation := range deprecations {
+			fmt.Fprintf(w, "%s: warning: %s\n", file, deprecation)
+		}
+	}
+
+	problems := 0
+	for _, err := range cfg.ValidateAll() {
+		fmt.Fprintf(w, "%s: %s\n", configLocation, err)
+		problems++
+	}
+
+	// the connectivity is tested only for valid configurations, to not report the same problem twice
+	if checkConnectivity && problems == 0 {
+		problems += checkInstancesConnectivity(cfg, w)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problems in %s", problems, configLocation)
+	}
+
+	fmt.Fprintf(w, "%s: OK\n", configLocation)
+	return nil
+}
+
+// checkInstancesConnectivity queries the node info of every Logstash instance
+// and returns the number of instances that could not be reached
+func checkInstancesConnectivity(cfg *config.Config, w io.Writer) int {
+	failures := 0
+
+	for i, instance := range cfg.Logstash.Instances {
+		field := fmt.Sprintf("logstash.instances[%d]", i)
+
+		client, err := collector_manager.NewInstanceClient(instance, cfg.Logstash.HttpTimeout)
+		if err != nil {
+			fmt.Fprintf(w, "%s: %s: %s\n", field, instance.Host, err)
+			failures++
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Logstash.HttpTimeout)
+		nodeInfo, err := client.GetNodeInfo(ctx)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(w, "%s: %s: failed to connect: %s\n", field, instance.Host, err)
+			failures++
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s: connected to Logstash %s (%s)\n", field, instance.Host, nodeInfo.Version, nodeInfo.Status)
+	}
+
+	return failures
+}
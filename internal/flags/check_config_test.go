@@ -0,0 +1,99 @@
+package flags
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	location := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(location, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return location
+}
+
+func TestRunCheckConfig(t *testing.T) {
+	t.Run("accepts a valid config", func(t *testing.T) {
+		location := writeConfig(t, "logstash:\n  instances:\n    - url: http://localhost:9600\n")
+
+		var output bytes.Buffer
+		if err := runCheckConfig(location, false, &output); err != nil {
+			t.Fatalf("unexpected error: %v, output: %s", err, output.String())
+		}
+		if !strings.Contains(output.String(), "OK") {
+			t.Errorf("expected OK to be printed, got %s", output.String())
+		}
+	})
+
+	t.Run("reports unknown keys with their lines", func(t *testing.T) {
+		location := writeConfig(t, "logstash:\n  instances:\n    - url: http://localhost:9600\n      nmae: main\nserver:\n  prot: 9198\n")
+
+		var output bytes.Buffer
+		if err := runCheckConfig(location, false, &output); err == nil {
+			t.Fatalf("expected an error")
+		}
+		for _, expected := range []string{"line 4: field nmae not found", "line 6: field prot not found"} {
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("expected %q in the output, got %s", expected, output.String())
+			}
+		}
+	})
+
+	t.Run("reports every invalid field", func(t *testing.T) {
+		location := writeConfig(t, "logstash:\n  instances:\n    - url: localhost\n      basic_auth:\n        username: user\nmetrics:\n  naming: v4\n")
+
+		var output bytes.Buffer
+		if err := runCheckConfig(location, false, &output); err == nil {
+			t.Fatalf("expected an error")
+		}
+		for _, expected := range []string{"logstash.instances[0].url:", "logstash.instances[0].basic_auth:", "metrics:"} {
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("expected %q in the output, got %s", expected, output.String())
+			}
+		}
+	})
+
+	t.Run("reports unknown keys with the fragment", func(t *testing.T) {
+		dir := t.TempDir()
+		fragments := map[string]string{
+			"10-team-a.yml": "logstash:\n  instances:\n    - url: http://team-a:9600\n",
+			"20-team-b.yml": "logstash:\n  instances:\n    - url: http://team-b:9600\n      nmae: team-b\n",
+		}
+		for name, content := range fragments {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+		}
+
+		var output bytes.Buffer
+		if err := runCheckConfig(dir, false, &output); err == nil {
+			t.Fatalf("expected an error")
+		}
+		expected := filepath.Join(dir, "20-team-b.yml") + ": line 4: field nmae not found"
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in the output, got %s", expected, output.String())
+		}
+	})
+
+	t.Run("tests the connectivity to the instances", func(t *testing.T) {
+		server := newLogstashServer(t)
+		location := writeConfig(t, "logstash:\n  instances:\n    - url: "+server.URL+"\n    - url: http://127.0.0.1:1\n")
+
+		var output bytes.Buffer
+		if err := runCheckConfig(location, true, &output); err == nil {
+			t.Fatalf("expected an error for the unreachable instance")
+		}
+		if !strings.Contains(output.String(), "logstash.instances[0]: "+server.URL+": connected") {
+			t.Errorf("expected the first instance to be connected, got %s", output.String())
+		}
+		if !strings.Contains(output.String(), "logstash.instances[1]: http://127.0.0.1:1: failed to connect") {
+			t.Errorf("expected the second instance to fail, got %s", output.String())
+		}
+	})
+}
@@ -8,12 +8,23 @@ import (
 	"github.com/kuskoman/logstash-exporter/pkg/config"
 )
 
+const (
+	// CommandSnapshot scrapes all configured instances once and prints the metrics
+	CommandSnapshot = "snapshot"
+	// CommandCheckConfig validates the configuration file
+	CommandCheckConfig = "check-config"
+)
+
 // FlagsConfig holds the parsed command-line flags
 type FlagsConfig struct {
 	ConfigLocation string
 	HotReload      bool
 	Version        bool
 	Help           bool
+	// Command is the subcommand to run instead of the exporter, empty if none
+	Command           string
+	SnapshotFormat    string
+	CheckConnectivity bool
 }
 
 // ParseFlags parses the provided command-line arguments for testability
@@ -23,18 +34,45 @@ func ParseFlags(args []string) (*FlagsConfig, error) {
 	versionFlag := flags.Bool("version", false, "prints the version and exits")
 	helpFlag := flags.Bool("help", false, "prints the help message and exits")
 	hotReloadFlag := flags.Bool("watch", false, "enable configuration hot reload")
-	configLocationFlag := flags.String("config", config.ExporterConfigLocation, "location of the exporter config file")
+	configLocationFlag := flags.String("config", config.ExporterConfigLocation, "location of the exporter config file, or of a directory of config files")
+	snapshotFormatFlag := flags.String("format", SnapshotFormatText, "output format of the snapshot command: text, json or csv")
+	checkConnectivityFlag := flags.Bool("check-connectivity", false, "test the connectivity to every instance in the check-config command")
 
 	if err := flags.Parse(args); err != nil {
 		return nil, err
 	}
 
+	// the flags can be passed both before and after the subcommand
+	var command string
+	if flags.NArg() > 0 {
+		command = flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return nil, err
+		}
+		if flags.NArg() > 0 {
+			return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+		}
+	}
+
+	switch command {
+	case "", CommandSnapshot, CommandCheckConfig:
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+
+	if !isValidSnapshotFormat(*snapshotFormatFlag) {
+		return nil, fmt.Errorf("unknown snapshot format %q", *snapshotFormatFlag)
+	}
+
 	// Create a struct with the parsed flags
 	return &FlagsConfig{
-		ConfigLocation: *configLocationFlag,
-		HotReload:      *hotReloadFlag,
-		Version:        *versionFlag,
-		Help:           *helpFlag,
+		ConfigLocation:    *configLocationFlag,
+		HotReload:         *hotReloadFlag,
+		Version:           *versionFlag,
+		Help:              *helpFlag,
+		Command:           command,
+		SnapshotFormat:    *snapshotFormatFlag,
+		CheckConnectivity: *checkConnectivityFlag,
 	}, nil
 }
 
@@ -53,9 +91,31 @@ func HandleFlags(flagsConfig *FlagsConfig) bool {
 	return false
 }
 
+// RunCommand runs the subcommand selected in the flags.
+// The returned error means that the process should exit with a non-zero code.
+func RunCommand(flagsConfig *FlagsConfig) error {
+	switch flagsConfig.Command {
+	case CommandSnapshot:
+		return runSnapshot(flagsConfig.ConfigLocation, flagsConfig.SnapshotFormat, os.Stdout)
+	case CommandCheckConfig:
+		return runCheckConfig(flagsConfig.ConfigLocation, flagsConfig.CheckConnectivity, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", flagsConfig.Command)
+	}
+}
+
 // printHelp prints usage instructions
 func printHelp() {
 	fmt.Printf("Usage of %s:\n", os.Args[0])
+	fmt.Printf("  %s [flags]\n", os.Args[0])
+	fmt.Printf("  %s %s [-config path] [-format text|json|csv]\n", os.Args[0], CommandSnapshot)
+	fmt.Printf("  %s %s [-config path] [-check-connectivity]\n", os.Args[0], CommandCheckConfig)
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Printf("  %s\tscrapes all configured instances once, prints the metrics and exits,\n", CommandSnapshot)
+	fmt.Println("  \t\twith a non-zero code if any instance failed")
+	fmt.Printf("  %s\tvalidates the config file, rejecting unknown keys, and exits\n", CommandCheckConfig)
+	fmt.Println("  \t\twith a non-zero code if any problem was found")
 	fmt.Println()
 	fmt.Println("Flags:")
 	flag.PrintDefaults()
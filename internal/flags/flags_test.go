@@ -35,6 +35,38 @@ func TestParseFlags(t *testing.T) {
 		}
 	})
 
+	t.Run("parses the snapshot command with flags on both sides", func(t *testing.T) {
+		t.Parallel()
+
+		args := []string{
+			"-config", "/path/to/config.yml", "snapshot", "-format", "json",
+		}
+		flagsConfig, err := ParseFlags(args)
+		if err != nil {
+			t.Fatalf("unexpected error parsing flags: %v", err)
+		}
+
+		if flagsConfig.Command != CommandSnapshot {
+			t.Errorf("expected Command to be %s, got %s", CommandSnapshot, flagsConfig.Command)
+		}
+		if flagsConfig.SnapshotFormat != SnapshotFormatJSON {
+			t.Errorf("expected SnapshotFormat to be %s, got %s", SnapshotFormatJSON, flagsConfig.SnapshotFormat)
+		}
+		if flagsConfig.ConfigLocation != "/path/to/config.yml" {
+			t.Errorf("expected ConfigLocation to be '/path/to/config.yml', got %s", flagsConfig.ConfigLocation)
+		}
+	})
+
+	t.Run("returns error for unknown command or format", func(t *testing.T) {
+		t.Parallel()
+
+		for _, args := range [][]string{{"unknown"}, {"snapshot", "-format", "xml"}, {"snapshot", "extra"}} {
+			if _, err := ParseFlags(args); err == nil {
+				t.Errorf("expected error for %v, but got none", args)
+			}
+		}
+	})
+
 	t.Run("returns error for invalid flag", func(t *testing.T) {
 		args := []string{
 			"-invalidFlag",
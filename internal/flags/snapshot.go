@@ -0,0 +1,151 @@
+package flags
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/kuskoman/logstash-exporter/internal/push"
+	"github.com/kuskoman/logstash-exporter/pkg/collector_manager"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	// SnapshotFormatText prints the snapshot in the Prometheus text exposition format
+	SnapshotFormatText = "text"
+	// SnapshotFormatJSON prints the snapshot as a JSON array of samples
+	SnapshotFormatJSON = "json"
+	// SnapshotFormatCSV prints the snapshot as CSV with a sample per row
+	SnapshotFormatCSV = "csv"
+)
+
+func isValidSnapshotFormat(format string) bool {
+	switch format {
+	case SnapshotFormatText, SnapshotFormatJSON, SnapshotFormatCSV:
+		return true
+	default:
+		return false
+	}
+}
+
+// snapshotSample is a single sample of the snapshot, in the JSON and CSV formats
+type snapshotSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	// Value is formatted as in the text exposition format, since JSON cannot represent NaN and infinities
+	Value string `json:"value"`
+}
+
+// runSnapshot scrapes all configured instances once and writes the metrics to the writer.
+// An error is returned if any instance failed, after the metrics of the others are written.
+func runSnapshot(configLocation string, format string, w io.Writer) error {
+	cfg, err := config.GetConfig(configLocation)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	collectorManager := collector_manager.NewCollectorManager(cfg.Logstash.Instances, cfg.Logstash.HttpTimeout, cfg.Metrics)
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collectorManager); err != nil {
+		return fmt.Errorf("failed to register collectors: %w", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	if err := writeSnapshot(w, format, families); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	var failedInstances []string
+	instancesUp := push.GetInstancesUp(families)
+	for _, instance := range cfg.Logstash.Instances {
+		if _, up := instancesUp[instance.Host]; !up {
+			failedInstances = append(failedInstances, instance.Host)
+		}
+	}
+
+	if len(failedInstances) > 0 {
+		return fmt.Errorf("failed to scrape %d of %d instances: %s", len(failedInstances), len(cfg.Logstash.Instances), strings.Join(failedInstances, ", "))
+	}
+
+	return nil
+}
+
+// writeSnapshot writes the metric families to the writer in the given format
+func writeSnapshot(w io.Writer, format string, families []*dto.MetricFamily) error {
+	switch format {
+	case SnapshotFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(familiesToSamples(families))
+	case SnapshotFormatCSV:
+		return writeCSV(w, familiesToSamples(families))
+	default:
+		encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeCSV writes a row per sample, with the labels formatted as in the text exposition format
+func writeCSV(w io.Writer, samples []snapshotSample) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write([]string{"name", "labels", "value"}); err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		if err := csvWriter.Write([]string{sample.Name, formatLabels(sample.Labels), sample.Value}); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// formatLabels formats the labels sorted by name, e.g. `hostname="http://localhost:9600",pipeline="main"`
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// familiesToSamples flattens the metric families into samples,
+// splitting summaries and histograms into their series as in the text exposition format
+func familiesToSamples(families []*dto.MetricFamily) []snapshotSample {
+	flattened := push.FlattenFamilies(families, 0)
+	samples := make([]snapshotSample, len(flattened))
+
+	for i, sample := range flattened {
+		samples[i] = snapshotSample{Name: sample.Name, Labels: sample.Labels, Value: push.FormatFloat(sample.Value)}
+	}
+
+	return samples
+}
@@ -0,0 +1,167 @@
+package flags
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// newLogstashServer serves the node info and node stats fixtures
+func newLogstashServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return newLogstashServerWithFixtures(t, map[string]string{"/": "node_info.json", "/_node/stats": "node_stats.json"})
+}
+
+// newLogstashServerWithFixtures serves the fixtures by path, and responds with 404 to the other paths
+func newLogstashServerWithFixtures(t *testing.T, fixtures map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		content, err := os.ReadFile(filepath.Join("..", "..", "fixtures", fixture))
+		if err != nil {
+			t.Errorf("failed to read fixture: %v", err)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func writeSnapshotConfig(t *testing.T, hosts ...string) string {
+	t.Helper()
+
+	content := "logstash:\n  instances:\n"
+	for _, host := range hosts {
+		content += fmt.Sprintf("    - url: %q\n", host)
+	}
+
+	return writeConfig(t, content)
+}
+
+func TestRunSnapshot(t *testing.T) {
+	t.Run("prints the metrics of all instances", func(t *testing.T) {
+		server := newLogstashServer(t)
+		configLocation := writeSnapshotConfig(t, server.URL)
+
+		var output bytes.Buffer
+		if err := runSnapshot(configLocation, SnapshotFormatText, &output); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, metric := range []string{"logstash_info_up", "logstash_stats_pipeline_up"} {
+			if !strings.Contains(output.String(), metric) {
+				t.Errorf("expected %s in the snapshot, got:\n%s", metric, output.String())
+			}
+		}
+	})
+
+	t.Run("returns an error if any instance failed", func(t *testing.T) {
+		server := newLogstashServer(t)
+		configLocation := writeSnapshotConfig(t, server.URL, "http://127.0.0.1:1")
+
+		var output bytes.Buffer
+		err := runSnapshot(configLocation, SnapshotFormatJSON, &output)
+		if err == nil || !strings.Contains(err.Error(), "http://127.0.0.1:1") {
+			t.Fatalf("expected an error naming the failed instance, got %v", err)
+		}
+
+		var samples []snapshotSample
+		if err := json.Unmarshal(output.Bytes(), &samples); err != nil {
+			t.Fatalf("expected the metrics of the working instance to be printed: %v", err)
+		}
+		if len(samples) == 0 {
+			t.Errorf("expected samples in the snapshot")
+		}
+	})
+
+	t.Run("returns an error if the node stats of an instance failed", func(t *testing.T) {
+		server := newLogstashServerWithFixtures(t, map[string]string{"/": "node_info.json"})
+		configLocation := writeSnapshotConfig(t, server.URL)
+
+		err := runSnapshot(configLocation, SnapshotFormatText, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), server.URL) {
+			t.Fatalf("expected an error naming the instance without node stats, got %v", err)
+		}
+	})
+
+	t.Run("returns an error for a missing config", func(t *testing.T) {
+		if err := runSnapshot(filepath.Join(t.TempDir(), "missing.yml"), SnapshotFormatText, &bytes.Buffer{}); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestFamiliesToSamples(t *testing.T) {
+	t.Parallel()
+
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("test_gauge"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{{Name: proto.String("pipeline"), Value: proto.String("main")}},
+				Gauge: &dto.Gauge{Value: proto.Float64(math.NaN())},
+			}},
+		},
+		{
+			Name: proto.String("test_summary"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(2),
+					SampleSum:   proto.Float64(3),
+					Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(1.5)}},
+				},
+			}},
+		},
+	}
+
+	samples := familiesToSamples(families)
+
+	expected := []snapshotSample{
+		{Name: "test_gauge", Labels: map[string]string{"pipeline": "main"}, Value: "NaN"},
+		{Name: "test_summary", Labels: map[string]string{"quantile": "0.5"}, Value: "1.5"},
+		{Name: "test_summary_sum", Labels: map[string]string{}, Value: "3"},
+		{Name: "test_summary_count", Labels: map[string]string{}, Value: "2"},
+	}
+	if len(samples) != len(expected) {
+		t.Fatalf("expected %d samples, got %v", len(expected), samples)
+	}
+	for i := range expected {
+		if samples[i].Name != expected[i].Name || samples[i].Value != expected[i].Value || formatLabels(samples[i].Labels) != formatLabels(expected[i].Labels) {
+			t.Errorf("expected sample %v, got %v", expected[i], samples[i])
+		}
+	}
+
+	var output bytes.Buffer
+	if err := writeSnapshot(&output, SnapshotFormatCSV, families); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := csv.NewReader(&output).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read csv: %v", err)
+	}
+	if len(records) != len(expected)+1 || records[1][1] != `pipeline="main"` {
+		t.Errorf("unexpected csv output: %v", records)
+	}
+}
@@ -6,11 +6,17 @@ import (
 	"log/slog"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/kuskoman/logstash-exporter/pkg/collector_manager"
 	"github.com/kuskoman/logstash-exporter/pkg/config"
@@ -25,7 +31,20 @@ type Controller struct {
 	stopCh           chan struct{}
 	mu               sync.Mutex
 	resourceHandlers map[string]ResourceHandler
+	secrets          *secretWatcher
+	namespaces       *namespaceSelector
 	runningWorker    bool
+	// instances are the discovered instances, of which only the shard of the replica is monitored
+	instances *shardedInstanceManager
+	// election assigns the shards to the replicas if leader election is enabled
+	election       *shardElection
+	cancelElection context.CancelFunc
+	// electionDone is closed once the election has released the Lease of its shard
+	electionDone chan struct{}
+	// events reports the monitored instances as Kubernetes Events on the objects they were discovered from
+	events      *targetEventRecorder
+	broadcaster record.EventBroadcaster
+	metrics     *controllerCollector
 }
 
 // NewController creates a new Kubernetes controller
@@ -54,6 +73,25 @@ func NewController(kubeConfig config.KubernetesConfig, collectorMgr *collector_m
 		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
 	}
 
+	// The dynamic client watches the custom resources, such as the Logstash resources of ECK
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %v", err)
+	}
+
+	// Without leader election, the replica monitors its static shard from the start
+	shard := noShard
+	if !kubeConfig.LeaderElection.Enabled {
+		shard, err = staticShardIndex(kubeConfig.Sharding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the shard of the replica: %v", err)
+		}
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events(metav1.NamespaceAll)})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "logstash-exporter"})
+
 	// Create controller with empty resource handlers map
 	controller := &Controller{
 		client:           client,
@@ -61,15 +99,50 @@ func NewController(kubeConfig config.KubernetesConfig, collectorMgr *collector_m
 		collectorMgr:     collectorMgr,
 		stopCh:           make(chan struct{}),
 		resourceHandlers: make(map[string]ResourceHandler),
+		broadcaster:      broadcaster,
+	}
+
+	// The events are only emitted for the instances of the shard of the replica
+	controller.events = newTargetEventRecorder(collectorMgr, recorder, controller.discoveredObject, kubeConfig.ResyncPeriod)
+	instances := newShardedInstanceManager(controller.events, kubeConfig.Sharding.Shards, shard)
+	controller.instances = instances
+	controller.secrets = newSecretWatcher(client, instances, kubeConfig.ResyncPeriod)
+	controller.metrics = newControllerCollector(controller)
+
+	if kubeConfig.LeaderElection.Enabled {
+		controller.election, err = newShardElection(client, kubeConfig, instances)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create leader election: %v", err)
+		}
+	}
+
+	controller.namespaces, err = newNamespaceSelector(client, kubeConfig.NamespaceSelector, kubeConfig.ResyncPeriod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create namespace selector: %v", err)
 	}
 
 	// Register resource handlers
-	podHandler := NewPodResourceHandler(client, collectorMgr, kubeConfig)
+	podHandler := NewPodResourceHandler(client, instances, kubeConfig, controller.secrets, controller.namespaces)
 	controller.resourceHandlers[podHandler.Name()] = podHandler
 
-	serviceHandler := NewServiceResourceHandler(client, collectorMgr, kubeConfig)
+	serviceHandler := NewServiceResourceHandler(client, instances, kubeConfig, controller.secrets, controller.namespaces)
 	controller.resourceHandlers[serviceHandler.Name()] = serviceHandler
 
+	endpointSliceHandler := NewEndpointSliceResourceHandler(client, instances, kubeConfig, controller.secrets, controller.namespaces)
+	controller.resourceHandlers[endpointSliceHandler.Name()] = endpointSliceHandler
+
+	statefulSetHandler := NewStatefulSetResourceHandler(client, instances, kubeConfig, controller.secrets, controller.namespaces)
+	controller.resourceHandlers[statefulSetHandler.Name()] = statefulSetHandler
+
+	deploymentHandler := NewDeploymentResourceHandler(client, instances, kubeConfig, controller.secrets, controller.namespaces)
+	controller.resourceHandlers[deploymentHandler.Name()] = deploymentHandler
+
+	eckLogstashHandler := NewECKLogstashResourceHandler(client, dynamicClient, instances, kubeConfig, controller.secrets, controller.namespaces)
+	controller.resourceHandlers[eckLogstashHandler.Name()] = eckLogstashHandler
+
+	logstashTargetHandler := NewLogstashTargetResourceHandler(client, dynamicClient, instances, kubeConfig, controller.secrets, controller.namespaces)
+	controller.resourceHandlers[logstashTargetHandler.Name()] = logstashTargetHandler
+
 	return controller, nil
 }
 
@@ -92,12 +165,38 @@ func (c *Controller) Start(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// Select the namespaces before the resources are discovered
+	if err := c.namespaces.start(ctx); err != nil {
+		return err
+	}
+
 	// Start all resource handlers
 	for name, handler := range c.resourceHandlers {
 		slog.Debug("starting resource handler", "name", name)
 		if err := handler.Start(ctx, namespaces); err != nil {
 			return fmt.Errorf("failed to start resource handler %s: %v", name, err)
 		}
+		if instrumented, ok := handler.(instrumentedHandler); ok {
+			instrumented.trackResyncs()
+		}
+	}
+
+	// Replace the collector of a previous start, as the version collector does on reload
+	prometheus.Unregister(c.metrics)
+	if err := prometheus.Register(c.metrics); err != nil {
+		return fmt.Errorf("failed to register the controller metrics: %v", err)
+	}
+
+	// Campaign for a shard once the handlers discover the instances, so that the replica
+	// monitors the instances of a shard as soon as it acquires it
+	if c.election != nil && c.cancelElection == nil {
+		electionCtx, cancel := context.WithCancel(context.Background())
+		c.cancelElection = cancel
+		c.electionDone = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			c.election.run(electionCtx)
+		}(c.electionDone)
 	}
 
 	// Start the worker
@@ -118,16 +217,50 @@ func (c *Controller) Stop(ctx context.Context) error {
 
 	slog.Info("stopping Kubernetes controller")
 
+	// Release the Lease of the shard, so that a standby replica takes it over without waiting for it to expire
+	c.mu.Lock()
+	electionDone := c.electionDone
+	if c.cancelElection != nil {
+		c.cancelElection()
+	}
+	c.mu.Unlock()
+
+	if electionDone != nil {
+		select {
+		case <-electionDone:
+		case <-ctx.Done():
+			slog.Warn("timed out releasing the lease of the shard", "err", ctx.Err())
+		}
+	}
+
 	// Stop all resource handlers
 	for name, handler := range c.resourceHandlers {
 		slog.Debug("stopping resource handler", "name", name)
 		handler.Stop()
 	}
+	c.secrets.stop()
+	c.namespaces.stop()
+	c.events.stop()
+	c.broadcaster.Shutdown()
+	prometheus.Unregister(c.metrics)
 
 	close(c.stopCh)
 	return nil
 }
 
+// discoveredObject returns the object the instance was discovered from, or nil if it is unknown
+func (c *Controller) discoveredObject(id string) *corev1.ObjectReference {
+	for _, handler := range c.resourceHandlers {
+		if instrumented, ok := handler.(instrumentedHandler); ok {
+			if object := instrumented.discoveredObject(id); object != nil {
+				return object
+			}
+		}
+	}
+
+	return nil
+}
+
 // worker performs periodic reconciliation
 func (c *Controller) worker() {
 	slog.Debug("kubernetes controller worker running")
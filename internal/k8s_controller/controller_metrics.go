@@ -0,0 +1,192 @@
+package k8s_controller
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// secretsResource is the resource label of the reconcile errors of the Secrets referenced by the instances
+const secretsResource = "secrets"
+
+// instrumentedHandler is implemented by the resource handlers through the BaseResourceHandler
+type instrumentedHandler interface {
+	discoveredTargets() map[string]int
+	discoveredObject(id string) *corev1.ObjectReference
+	informersSynced() (started bool, synced bool)
+	reconcileErrorCount() uint64
+	lastResyncTime() time.Time
+	trackResyncs()
+}
+
+// discoveredTargets returns the number of discovered instances by namespace
+func (h *BaseResourceHandler) discoveredTargets() map[string]int {
+	h.targetsMu.Lock()
+	defer h.targetsMu.Unlock()
+
+	// the IDs of some handlers are prefixed with the kind, so the namespace is taken from the object
+	targets := make(map[string]int)
+	for id, object := range h.targets {
+		namespace, _, _ := strings.Cut(id, "/")
+		if object != nil {
+			namespace = object.Namespace
+		}
+		targets[namespace]++
+	}
+
+	return targets
+}
+
+// discoveredObject returns the object the instance was discovered from, or nil if the handler did not discover it
+func (h *BaseResourceHandler) discoveredObject(id string) *corev1.ObjectReference {
+	h.targetsMu.Lock()
+	defer h.targetsMu.Unlock()
+
+	return h.targets[id]
+}
+
+// informersSynced returns true if the handler started informers, and if all of them synced with the API server
+func (h *BaseResourceHandler) informersSynced() (bool, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, informer := range h.informers {
+		if !informer.HasSynced() {
+			return true, false
+		}
+	}
+
+	return len(h.informers) > 0, len(h.informers) > 0
+}
+
+func (h *BaseResourceHandler) reconcileErrorCount() uint64 {
+	return h.reconcileErrors.Load()
+}
+
+// lastResyncTime returns the time of the last sync of the informers, or the zero time if they did not sync yet
+func (h *BaseResourceHandler) lastResyncTime() time.Time {
+	if lastResync := h.lastResync.Load(); lastResync != 0 {
+		return time.Unix(0, lastResync)
+	}
+
+	return time.Time{}
+}
+
+// trackResyncs records the time of the initial sync of the started informers, and of their periodic resyncs,
+// which deliver the cached objects again as updates with an unchanged resource version
+func (h *BaseResourceHandler) trackResyncs() {
+	h.mu.RLock()
+	informers := append([]cache.SharedIndexInformer(nil), h.informers...)
+	h.mu.RUnlock()
+
+	if len(informers) == 0 {
+		return
+	}
+
+	for _, informer := range informers {
+		_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldObject, oldErr := meta.Accessor(oldObj)
+				newObject, newErr := meta.Accessor(newObj)
+				if oldErr == nil && newErr == nil && oldObject.GetResourceVersion() == newObject.GetResourceVersion() {
+					h.lastResync.Store(time.Now().UnixNano())
+				}
+			},
+		})
+		if err != nil {
+			slog.Warn("failed to track the resyncs of an informer", "err", err)
+		}
+	}
+
+	go func() {
+		hasSynced := make([]cache.InformerSynced, len(informers))
+		for i, informer := range informers {
+			hasSynced[i] = informer.HasSynced
+		}
+		if cache.WaitForCacheSync(h.stopCh, hasSynced...) {
+			h.lastResync.Store(time.Now().UnixNano())
+		}
+	}()
+}
+
+// controllerCollector exports the state of the discovery of the controller
+type controllerCollector struct {
+	controller *Controller
+
+	discoveredTargets *prometheus.Desc
+	informerSynced    *prometheus.Desc
+	reconcileErrors   *prometheus.Desc
+	lastResync        *prometheus.Desc
+}
+
+func newControllerCollector(controller *Controller) *controllerCollector {
+	fqName := func(name string) string {
+		return prometheus.BuildFQName(config.PrometheusNamespace, "exporter", name)
+	}
+	prometheus_helper.RegisterUnit(fqName("k8s_last_resync_timestamp_seconds"), prometheus_helper.UnitSeconds)
+
+	return &controllerCollector{
+		controller: controller,
+		discoveredTargets: prometheus.NewDesc(fqName("k8s_discovered_targets"),
+			"logstash_exporter: Number of Logstash instances discovered from the Kubernetes resources.",
+			[]string{"resource", "namespace"}, nil),
+		informerSynced: prometheus.NewDesc(fqName("k8s_informer_synced"),
+			"logstash_exporter: 1 if the informers of the Kubernetes resources synced with the API server, 0 otherwise.",
+			[]string{"resource"}, nil),
+		reconcileErrors: prometheus.NewDesc(fqName("k8s_reconcile_errors_total"),
+			"logstash_exporter: Number of Kubernetes resources which could not be turned into Logstash instances.",
+			[]string{"resource"}, nil),
+		lastResync: prometheus.NewDesc(fqName("k8s_last_resync_timestamp_seconds"),
+			"logstash_exporter: Time of the last sync of the informers of the Kubernetes resources.",
+			[]string{"resource"}, nil),
+	}
+}
+
+// Describe sends the descriptors of the metrics of the controller
+func (c *controllerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.discoveredTargets
+	ch <- c.informerSynced
+	ch <- c.reconcileErrors
+	ch <- c.lastResync
+}
+
+// Collect sends the metrics of the started resource handlers
+func (c *controllerCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, handler := range c.controller.resourceHandlers {
+		instrumented, ok := handler.(instrumentedHandler)
+		if !ok {
+			continue
+		}
+
+		started, synced := instrumented.informersSynced()
+		if !started {
+			continue
+		}
+
+		syncedValue := 0.0
+		if synced {
+			syncedValue = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.informerSynced, prometheus.GaugeValue, syncedValue, name)
+		ch <- prometheus.MustNewConstMetric(c.reconcileErrors, prometheus.CounterValue, float64(instrumented.reconcileErrorCount()), name)
+
+		if lastResync := instrumented.lastResyncTime(); !lastResync.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.lastResync, prometheus.GaugeValue, float64(lastResync.UnixNano())/1e9, name)
+		}
+
+		for namespace, count := range instrumented.discoveredTargets() {
+			ch <- prometheus.MustNewConstMetric(c.discoveredTargets, prometheus.GaugeValue, float64(count), name, namespace)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.reconcileErrors, prometheus.CounterValue,
+		float64(c.controller.secrets.reconcileErrors.Load()), secretsResource)
+}
@@ -0,0 +1,126 @@
+package k8s_controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// gatherControllerMetrics returns the values of the metrics of the controller by name and labels
+func gatherControllerMetrics(t *testing.T, controller *Controller) map[string]map[string]float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newControllerCollector(controller))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	metrics := make(map[string]map[string]float64)
+	for _, family := range families {
+		metrics[family.GetName()] = make(map[string]float64)
+		for _, metric := range family.GetMetric() {
+			labels := ""
+			for _, label := range metric.GetLabel() {
+				labels += label.GetName() + "=" + label.GetValue() + ","
+			}
+			metrics[family.GetName()][labels] = metricValue(metric)
+		}
+	}
+	return metrics
+}
+
+func metricValue(metric *dto.Metric) float64 {
+	if metric.GetCounter() != nil {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetGauge().GetValue()
+}
+
+func TestControllerCollector(t *testing.T) {
+	t.Parallel()
+
+	manager := newFakeInstanceManager()
+	handler := newTestPodHandler(manager, nil)
+	t.Cleanup(handler.Stop)
+
+	// an informer of an empty list stands for the informer of the API server
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListWithContextFunc: func(context.Context, metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{}, nil
+		},
+		WatchFuncWithContext: func(context.Context, metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}, &corev1.Pod{}, 0, cache.Indexers{})
+	handler.informers = append(handler.informers, informer)
+	handler.trackResyncs()
+	go informer.Run(handler.stopCh)
+
+	handler.processPod(newTestPod("logging", "logstash-0", nil))
+	handler.processPod(newTestPod("logging", "logstash-1", nil))
+	handler.processPod(newTestPod("ingest", "logstash-0", nil))
+	handler.processPod(newTestPod("ingest", "logstash-1", map[string]string{
+		handler.config.LogstashPasswordSecretAnnotation: "logstash-api",
+	}))
+
+	client := fake.NewSimpleClientset()
+	controller := &Controller{
+		resourceHandlers: map[string]ResourceHandler{handler.Name(): handler},
+		secrets:          newSecretWatcher(client, manager, 0),
+	}
+
+	deadline := time.Now().Add(testTimeout)
+	for handler.lastResyncTime().IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the informer to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	metrics := gatherControllerMetrics(t, controller)
+
+	discovered := metrics["logstash_exporter_k8s_discovered_targets"]
+	if discovered["namespace=logging,resource=pods,"] != 2 || discovered["namespace=ingest,resource=pods,"] != 1 {
+		t.Errorf("expected the discovered instances by namespace, got %v", discovered)
+	}
+	if synced := metrics["logstash_exporter_k8s_informer_synced"]["resource=pods,"]; synced != 1 {
+		t.Errorf("expected the informer to be reported synced, got %v", synced)
+	}
+	errors := metrics["logstash_exporter_k8s_reconcile_errors_total"]
+	if errors["resource=pods,"] != 1 || errors["resource=secrets,"] != 0 {
+		t.Errorf("expected the invalid annotations to be counted, got %v", errors)
+	}
+	if lastResync := metrics["logstash_exporter_k8s_last_resync_timestamp_seconds"]["resource=pods,"]; lastResync == 0 {
+		t.Errorf("expected the time of the sync of the informer")
+	}
+}
+
+func TestDiscoveredTargetsByNamespace(t *testing.T) {
+	t.Parallel()
+
+	// the IDs of the workload instances are prefixed with the workload kind
+	handler := newTestWorkloadHandler(newFakeInstanceManager(), workloadKindStatefulSet)
+	owner := metav1.OwnerReference{Kind: workloadKindStatefulSet, Name: "logstash"}
+	_ = handler.workloadIndexers[0].Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}})
+	_ = handler.podIndexers[0].Add(newTestWorkloadPod("logstash-0", "node-a", owner, nil))
+	_ = handler.podIndexers[0].Add(newTestWorkloadPod("logstash-1", "node-b", owner, nil))
+	handler.reconcile(types.NamespacedName{Namespace: "logging", Name: "logstash"})
+
+	targets := handler.discoveredTargets()
+	if len(targets) != 1 || targets["logging"] != 2 {
+		t.Errorf("expected the instances to be counted in the namespace of their pods, got %v", targets)
+	}
+}
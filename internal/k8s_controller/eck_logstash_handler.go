@@ -0,0 +1,560 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	eckLogstashKind = "Logstash"
+
+	// eckLogstashNameLabel is set by ECK on the pods and services of a Logstash resource
+	eckLogstashNameLabel = "logstash.k8s.elastic.co/name"
+
+	// eckLogstashIndex indexes the pods and services by the namespaced name of their Logstash resource
+	eckLogstashIndex = "logstash"
+
+	// eckAPIServiceName is the name of the API service in the Logstash resource,
+	// created by ECK as "<name>-ls-api"
+	eckAPIServiceName = "api"
+	eckDefaultAPIPort = 9600
+
+	// eckAPICertsSecretSuffix is the suffix of the Secret holding the certificate authority of the API,
+	// created by ECK as "<name>-ls-api-certs-public"
+	eckAPICertsSecretSuffix = "-ls-api-certs-public"
+)
+
+// eckLogstashGVR is the resource of the Logstash custom resources of Elastic Cloud on Kubernetes
+var eckLogstashGVR = schema.GroupVersionResource{
+	Group:    "logstash.k8s.elastic.co",
+	Version:  "v1alpha1",
+	Resource: "logstashes",
+}
+
+// keystoreReference matches a setting value referencing a key of the Logstash keystore, e.g. "${API_PASSWORD}"
+var keystoreReference = regexp.MustCompile(`^\$\{([^:}]+)\}$`)
+
+// eckLogstashSpec holds the fields of the Logstash resource spec used to monitor it
+type eckLogstashSpec struct {
+	Config         map[string]interface{} `json:"config,omitempty"`
+	Services       []eckLogstashService   `json:"services,omitempty"`
+	SecureSettings []eckSecretSource      `json:"secureSettings,omitempty"`
+}
+
+type eckLogstashService struct {
+	Name string `json:"name"`
+	TLS  struct {
+		SelfSignedCertificate *struct {
+			Disabled bool `json:"disabled,omitempty"`
+		} `json:"selfSignedCertificate,omitempty"`
+	} `json:"tls,omitempty"`
+}
+
+// eckSecretSource is a Secret whose keys are added to the Logstash keystore,
+// all of them or only the entries, under their path if it is set
+type eckSecretSource struct {
+	SecretName string `json:"secretName"`
+	Entries    []struct {
+		Key  string `json:"key"`
+		Path string `json:"path,omitempty"`
+	} `json:"entries,omitempty"`
+}
+
+// ECKLogstashResourceHandler monitors the pods of the Logstash resources managed by Elastic Cloud on Kubernetes,
+// without annotations. The pods are monitored on the port of the API service, with the credentials of
+// the api.auth.basic settings, read from the Secrets of the keystore when they reference it.
+// The certificate of the API is verified with the certificate authority of the public certificates Secret of ECK.
+// The instances are named "logstash/<namespace>/<logstash>/<pod>", labeled like the pods of a StatefulSet.
+type ECKLogstashResourceHandler struct {
+	*BaseResourceHandler
+
+	dynamicClient dynamic.Interface
+
+	logstashIndexers []cache.Indexer
+	podIndexers      []cache.Indexer
+	serviceIndexers  []cache.Indexer
+
+	reconcileMu sync.Mutex
+	// logstashInstances are the instances of the pods of every Logstash resource, guarded by reconcileMu
+	logstashInstances *instanceGroups
+}
+
+// NewECKLogstashResourceHandler creates a new ECK Logstash resource handler
+func NewECKLogstashResourceHandler(
+	client kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	instances *shardedInstanceManager,
+	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
+) ResourceHandler {
+	return newECKLogstashResourceHandler(
+		newBaseResourceHandler(
+			client,
+			instances,
+			kubeConfig,
+			kubeConfig.Resources.Logstashes,
+			secrets,
+			namespaces,
+		),
+		dynamicClient,
+	)
+}
+
+func newECKLogstashResourceHandler(base *BaseResourceHandler, dynamicClient dynamic.Interface) *ECKLogstashResourceHandler {
+	return &ECKLogstashResourceHandler{
+		BaseResourceHandler: base,
+		dynamicClient:       dynamicClient,
+		logstashInstances:   newInstanceGroups(base, "ECK logstash"),
+	}
+}
+
+// Name returns the name of the resource handler
+func (h *ECKLogstashResourceHandler) Name() string {
+	return "logstashes"
+}
+
+// Start starts watching the Logstash resources, their pods and services
+func (h *ECKLogstashResourceHandler) Start(ctx context.Context, namespaces []string) error {
+	if !h.resourceConfig.Enabled {
+		slog.Info("ECK logstash monitoring is disabled")
+		return nil
+	}
+
+	slog.Info("starting ECK logstash monitoring",
+		"labelSelector", h.resourceConfig.LabelSelector,
+		"fieldSelector", h.resourceConfig.FieldSelector,
+		"portName", h.resourceConfig.PortName,
+		"namespaces", namespaces)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	selectManaged := func(options *metav1.ListOptions) {
+		options.LabelSelector = eckLogstashNameLabel
+	}
+
+	// Create the informers of the Logstash resources, their pods and services for each namespace
+	for _, namespace := range namespaces {
+		// the selectors select the Logstash resources whose pods are monitored
+		logstashInformer := dynamicinformer.NewFilteredDynamicInformer(
+			h.dynamicClient,
+			eckLogstashGVR,
+			namespace,
+			h.config.ResyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			h.applySelectors,
+		).Informer()
+
+		podInformer := cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(h.client.CoreV1().RESTClient(), "pods", namespace, selectManaged),
+			&corev1.Pod{},
+			h.config.ResyncPeriod,
+			cache.Indexers{eckLogstashIndex: eckLogstashIndexFunc},
+		)
+
+		serviceInformer := cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(h.client.CoreV1().RESTClient(), "services", namespace, selectManaged),
+			&corev1.Service{},
+			h.config.ResyncPeriod,
+			cache.Indexers{eckLogstashIndex: eckLogstashIndexFunc},
+		)
+
+		for _, informer := range []cache.SharedIndexInformer{logstashInformer, podInformer, serviceInformer} {
+			_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc:    h.onObjectChange,
+				UpdateFunc: func(_, newObj interface{}) { h.onObjectChange(newObj) },
+				DeleteFunc: h.onObjectChange,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to add event handler to ECK logstash informer: %w", err)
+			}
+		}
+
+		h.informers = append(h.informers, logstashInformer, podInformer, serviceInformer)
+		h.stores = append(h.stores, logstashInformer.GetStore())
+		h.logstashIndexers = append(h.logstashIndexers, logstashInformer.GetIndexer())
+		h.podIndexers = append(h.podIndexers, podInformer.GetIndexer())
+		h.serviceIndexers = append(h.serviceIndexers, serviceInformer.GetIndexer())
+	}
+
+	h.namespaces.subscribe(h.resyncLogstashes)
+
+	// Start all informers
+	for _, informer := range h.informers {
+		go informer.Run(h.stopCh)
+	}
+
+	return nil
+}
+
+// eckLogstashIndexFunc indexes a pod or service by the namespaced name of its Logstash resource
+func eckLogstashIndexFunc(obj interface{}) ([]string, error) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil
+	}
+
+	name, exists := object.GetLabels()[eckLogstashNameLabel]
+	if !exists {
+		return nil, nil
+	}
+
+	return []string{types.NamespacedName{Namespace: object.GetNamespace(), Name: name}.String()}, nil
+}
+
+// onObjectChange reconciles the instances of the Logstash resource of the changed object
+func (h *ECKLogstashResourceHandler) onObjectChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		slog.Warn("unexpected type in ECK logstash event handler")
+		return
+	}
+
+	name := object.GetName()
+	if _, isLogstash := obj.(*unstructured.Unstructured); !isLogstash {
+		var exists bool
+		if name, exists = object.GetLabels()[eckLogstashNameLabel]; !exists {
+			return
+		}
+	}
+
+	h.reconcile(types.NamespacedName{Namespace: object.GetNamespace(), Name: name})
+}
+
+// resyncLogstashes reconciles the instances of the Logstash resources of a namespace which was selected or unselected
+func (h *ECKLogstashResourceHandler) resyncLogstashes(namespace string) {
+	logstashes := make(map[types.NamespacedName]struct{})
+
+	h.reconcileMu.Lock()
+	for _, logstash := range h.logstashInstances.namespaceGroups(namespace) {
+		logstashes[logstash] = struct{}{}
+	}
+	h.reconcileMu.Unlock()
+
+	h.mu.RLock()
+	for _, indexer := range h.logstashIndexers {
+		objects, _ := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		for _, obj := range objects {
+			if logstash, err := meta.Accessor(obj); err == nil {
+				logstashes[types.NamespacedName{Namespace: logstash.GetNamespace(), Name: logstash.GetName()}] = struct{}{}
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for logstash := range logstashes {
+		h.reconcile(logstash)
+	}
+}
+
+// reconcile adds the new and changed instances of the running pods of the Logstash resource,
+// and removes the other instances of the resource
+func (h *ECKLogstashResourceHandler) reconcile(logstashName types.NamespacedName) {
+	h.reconcileMu.Lock()
+	defer h.reconcileMu.Unlock()
+
+	h.logstashInstances.apply(logstashName, h.podInstances(logstashName))
+}
+
+// podInstances returns the instances of the running pods of the Logstash resource by their IDs
+func (h *ECKLogstashResourceHandler) podInstances(logstashName types.NamespacedName) map[string]endpointInstance {
+	logstash := h.getLogstash(logstashName)
+	if logstash == nil || !h.namespaces.selected(logstashName.Namespace) {
+		return nil
+	}
+
+	spec, err := parseECKLogstashSpec(logstash)
+	if err != nil {
+		h.reconcileError("invalid ECK logstash resource", "logstash", logstashName.String(), "err", err)
+		return nil
+	}
+
+	basicAuth, passwordRef, err := eckLogstashCredentials(logstashName.Namespace, spec)
+	if err != nil {
+		h.reconcileError("failed to find the credentials of the ECK logstash API", "logstash", logstashName.String(), "err", err)
+		return nil
+	}
+
+	scheme, targetPort := h.apiEndpoint(logstashName, spec)
+	secretRefs := instanceSecretRefs{password: passwordRef}
+	tlsConfig := h.apiTLSConfig(logstashName, scheme, &secretRefs)
+
+	instances := make(map[string]endpointInstance)
+	for _, pod := range h.getPods(logstashName) {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		port, found := podTargetPort(pod, targetPort)
+		if !found {
+			h.reconcileError("failed to find the target port of the ECK logstash API service in the pod",
+				"logstash", logstashName.String(), "pod", pod.Name, "targetPort", targetPort.String())
+			continue
+		}
+
+		// the IDs are prefixed with the kind, as the Service of the Logstash resource expands to "<namespace>/<service>/<pod>"
+		id := fmt.Sprintf("logstash/%s/%s", logstashName.String(), pod.Name)
+		instance := &config.LogstashInstance{
+			Host:      (&url.URL{Scheme: scheme, Host: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port))}).String(),
+			Name:      id,
+			BasicAuth: basicAuth,
+			TLSConfig: tlsConfig,
+			Labels:    h.podMetadataLabels(pod, workloadPodLabels(eckLogstashKind, logstashName.Name, logstashName.Name+"-ls", pod)),
+		}
+		instances[id] = endpointInstance{instance: instance, secretRefs: secretRefs, object: objectReference("v1", "Pod", pod)}
+	}
+
+	return instances
+}
+
+// apiTLSConfig returns the TLS configuration of the API of the Logstash resource, nil over http.
+// The certificate is verified with the certificate authority of the public certificates Secret of ECK,
+// referenced in the Secrets of the instances, unless the verification is explicitly skipped.
+func (h *ECKLogstashResourceHandler) apiTLSConfig(logstashName types.NamespacedName, scheme string, secretRefs *instanceSecretRefs) *config.TLSClientConfig {
+	if scheme != "https" {
+		return nil
+	}
+	if h.resourceConfig.InsecureSkipVerify {
+		return &config.TLSClientConfig{InsecureSkipVerify: true}
+	}
+
+	secretRefs.ca = &secretKeyRef{
+		secret: types.NamespacedName{Namespace: logstashName.Namespace, Name: logstashName.Name + eckAPICertsSecretSuffix},
+		key:    defaultCAKey,
+	}
+
+	// the pods are scraped by their IPs, which the certificate of the API service does not include
+	return &config.TLSClientConfig{ServerName: fmt.Sprintf("%s-ls-api.%s.svc", logstashName.Name, logstashName.Namespace)}
+}
+
+// podTargetPort returns the port of the pod targeted by the port of a service, which may name a container port
+func podTargetPort(pod *corev1.Pod, targetPort intstr.IntOrString) (int, bool) {
+	if targetPort.Type == intstr.Int {
+		return targetPort.IntValue(), true
+	}
+
+	port, found := containerPort(pod, targetPort.StrVal)
+	return int(port), found
+}
+
+// apiEndpoint returns the scheme and the target port of the API service of the Logstash resource,
+// which may be the name of a container port. The API is served over HTTPS unless its self-signed certificate is disabled.
+func (h *ECKLogstashResourceHandler) apiEndpoint(logstashName types.NamespacedName, spec *eckLogstashSpec) (string, intstr.IntOrString) {
+	scheme := "https"
+	for _, service := range spec.Services {
+		if service.Name == eckAPIServiceName && service.TLS.SelfSignedCertificate != nil && service.TLS.SelfSignedCertificate.Disabled {
+			scheme = "http"
+		}
+	}
+
+	service := h.getService(types.NamespacedName{Namespace: logstashName.Namespace, Name: logstashName.Name + "-ls-api"})
+	if service == nil {
+		return scheme, intstr.FromInt32(eckDefaultAPIPort)
+	}
+
+	for _, port := range service.Spec.Ports {
+		if h.resourceConfig.PortName != "" && port.Name != h.resourceConfig.PortName {
+			continue
+		}
+		if port.TargetPort.Type == intstr.String || port.TargetPort.IntValue() > 0 {
+			return scheme, port.TargetPort
+		}
+		return scheme, intstr.FromInt32(port.Port)
+	}
+
+	return scheme, intstr.FromInt32(eckDefaultAPIPort)
+}
+
+// parseECKLogstashSpec converts the spec of the Logstash resource
+func parseECKLogstashSpec(logstash *unstructured.Unstructured) (*eckLogstashSpec, error) {
+	spec := &eckLogstashSpec{}
+
+	object, found, err := unstructured.NestedMap(logstash.Object, "spec")
+	if err != nil || !found {
+		return spec, err
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object, spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// eckLogstashCredentials returns the credentials of the API from the api.auth.basic settings of the Logstash resource.
+// The returned secret reference is set if the password references the keystore, which is filled from
+// the Secrets of the secure settings. The username may reference the keystore if it is in the same Secret.
+func eckLogstashCredentials(namespace string, spec *eckLogstashSpec) (*config.ClientAuthConfig, *secretKeyRef, error) {
+	if logstashSetting(spec.Config, "api.auth.type") != "basic" {
+		return nil, nil, nil
+	}
+
+	username := logstashSetting(spec.Config, "api.auth.basic.username")
+	password := logstashSetting(spec.Config, "api.auth.basic.password")
+	usernameKey := keystoreReference.FindStringSubmatch(username)
+	passwordKey := keystoreReference.FindStringSubmatch(password)
+
+	if passwordKey == nil {
+		if usernameKey != nil {
+			return nil, nil, fmt.Errorf("the username references the keystore, which is only supported with the password")
+		}
+		return &config.ClientAuthConfig{Username: username, Password: password}, nil, nil
+	}
+
+	passwordRef, err := resolveSecureSetting(namespace, spec.SecureSettings, passwordKey[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if usernameKey != nil {
+		usernameRef, err := resolveSecureSetting(namespace, spec.SecureSettings, usernameKey[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		if usernameRef.secret != passwordRef.secret {
+			return nil, nil, fmt.Errorf("the username and the password must be stored in the same secret, got %s and %s",
+				usernameRef.secret.String(), passwordRef.secret.String())
+		}
+		passwordRef.usernameKey = usernameRef.key
+		username = ""
+	}
+
+	return &config.ClientAuthConfig{Username: username}, passwordRef, nil
+}
+
+// resolveSecureSetting returns the key of the Secret holding the keystore key. The Secret is the one
+// listing the key in its entries, or the only Secret without entries, whose keys are all added to the keystore.
+func resolveSecureSetting(namespace string, sources []eckSecretSource, keystoreKey string) (*secretKeyRef, error) {
+	var candidates []string
+	for _, source := range sources {
+		if len(source.Entries) == 0 {
+			candidates = append(candidates, source.SecretName)
+			continue
+		}
+		for _, entry := range source.Entries {
+			if entry.Path == keystoreKey || (entry.Path == "" && entry.Key == keystoreKey) {
+				return &secretKeyRef{
+					secret: types.NamespacedName{Namespace: namespace, Name: source.SecretName},
+					key:    entry.Key,
+				}, nil
+			}
+		}
+	}
+
+	if len(candidates) != 1 {
+		return nil, fmt.Errorf("failed to find the secret of the keystore key %s among %d secure settings secrets without entries",
+			keystoreKey, len(candidates))
+	}
+
+	return &secretKeyRef{
+		secret: types.NamespacedName{Namespace: namespace, Name: candidates[0]},
+		key:    keystoreKey,
+	}, nil
+}
+
+// logstashSetting returns a Logstash setting, which may be written flat ("api.auth.type"),
+// nested ("api: {auth: {type}}") or anything in between
+func logstashSetting(settings map[string]interface{}, key string) string {
+	if value, exists := settings[key]; exists {
+		if _, nested := value.(map[string]interface{}); !nested {
+			return fmt.Sprint(value)
+		}
+	}
+
+	parts := strings.Split(key, ".")
+	for i := 1; i < len(parts); i++ {
+		nested, ok := settings[strings.Join(parts[:i], ".")].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value := logstashSetting(nested, strings.Join(parts[i:], ".")); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// getLogstash returns the Logstash resource from the informers, or nil if it does not exist
+func (h *ECKLogstashResourceHandler) getLogstash(logstashName types.NamespacedName) *unstructured.Unstructured {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, indexer := range h.logstashIndexers {
+		obj, exists, err := indexer.GetByKey(logstashName.String())
+		if err != nil || !exists {
+			continue
+		}
+		if logstash, ok := obj.(*unstructured.Unstructured); ok {
+			return logstash
+		}
+	}
+
+	return nil
+}
+
+// getService returns the service from the informers, or nil if it does not exist
+func (h *ECKLogstashResourceHandler) getService(serviceName types.NamespacedName) *corev1.Service {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, indexer := range h.serviceIndexers {
+		obj, exists, err := indexer.GetByKey(serviceName.String())
+		if err != nil || !exists {
+			continue
+		}
+		if service, ok := obj.(*corev1.Service); ok {
+			return service
+		}
+	}
+
+	return nil
+}
+
+// getPods returns the pods of the Logstash resource from the informers
+func (h *ECKLogstashResourceHandler) getPods(logstashName types.NamespacedName) []*corev1.Pod {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var pods []*corev1.Pod
+	for _, indexer := range h.podIndexers {
+		objects, err := indexer.ByIndex(eckLogstashIndex, logstashName.String())
+		if err != nil {
+			continue
+		}
+		for _, obj := range objects {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	return pods
+}
@@ -0,0 +1,240 @@
+package k8s_controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestECKLogstashHandler creates a handler with stores filled by the test instead of informers
+func newTestECKLogstashHandler(manager *fakeInstanceManager, client *fake.Clientset) *ECKLogstashResourceHandler {
+	kubeConfig := newTestKubernetesConfig()
+	kubeConfig.Resources.Logstashes.Enabled = true
+
+	handler := newECKLogstashResourceHandler(newBaseResourceHandler(client, manager, kubeConfig,
+		kubeConfig.Resources.Logstashes, newSecretWatcher(client, manager, 0), nil), nil)
+	handler.logstashIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	handler.podIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{eckLogstashIndex: eckLogstashIndexFunc})}
+	handler.serviceIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{eckLogstashIndex: eckLogstashIndexFunc})}
+
+	return handler
+}
+
+func newTestECKLogstash(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "logstash.k8s.elastic.co/v1alpha1",
+		"kind":       "Logstash",
+		"metadata":   map[string]interface{}{"namespace": "logging", "name": "quickstart"},
+		"spec":       spec,
+	}}
+}
+
+func newTestECKLogstashPod(name, node string) *corev1.Pod {
+	pod := newTestPod("logging", name, nil)
+	pod.Labels = map[string]string{eckLogstashNameLabel: "quickstart"}
+	pod.Spec.NodeName = node
+	return pod
+}
+
+func TestECKLogstashResourceHandler(t *testing.T) {
+	t.Parallel()
+
+	logstashName := types.NamespacedName{Namespace: "logging", Name: "quickstart"}
+
+	t.Run("monitors the pods over https on the port of the api service", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "quickstart-ls-api-certs-public"},
+			Data:       map[string][]byte{"ca.crt": []byte("eck-ca")},
+		})
+		manager := newFakeInstanceManager()
+		handler := newTestECKLogstashHandler(manager, client)
+		t.Cleanup(handler.secrets.stop)
+
+		_ = handler.logstashIndexers[0].Add(newTestECKLogstash(map[string]interface{}{"version": "8.15.0"}))
+		_ = handler.serviceIndexers[0].Add(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "logging",
+				Name:      "quickstart-ls-api",
+				Labels:    map[string]string{eckLogstashNameLabel: "quickstart"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "api", Port: 80, TargetPort: intstr.FromInt32(9601)}}},
+		})
+		pod := newTestECKLogstashPod("quickstart-ls-0", "node-a")
+		_ = handler.podIndexers[0].Add(pod)
+		handler.onObjectChange(pod)
+
+		instance := manager.waitForInstance(t, "logstash/logging/quickstart/quickstart-ls-0")
+		if instance.Host != "https://10.0.0.1:9601" {
+			t.Fatalf("expected the instance of the pod, got %+v", instance)
+		}
+		if instance.BasicAuth != nil {
+			t.Errorf("expected the instance without credentials, got %+v", instance.BasicAuth)
+		}
+		tlsConfig := instance.TLSConfig
+		if tlsConfig == nil || tlsConfig.CA != "eck-ca" || tlsConfig.ServerName != "quickstart-ls-api.logging.svc" || tlsConfig.InsecureSkipVerify {
+			t.Errorf("expected the certificate to be verified with the certificate authority of ECK, got %+v", tlsConfig)
+		}
+		if instance.Labels["workload"] != "quickstart" || instance.Labels["workload_kind"] != "Logstash" || instance.Labels["ordinal"] != "0" {
+			t.Errorf("expected the labels of the logstash pod, got %v", instance.Labels)
+		}
+	})
+
+	t.Run("skips the verification of the certificate only when configured", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestECKLogstashHandler(manager, fake.NewSimpleClientset())
+		handler.resourceConfig.InsecureSkipVerify = true
+
+		_ = handler.logstashIndexers[0].Add(newTestECKLogstash(map[string]interface{}{}))
+		_ = handler.podIndexers[0].Add(newTestECKLogstashPod("quickstart-ls-0", "node-a"))
+		handler.reconcile(logstashName)
+
+		instance := manager.getInstance("logstash/logging/quickstart/quickstart-ls-0")
+		if instance == nil || instance.TLSConfig == nil || !instance.TLSConfig.InsecureSkipVerify {
+			t.Errorf("expected the verification to be skipped, got %+v", instance)
+		}
+	})
+
+	t.Run("resolves a named target port against the container ports", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestECKLogstashHandler(manager, fake.NewSimpleClientset())
+		handler.resourceConfig.InsecureSkipVerify = true
+
+		_ = handler.logstashIndexers[0].Add(newTestECKLogstash(map[string]interface{}{}))
+		_ = handler.serviceIndexers[0].Add(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "logging",
+				Name:      "quickstart-ls-api",
+				Labels:    map[string]string{eckLogstashNameLabel: "quickstart"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "api", Port: 80, TargetPort: intstr.FromString("http-api")}}},
+		})
+		_ = handler.podIndexers[0].Add(newTestECKLogstashPod("quickstart-ls-0", "node-a"))
+		handler.reconcile(logstashName)
+
+		instance := manager.getInstance("logstash/logging/quickstart/quickstart-ls-0")
+		if instance == nil || instance.Host != "https://10.0.0.1:9600" {
+			t.Errorf("expected the instance on the named container port, got %+v", instance)
+		}
+	})
+
+	t.Run("uses http when the self-signed certificate is disabled", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestECKLogstashHandler(manager, fake.NewSimpleClientset())
+
+		_ = handler.logstashIndexers[0].Add(newTestECKLogstash(map[string]interface{}{
+			"config": map[string]interface{}{
+				"api.auth.type": "basic",
+				"api": map[string]interface{}{
+					"auth.basic": map[string]interface{}{"username": "monitoring", "password": "secret"},
+				},
+			},
+			"services": []interface{}{map[string]interface{}{
+				"name": "api",
+				"tls":  map[string]interface{}{"selfSignedCertificate": map[string]interface{}{"disabled": true}},
+			}},
+		}))
+		_ = handler.podIndexers[0].Add(newTestECKLogstashPod("quickstart-ls-0", "node-a"))
+		handler.reconcile(logstashName)
+
+		instance := manager.getInstance("logstash/logging/quickstart/quickstart-ls-0")
+		if instance == nil || instance.Host != "http://10.0.0.1:9600" {
+			t.Fatalf("expected the instance on the default port, got %+v", instance)
+		}
+		if instance.BasicAuth == nil || instance.BasicAuth.Username != "monitoring" || instance.BasicAuth.Password != "secret" {
+			t.Errorf("expected the credentials of the nested settings, got %+v", instance.BasicAuth)
+		}
+	})
+
+	t.Run("reads the credentials referencing the keystore from the secure settings", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash-api"},
+			Data:       map[string][]byte{"user": []byte("monitoring"), "password": []byte("secret")},
+		}, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "quickstart-ls-api-certs-public"},
+			Data:       map[string][]byte{"ca.crt": []byte("eck-ca")},
+		})
+		manager := newFakeInstanceManager()
+		handler := newTestECKLogstashHandler(manager, client)
+		t.Cleanup(handler.secrets.stop)
+
+		_ = handler.logstashIndexers[0].Add(newTestECKLogstash(map[string]interface{}{
+			"config": map[string]interface{}{
+				"api.auth.type":           "basic",
+				"api.auth.basic.username": "${API_USERNAME}",
+				"api.auth.basic.password": "${API_PASSWORD}",
+			},
+			"secureSettings": []interface{}{
+				map[string]interface{}{"secretName": "other-settings"},
+				map[string]interface{}{
+					"secretName": "logstash-api",
+					"entries": []interface{}{
+						map[string]interface{}{"key": "user", "path": "API_USERNAME"},
+						map[string]interface{}{"key": "password", "path": "API_PASSWORD"},
+					},
+				},
+			},
+		}))
+		_ = handler.podIndexers[0].Add(newTestECKLogstashPod("quickstart-ls-0", "node-a"))
+		handler.reconcile(logstashName)
+
+		instance := manager.waitForPassword(t, "logstash/logging/quickstart/quickstart-ls-0", "secret")
+		if instance.BasicAuth.Username != "monitoring" {
+			t.Errorf("expected the username of the secret, got %q", instance.BasicAuth.Username)
+		}
+	})
+
+	t.Run("removes the instances of a deleted logstash resource", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestECKLogstashHandler(manager, fake.NewSimpleClientset())
+
+		logstash := newTestECKLogstash(map[string]interface{}{})
+		_ = handler.logstashIndexers[0].Add(logstash)
+		_ = handler.podIndexers[0].Add(newTestECKLogstashPod("quickstart-ls-0", "node-a"))
+		handler.onObjectChange(logstash)
+
+		_ = handler.logstashIndexers[0].Delete(logstash)
+		handler.onObjectChange(cache.DeletedFinalStateUnknown{Key: "logging/quickstart", Obj: logstash})
+
+		if len(manager.instances) != 0 || len(handler.logstashInstances.instances) != 0 {
+			t.Errorf("expected the instances to be removed, got %v", manager.instances)
+		}
+	})
+}
+
+func TestResolveSecureSetting(t *testing.T) {
+	t.Parallel()
+
+	ref, err := resolveSecureSetting("logging", []eckSecretSource{{SecretName: "logstash-keystore"}}, "API_PASSWORD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref.secret.Name != "logstash-keystore" || ref.key != "API_PASSWORD" {
+		t.Errorf("expected the key of the only secret, got %+v", ref)
+	}
+
+	ambiguous := []eckSecretSource{{SecretName: "first"}, {SecretName: "second"}}
+	if _, err := resolveSecureSetting("logging", ambiguous, "API_PASSWORD"); err == nil {
+		t.Errorf("expected an error for a key of several secrets")
+	}
+}
@@ -0,0 +1,386 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"reflect"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// serviceNameIndex indexes the EndpointSlices by the namespaced name of their Service
+const serviceNameIndex = "serviceName"
+
+// EndpointSliceResourceHandler expands the selected Services into one instance per ready endpoint,
+// named "<namespace>/<service>/<pod>", so that every Logstash node behind a Service is scraped directly
+type EndpointSliceResourceHandler struct {
+	*BaseResourceHandler
+
+	serviceIndexers []cache.Indexer
+	sliceIndexers   []cache.Indexer
+
+	reconcileMu sync.Mutex
+	// serviceInstances are the instances of the endpoints of every Service, guarded by reconcileMu
+	serviceInstances *instanceGroups
+}
+
+// NewEndpointSliceResourceHandler creates a new EndpointSlice resource handler
+func NewEndpointSliceResourceHandler(
+	client kubernetes.Interface,
+	instances *shardedInstanceManager,
+	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
+) ResourceHandler {
+	return newEndpointSliceResourceHandler(
+		newBaseResourceHandler(
+			client,
+			instances,
+			kubeConfig,
+			kubeConfig.Resources.EndpointSlices,
+			secrets,
+			namespaces,
+		),
+	)
+}
+
+func newEndpointSliceResourceHandler(base *BaseResourceHandler) *EndpointSliceResourceHandler {
+	return &EndpointSliceResourceHandler{
+		BaseResourceHandler: base,
+		serviceInstances:    newInstanceGroups(base, "endpoint slice"),
+	}
+}
+
+// Name returns the name of the resource handler
+func (h *EndpointSliceResourceHandler) Name() string {
+	return "endpointslices"
+}
+
+// Start starts watching the services and their endpoint slices
+func (h *EndpointSliceResourceHandler) Start(ctx context.Context, namespaces []string) error {
+	if !h.resourceConfig.Enabled {
+		slog.Info("endpoint slice monitoring is disabled")
+		return nil
+	}
+
+	slog.Info("starting endpoint slice monitoring",
+		"annotationPrefix", h.resourceConfig.AnnotationPrefix,
+		"labelSelector", h.resourceConfig.LabelSelector,
+		"fieldSelector", h.resourceConfig.FieldSelector,
+		"portName", h.resourceConfig.PortName,
+		"namespaces", namespaces)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Create the informers of the services and their endpoint slices for each namespace
+	for _, namespace := range namespaces {
+		// the selectors select the services whose endpoints are monitored
+		serviceListWatcher := cache.NewFilteredListWatchFromClient(
+			h.client.CoreV1().RESTClient(),
+			"services",
+			namespace,
+			h.applySelectors,
+		)
+
+		serviceInformer := cache.NewSharedIndexInformer(
+			serviceListWatcher,
+			&corev1.Service{},
+			h.config.ResyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+
+		sliceListWatcher := cache.NewFilteredListWatchFromClient(
+			h.client.DiscoveryV1().RESTClient(),
+			"endpointslices",
+			namespace,
+			func(options *metav1.ListOptions) {
+				options.LabelSelector = discoveryv1.LabelServiceName
+			},
+		)
+
+		sliceInformer := cache.NewSharedIndexInformer(
+			sliceListWatcher,
+			&discoveryv1.EndpointSlice{},
+			h.config.ResyncPeriod,
+			cache.Indexers{serviceNameIndex: endpointSliceServiceIndexFunc},
+		)
+
+		_, err := serviceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.onObjectChange,
+			UpdateFunc: h.onServiceUpdate,
+			DeleteFunc: h.onObjectChange,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add event handler to service informer: %w", err)
+		}
+
+		_, err = sliceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.onObjectChange,
+			UpdateFunc: func(_, newObj interface{}) { h.onObjectChange(newObj) },
+			DeleteFunc: h.onObjectChange,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add event handler to endpoint slice informer: %w", err)
+		}
+
+		h.informers = append(h.informers, serviceInformer, sliceInformer)
+		h.stores = append(h.stores, serviceInformer.GetStore())
+		h.serviceIndexers = append(h.serviceIndexers, serviceInformer.GetIndexer())
+		h.sliceIndexers = append(h.sliceIndexers, sliceInformer.GetIndexer())
+	}
+
+	h.namespaces.subscribe(h.resyncServices)
+
+	// Start all informers
+	for _, informer := range h.informers {
+		go informer.Run(h.stopCh)
+	}
+
+	return nil
+}
+
+// endpointSliceServiceIndexFunc indexes an EndpointSlice by the namespaced name of its Service
+func endpointSliceServiceIndexFunc(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil, nil
+	}
+
+	serviceName, exists := slice.Labels[discoveryv1.LabelServiceName]
+	if !exists {
+		return nil, nil
+	}
+
+	return []string{types.NamespacedName{Namespace: slice.Namespace, Name: serviceName}.String()}, nil
+}
+
+// onServiceUpdate is called when a service is updated
+func (h *EndpointSliceResourceHandler) onServiceUpdate(oldObj, newObj interface{}) {
+	oldService, ok := oldObj.(*corev1.Service)
+	if !ok {
+		slog.Warn("unexpected type in service update event handler (old object)")
+		return
+	}
+
+	newService, ok := newObj.(*corev1.Service)
+	if !ok {
+		slog.Warn("unexpected type in service update event handler (new object)")
+		return
+	}
+
+	// Check if the annotations or the ports have changed
+	if reflect.DeepEqual(oldService.Annotations, newService.Annotations) &&
+		reflect.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports) {
+		return
+	}
+
+	h.onObjectChange(newService)
+}
+
+// onObjectChange reconciles the instances of the service of the changed service or endpoint slice
+func (h *EndpointSliceResourceHandler) onObjectChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	switch object := obj.(type) {
+	case *corev1.Service:
+		h.reconcile(types.NamespacedName{Namespace: object.Namespace, Name: object.Name})
+	case *discoveryv1.EndpointSlice:
+		serviceName, exists := object.Labels[discoveryv1.LabelServiceName]
+		if !exists {
+			return
+		}
+		h.reconcile(types.NamespacedName{Namespace: object.Namespace, Name: serviceName})
+	default:
+		slog.Warn("unexpected type in endpoint slice event handler")
+	}
+}
+
+// resyncServices reconciles the instances of the services of a namespace which was selected or unselected
+func (h *EndpointSliceResourceHandler) resyncServices(namespace string) {
+	services := make(map[types.NamespacedName]struct{})
+
+	h.reconcileMu.Lock()
+	for _, service := range h.serviceInstances.namespaceGroups(namespace) {
+		services[service] = struct{}{}
+	}
+	h.reconcileMu.Unlock()
+
+	h.mu.RLock()
+	for _, indexer := range h.serviceIndexers {
+		objects, _ := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		for _, obj := range objects {
+			if service, ok := obj.(*corev1.Service); ok {
+				services[types.NamespacedName{Namespace: service.Namespace, Name: service.Name}] = struct{}{}
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for service := range services {
+		h.reconcile(service)
+	}
+}
+
+// reconcile adds the new and changed instances of the ready endpoints of the service,
+// and removes the other instances of the service
+func (h *EndpointSliceResourceHandler) reconcile(serviceName types.NamespacedName) {
+	h.reconcileMu.Lock()
+	defer h.reconcileMu.Unlock()
+
+	h.serviceInstances.apply(serviceName, h.endpointInstances(serviceName))
+}
+
+// endpointInstances returns the instances of the ready endpoints of the service by their IDs
+func (h *EndpointSliceResourceHandler) endpointInstances(serviceName types.NamespacedName) map[string]endpointInstance {
+	service := h.getService(serviceName)
+	if service == nil || !h.namespaces.selected(service.Namespace) {
+		return nil
+	}
+
+	// the instance of the service holds the URL annotation and the credentials of its endpoints
+	_, serviceInstance, passwordRef, err := h.extractLogstashInfo(service.Annotations, service.Namespace, serviceName.String(), h.schemeURL())
+	if err != nil {
+		h.reconcileError("invalid logstash annotations", "instance", serviceName.String(), "err", err)
+		return nil
+	}
+	if serviceInstance == nil {
+		return nil
+	}
+
+	serviceURL, err := url.Parse(serviceInstance.Host)
+	if err != nil {
+		h.reconcileError("invalid logstash url", "instance", serviceName.String(), "url", serviceInstance.Host, "err", err)
+		return nil
+	}
+
+	instances := make(map[string]endpointInstance)
+	for _, slice := range h.getEndpointSlices(serviceName) {
+		port, found := h.endpointPort(slice, service, serviceURL)
+		if !found {
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			if len(endpoint.Addresses) == 0 || (endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready) {
+				continue
+			}
+
+			// the first address is used, as advised by the EndpointSlice API
+			endpointName := endpoint.Addresses[0]
+			object := objectReference("v1", "Service", service)
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				endpointName = endpoint.TargetRef.Name
+				object = &corev1.ObjectReference{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Namespace:  service.Namespace,
+					Name:       endpoint.TargetRef.Name,
+					UID:        endpoint.TargetRef.UID,
+				}
+			}
+			id := fmt.Sprintf("%s/%s", serviceName.String(), endpointName)
+
+			instance := *serviceInstance
+			instance.Name = id
+			instance.Host = (&url.URL{Scheme: serviceURL.Scheme, Host: net.JoinHostPort(endpoint.Addresses[0], port)}).String()
+			instances[id] = endpointInstance{instance: &instance, secretRefs: instanceSecretRefs{password: passwordRef}, object: object}
+		}
+	}
+
+	return instances
+}
+
+// endpointPort returns the port of the endpoints of the slice, which is the port with the configured name,
+// or the target port of the service port of the URL annotation, or the only port of the slice.
+// The port of the URL annotation is used as is if the service does not declare it.
+func (h *EndpointSliceResourceHandler) endpointPort(slice *discoveryv1.EndpointSlice, service *corev1.Service, serviceURL *url.URL) (string, bool) {
+	if h.resourceConfig.PortName != "" {
+		if port, found := slicePort(slice, h.resourceConfig.PortName); found {
+			return port, true
+		}
+	}
+
+	if serviceURL.Port() != "" {
+		// the endpoint slices name their ports after the ports of the service, whose target ports they resolve
+		for _, servicePort := range service.Spec.Ports {
+			if fmt.Sprint(servicePort.Port) == serviceURL.Port() {
+				return slicePort(slice, servicePort.Name)
+			}
+		}
+		return serviceURL.Port(), true
+	}
+
+	if len(slice.Ports) == 1 && slice.Ports[0].Port != nil {
+		return fmt.Sprint(*slice.Ports[0].Port), true
+	}
+
+	return "", false
+}
+
+// slicePort returns the port of the endpoint slice with the given name
+func slicePort(slice *discoveryv1.EndpointSlice, name string) (string, bool) {
+	for _, port := range slice.Ports {
+		// the name of the only port of a service may be empty
+		portName := ""
+		if port.Name != nil {
+			portName = *port.Name
+		}
+		if portName == name && port.Port != nil {
+			return fmt.Sprint(*port.Port), true
+		}
+	}
+	return "", false
+}
+
+// getService returns the service from the informers, or nil if it does not exist
+func (h *EndpointSliceResourceHandler) getService(serviceName types.NamespacedName) *corev1.Service {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, indexer := range h.serviceIndexers {
+		obj, exists, err := indexer.GetByKey(serviceName.String())
+		if err != nil || !exists {
+			continue
+		}
+		if service, ok := obj.(*corev1.Service); ok {
+			return service
+		}
+	}
+
+	return nil
+}
+
+// getEndpointSlices returns the endpoint slices of the service from the informers
+func (h *EndpointSliceResourceHandler) getEndpointSlices(serviceName types.NamespacedName) []*discoveryv1.EndpointSlice {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var slices []*discoveryv1.EndpointSlice
+	for _, indexer := range h.sliceIndexers {
+		objects, err := indexer.ByIndex(serviceNameIndex, serviceName.String())
+		if err != nil {
+			continue
+		}
+		for _, obj := range objects {
+			if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+				slices = append(slices, slice)
+			}
+		}
+	}
+
+	return slices
+}
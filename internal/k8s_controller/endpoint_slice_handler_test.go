@@ -0,0 +1,166 @@
+package k8s_controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestEndpointSliceHandler creates a handler with stores filled by the test instead of informers
+func newTestEndpointSliceHandler(manager *fakeInstanceManager) *EndpointSliceResourceHandler {
+	kubeConfig := newTestKubernetesConfig()
+	kubeConfig.Resources.EndpointSlices.PortName = "http-api"
+	kubeConfig.Resources.EndpointSlices.Scheme = "http"
+	client := fake.NewSimpleClientset()
+
+	handler := newEndpointSliceResourceHandler(newBaseResourceHandler(client, manager, kubeConfig,
+		kubeConfig.Resources.EndpointSlices, newSecretWatcher(client, manager, 0), nil))
+	handler.serviceIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	handler.sliceIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{serviceNameIndex: endpointSliceServiceIndexFunc})}
+
+	return handler
+}
+
+func newTestEndpoint(address, podName string, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{address},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: podName},
+	}
+}
+
+func newTestEndpointSlice(name string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	portName := "http-api"
+	port := int32(9600)
+
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "logging",
+			Name:      name,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "logstash"},
+		},
+		Ports:     []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+		Endpoints: endpoints,
+	}
+}
+
+func TestEndpointSliceResourceHandler(t *testing.T) {
+	t.Parallel()
+
+	serviceName := types.NamespacedName{Namespace: "logging", Name: "logstash"}
+
+	t.Run("adds one instance per ready endpoint of an annotated service", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestEndpointSliceHandler(manager)
+
+		_ = handler.serviceIndexers[0].Add(&corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "logging",
+			Name:        "logstash",
+			Annotations: map[string]string{"logstash-exporter.io/url": "https://logstash:9600"},
+		}})
+		_ = handler.sliceIndexers[0].Add(newTestEndpointSlice("logstash-abc",
+			newTestEndpoint("10.0.0.1", "logstash-0", true),
+			newTestEndpoint("10.0.0.2", "logstash-1", true),
+			newTestEndpoint("10.0.0.3", "logstash-2", false),
+		))
+		handler.reconcile(serviceName)
+
+		if len(manager.instances) != 2 {
+			t.Fatalf("expected the instances of the ready endpoints, got %v", manager.instances)
+		}
+		instance := manager.getInstance("logging/logstash/logstash-1")
+		if instance == nil || instance.Host != "https://10.0.0.2:9600" || instance.Name != "logging/logstash/logstash-1" {
+			t.Fatalf("expected the instance of the endpoint, got %+v", instance)
+		}
+		if instance.TLSConfig == nil {
+			t.Errorf("expected the tls configuration of the https service")
+		}
+
+		// the endpoints follow the readiness of the pods
+		_ = handler.sliceIndexers[0].Update(newTestEndpointSlice("logstash-abc",
+			newTestEndpoint("10.0.0.1", "logstash-0", false),
+			newTestEndpoint("10.0.0.3", "logstash-2", true),
+		))
+		handler.reconcile(serviceName)
+
+		if manager.getInstance("logging/logstash/logstash-0") != nil || manager.getInstance("logging/logstash/logstash-2") == nil {
+			t.Errorf("expected the instances to follow the readiness, got %v", manager.instances)
+		}
+	})
+
+	t.Run("uses the named port of services without annotations", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestEndpointSliceHandler(manager)
+
+		_ = handler.serviceIndexers[0].Add(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}})
+		_ = handler.sliceIndexers[0].Add(newTestEndpointSlice("logstash-abc", newTestEndpoint("10.0.0.1", "logstash-0", true)))
+		handler.reconcile(serviceName)
+
+		instance := manager.getInstance("logging/logstash/logstash-0")
+		if instance == nil || instance.Host != "http://10.0.0.1:9600" {
+			t.Fatalf("expected the instance of the named port, got %+v", instance)
+		}
+	})
+
+	t.Run("resolves the service port of the URL annotation to the port of the endpoints", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestEndpointSliceHandler(manager)
+		handler.resourceConfig.PortName = ""
+
+		_ = handler.serviceIndexers[0].Add(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "logging",
+				Name:        "logstash",
+				Annotations: map[string]string{"logstash-exporter.io/url": "http://logstash:80"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "beats", Port: 5044, TargetPort: intstr.FromInt32(5044)},
+				{Name: "http-api", Port: 80, TargetPort: intstr.FromInt32(9600)},
+			}},
+		})
+
+		slice := newTestEndpointSlice("logstash-abc", newTestEndpoint("10.0.0.1", "logstash-0", true))
+		beatsName, beatsPort := "beats", int32(5044)
+		slice.Ports = append(slice.Ports, discoveryv1.EndpointPort{Name: &beatsName, Port: &beatsPort})
+		_ = handler.sliceIndexers[0].Add(slice)
+		handler.reconcile(serviceName)
+
+		instance := manager.getInstance("logging/logstash/logstash-0")
+		if instance == nil || instance.Host != "http://10.0.0.1:9600" {
+			t.Fatalf("expected the instance of the target port, got %+v", instance)
+		}
+	})
+
+	t.Run("removes the instances of a deleted service", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestEndpointSliceHandler(manager)
+
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}}
+		_ = handler.serviceIndexers[0].Add(service)
+		_ = handler.sliceIndexers[0].Add(newTestEndpointSlice("logstash-abc", newTestEndpoint("10.0.0.1", "logstash-0", true)))
+		handler.reconcile(serviceName)
+
+		_ = handler.serviceIndexers[0].Delete(service)
+		handler.onObjectChange(service)
+
+		if len(manager.instances) != 0 || len(handler.serviceInstances.instances) != 0 {
+			t.Errorf("expected the instances to be removed, got %v", manager.instances)
+		}
+	})
+}
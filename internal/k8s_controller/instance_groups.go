@@ -0,0 +1,78 @@
+package k8s_controller
+
+import (
+	"log/slog"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// endpointInstance is the instance of an endpoint, with the references of its Secrets
+// and the object it was discovered from
+type endpointInstance struct {
+	instance   *config.LogstashInstance
+	secretRefs instanceSecretRefs
+	object     *corev1.ObjectReference
+}
+
+// instanceGroups tracks the instances expanded from a resource, such as the endpoints of a Service
+// or the pods of a StatefulSet, to add the new and changed instances and remove the instances that disappeared.
+// It is not safe for concurrent use.
+type instanceGroups struct {
+	handler *BaseResourceHandler
+	// source describes the expanded resources in the logs
+	source    string
+	instances map[types.NamespacedName]map[string]endpointInstance
+}
+
+func newInstanceGroups(handler *BaseResourceHandler, source string) *instanceGroups {
+	return &instanceGroups{
+		handler:   handler,
+		source:    source,
+		instances: make(map[types.NamespacedName]map[string]endpointInstance),
+	}
+}
+
+// apply adds the new and changed instances of the group, and removes its other instances
+func (g *instanceGroups) apply(group types.NamespacedName, desired map[string]endpointInstance) {
+	previous := g.instances[group]
+
+	for id, endpoint := range desired {
+		previousEndpoint, exists := previous[id]
+		if exists && reflect.DeepEqual(previousEndpoint, endpoint) {
+			continue
+		}
+		if !exists {
+			slog.Info("discovered logstash instance from "+g.source, "instance", id, "url", endpoint.instance.Host)
+		}
+		g.handler.addInstance(id, endpoint.instance, endpoint.secretRefs, endpoint.object)
+	}
+
+	for id := range previous {
+		if _, exists := desired[id]; !exists {
+			slog.Info("removing logstash instance", "instance", id)
+			g.handler.removeInstance(id)
+		}
+	}
+
+	if len(desired) == 0 {
+		delete(g.instances, group)
+		return
+	}
+	g.instances[group] = desired
+}
+
+// namespaceGroups returns the groups of the namespace with instances
+func (g *instanceGroups) namespaceGroups(namespace string) []types.NamespacedName {
+	var groups []types.NamespacedName
+	for group := range g.instances {
+		if group.Namespace == namespace {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
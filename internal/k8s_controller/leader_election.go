@@ -0,0 +1,144 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod running in the cluster
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// shardElection assigns the shards to the replicas with a Lease per shard.
+// Every replica tries the shards in turn until it acquires the Lease of one of them,
+// and monitors the instances of the shard while it holds it. The replicas without a shard
+// stand by, and take over the shard of a replica which stopped renewing its Lease.
+type shardElection struct {
+	client    kubernetes.Interface
+	config    config.LeaderElectionConfig
+	shards    int
+	namespace string
+	identity  string
+	instances *shardedInstanceManager
+}
+
+func newShardElection(client kubernetes.Interface, kubeConfig config.KubernetesConfig, instances *shardedInstanceManager) (*shardElection, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the hostname: %w", err)
+	}
+
+	namespace := kubeConfig.LeaderElection.LeaseNamespace
+	if namespace == "" {
+		namespace = podNamespace()
+	}
+
+	return &shardElection{
+		client:    client,
+		config:    kubeConfig.LeaderElection,
+		shards:    kubeConfig.Sharding.Shards,
+		namespace: namespace,
+		identity:  identity,
+		instances: instances,
+	}, nil
+}
+
+// podNamespace returns the namespace of the pod running the controller, or "default" outside the cluster
+func podNamespace() string {
+	if namespace, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(namespace))
+	}
+
+	return metav1.NamespaceDefault
+}
+
+// leaseName returns the name of the Lease of the shard
+func (e *shardElection) leaseName(shard int) string {
+	if e.shards <= 1 {
+		return e.config.LeaseName
+	}
+
+	return fmt.Sprintf("%s-%d", e.config.LeaseName, shard)
+}
+
+// run campaigns for the shards until the context is canceled, then releases the held Lease
+func (e *shardElection) run(ctx context.Context) {
+	// the replicas start with different shards, so that they do not all wait for the same Lease
+	first := shardOf(e.identity, e.shards)
+
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		shard := (first + attempt) % e.shards
+		if err := e.lead(ctx, shard); err != nil {
+			slog.Error("failed to run the leader election", "lease", e.leaseName(shard), "err", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(e.config.RetryPeriod):
+			}
+		}
+	}
+}
+
+// lead tries to acquire the Lease of the shard, and monitors the instances of the shard until it loses the Lease.
+// It gives up the shard if the Lease is held by another replica for longer than the Lease duration.
+func (e *shardElection) lead(ctx context.Context, shard int) error {
+	leaseName := e.leaseName(shard)
+	electionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	acquired := make(chan struct{})
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: e.namespace, Name: leaseName},
+			Client:     e.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: e.identity},
+		},
+		LeaseDuration:   e.config.LeaseDuration,
+		RenewDeadline:   e.config.RenewDeadline,
+		RetryPeriod:     e.config.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) { close(acquired) },
+			OnStoppedLeading: func() {},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// a Lease which is not renewed can be acquired after its duration
+	timer := time.AfterFunc(2*e.config.LeaseDuration, func() {
+		if !elector.IsLeader() {
+			cancel()
+		}
+	})
+	defer timer.Stop()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		elector.Run(electionCtx)
+	}()
+
+	select {
+	case <-stopped:
+	case <-acquired:
+		slog.Info("acquired the lease of the shard", "lease", leaseName, "shard", shard)
+		e.instances.setShard(shard)
+		<-stopped
+		e.instances.setShard(noShard)
+		slog.Info("stopped holding the lease of the shard", "lease", leaseName, "shard", shard)
+	}
+
+	return nil
+}
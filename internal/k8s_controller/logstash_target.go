@@ -0,0 +1,263 @@
+package k8s_controller
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	// defaultCAKey is the key of the certificate authority in the Secret referenced by a LogstashTarget,
+	// like in the Secrets of cert-manager
+	defaultCAKey = "ca.crt"
+
+	// logstashTargetIDPrefix prefixes the IDs of the instances of the targets, which are often named
+	// like the Service of their pods, so that they are not mistaken for the instances of the Service
+	logstashTargetIDPrefix = "logstashtarget"
+)
+
+// logstashTargetGVR is the resource of the LogstashTarget custom resources, defined in the chart
+var logstashTargetGVR = schema.GroupVersionResource{
+	Group:    "logstash-exporter.io",
+	Version:  "v1alpha1",
+	Resource: "logstashtargets",
+}
+
+// logstashTargetSpec is the spec of a LogstashTarget, declaring a Logstash instance by its URL,
+// or the pods of the namespace selected by their labels
+type logstashTargetSpec struct {
+	URL string `json:"url,omitempty"`
+
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// PortName is the name of the container port of the selected pods
+	PortName string `json:"portName,omitempty"`
+	// Scheme of the URLs of the selected pods, "http" by default
+	Scheme string `json:"scheme,omitempty"`
+
+	TLS       *logstashTargetTLS       `json:"tls,omitempty"`
+	BasicAuth *logstashTargetBasicAuth `json:"basicAuth,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+	// ScrapeInterval is the interval at which the target is reconciled and checked,
+	// the scrapeInterval of the controller by default
+	ScrapeInterval string `json:"scrapeInterval,omitempty"`
+
+	MetricFilter *logstashTargetMetricFilter `json:"metricFilter,omitempty"`
+}
+
+type logstashTargetTLS struct {
+	// CASecretRef references the certificate authority in a Secret of the namespace
+	CASecretRef        *logstashTargetSecretKey `json:"caSecretRef,omitempty"`
+	ServerName         string                   `json:"serverName,omitempty"`
+	InsecureSkipVerify bool                     `json:"insecureSkipVerify,omitempty"`
+}
+
+// logstashTargetBasicAuth references a Secret of the namespace with the username and password keys,
+// like the Secrets of the kubernetes.io/basic-auth type
+type logstashTargetBasicAuth struct {
+	SecretName string `json:"secretName"`
+}
+
+type logstashTargetSecretKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key,omitempty"`
+}
+
+type logstashTargetMetricFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// parseLogstashTargetSpec converts and validates the spec of the LogstashTarget
+func parseLogstashTargetSpec(target *unstructured.Unstructured) (*logstashTargetSpec, error) {
+	object, _, err := unstructured.NestedMap(target.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &logstashTargetSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object, spec); err != nil {
+		return nil, err
+	}
+
+	if (spec.URL == "") == (spec.Selector == nil) {
+		return nil, fmt.Errorf("exactly one of url and selector must be specified")
+	}
+
+	if spec.URL != "" {
+		instance := config.LogstashInstance{Host: spec.URL}
+		if err := instance.ValidateURL(); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Selector != nil {
+		if spec.PortName == "" {
+			return nil, fmt.Errorf("portName must be specified with the selector")
+		}
+		if _, err := metav1.LabelSelectorAsSelector(spec.Selector); err != nil {
+			return nil, fmt.Errorf("invalid selector: %w", err)
+		}
+	}
+
+	switch spec.Scheme {
+	case "":
+		spec.Scheme = "http"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unknown scheme %q, expected one of: http, https", spec.Scheme)
+	}
+
+	if spec.BasicAuth != nil && spec.BasicAuth.SecretName == "" {
+		return nil, fmt.Errorf("basicAuth.secretName must be specified")
+	}
+
+	if spec.TLS != nil && spec.TLS.CASecretRef != nil && spec.TLS.CASecretRef.Name == "" {
+		return nil, fmt.Errorf("tls.caSecretRef.name must be specified")
+	}
+
+	if err := config.ValidateLabels(spec.Labels); err != nil {
+		return nil, fmt.Errorf("invalid labels: %w", err)
+	}
+
+	if spec.ScrapeInterval != "" {
+		interval, err := time.ParseDuration(spec.ScrapeInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid scrapeInterval %q, expected a positive duration", spec.ScrapeInterval)
+		}
+	}
+
+	if spec.MetricFilter != nil {
+		if err := spec.metricFilterConfig().ValidateMetricFilter(); err != nil {
+			return nil, fmt.Errorf("invalid metricFilter: %w", err)
+		}
+	}
+
+	return spec, nil
+}
+
+// scrapeInterval returns the interval of the target, or the default interval if it has none
+func (spec *logstashTargetSpec) scrapeInterval(defaultInterval time.Duration) time.Duration {
+	if interval, err := time.ParseDuration(spec.ScrapeInterval); err == nil && interval > 0 {
+		return interval
+	}
+
+	return defaultInterval
+}
+
+func (spec *logstashTargetSpec) metricFilterConfig() *config.MetricFilterConfig {
+	if spec.MetricFilter == nil {
+		return nil
+	}
+
+	return &config.MetricFilterConfig{Include: spec.MetricFilter.Include, Exclude: spec.MetricFilter.Exclude}
+}
+
+// declaredInstances returns the instances declared by the LogstashTarget by their IDs, with the references
+// of the Secrets holding their credentials and certificate authority, applied by the secret watcher
+func (h *LogstashTargetResourceHandler) declaredInstances(target *unstructured.Unstructured, spec *logstashTargetSpec) (map[string]endpointInstance, error) {
+	namespace := target.GetNamespace()
+	template := config.LogstashInstance{
+		Labels:       spec.Labels,
+		MetricFilter: spec.metricFilterConfig(),
+	}
+
+	var secretRefs instanceSecretRefs
+	if spec.TLS != nil {
+		template.TLSConfig = &config.TLSClientConfig{
+			ServerName:         spec.TLS.ServerName,
+			InsecureSkipVerify: spec.TLS.InsecureSkipVerify,
+		}
+		if spec.TLS.CASecretRef != nil {
+			key := spec.TLS.CASecretRef.Key
+			if key == "" {
+				key = defaultCAKey
+			}
+			secretRefs.ca = &secretKeyRef{
+				secret: types.NamespacedName{Namespace: namespace, Name: spec.TLS.CASecretRef.Name},
+				key:    key,
+			}
+		}
+	}
+
+	if spec.BasicAuth != nil {
+		secretRefs.password = &secretKeyRef{
+			secret:      types.NamespacedName{Namespace: namespace, Name: spec.BasicAuth.SecretName},
+			key:         corev1.BasicAuthPasswordKey,
+			usernameKey: corev1.BasicAuthUsernameKey,
+		}
+	}
+
+	instances := make(map[string]endpointInstance)
+	if spec.URL != "" {
+		id := fmt.Sprintf("%s/%s/%s", logstashTargetIDPrefix, namespace, target.GetName())
+		instance := template
+		instance.Name = id
+		instance.Host = spec.URL
+		instances[id] = endpointInstance{instance: &instance, secretRefs: secretRefs, object: logstashTargetReference(target)}
+		return instances, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range h.getPods(namespace, selector) {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		port, found := containerPort(pod, spec.PortName)
+		if !found {
+			continue
+		}
+
+		id := fmt.Sprintf("%s/%s/%s/%s", logstashTargetIDPrefix, namespace, target.GetName(), pod.Name)
+		instance := template
+		instance.Name = id
+		instance.Host = (&url.URL{Scheme: spec.Scheme, Host: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port)))}).String()
+		instances[id] = endpointInstance{instance: &instance, secretRefs: secretRefs, object: objectReference("v1", "Pod", pod)}
+	}
+
+	return instances, nil
+}
+
+// logstashTargetReference returns the reference of the LogstashTarget, on which the events of its URL are reported
+func logstashTargetReference(target *unstructured.Unstructured) *corev1.ObjectReference {
+	return objectReference(target.GetAPIVersion(), target.GetKind(), target)
+}
+
+// getPods returns the pods of the namespace matching the selector from the informers
+func (h *LogstashTargetResourceHandler) getPods(namespace string, selector labels.Selector) []*corev1.Pod {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var pods []*corev1.Pod
+	for _, indexer := range h.podIndexers {
+		objects, err := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			continue
+		}
+		for _, obj := range objects {
+			if pod, ok := obj.(*corev1.Pod); ok && selector.Matches(labels.Set(pod.Labels)) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	return pods
+}
@@ -0,0 +1,440 @@
+package k8s_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// LogstashTargetResourceHandler monitors the instances declared by the LogstashTarget custom resources.
+// Every target is reconciled at its scrape interval: its instances are updated in the collector manager,
+// checked, and the result is reported in the status of the target by the replica of its shard.
+// The instances are named "logstashtarget/<namespace>/<target>", or "logstashtarget/<namespace>/<target>/<pod>"
+// for the selected pods.
+type LogstashTargetResourceHandler struct {
+	*BaseResourceHandler
+
+	dynamicClient dynamic.Interface
+	// probeTimeout bounds the check of every instance of a target
+	probeTimeout time.Duration
+	// ownsStatus returns true if the replica checks the target and reports its status,
+	// so that a single replica of the sharded controller writes it
+	ownsStatus func(target string) bool
+
+	targetIndexers []cache.Indexer
+	// podIndexers hold the pods of the watched namespaces, selected by the targets
+	podIndexers []cache.Indexer
+
+	reconcileMu sync.Mutex
+	// targetInstances are the instances of every target, guarded by reconcileMu
+	targetInstances *instanceGroups
+
+	loopsMu sync.Mutex
+	// ctx is canceled when the handler is stopped, ending the loops of the targets
+	ctx   context.Context
+	loops map[types.NamespacedName]*targetLoop
+}
+
+// targetLoop reconciles a target at its interval, and when it is triggered
+type targetLoop struct {
+	interval time.Duration
+	trigger  chan struct{}
+	cancel   context.CancelFunc
+}
+
+// NewLogstashTargetResourceHandler creates a new LogstashTarget resource handler
+func NewLogstashTargetResourceHandler(
+	client kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	instances *shardedInstanceManager,
+	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
+) ResourceHandler {
+	handler := newLogstashTargetResourceHandler(
+		newBaseResourceHandler(
+			client,
+			instances,
+			kubeConfig,
+			kubeConfig.Resources.LogstashTargets,
+			secrets,
+			namespaces,
+		),
+		dynamicClient,
+	)
+	handler.ownsStatus = instances.owns
+
+	return handler
+}
+
+func newLogstashTargetResourceHandler(base *BaseResourceHandler, dynamicClient dynamic.Interface) *LogstashTargetResourceHandler {
+	return &LogstashTargetResourceHandler{
+		BaseResourceHandler: base,
+		dynamicClient:       dynamicClient,
+		probeTimeout:        defaultProbeTimeout,
+		ownsStatus:          func(string) bool { return true },
+		targetInstances:     newInstanceGroups(base, "logstash target"),
+		ctx:                 context.Background(),
+		loops:               make(map[types.NamespacedName]*targetLoop),
+	}
+}
+
+// Name returns the name of the resource handler
+func (h *LogstashTargetResourceHandler) Name() string {
+	return "logstashtargets"
+}
+
+// Start starts watching the LogstashTargets
+func (h *LogstashTargetResourceHandler) Start(ctx context.Context, namespaces []string) error {
+	if !h.resourceConfig.Enabled {
+		slog.Info("logstash target monitoring is disabled")
+		return nil
+	}
+
+	slog.Info("starting logstash target monitoring",
+		"labelSelector", h.resourceConfig.LabelSelector,
+		"fieldSelector", h.resourceConfig.FieldSelector,
+		"namespaces", namespaces)
+
+	loopsCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-h.stopCh
+		cancel()
+	}()
+
+	h.loopsMu.Lock()
+	h.ctx = loopsCtx
+	h.loopsMu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Create an informer of the targets for each namespace
+	for _, namespace := range namespaces {
+		informer := dynamicinformer.NewFilteredDynamicInformer(
+			h.dynamicClient,
+			logstashTargetGVR,
+			namespace,
+			h.config.ResyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			h.applySelectors,
+		).Informer()
+
+		_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.onTargetChange,
+			UpdateFunc: h.onTargetUpdate,
+			DeleteFunc: h.onTargetChange,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add event handler to logstash target informer: %w", err)
+		}
+
+		h.informers = append(h.informers, informer)
+		h.stores = append(h.stores, informer.GetStore())
+		h.targetIndexers = append(h.targetIndexers, informer.GetIndexer())
+
+		// The pods are shared by the targets of the namespace, and are not resynced as resources
+		podInformer := cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(h.client.CoreV1().RESTClient(), "pods", namespace, nil),
+			&corev1.Pod{},
+			h.config.ResyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+
+		_, err = podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.onPodChange,
+			UpdateFunc: func(_, newObj interface{}) { h.onPodChange(newObj) },
+			DeleteFunc: h.onPodChange,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add event handler to logstash target pod informer: %w", err)
+		}
+
+		h.informers = append(h.informers, podInformer)
+		h.podIndexers = append(h.podIndexers, podInformer.GetIndexer())
+	}
+
+	h.namespaces.subscribe(func(namespace string) {
+		h.resyncNamespace(namespace, h.onTargetChange)
+	})
+
+	// Start all informers
+	for _, informer := range h.informers {
+		go informer.Run(h.stopCh)
+	}
+
+	return nil
+}
+
+// onTargetUpdate reconciles a target when its spec changes. The updates of its status,
+// which do not change its generation, are ignored.
+func (h *LogstashTargetResourceHandler) onTargetUpdate(oldObj, newObj interface{}) {
+	oldTarget, err := meta.Accessor(oldObj)
+	if err != nil {
+		slog.Warn("unexpected type in logstash target update event handler (old object)")
+		return
+	}
+
+	newTarget, err := meta.Accessor(newObj)
+	if err != nil {
+		slog.Warn("unexpected type in logstash target update event handler (new object)")
+		return
+	}
+
+	if oldTarget.GetGeneration() == newTarget.GetGeneration() {
+		return
+	}
+
+	h.onTargetChange(newObj)
+}
+
+// onTargetChange starts, restarts or triggers the loop of an added or changed target,
+// and stops the loop of a deleted target
+func (h *LogstashTargetResourceHandler) onTargetChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		slog.Warn("unexpected type in logstash target event handler")
+		return
+	}
+
+	targetName := types.NamespacedName{Namespace: object.GetNamespace(), Name: object.GetName()}
+	target := h.getTarget(targetName)
+	if target == nil {
+		h.stopLoop(targetName)
+		h.reconcileMu.Lock()
+		h.targetInstances.apply(targetName, nil)
+		h.reconcileMu.Unlock()
+		return
+	}
+
+	interval := h.config.ScrapeInterval
+	if spec, err := parseLogstashTargetSpec(target); err == nil {
+		interval = spec.scrapeInterval(interval)
+	}
+
+	h.ensureLoop(targetName, interval)
+}
+
+// onPodChange triggers the loops of the targets of the namespace selecting the pod
+func (h *LogstashTargetResourceHandler) onPodChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		slog.Warn("unexpected type in logstash target pod event handler")
+		return
+	}
+
+	for _, target := range h.getTargets(pod.Namespace) {
+		spec, err := parseLogstashTargetSpec(target)
+		if err != nil || spec.Selector == nil {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		h.triggerLoop(types.NamespacedName{Namespace: target.GetNamespace(), Name: target.GetName()})
+	}
+}
+
+// triggerLoop triggers the loop of the target, if it is running
+func (h *LogstashTargetResourceHandler) triggerLoop(targetName types.NamespacedName) {
+	h.loopsMu.Lock()
+	defer h.loopsMu.Unlock()
+
+	if loop, exists := h.loops[targetName]; exists {
+		select {
+		case loop.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ensureLoop starts the loop of the target, restarts it if its interval changed, or triggers it
+func (h *LogstashTargetResourceHandler) ensureLoop(targetName types.NamespacedName, interval time.Duration) {
+	h.loopsMu.Lock()
+	defer h.loopsMu.Unlock()
+
+	if loop, exists := h.loops[targetName]; exists {
+		if loop.interval == interval {
+			select {
+			case loop.trigger <- struct{}{}:
+			default:
+			}
+			return
+		}
+		loop.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	loop := &targetLoop{interval: interval, trigger: make(chan struct{}, 1), cancel: cancel}
+	h.loops[targetName] = loop
+
+	go func() {
+		if interval <= 0 {
+			interval = config.DefaultKubernetesConfig().ScrapeInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			h.sync(ctx, targetName)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-loop.trigger:
+			}
+		}
+	}()
+}
+
+// stopLoop stops the loop of a deleted target
+func (h *LogstashTargetResourceHandler) stopLoop(targetName types.NamespacedName) {
+	h.loopsMu.Lock()
+	defer h.loopsMu.Unlock()
+
+	if loop, exists := h.loops[targetName]; exists {
+		loop.cancel()
+		delete(h.loops, targetName)
+	}
+}
+
+// sync reconciles the instances of the target, checks them and reports the result in the status of the target
+func (h *LogstashTargetResourceHandler) sync(ctx context.Context, targetName types.NamespacedName) {
+	target := h.getTarget(targetName)
+	if target == nil || !h.namespaces.selected(targetName.Namespace) {
+		h.reconcileMu.Lock()
+		h.targetInstances.apply(targetName, nil)
+		h.reconcileMu.Unlock()
+		return
+	}
+
+	var instances map[string]endpointInstance
+	spec, err := parseLogstashTargetSpec(target)
+	if err != nil {
+		err = &invalidSpecError{err: err}
+	} else {
+		instances, err = h.declaredInstances(target, spec)
+	}
+	if err != nil {
+		h.reconcileError("failed to reconcile logstash target", "target", targetName.String(), "err", err)
+	}
+
+	// the previous instances are kept if the Secrets or the pods can not be read
+	var invalidSpec *invalidSpecError
+	if err == nil || errors.As(err, &invalidSpec) {
+		h.reconcileMu.Lock()
+		// the target may have been deleted, and its instances removed, since it was read
+		if h.getTarget(targetName) == nil {
+			h.targetInstances.apply(targetName, nil)
+			h.reconcileMu.Unlock()
+			return
+		}
+		h.targetInstances.apply(targetName, instances)
+		h.reconcileMu.Unlock()
+	}
+
+	if !h.ownsStatus(targetName.String()) {
+		return
+	}
+
+	status := h.targetStatus(ctx, target, instances, err)
+	if err := h.updateStatus(ctx, target, status); err != nil {
+		h.reconcileError("failed to update the status of logstash target", "target", targetName.String(), "err", err)
+	}
+}
+
+// invalidSpecError is returned for a LogstashTarget with an invalid spec
+type invalidSpecError struct {
+	err error
+}
+
+func (e *invalidSpecError) Error() string {
+	return e.err.Error()
+}
+
+// getTarget returns the LogstashTarget from the informers, or nil if it does not exist
+func (h *LogstashTargetResourceHandler) getTarget(targetName types.NamespacedName) *unstructured.Unstructured {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, indexer := range h.targetIndexers {
+		obj, exists, err := indexer.GetByKey(targetName.String())
+		if err != nil || !exists {
+			continue
+		}
+		if target, ok := obj.(*unstructured.Unstructured); ok {
+			return target
+		}
+	}
+
+	return nil
+}
+
+// getTargets returns the LogstashTargets of the namespace from the informers
+func (h *LogstashTargetResourceHandler) getTargets(namespace string) []*unstructured.Unstructured {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var targets []*unstructured.Unstructured
+	for _, indexer := range h.targetIndexers {
+		objects, err := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			continue
+		}
+		for _, obj := range objects {
+			if target, ok := obj.(*unstructured.Unstructured); ok {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	return targets
+}
+
+// updateStatus writes the status of the target, unless it is unchanged
+func (h *LogstashTargetResourceHandler) updateStatus(ctx context.Context, target *unstructured.Unstructured, status *logstashTargetStatus) error {
+	object, err := status.toUnstructured()
+	if err != nil {
+		return err
+	}
+
+	current, _, _ := unstructured.NestedMap(target.Object, "status")
+	if equalStatus(current, object) {
+		return nil
+	}
+
+	updated := target.DeepCopy()
+	updated.Object["status"] = object
+
+	_, err = h.dynamicClient.Resource(logstashTargetGVR).Namespace(target.GetNamespace()).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,330 @@
+package k8s_controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestLogstashTargetHandler creates a handler with the target in a fake dynamic client,
+// and in an indexer filled by the test instead of an informer, like the pods
+func newTestLogstashTargetHandler(t *testing.T, manager *fakeInstanceManager, client *fake.Clientset, target *unstructured.Unstructured, pods ...*corev1.Pod) *LogstashTargetResourceHandler {
+	kubeConfig := newTestKubernetesConfig()
+	kubeConfig.Resources.LogstashTargets.Enabled = true
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{logstashTargetGVR: "LogstashTargetList"}, target)
+
+	handler := newLogstashTargetResourceHandler(newBaseResourceHandler(client, manager, kubeConfig,
+		kubeConfig.Resources.LogstashTargets, newSecretWatcher(client, manager, 0), nil), dynamicClient)
+	handler.probeTimeout = 200 * time.Millisecond
+	handler.targetIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	_ = handler.targetIndexers[0].Add(target)
+	handler.podIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	for _, pod := range pods {
+		_ = handler.podIndexers[0].Add(pod)
+	}
+	t.Cleanup(handler.secrets.stop)
+
+	return handler
+}
+
+func newTestLogstashTarget(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "logstash-exporter.io/v1alpha1",
+		"kind":       "LogstashTarget",
+		"metadata":   map[string]interface{}{"namespace": "logging", "name": "ingest", "generation": int64(1)},
+		"spec":       spec,
+	}}
+}
+
+// newTestLogstashServer serves the node info of the version to the requests with the credentials
+func newTestLogstashServer(t *testing.T, version string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "monitoring" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"host":"logstash","version":"` + version + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestBasicAuthSecret(password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash-api"},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("monitoring"),
+			corev1.BasicAuthPasswordKey: []byte(password),
+		},
+	}
+}
+
+// syncTestTarget reconciles the target, and returns the conditions of its status written to the dynamic client
+func syncTestTarget(t *testing.T, handler *LogstashTargetResourceHandler) (map[string]interface{}, []metav1.Condition) {
+	t.Helper()
+
+	ctx := context.Background()
+	handler.sync(ctx, types.NamespacedName{Namespace: "logging", Name: "ingest"})
+
+	target, err := handler.dynamicClient.Resource(logstashTargetGVR).Namespace("logging").Get(ctx, "ingest", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	object, found, _ := unstructured.NestedMap(target.Object, "status")
+	if !found {
+		t.Fatalf("expected the status of the target to be updated")
+	}
+
+	status := &logstashTargetStatus{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object, status); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return object, status.Conditions
+}
+
+func expectCondition(t *testing.T, conditions []metav1.Condition, conditionType string, expected metav1.ConditionStatus) {
+	t.Helper()
+
+	condition := meta.FindStatusCondition(conditions, conditionType)
+	if condition == nil || condition.Status != expected {
+		t.Errorf("expected the %s condition to be %s, got %+v", conditionType, expected, condition)
+	}
+}
+
+func TestLogstashTargetResourceHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("monitors the url with the credentials of the secret and reports it reachable", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "8.15.0")
+		manager := newFakeInstanceManager()
+		handler := newTestLogstashTargetHandler(t, manager, fake.NewSimpleClientset(newTestBasicAuthSecret("secret")),
+			newTestLogstashTarget(map[string]interface{}{
+				"url":          server.URL,
+				"basicAuth":    map[string]interface{}{"secretName": "logstash-api"},
+				"labels":       map[string]interface{}{"team": "ingest"},
+				"metricFilter": map[string]interface{}{"exclude": []interface{}{".*_plugin_.*"}},
+			}))
+
+		status, conditions := syncTestTarget(t, handler)
+
+		instance := manager.getInstance("logstashtarget/logging/ingest")
+		if instance == nil || instance.Host != server.URL || instance.BasicAuth == nil || instance.BasicAuth.Password != "secret" {
+			t.Fatalf("expected the instance of the url with the credentials, got %+v", instance)
+		}
+		if instance.Labels["team"] != "ingest" || instance.MetricFilter == nil || len(instance.MetricFilter.Exclude) != 1 {
+			t.Errorf("expected the labels and the metric filter of the target, got %+v", instance)
+		}
+
+		expectCondition(t, conditions, conditionReachable, metav1.ConditionTrue)
+		expectCondition(t, conditions, conditionAuthFailed, metav1.ConditionFalse)
+		expectCondition(t, conditions, conditionVersionUnsupported, metav1.ConditionFalse)
+		if status["version"] != "8.15.0" {
+			t.Errorf("expected the version of the instance, got %v", status["version"])
+		}
+	})
+
+	t.Run("reports the rejected credentials", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "8.15.0")
+		handler := newTestLogstashTargetHandler(t, newFakeInstanceManager(), fake.NewSimpleClientset(newTestBasicAuthSecret("wrong")),
+			newTestLogstashTarget(map[string]interface{}{
+				"url":       server.URL,
+				"basicAuth": map[string]interface{}{"secretName": "logstash-api"},
+			}))
+
+		_, conditions := syncTestTarget(t, handler)
+
+		expectCondition(t, conditions, conditionReachable, metav1.ConditionTrue)
+		expectCondition(t, conditions, conditionAuthFailed, metav1.ConditionTrue)
+		expectCondition(t, conditions, conditionVersionUnsupported, metav1.ConditionUnknown)
+	})
+
+	t.Run("reports an unsupported version", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "6.8.23")
+		handler := newTestLogstashTargetHandler(t, newFakeInstanceManager(), fake.NewSimpleClientset(newTestBasicAuthSecret("secret")),
+			newTestLogstashTarget(map[string]interface{}{
+				"url":       server.URL,
+				"basicAuth": map[string]interface{}{"secretName": "logstash-api"},
+			}))
+
+		_, conditions := syncTestTarget(t, handler)
+
+		expectCondition(t, conditions, conditionVersionUnsupported, metav1.ConditionTrue)
+	})
+
+	t.Run("monitors the running pods matching the selector", func(t *testing.T) {
+		t.Parallel()
+
+		selected := newTestPod("logging", "logstash-0", nil)
+		selected.Labels = map[string]string{"app": "logstash"}
+		pending := newTestPod("logging", "logstash-1", nil)
+		pending.Labels = map[string]string{"app": "logstash"}
+		pending.Status.Phase = corev1.PodPending
+		other := newTestPod("logging", "other-0", nil)
+
+		manager := newFakeInstanceManager()
+		handler := newTestLogstashTargetHandler(t, manager, fake.NewSimpleClientset(),
+			newTestLogstashTarget(map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "logstash"}},
+				"portName": "http-api",
+				"scheme":   "https",
+			}), selected, pending, other)
+
+		handler.sync(context.Background(), types.NamespacedName{Namespace: "logging", Name: "ingest"})
+
+		instance := manager.getInstance("logstashtarget/logging/ingest/logstash-0")
+		if instance == nil || instance.Host != "https://10.0.0.1:9600" {
+			t.Fatalf("expected the instance of the selected pod, got %+v", instance)
+		}
+		if len(manager.instances) != 1 {
+			t.Errorf("expected only the running selected pod, got %v", manager.instances)
+		}
+	})
+
+	t.Run("reports an invalid spec without instances", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestLogstashTargetHandler(t, manager, fake.NewSimpleClientset(),
+			newTestLogstashTarget(map[string]interface{}{"selector": map[string]interface{}{}}))
+
+		_, conditions := syncTestTarget(t, handler)
+
+		condition := meta.FindStatusCondition(conditions, conditionReachable)
+		if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != "InvalidSpec" {
+			t.Errorf("expected the target to be reported invalid, got %+v", condition)
+		}
+		if len(manager.instances) != 0 {
+			t.Errorf("expected no instances, got %v", manager.instances)
+		}
+	})
+
+	t.Run("removes the instances of a deleted target", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "8.15.0")
+		manager := newFakeInstanceManager()
+		target := newTestLogstashTarget(map[string]interface{}{"url": server.URL})
+		handler := newTestLogstashTargetHandler(t, manager, fake.NewSimpleClientset(), target)
+		handler.sync(context.Background(), types.NamespacedName{Namespace: "logging", Name: "ingest"})
+
+		_ = handler.targetIndexers[0].Delete(target)
+		handler.onTargetChange(cache.DeletedFinalStateUnknown{Key: "logging/ingest", Obj: target})
+
+		if len(manager.instances) != 0 {
+			t.Errorf("expected the instances to be removed, got %v", manager.instances)
+		}
+	})
+
+	t.Run("does not share the instances of the endpoint slices of the service of the same name", func(t *testing.T) {
+		t.Parallel()
+
+		pod := newTestPod("logging", "logstash-0", nil)
+		pod.Labels = map[string]string{"app": "logstash"}
+		target := newTestLogstashTarget(map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "logstash"}},
+			"portName": "http-api",
+		})
+		target.SetName("logstash")
+
+		manager := newFakeInstanceManager()
+		targetHandler := newTestLogstashTargetHandler(t, manager, fake.NewSimpleClientset(), target, pod)
+		targetHandler.ownsStatus = func(string) bool { return false }
+		targetName := types.NamespacedName{Namespace: "logging", Name: "logstash"}
+		targetHandler.sync(context.Background(), targetName)
+
+		sliceHandler := newTestEndpointSliceHandler(manager)
+		_ = sliceHandler.serviceIndexers[0].Add(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}})
+		_ = sliceHandler.sliceIndexers[0].Add(newTestEndpointSlice("logstash-abc", newTestEndpoint("10.0.0.1", "logstash-0", true)))
+		sliceHandler.reconcile(targetName)
+
+		if len(manager.instances) != 2 {
+			t.Fatalf("expected an instance of each handler, got %v", manager.instances)
+		}
+
+		_ = targetHandler.targetIndexers[0].Delete(target)
+		targetHandler.sync(context.Background(), targetName)
+
+		if manager.getInstance("logstashtarget/logging/logstash/logstash-0") != nil || manager.getInstance("logging/logstash/logstash-0") == nil {
+			t.Errorf("expected only the instance of the target to be removed, got %v", manager.instances)
+		}
+	})
+
+	t.Run("does not add the instances of a target deleted while it is reconciled", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "8.15.0")
+		manager := newFakeInstanceManager()
+		target := newTestLogstashTarget(map[string]interface{}{"url": server.URL})
+		handler := newTestLogstashTargetHandler(t, manager, fake.NewSimpleClientset(), target)
+
+		// the target is read by the reconciliation, which waits for the deletion to be handled
+		handler.reconcileMu.Lock()
+		done := make(chan struct{})
+		go func() {
+			handler.sync(context.Background(), types.NamespacedName{Namespace: "logging", Name: "ingest"})
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		_ = handler.targetIndexers[0].Delete(target)
+		handler.targetInstances.apply(types.NamespacedName{Namespace: "logging", Name: "ingest"}, nil)
+		handler.reconcileMu.Unlock()
+		<-done
+
+		if len(manager.instances) != 0 {
+			t.Errorf("expected no instances of the deleted target, got %v", manager.instances)
+		}
+	})
+
+	t.Run("triggers the targets selecting a changed pod", func(t *testing.T) {
+		t.Parallel()
+
+		target := newTestLogstashTarget(map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "logstash"}},
+			"portName": "http-api",
+		})
+		handler := newTestLogstashTargetHandler(t, newFakeInstanceManager(), fake.NewSimpleClientset(), target)
+		targetName := types.NamespacedName{Namespace: "logging", Name: "ingest"}
+		loop := &targetLoop{trigger: make(chan struct{}, 1), cancel: func() {}}
+		handler.loops[targetName] = loop
+
+		other := newTestPod("logging", "other-0", nil)
+		handler.onPodChange(other)
+		if len(loop.trigger) != 0 {
+			t.Fatalf("expected the target not to be triggered by a pod it does not select")
+		}
+
+		selected := newTestPod("logging", "logstash-0", nil)
+		selected.Labels = map[string]string{"app": "logstash"}
+		handler.onPodChange(cache.DeletedFinalStateUnknown{Key: "logging/logstash-0", Obj: selected})
+		if len(loop.trigger) != 1 {
+			t.Errorf("expected the target to be triggered by the deleted pod it selects")
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package k8s_controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+	customtls "github.com/kuskoman/logstash-exporter/pkg/tls"
+)
+
+const (
+	defaultProbeTimeout = 10 * time.Second
+
+	// minimumLogstashMajorVersion is the oldest major version of Logstash with the monitoring APIs read by the exporter
+	minimumLogstashMajorVersion = 7
+
+	// the conditions reported in the status of a LogstashTarget
+	conditionReachable          = "Reachable"
+	conditionAuthFailed         = "AuthFailed"
+	conditionVersionUnsupported = "VersionUnsupported"
+)
+
+// logstashTargetStatus is the status of a LogstashTarget
+type logstashTargetStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Instances          int                `json:"instances"`
+	ReachableInstances int                `json:"reachableInstances"`
+	Version            string             `json:"version,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+func (status *logstashTargetStatus) toUnstructured() (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+}
+
+// equalStatus compares the statuses after a JSON round trip, which normalizes the numbers and the times
+func equalStatus(current, desired map[string]interface{}) bool {
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return false
+	}
+	desiredJSON, err := json.Marshal(desired)
+	if err != nil {
+		return false
+	}
+
+	var currentValue, desiredValue interface{}
+	_ = json.Unmarshal(currentJSON, &currentValue)
+	_ = json.Unmarshal(desiredJSON, &desiredValue)
+	return reflect.DeepEqual(currentValue, desiredValue)
+}
+
+// probeResult is the result of the check of an instance
+type probeResult struct {
+	reachable  bool
+	authFailed bool
+	version    string
+	err        error
+}
+
+// targetStatus checks the instances of the target, and returns its status with the conditions
+// updated from its current status, so that their transition times only change with their status
+func (h *LogstashTargetResourceHandler) targetStatus(ctx context.Context, target *unstructured.Unstructured, instances map[string]endpointInstance, reconcileErr error) *logstashTargetStatus {
+	status := &logstashTargetStatus{}
+	if current, found, _ := unstructured.NestedMap(target.Object, "status"); found {
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(current, status)
+	}
+
+	status.ObservedGeneration = target.GetGeneration()
+	status.Instances = len(instances)
+	status.ReachableInstances = 0
+	status.Version = ""
+
+	setCondition := func(conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			ObservedGeneration: status.ObservedGeneration,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+	setNotChecked := func(reason, message string) {
+		setCondition(conditionReachable, metav1.ConditionFalse, reason, message)
+		setCondition(conditionAuthFailed, metav1.ConditionUnknown, reason, message)
+		setCondition(conditionVersionUnsupported, metav1.ConditionUnknown, reason, message)
+	}
+
+	var invalidSpec *invalidSpecError
+	switch {
+	case errors.As(reconcileErr, &invalidSpec):
+		setNotChecked("InvalidSpec", reconcileErr.Error())
+		return status
+	case reconcileErr != nil:
+		setNotChecked("ReconcileFailed", reconcileErr.Error())
+		return status
+	case len(instances) == 0:
+		setNotChecked("NoInstances", "no running pod matches the selector")
+		return status
+	}
+
+	results := h.probeInstances(ctx, instances)
+
+	var failures []string
+	var unauthorized []string
+	var unsupported []string
+	versions := make(map[string]bool)
+	for id, result := range results {
+		if result.reachable {
+			status.ReachableInstances++
+		} else {
+			failures = append(failures, fmt.Sprintf("%s: %v", id, result.err))
+		}
+		if result.authFailed {
+			unauthorized = append(unauthorized, id)
+		}
+		if result.version != "" {
+			versions[result.version] = true
+			if !isSupportedLogstashVersion(result.version) {
+				unsupported = append(unsupported, fmt.Sprintf("%s: %s", id, result.version))
+			}
+		}
+	}
+
+	var versionList []string
+	for version := range versions {
+		versionList = append(versionList, version)
+	}
+	sort.Strings(versionList)
+	sort.Strings(failures)
+	sort.Strings(unauthorized)
+	sort.Strings(unsupported)
+	status.Version = strings.Join(versionList, ",")
+
+	if len(failures) == 0 {
+		setCondition(conditionReachable, metav1.ConditionTrue, "Reachable",
+			fmt.Sprintf("%d of %d instances are reachable", status.ReachableInstances, status.Instances))
+	} else {
+		setCondition(conditionReachable, metav1.ConditionFalse, "Unreachable", strings.Join(failures, "; "))
+	}
+
+	if len(unauthorized) == 0 {
+		setCondition(conditionAuthFailed, metav1.ConditionFalse, "Authorized", "")
+	} else {
+		setCondition(conditionAuthFailed, metav1.ConditionTrue, "Unauthorized",
+			"the credentials were rejected by "+strings.Join(unauthorized, ", "))
+	}
+
+	switch {
+	case len(unsupported) > 0:
+		setCondition(conditionVersionUnsupported, metav1.ConditionTrue, "VersionUnsupported",
+			fmt.Sprintf("Logstash %d or later is required, got %s", minimumLogstashMajorVersion, strings.Join(unsupported, ", ")))
+	case len(versions) == 0:
+		setCondition(conditionVersionUnsupported, metav1.ConditionUnknown, "VersionUnknown", "no instance reported its version")
+	default:
+		setCondition(conditionVersionUnsupported, metav1.ConditionFalse, "VersionSupported", "")
+	}
+
+	return status
+}
+
+// probeInstances checks the instances concurrently
+func (h *LogstashTargetResourceHandler) probeInstances(ctx context.Context, instances map[string]endpointInstance) map[string]probeResult {
+	var mu sync.Mutex
+	var waitGroup sync.WaitGroup
+	results := make(map[string]probeResult, len(instances))
+
+	for id, endpoint := range instances {
+		waitGroup.Add(1)
+		go func(id string, endpoint endpointInstance) {
+			defer waitGroup.Done()
+			result := h.probeEndpoint(ctx, id, endpoint)
+
+			mu.Lock()
+			results[id] = result
+			mu.Unlock()
+		}(id, endpoint)
+	}
+	waitGroup.Wait()
+
+	return results
+}
+
+// probeEndpoint checks the instance with the values of its Secrets, read by the secret watcher
+func (h *LogstashTargetResourceHandler) probeEndpoint(ctx context.Context, id string, endpoint endpointInstance) probeResult {
+	instance := endpoint.instance
+	if !endpoint.secretRefs.empty() {
+		resolveCtx, cancel := context.WithTimeout(ctx, h.probeTimeout)
+		defer cancel()
+
+		resolved, err := h.secrets.resolve(resolveCtx, id)
+		if err != nil {
+			return probeResult{err: err}
+		}
+		instance = resolved
+	}
+
+	return probeInstance(ctx, instance, h.probeTimeout)
+}
+
+// probeInstance requests the node info of the instance, to check that it is reachable with its credentials
+func probeInstance(ctx context.Context, instance *config.LogstashInstance, timeout time.Duration) probeResult {
+	httpClient, err := customtls.ConfigureHTTPClientFromLogstashInstance(instance, timeout)
+	if err != nil {
+		return probeResult{err: err}
+	}
+	if instance.BasicAuth != nil {
+		httpClient = customtls.ConfigureBasicAuth(httpClient, instance.BasicAuth.Username, instance.BasicAuth.Password)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, instance.Host, nil)
+	if err != nil {
+		return probeResult{err: err}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return probeResult{err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return probeResult{reachable: true, authFailed: true}
+	case resp.StatusCode != http.StatusOK:
+		return probeResult{err: fmt.Errorf("unexpected status code: %d", resp.StatusCode)}
+	}
+
+	var nodeInfo responses.NodeInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&nodeInfo); err != nil {
+		return probeResult{reachable: true, err: fmt.Errorf("invalid node info: %w", err)}
+	}
+
+	return probeResult{reachable: true, version: nodeInfo.Version}
+}
+
+// isSupportedLogstashVersion returns true if the major version is at least the minimum major version
+func isSupportedLogstashVersion(version string) bool {
+	major, _, _ := strings.Cut(version, ".")
+	majorVersion, err := strconv.Atoi(major)
+	return err == nil && majorVersion >= minimumLogstashMajorVersion
+}
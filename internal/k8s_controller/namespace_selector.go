@@ -0,0 +1,142 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceSelector selects the namespaces of the monitored resources by the labels of the namespaces.
+// A nil namespaceSelector selects every namespace.
+type namespaceSelector struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+
+	mu        sync.RWMutex
+	listeners []func(namespace string)
+}
+
+// newNamespaceSelector creates a selector of the namespaces matching the label selector,
+// or nil if the label selector is empty
+func newNamespaceSelector(client kubernetes.Interface, labelSelector string, resyncPeriod time.Duration) (*namespaceSelector, error) {
+	if labelSelector == "" {
+		return nil, nil
+	}
+
+	namespaces := client.CoreV1().Namespaces()
+	listWatch := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+			return namespaces.List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			return namespaces.Watch(ctx, options)
+		},
+	}
+
+	selector := &namespaceSelector{
+		informer: cache.NewSharedIndexInformer(listWatch, &corev1.Namespace{}, resyncPeriod, cache.Indexers{}),
+		stopCh:   make(chan struct{}),
+	}
+
+	// namespaces whose labels stop matching are deleted from the informer
+	_, err := selector.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    selector.onNamespaceChange,
+		DeleteFunc: selector.onNamespaceChange,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add event handler to namespace informer: %w", err)
+	}
+
+	return selector, nil
+}
+
+// start starts watching the namespaces and waits for the initial list of namespaces
+func (s *namespaceSelector) start(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	go s.informer.Run(s.stopCh)
+
+	// stop waiting when either the context is done or the selector is stopped
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if !cache.WaitForCacheSync(ctx.Done(), s.informer.HasSynced) {
+		return fmt.Errorf("failed to sync the namespaces")
+	}
+
+	return nil
+}
+
+// stop stops watching the namespaces
+func (s *namespaceSelector) stop() {
+	if s == nil {
+		return
+	}
+
+	close(s.stopCh)
+}
+
+// selected returns true if the resources of the namespace should be monitored
+func (s *namespaceSelector) selected(namespace string) bool {
+	if s == nil {
+		return true
+	}
+
+	_, exists, err := s.informer.GetStore().GetByKey(namespace)
+	return err == nil && exists
+}
+
+// subscribe registers a listener called with the name of every namespace that is selected or unselected
+func (s *namespaceSelector) subscribe(listener func(namespace string)) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// onNamespaceChange notifies the listeners of a namespace that is selected or unselected
+func (s *namespaceSelector) onNamespaceChange(obj interface{}) {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown)
+		if !isTombstone {
+			slog.Warn("unexpected type in namespace event handler")
+			return
+		}
+		if namespace, ok = tombstone.Obj.(*corev1.Namespace); !ok {
+			slog.Warn("unexpected type in namespace event handler")
+			return
+		}
+	}
+
+	slog.Debug("namespace selection changed", "namespace", namespace.Name, "selected", s.selected(namespace.Name))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, listener := range s.listeners {
+		listener(namespace.Name)
+	}
+}
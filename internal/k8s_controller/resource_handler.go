@@ -4,15 +4,19 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 
-	"github.com/kuskoman/logstash-exporter/pkg/collector_manager"
 	"github.com/kuskoman/logstash-exporter/pkg/config"
 )
 
@@ -29,28 +33,43 @@ type ResourceHandler interface {
 // BaseResourceHandler contains common functionality for all resource handlers
 type BaseResourceHandler struct {
 	client         kubernetes.Interface
-	collectorMgr   *collector_manager.CollectorManager
+	collectorMgr   instanceManager
 	config         config.KubernetesConfig
 	resourceConfig config.ResourceConfig
+	secrets        *secretWatcher
+	namespaces     *namespaceSelector
 	mu             sync.RWMutex
 	informers      []cache.SharedIndexInformer
 	stores         []cache.Store
 	stopCh         chan struct{}
+
+	targetsMu sync.Mutex
+	// targets are the objects of the discovered instances by their IDs, guarded by targetsMu
+	targets map[string]*corev1.ObjectReference
+	// reconcileErrors counts the resources which could not be turned into instances
+	reconcileErrors atomic.Uint64
+	// lastResync is the time of the last sync of the informers with the API server, in Unix nanoseconds
+	lastResync atomic.Int64
 }
 
 // newBaseResourceHandler creates a new base resource handler
 func newBaseResourceHandler(
 	client kubernetes.Interface,
-	collectorMgr *collector_manager.CollectorManager,
+	collectorMgr instanceManager,
 	kubeConfig config.KubernetesConfig,
 	resourceConfig config.ResourceConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
 ) *BaseResourceHandler {
 	return &BaseResourceHandler{
 		client:         client,
 		collectorMgr:   collectorMgr,
 		config:         kubeConfig,
 		resourceConfig: resourceConfig,
+		secrets:        secrets,
+		namespaces:     namespaces,
 		stopCh:         make(chan struct{}),
+		targets:        make(map[string]*corev1.ObjectReference),
 	}
 }
 
@@ -59,11 +78,53 @@ func (h *BaseResourceHandler) Stop() {
 	close(h.stopCh)
 }
 
-// extractLogstashInfo extracts Logstash connection info from object annotations
-func (h *BaseResourceHandler) extractLogstashInfo(annotations map[string]string, resourceName string) (string, *config.LogstashInstance) {
+// applySelectors restricts the listed and watched resources to those matching the configured selectors
+func (h *BaseResourceHandler) applySelectors(options *metav1.ListOptions) {
+	options.LabelSelector = h.resourceConfig.LabelSelector
+	options.FieldSelector = h.resourceConfig.FieldSelector
+}
+
+// resyncNamespace processes again the resources of a namespace which was selected or unselected
+func (h *BaseResourceHandler) resyncNamespace(namespace string, process func(obj interface{})) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, store := range h.stores {
+		for _, obj := range store.List() {
+			object, err := meta.Accessor(obj)
+			if err != nil || object.GetNamespace() != namespace {
+				continue
+			}
+			process(obj)
+		}
+	}
+}
+
+// portURL returns the URL of the Logstash API listening on the host and port
+func (h *BaseResourceHandler) portURL(host string, port int32) string {
+	return fmt.Sprintf("%s://%s", h.resourceConfig.Scheme, net.JoinHostPort(host, strconv.Itoa(int(port))))
+}
+
+// schemeURL is the URL of the resources expanded into instances without the URL annotation,
+// which only holds the scheme, since the ports of the instances are found by the port name
+func (h *BaseResourceHandler) schemeURL() string {
+	if h.resourceConfig.PortName == "" {
+		return ""
+	}
+
+	return h.resourceConfig.Scheme + "://"
+}
+
+// extractLogstashInfo extracts Logstash connection info from object annotations.
+// The URL annotation takes precedence over the portURL, which is the URL of the named port, if any.
+// The returned secret reference is set if the password is stored in a Secret of the namespace.
+func (h *BaseResourceHandler) extractLogstashInfo(annotations map[string]string, namespace, resourceName, portURL string) (string, *config.LogstashInstance, *secretKeyRef, error) {
 	logstashURL, ok := annotations[h.config.LogstashURLAnnotation]
 	if !ok {
-		return "", nil
+		logstashURL = portURL
+	}
+	if logstashURL == "" {
+		return "", nil, nil, nil
 	}
 
 	// Create a new LogstashInstance with the discovered information
@@ -79,7 +140,76 @@ func (h *BaseResourceHandler) extractLogstashInfo(annotations map[string]string,
 		}
 	}
 
-	return resourceName, instance
+	username := annotations[h.config.LogstashUsernameAnnotation]
+	password, hasPassword := annotations[h.config.LogstashPasswordAnnotation]
+	secretValue, hasSecret := annotations[h.config.LogstashPasswordSecretAnnotation]
+
+	if hasSecret {
+		passwordRef, err := parseSecretKeyRef(namespace, secretValue)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if hasPassword {
+			slog.Warn("ignoring the password annotation in favor of the password secret", "instance", resourceName)
+		}
+		instance.BasicAuth = &config.ClientAuthConfig{Username: username}
+		return resourceName, instance, passwordRef, nil
+	}
+
+	if hasPassword {
+		slog.Warn("the password annotation is stored in plaintext, consider referencing a secret instead",
+			"instance", resourceName,
+			"annotation", h.config.LogstashPasswordSecretAnnotation)
+	}
+	if username != "" || hasPassword {
+		instance.BasicAuth = &config.ClientAuthConfig{Username: username, Password: password}
+	}
+
+	return resourceName, instance, nil, nil
+}
+
+// addInstance adds the instance to the collector manager, or to the secret watcher
+// if its password is stored in a Secret. The object is the resource the instance was discovered from.
+func (h *BaseResourceHandler) addInstance(resourceName string, instance *config.LogstashInstance, secretRefs instanceSecretRefs, object *corev1.ObjectReference) {
+	h.targetsMu.Lock()
+	h.targets[resourceName] = object
+	h.targetsMu.Unlock()
+
+	if !secretRefs.empty() {
+		h.secrets.register(resourceName, instance, secretRefs)
+		return
+	}
+
+	h.secrets.unregister(resourceName)
+	h.collectorMgr.AddInstance(resourceName, instance)
+}
+
+// removeInstance removes the instance from the collector manager and the secret watcher
+func (h *BaseResourceHandler) removeInstance(resourceName string) {
+	h.secrets.unregister(resourceName)
+	h.collectorMgr.RemoveInstance(resourceName)
+
+	// the object is forgotten after the instance is removed, to report the removal on it
+	h.targetsMu.Lock()
+	delete(h.targets, resourceName)
+	h.targetsMu.Unlock()
+}
+
+// reconcileError logs and counts a resource which could not be turned into an instance
+func (h *BaseResourceHandler) reconcileError(msg string, args ...any) {
+	h.reconcileErrors.Add(1)
+	slog.Error(msg, args...)
+}
+
+// objectReference returns the reference of the object, which is not set in the objects of the informers
+func objectReference(apiVersion, kind string, object metav1.Object) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  object.GetNamespace(),
+		Name:       object.GetName(),
+		UID:        object.GetUID(),
+	}
 }
 
 // PodResourceHandler handles Pod resources
@@ -90,15 +220,19 @@ type PodResourceHandler struct {
 // NewPodResourceHandler creates a new Pod resource handler
 func NewPodResourceHandler(
 	client kubernetes.Interface,
-	collectorMgr *collector_manager.CollectorManager,
+	instances *shardedInstanceManager,
 	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
 ) ResourceHandler {
 	return &PodResourceHandler{
 		BaseResourceHandler: newBaseResourceHandler(
 			client,
-			collectorMgr,
+			instances,
 			kubeConfig,
 			kubeConfig.Resources.Pods,
+			secrets,
+			namespaces,
 		),
 	}
 }
@@ -117,6 +251,9 @@ func (h *PodResourceHandler) Start(ctx context.Context, namespaces []string) err
 
 	slog.Info("starting pod monitoring",
 		"annotationPrefix", h.resourceConfig.AnnotationPrefix,
+		"labelSelector", h.resourceConfig.LabelSelector,
+		"fieldSelector", h.resourceConfig.FieldSelector,
+		"portName", h.resourceConfig.PortName,
 		"namespaces", namespaces)
 
 	h.mu.Lock()
@@ -124,13 +261,11 @@ func (h *PodResourceHandler) Start(ctx context.Context, namespaces []string) err
 
 	// Create an informer for each namespace
 	for _, namespace := range namespaces {
-		fieldSelector := fields.Everything()
-
-		podListWatcher := cache.NewListWatchFromClient(
+		podListWatcher := cache.NewFilteredListWatchFromClient(
 			h.client.CoreV1().RESTClient(),
 			"pods",
 			namespace,
-			fieldSelector,
+			h.applySelectors,
 		)
 
 		informer := cache.NewSharedIndexInformer(
@@ -153,6 +288,10 @@ func (h *PodResourceHandler) Start(ctx context.Context, namespaces []string) err
 		h.stores = append(h.stores, informer.GetStore())
 	}
 
+	h.namespaces.subscribe(func(namespace string) {
+		h.resyncNamespace(namespace, h.onPodAdd)
+	})
+
 	// Start all informers
 	for _, informer := range h.informers {
 		go informer.Run(h.stopCh)
@@ -186,8 +325,12 @@ func (h *PodResourceHandler) onPodUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	// Check if annotations have changed
-	if fmt.Sprintf("%v", oldPod.Annotations) == fmt.Sprintf("%v", newPod.Annotations) {
+	// Check if the annotations, the phase, the IP, the ports or the copied labels have changed
+	if reflect.DeepEqual(oldPod.Annotations, newPod.Annotations) &&
+		oldPod.Status.Phase == newPod.Status.Phase &&
+		oldPod.Status.PodIP == newPod.Status.PodIP &&
+		reflect.DeepEqual(oldPod.Spec.Containers, newPod.Spec.Containers) &&
+		(len(h.resourceConfig.PodLabels) == 0 || reflect.DeepEqual(oldPod.Labels, newPod.Labels)) {
 		return
 	}
 
@@ -215,25 +358,87 @@ func (h *PodResourceHandler) onPodDelete(obj interface{}) {
 	h.removePod(pod)
 }
 
-// processPod processes a pod to see if it has the required annotations
+// processPod processes a pod to see if it has the required annotations or the named port.
+// The pods that are not running, or not in a selected namespace, are not monitored.
 func (h *PodResourceHandler) processPod(pod *corev1.Pod) {
-	if pod.Status.Phase != corev1.PodRunning {
+	instanceName := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	if pod.Status.Phase != corev1.PodRunning || !h.namespaces.selected(pod.Namespace) {
+		h.removeInstance(instanceName)
 		return
 	}
 
-	instanceName := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
-	resourceName, instance := h.extractLogstashInfo(pod.Annotations, instanceName)
+	resourceName, instance, passwordRef, err := h.extractLogstashInfo(pod.Annotations, pod.Namespace, instanceName, h.podPortURL(pod))
+	if err != nil {
+		h.reconcileError("invalid logstash annotations", "instance", instanceName, "err", err)
+		return
+	}
 
 	if instance == nil {
+		h.removeInstance(instanceName)
 		return
 	}
 
-	slog.Info("discovered logstash instance from pod annotation",
+	instance.Labels = h.podMetadataLabels(pod, nil)
+
+	slog.Info("discovered logstash instance from pod",
 		"instance", instanceName,
 		"url", instance.Host)
 
 	// Add the instance to the collector manager
-	h.collectorMgr.AddInstance(resourceName, instance)
+	h.addInstance(resourceName, instance, instanceSecretRefs{password: passwordRef}, objectReference("v1", "Pod", pod))
+}
+
+// podPortURL returns the URL of the container port with the configured name, if the pod has one
+func (h *PodResourceHandler) podPortURL(pod *corev1.Pod) string {
+	if h.resourceConfig.PortName == "" || pod.Status.PodIP == "" {
+		return ""
+	}
+
+	if port, found := containerPort(pod, h.resourceConfig.PortName); found {
+		return h.portURL(pod.Status.PodIP, port)
+	}
+
+	return ""
+}
+
+// podMetadataLabels returns the labels of the instance of the pod, with the configured labels and annotations
+// of the pod copied under their sanitised names. The labels set by the handler take precedence.
+func (h *BaseResourceHandler) podMetadataLabels(pod *corev1.Pod, labels map[string]string) map[string]string {
+	copyMetadata := func(keys []string, metadata map[string]string) {
+		for _, key := range keys {
+			value, exists := metadata[key]
+			if !exists {
+				continue
+			}
+
+			name := config.SanitizeLabelName(key)
+			if _, exists := labels[name]; exists {
+				continue
+			}
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[name] = value
+		}
+	}
+
+	copyMetadata(h.resourceConfig.PodLabels, pod.Labels)
+	copyMetadata(h.resourceConfig.PodAnnotations, pod.Annotations)
+
+	return labels
+}
+
+// containerPort returns the container port of the pod with the name
+func containerPort(pod *corev1.Pod, name string) (int32, bool) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return port.ContainerPort, true
+			}
+		}
+	}
+
+	return 0, false
 }
 
 // removePod removes a pod from monitoring
@@ -242,7 +447,7 @@ func (h *PodResourceHandler) removePod(pod *corev1.Pod) {
 	slog.Info("removing logstash instance", "instance", instanceName)
 
 	// Remove the instance from the collector manager
-	h.collectorMgr.RemoveInstance(instanceName)
+	h.removeInstance(instanceName)
 }
 
 // ServiceResourceHandler handles Service resources
@@ -253,15 +458,19 @@ type ServiceResourceHandler struct {
 // NewServiceResourceHandler creates a new Service resource handler
 func NewServiceResourceHandler(
 	client kubernetes.Interface,
-	collectorMgr *collector_manager.CollectorManager,
+	instances *shardedInstanceManager,
 	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
 ) ResourceHandler {
 	return &ServiceResourceHandler{
 		BaseResourceHandler: newBaseResourceHandler(
 			client,
-			collectorMgr,
+			instances,
 			kubeConfig,
 			kubeConfig.Resources.Services,
+			secrets,
+			namespaces,
 		),
 	}
 }
@@ -280,6 +489,9 @@ func (h *ServiceResourceHandler) Start(ctx context.Context, namespaces []string)
 
 	slog.Info("starting service monitoring",
 		"annotationPrefix", h.resourceConfig.AnnotationPrefix,
+		"labelSelector", h.resourceConfig.LabelSelector,
+		"fieldSelector", h.resourceConfig.FieldSelector,
+		"portName", h.resourceConfig.PortName,
 		"namespaces", namespaces)
 
 	h.mu.Lock()
@@ -287,13 +499,11 @@ func (h *ServiceResourceHandler) Start(ctx context.Context, namespaces []string)
 
 	// Create an informer for each namespace
 	for _, namespace := range namespaces {
-		fieldSelector := fields.Everything()
-
-		serviceListWatcher := cache.NewListWatchFromClient(
+		serviceListWatcher := cache.NewFilteredListWatchFromClient(
 			h.client.CoreV1().RESTClient(),
 			"services",
 			namespace,
-			fieldSelector,
+			h.applySelectors,
 		)
 
 		informer := cache.NewSharedIndexInformer(
@@ -316,6 +526,10 @@ func (h *ServiceResourceHandler) Start(ctx context.Context, namespaces []string)
 		h.stores = append(h.stores, informer.GetStore())
 	}
 
+	h.namespaces.subscribe(func(namespace string) {
+		h.resyncNamespace(namespace, h.onServiceAdd)
+	})
+
 	// Start all informers
 	for _, informer := range h.informers {
 		go informer.Run(h.stopCh)
@@ -349,8 +563,9 @@ func (h *ServiceResourceHandler) onServiceUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	// Check if annotations have changed
-	if fmt.Sprintf("%v", oldService.Annotations) == fmt.Sprintf("%v", newService.Annotations) {
+	// Check if the annotations or the ports have changed
+	if reflect.DeepEqual(oldService.Annotations, newService.Annotations) &&
+		reflect.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports) {
 		return
 	}
 
@@ -378,21 +593,48 @@ func (h *ServiceResourceHandler) onServiceDelete(obj interface{}) {
 	h.removeService(service)
 }
 
-// processService processes a service to see if it has the required annotations
+// processService processes a service to see if it has the required annotations or the named port.
+// The services that are not in a selected namespace are not monitored.
 func (h *ServiceResourceHandler) processService(service *corev1.Service) {
 	instanceName := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
-	resourceName, instance := h.extractLogstashInfo(service.Annotations, instanceName)
+	if !h.namespaces.selected(service.Namespace) {
+		h.removeInstance(instanceName)
+		return
+	}
+
+	resourceName, instance, passwordRef, err := h.extractLogstashInfo(service.Annotations, service.Namespace, instanceName, h.servicePortURL(service))
+	if err != nil {
+		h.reconcileError("invalid logstash annotations", "instance", instanceName, "err", err)
+		return
+	}
 
 	if instance == nil {
+		h.removeInstance(instanceName)
 		return
 	}
 
-	slog.Info("discovered logstash instance from service annotation",
+	slog.Info("discovered logstash instance from service",
 		"instance", instanceName,
 		"url", instance.Host)
 
 	// Add the instance to the collector manager
-	h.collectorMgr.AddInstance(resourceName, instance)
+	h.addInstance(resourceName, instance, instanceSecretRefs{password: passwordRef}, objectReference("v1", "Service", service))
+}
+
+// servicePortURL returns the URL of the service port with the configured name, if the service has one.
+// The service is addressed by its cluster DNS name.
+func (h *ServiceResourceHandler) servicePortURL(service *corev1.Service) string {
+	if h.resourceConfig.PortName == "" {
+		return ""
+	}
+
+	for _, port := range service.Spec.Ports {
+		if port.Name == h.resourceConfig.PortName {
+			return h.portURL(fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace), port.Port)
+		}
+	}
+
+	return ""
 }
 
 // removeService removes a service from monitoring
@@ -401,5 +643,5 @@ func (h *ServiceResourceHandler) removeService(service *corev1.Service) {
 	slog.Info("removing logstash instance", "instance", instanceName)
 
 	// Remove the instance from the collector manager
-	h.collectorMgr.RemoveInstance(instanceName)
+	h.removeInstance(instanceName)
 }
@@ -0,0 +1,239 @@
+package k8s_controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+func newTestKubernetesConfig() config.KubernetesConfig {
+	kubeConfig := config.DefaultKubernetesConfig()
+	kubeConfig.Enabled = true
+	kubeConfig.Resources.Pods.PortName = "http-api"
+	kubeConfig.Resources.Pods.Scheme = "http"
+	kubeConfig.Resources.Services.PortName = "http-api"
+	kubeConfig.Resources.Services.Scheme = "https"
+	return kubeConfig
+}
+
+func newTestPodHandler(manager *fakeInstanceManager, namespaces *namespaceSelector) *PodResourceHandler {
+	kubeConfig := newTestKubernetesConfig()
+	client := fake.NewSimpleClientset()
+	return &PodResourceHandler{
+		BaseResourceHandler: newBaseResourceHandler(client, manager, kubeConfig, kubeConfig.Resources.Pods,
+			newSecretWatcher(client, manager, 0), namespaces),
+	}
+}
+
+func newTestPod(namespace, name string, annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Annotations: annotations},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "logstash",
+			Ports: []corev1.ContainerPort{
+				{Name: "beats", ContainerPort: 5044},
+				{Name: "http-api", ContainerPort: 9600},
+			},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.1"},
+	}
+}
+
+func (m *fakeInstanceManager) getInstance(id string) *config.LogstashInstance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.instances[id]
+}
+
+func TestPodResourceHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("discovers pods by the named container port", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestPodHandler(manager, nil)
+
+		handler.processPod(newTestPod("logging", "logstash-0", nil))
+
+		instance := manager.getInstance("logging/logstash-0")
+		if instance == nil || instance.Host != "http://10.0.0.1:9600" {
+			t.Fatalf("expected the instance of the named port, got %+v", instance)
+		}
+	})
+
+	t.Run("prefers the url annotation over the named port", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestPodHandler(manager, nil)
+
+		handler.processPod(newTestPod("logging", "logstash-0", map[string]string{
+			"logstash-exporter.io/url":      "http://logstash-0.logstash:9601",
+			"logstash-exporter.io/username": "monitoring",
+			"logstash-exporter.io/password": "secret",
+		}))
+
+		instance := manager.getInstance("logging/logstash-0")
+		if instance == nil || instance.Host != "http://logstash-0.logstash:9601" {
+			t.Fatalf("expected the instance of the annotation, got %+v", instance)
+		}
+		if instance.BasicAuth == nil || instance.BasicAuth.Username != "monitoring" || instance.BasicAuth.Password != "secret" {
+			t.Errorf("expected the credentials of the annotations, got %+v", instance.BasicAuth)
+		}
+	})
+
+	t.Run("removes pods that stop running or lose the named port", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestPodHandler(manager, nil)
+
+		pod := newTestPod("logging", "logstash-0", nil)
+		handler.processPod(pod)
+
+		pod.Status.Phase = corev1.PodSucceeded
+		handler.processPod(pod)
+		if instance := manager.getInstance("logging/logstash-0"); instance != nil {
+			t.Errorf("expected the completed pod to be removed, got %+v", instance)
+		}
+
+		pod = newTestPod("logging", "logstash-0", nil)
+		handler.processPod(pod)
+		pod.Spec.Containers[0].Ports = nil
+		handler.processPod(pod)
+		if instance := manager.getInstance("logging/logstash-0"); instance != nil {
+			t.Errorf("expected the pod without the named port to be removed, got %+v", instance)
+		}
+	})
+
+	t.Run("copies the configured pod labels and annotations onto the instance labels", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestPodHandler(manager, nil)
+		handler.resourceConfig.PodLabels = []string{"app.kubernetes.io/instance", "team", "missing"}
+		handler.resourceConfig.PodAnnotations = []string{"example.com/owner"}
+
+		pod := newTestPod("logging", "logstash-0", map[string]string{"example.com/owner": "ingest-oncall"})
+		pod.Labels = map[string]string{"app.kubernetes.io/instance": "ingest", "team": "data", "tier": "backend"}
+		handler.processPod(pod)
+
+		instance := manager.getInstance("logging/logstash-0")
+		expected := map[string]string{"app_kubernetes_io_instance": "ingest", "team": "data", "example_com_owner": "ingest-oncall"}
+		if instance == nil || len(instance.Labels) != len(expected) {
+			t.Fatalf("expected the instance with the copied labels, got %+v", instance)
+		}
+		for name, value := range expected {
+			if instance.Labels[name] != value {
+				t.Errorf("expected label %s to be %q, got %q", name, value, instance.Labels[name])
+			}
+		}
+	})
+
+	t.Run("updates the copied pod labels of a relabelled pod", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestPodHandler(manager, nil)
+		handler.resourceConfig.PodLabels = []string{"team"}
+
+		pod := newTestPod("logging", "logstash-0", nil)
+		pod.Labels = map[string]string{"team": "data"}
+		handler.onPodAdd(pod)
+
+		relabelled := pod.DeepCopy()
+		relabelled.Labels["team"] = "ingest"
+		handler.onPodUpdate(pod, relabelled)
+
+		if instance := manager.getInstance("logging/logstash-0"); instance == nil || instance.Labels["team"] != "ingest" {
+			t.Errorf("expected the instance with the new label, got %+v", instance)
+		}
+	})
+}
+
+func TestServiceResourceHandler(t *testing.T) {
+	t.Parallel()
+
+	kubeConfig := newTestKubernetesConfig()
+	manager := newFakeInstanceManager()
+	client := fake.NewSimpleClientset()
+	handler := &ServiceResourceHandler{
+		BaseResourceHandler: newBaseResourceHandler(client, manager, kubeConfig, kubeConfig.Resources.Services,
+			newSecretWatcher(client, manager, 0), nil),
+	}
+
+	handler.processService(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http-api", Port: 9600}}},
+	})
+
+	instance := manager.getInstance("logging/logstash")
+	if instance == nil || instance.Host != "https://logstash.logging.svc:9600" {
+		t.Fatalf("expected the instance of the named service port, got %+v", instance)
+	}
+}
+
+func TestNamespaceSelector(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "logging", Labels: map[string]string{"monitoring": "enabled"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	)
+
+	selector, err := newNamespaceSelector(client, "monitoring=enabled", 0)
+	if err != nil {
+		t.Fatalf("failed to create namespace selector: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := selector.start(ctx); err != nil {
+		t.Fatalf("failed to start namespace selector: %v", err)
+	}
+	t.Cleanup(selector.stop)
+
+	if !selector.selected("logging") || selector.selected("default") {
+		t.Errorf("expected only the labeled namespace to be selected")
+	}
+
+	manager := newFakeInstanceManager()
+	handler := newTestPodHandler(manager, selector)
+	handler.processPod(newTestPod("default", "logstash-0", nil))
+	handler.processPod(newTestPod("logging", "logstash-0", nil))
+
+	if manager.getInstance("default/logstash-0") != nil || manager.getInstance("logging/logstash-0") == nil {
+		t.Errorf("expected only the pod of the selected namespace, got %v", manager.instances)
+	}
+
+	var nilSelector *namespaceSelector
+	if !nilSelector.selected("default") {
+		t.Errorf("expected every namespace to be selected without a selector")
+	}
+
+	// the resources of a namespace are processed again when it is selected
+	resynced := make(chan string, 1)
+	selector.subscribe(func(namespace string) { resynced <- namespace })
+	_, err = client.CoreV1().Namespaces().Create(context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"monitoring": "enabled"}}},
+		metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+
+	select {
+	case namespace := <-resynced:
+		if namespace != "team" {
+			t.Errorf("expected the team namespace to be resynced, got %s", namespace)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("expected the selected namespace to be resynced")
+	}
+}
@@ -0,0 +1,419 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// instanceManager is notified of the discovered instances, implemented by the CollectorManager
+type instanceManager interface {
+	AddInstance(id string, instance *config.LogstashInstance)
+	RemoveInstance(id string)
+}
+
+// secretKeyRef references a key of a Secret
+type secretKeyRef struct {
+	secret types.NamespacedName
+	key    string
+	// usernameKey is the key of the username, if it is stored in the same Secret
+	usernameKey string
+}
+
+// parseSecretKeyRef parses a "<secret-name>/<key>" reference to a Secret in the namespace
+func parseSecretKeyRef(namespace, value string) (*secretKeyRef, error) {
+	name, key, found := strings.Cut(value, "/")
+	if !found || name == "" || key == "" {
+		return nil, fmt.Errorf("invalid secret reference %q, expected <secret-name>/<key>", value)
+	}
+
+	return &secretKeyRef{
+		secret: types.NamespacedName{Namespace: namespace, Name: name},
+		key:    key,
+	}, nil
+}
+
+// instanceSecretRefs references the Secrets of an instance, holding its password and its certificate authority
+type instanceSecretRefs struct {
+	password *secretKeyRef
+	ca       *secretKeyRef
+}
+
+// empty returns true if the instance references no Secret
+func (refs instanceSecretRefs) empty() bool {
+	return refs.password == nil && refs.ca == nil
+}
+
+// secrets returns the names of the referenced Secrets, which may be the same Secret
+func (refs instanceSecretRefs) secrets() []types.NamespacedName {
+	var secrets []types.NamespacedName
+	for _, ref := range []*secretKeyRef{refs.password, refs.ca} {
+		if ref != nil {
+			secrets = append(secrets, ref.secret)
+		}
+	}
+	return secrets
+}
+
+// references returns true if the instance references the Secret
+func (refs instanceSecretRefs) references(secret types.NamespacedName) bool {
+	for _, name := range refs.secrets() {
+		if name == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// secretReference is an instance authenticating with a password, or verifying the certificate of Logstash
+// with a certificate authority, stored in Secrets
+type secretReference struct {
+	instance *config.LogstashInstance
+	refs     instanceSecretRefs
+	// username, password and ca are the last values applied to the instance
+	username string
+	password string
+	ca       string
+	applied  bool
+	// current is the last instance added to the instance manager
+	current *config.LogstashInstance
+}
+
+// secretWatcher watches the Secrets referenced by the instances, and adds the instances with the current
+// password and certificate authority to the instance manager, again whenever they change.
+// Every Secret is watched by its name, so only the get and watch permissions are required.
+type secretWatcher struct {
+	client       kubernetes.Interface
+	manager      instanceManager
+	resyncPeriod time.Duration
+
+	mu         sync.Mutex
+	references map[string]*secretReference
+	informers  map[types.NamespacedName]*secretInformer
+
+	// reconcileErrors counts the Secrets which could not be watched or applied to their instances
+	reconcileErrors atomic.Uint64
+}
+
+// secretInformer is the informer of a single Secret
+type secretInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// newSecretWatcher creates a watcher of the Secrets referenced by the instances
+func newSecretWatcher(client kubernetes.Interface, manager instanceManager, resyncPeriod time.Duration) *secretWatcher {
+	return &secretWatcher{
+		client:       client,
+		manager:      manager,
+		resyncPeriod: resyncPeriod,
+		references:   make(map[string]*secretReference),
+		informers:    make(map[types.NamespacedName]*secretInformer),
+	}
+}
+
+// register adds the instance once the referenced Secrets are available, replacing its previous references
+func (w *secretWatcher) register(id string, instance *config.LogstashInstance, refs instanceSecretRefs) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	previous, exists := w.references[id]
+	reference := &secretReference{instance: instance, refs: refs}
+	w.references[id] = reference
+	if exists {
+		for _, secret := range previous.refs.secrets() {
+			if !refs.references(secret) {
+				w.releaseInformer(secret)
+			}
+		}
+	}
+
+	for _, secret := range refs.secrets() {
+		if _, err := w.ensureInformer(secret); err != nil {
+			w.reconcileError("failed to watch secret", "secret", secret.String(), "instance", id, "err", err)
+			return
+		}
+	}
+
+	w.apply(id, reference)
+}
+
+// unregister stops applying the Secrets referenced by the instance, if any
+func (w *secretWatcher) unregister(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	reference, exists := w.references[id]
+	if !exists {
+		return
+	}
+
+	delete(w.references, id)
+	for _, secret := range reference.refs.secrets() {
+		w.releaseInformer(secret)
+	}
+}
+
+// stop stops watching all Secrets
+func (w *secretWatcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for name, informer := range w.informers {
+		close(informer.stopCh)
+		delete(w.informers, name)
+	}
+}
+
+// ensureInformer starts the informer of the Secret, unless it is already running
+func (w *secretWatcher) ensureInformer(name types.NamespacedName) (*secretInformer, error) {
+	if informer, exists := w.informers[name]; exists {
+		return informer, nil
+	}
+
+	informer := cache.NewSharedIndexInformer(
+		w.newListWatch(name),
+		&corev1.Secret{},
+		w.resyncPeriod,
+		cache.Indexers{},
+	)
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.onSecretChange,
+		UpdateFunc: func(_, newObj interface{}) { w.onSecretChange(newObj) },
+		DeleteFunc: w.onSecretDelete,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add event handler to secret informer: %w", err)
+	}
+
+	secretInformer := &secretInformer{informer: informer, stopCh: make(chan struct{})}
+	w.informers[name] = secretInformer
+	go informer.Run(secretInformer.stopCh)
+
+	return secretInformer, nil
+}
+
+// releaseInformer stops the informer of the Secret if no instance references it anymore
+func (w *secretWatcher) releaseInformer(name types.NamespacedName) {
+	for _, reference := range w.references {
+		if reference.refs.references(name) {
+			return
+		}
+	}
+
+	if informer, exists := w.informers[name]; exists {
+		close(informer.stopCh)
+		delete(w.informers, name)
+	}
+}
+
+// newListWatch lists and watches a single Secret by its name.
+// The list is served by a get of the Secret, so that listing the Secrets is not required.
+func (w *secretWatcher) newListWatch(name types.NamespacedName) *cache.ListWatch {
+	secrets := w.client.CoreV1().Secrets(name.Namespace)
+
+	return &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, _ metav1.ListOptions) (runtime.Object, error) {
+			secret, err := secrets.Get(ctx, name.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return &corev1.SecretList{}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			return &corev1.SecretList{
+				ListMeta: metav1.ListMeta{ResourceVersion: secret.ResourceVersion},
+				Items:    []corev1.Secret{*secret},
+			}, nil
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name.Name).String()
+			return secrets.Watch(ctx, options)
+		},
+	}
+}
+
+// onSecretChange applies the changed Secret to the instances referencing it
+func (w *secretWatcher) onSecretChange(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		slog.Warn("unexpected type in secret event handler")
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+	for id, reference := range w.references {
+		if reference.refs.references(name) {
+			w.apply(id, reference)
+		}
+	}
+}
+
+// onSecretDelete keeps the instances with their last password, which is still in use until the secret is recreated
+func (w *secretWatcher) onSecretDelete(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		if tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown); isTombstone {
+			secret, ok = tombstone.Obj.(*corev1.Secret)
+		}
+	}
+	if !ok {
+		slog.Warn("unexpected type in secret delete event handler")
+		return
+	}
+
+	slog.Warn("secret referenced by logstash instances was deleted, keeping their last credentials",
+		"secret", types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}.String())
+}
+
+// reconcileError logs and counts a Secret which could not be watched or applied
+func (w *secretWatcher) reconcileError(msg string, args ...any) {
+	w.reconcileErrors.Add(1)
+	slog.Error(msg, args...)
+}
+
+// apply adds the instance with the credentials and the certificate authority of the Secrets,
+// once all of them are available and unless they are unchanged
+func (w *secretWatcher) apply(id string, reference *secretReference) {
+	var username string
+	if reference.instance.BasicAuth != nil {
+		username = reference.instance.BasicAuth.Username
+	}
+
+	var password string
+	if ref := reference.refs.password; ref != nil {
+		value, found := w.secretValue(id, *ref, ref.key)
+		if !found {
+			return
+		}
+		password = value
+
+		if ref.usernameKey != "" {
+			if username, found = w.secretValue(id, *ref, ref.usernameKey); !found {
+				return
+			}
+		}
+	}
+
+	var ca string
+	if ref := reference.refs.ca; ref != nil {
+		value, found := w.secretValue(id, *ref, ref.key)
+		if !found {
+			return
+		}
+		ca = value
+	}
+
+	if reference.applied && reference.username == username && reference.password == password && reference.ca == ca {
+		return
+	}
+
+	instance := *reference.instance
+	if reference.refs.password != nil {
+		instance.BasicAuth = &config.ClientAuthConfig{Username: username, Password: password}
+	}
+	if reference.refs.ca != nil {
+		tlsConfig := config.TLSClientConfig{}
+		if instance.TLSConfig != nil {
+			tlsConfig = *instance.TLSConfig
+		}
+		tlsConfig.CA = ca
+		instance.TLSConfig = &tlsConfig
+	}
+
+	if reference.applied {
+		slog.Info("rotating secrets of logstash instance", "instance", id, "secrets", reference.refs.secrets())
+	}
+
+	w.manager.AddInstance(id, &instance)
+	reference.username = username
+	reference.password = password
+	reference.ca = ca
+	reference.applied = true
+	reference.current = &instance
+}
+
+// resolve returns the registered instance with the values of its Secrets, once their informers have synced,
+// so that the instance can be checked with the credentials it is monitored with
+func (w *secretWatcher) resolve(ctx context.Context, id string) (*config.LogstashInstance, error) {
+	w.mu.Lock()
+	reference, exists := w.references[id]
+	var synced []cache.InformerSynced
+	if exists {
+		for _, secret := range reference.refs.secrets() {
+			if informer, running := w.informers[secret]; running {
+				synced = append(synced, informer.informer.HasSynced)
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("instance %s references no secret", id)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return nil, fmt.Errorf("timed out waiting for the secrets %v", reference.refs.secrets())
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.references[id] != reference {
+		return nil, fmt.Errorf("the secrets of instance %s changed", id)
+	}
+	w.apply(id, reference)
+	if !reference.applied {
+		return nil, fmt.Errorf("waiting for the secrets %v", reference.refs.secrets())
+	}
+
+	return reference.current, nil
+}
+
+// secretValue returns the value of the key of the referenced Secret from its informer,
+// or false if the Secret is not available yet or has no such key
+func (w *secretWatcher) secretValue(id string, ref secretKeyRef, key string) (string, bool) {
+	informer, exists := w.informers[ref.secret]
+	if !exists {
+		return "", false
+	}
+
+	item, exists, err := informer.informer.GetStore().GetByKey(ref.secret.String())
+	if err != nil || !exists {
+		slog.Info("waiting for the secret of the instance", "secret", ref.secret.String(), "instance", id)
+		return "", false
+	}
+
+	secret, ok := item.(*corev1.Secret)
+	if !ok {
+		return "", false
+	}
+
+	value, exists := secret.Data[key]
+	if !exists {
+		w.reconcileError("secret has no key referenced by the instance", "secret", ref.secret.String(), "key", key, "instance", id)
+		return "", false
+	}
+
+	return string(value), true
+}
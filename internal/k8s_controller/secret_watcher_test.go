@@ -0,0 +1,223 @@
+package k8s_controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const testTimeout = 2 * time.Second
+
+// fakeInstanceManager records the instances like the CollectorManager
+type fakeInstanceManager struct {
+	mu        sync.Mutex
+	instances map[string]*config.LogstashInstance
+	// replaced counts the batches of replaced instances
+	replaced int
+}
+
+func newFakeInstanceManager() *fakeInstanceManager {
+	return &fakeInstanceManager{instances: make(map[string]*config.LogstashInstance)}
+}
+
+func (m *fakeInstanceManager) AddInstance(id string, instance *config.LogstashInstance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[id] = instance
+}
+
+func (m *fakeInstanceManager) RemoveInstance(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, id)
+}
+
+func (m *fakeInstanceManager) ReplaceInstances(removed []string, added map[string]*config.LogstashInstance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replaced++
+	for _, id := range removed {
+		delete(m.instances, id)
+	}
+	for id, instance := range added {
+		m.instances[id] = instance
+	}
+}
+
+// waitForPassword waits until the instance is added with the expected password
+func (m *fakeInstanceManager) waitForPassword(t *testing.T, id, expected string) *config.LogstashInstance {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		m.mu.Lock()
+		instance := m.instances[id]
+		m.mu.Unlock()
+
+		if instance != nil && instance.BasicAuth != nil && instance.BasicAuth.Password == expected {
+			return instance
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected instance %s with password %q, got %+v", id, expected, instance)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForInstance waits until the instance is added, once its Secrets are available
+func (m *fakeInstanceManager) waitForInstance(t *testing.T, id string) *config.LogstashInstance {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		if instance := m.getInstance(id); instance != nil {
+			return instance
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected instance %s to be added", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestSecret(namespace, name, password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string][]byte{"password": []byte(password)},
+	}
+}
+
+func TestParseSecretKeyRef(t *testing.T) {
+	t.Parallel()
+
+	ref, err := parseSecretKeyRef("logging", "logstash-credentials/password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref.secret.Namespace != "logging" || ref.secret.Name != "logstash-credentials" || ref.key != "password" {
+		t.Errorf("unexpected reference: %+v", ref)
+	}
+
+	for _, invalid := range []string{"", "logstash-credentials", "/password", "logstash-credentials/"} {
+		if _, err := parseSecretKeyRef("logging", invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestSecretWatcher(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rotates the credentials when the secret changes", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset(newTestSecret("logging", "logstash-credentials", "first"))
+		manager := newFakeInstanceManager()
+		watcher := newSecretWatcher(client, manager, 0)
+		t.Cleanup(watcher.stop)
+
+		ref, _ := parseSecretKeyRef("logging", "logstash-credentials/password")
+		instance := &config.LogstashInstance{
+			Host:      "http://logstash:9600",
+			BasicAuth: &config.ClientAuthConfig{Username: "monitoring"},
+		}
+		watcher.register("logging/logstash-0", instance, instanceSecretRefs{password: ref})
+
+		added := manager.waitForPassword(t, "logging/logstash-0", "first")
+		if added.BasicAuth.Username != "monitoring" || added.Host != instance.Host {
+			t.Errorf("expected the instance with its username, got %+v", added)
+		}
+		if instance.BasicAuth.Password != "" {
+			t.Errorf("expected the registered instance to be left unchanged, got %+v", instance.BasicAuth)
+		}
+
+		_, err := client.CoreV1().Secrets("logging").Update(context.Background(), newTestSecret("logging", "logstash-credentials", "second"), metav1.UpdateOptions{})
+		if err != nil {
+			t.Fatalf("failed to update secret: %v", err)
+		}
+		manager.waitForPassword(t, "logging/logstash-0", "second")
+	})
+
+	t.Run("adds the instance once the secret is created", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset()
+		manager := newFakeInstanceManager()
+		watcher := newSecretWatcher(client, manager, 0)
+		t.Cleanup(watcher.stop)
+
+		ref, _ := parseSecretKeyRef("logging", "logstash-credentials/password")
+		watcher.register("logging/logstash-0", &config.LogstashInstance{Host: "http://logstash:9600"}, instanceSecretRefs{password: ref})
+
+		_, err := client.CoreV1().Secrets("logging").Create(context.Background(), newTestSecret("logging", "logstash-credentials", "created"), metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("failed to create secret: %v", err)
+		}
+		manager.waitForPassword(t, "logging/logstash-0", "created")
+	})
+
+	t.Run("adds the instance with the certificate authority of the secret", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset(newTestSecret("logging", "logstash-credentials", "first"), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash-certs"},
+			Data:       map[string][]byte{"ca.crt": []byte("first-ca")},
+		})
+		manager := newFakeInstanceManager()
+		watcher := newSecretWatcher(client, manager, 0)
+		t.Cleanup(watcher.stop)
+
+		passwordRef, _ := parseSecretKeyRef("logging", "logstash-credentials/password")
+		caRef, _ := parseSecretKeyRef("logging", "logstash-certs/ca.crt")
+		instance := &config.LogstashInstance{
+			Host:      "https://logstash:9600",
+			TLSConfig: &config.TLSClientConfig{ServerName: "logstash.logging.svc"},
+		}
+		watcher.register("logging/logstash-0", instance, instanceSecretRefs{password: passwordRef, ca: caRef})
+
+		added := manager.waitForPassword(t, "logging/logstash-0", "first")
+		if added.TLSConfig == nil || added.TLSConfig.CA != "first-ca" || added.TLSConfig.ServerName != "logstash.logging.svc" {
+			t.Errorf("expected the certificate authority of the secret, got %+v", added.TLSConfig)
+		}
+		if instance.TLSConfig.CA != "" {
+			t.Errorf("expected the registered instance to be left unchanged, got %+v", instance.TLSConfig)
+		}
+		if len(watcher.informers) != 2 {
+			t.Errorf("expected both secrets to be watched, got %d informers", len(watcher.informers))
+		}
+
+		watcher.unregister("logging/logstash-0")
+		if len(watcher.informers) != 0 {
+			t.Errorf("expected the secrets not to be watched, got %d informers", len(watcher.informers))
+		}
+	})
+
+	t.Run("stops watching secrets that are not referenced anymore", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset(newTestSecret("logging", "logstash-credentials", "first"))
+		watcher := newSecretWatcher(client, newFakeInstanceManager(), 0)
+		t.Cleanup(watcher.stop)
+
+		ref, _ := parseSecretKeyRef("logging", "logstash-credentials/password")
+		watcher.register("logging/logstash-0", &config.LogstashInstance{Host: "http://logstash-0:9600"}, instanceSecretRefs{password: ref})
+		watcher.register("logging/logstash-1", &config.LogstashInstance{Host: "http://logstash-1:9600"}, instanceSecretRefs{password: ref})
+
+		watcher.unregister("logging/logstash-0")
+		if len(watcher.informers) != 1 {
+			t.Errorf("expected the secret to be watched while it is referenced, got %d informers", len(watcher.informers))
+		}
+
+		watcher.unregister("logging/logstash-1")
+		if len(watcher.informers) != 0 {
+			t.Errorf("expected the secret not to be watched, got %d informers", len(watcher.informers))
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package k8s_controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// noShard is the shard of a replica which does not hold the Lease of any shard
+const noShard = -1
+
+// shardManager applies the instances of a shard at once, implemented by the CollectorManager
+type shardManager interface {
+	instanceManager
+	ReplaceInstances(removed []string, added map[string]*config.LogstashInstance)
+}
+
+// shardedInstanceManager adds to the collector manager the discovered instances of the shard of the replica,
+// the instances being assigned to the shards by the hash of their IDs.
+// All the discovered instances are kept, so that the instances of a shard are monitored as soon as
+// the replica acquires it, and until then the replica monitors no discovered instance.
+type shardedInstanceManager struct {
+	manager shardManager
+	shards  int
+
+	mu    sync.Mutex
+	shard int
+	// instances are all the discovered instances, guarded by mu
+	instances map[string]*config.LogstashInstance
+}
+
+func newShardedInstanceManager(manager shardManager, shards, shard int) *shardedInstanceManager {
+	return &shardedInstanceManager{
+		manager:   manager,
+		shards:    shards,
+		shard:     shard,
+		instances: make(map[string]*config.LogstashInstance),
+	}
+}
+
+// shardOf returns the shard of the key
+func shardOf(key string, shards int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// AddInstance records the instance, and adds it to the collector manager if it belongs to the shard of the replica
+func (m *shardedInstanceManager) AddInstance(id string, instance *config.LogstashInstance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.instances[id] = instance
+	if m.ownsLocked(id) {
+		m.manager.AddInstance(id, instance)
+	}
+}
+
+// RemoveInstance forgets the instance, and removes it from the collector manager if it belongs to the shard of the replica
+func (m *shardedInstanceManager) RemoveInstance(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.instances[id]; !exists {
+		return
+	}
+
+	delete(m.instances, id)
+	if m.ownsLocked(id) {
+		m.manager.RemoveInstance(id)
+	}
+}
+
+// owns returns true if the key, such as the ID of an instance, belongs to the shard of the replica
+func (m *shardedInstanceManager) owns(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ownsLocked(key)
+}
+
+func (m *shardedInstanceManager) ownsLocked(key string) bool {
+	return m.shard != noShard && shardOf(key, m.shards) == m.shard
+}
+
+// setShard changes the shard of the replica, replacing the instances of the previous shard
+// with the instances of the new shard in the collector manager at once
+func (m *shardedInstanceManager) setShard(shard int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.shard
+	if previous == shard {
+		return
+	}
+
+	var removed []string
+	for id := range m.instances {
+		if m.ownsLocked(id) {
+			removed = append(removed, id)
+		}
+	}
+
+	m.shard = shard
+	added := make(map[string]*config.LogstashInstance)
+	for id, instance := range m.instances {
+		if m.ownsLocked(id) {
+			added[id] = instance
+		}
+	}
+
+	m.manager.ReplaceInstances(removed, added)
+
+	slog.Info("changed the shard of the monitored instances", "previous", previous, "shard", shard, "shards", m.shards)
+}
+
+// staticShardIndex returns the shard of the replica without leader election: the configured index,
+// or the ordinal of the pod name, e.g. 2 for the "logstash-exporter-2" pod of a StatefulSet
+func staticShardIndex(sharding config.ShardingConfig) (int, error) {
+	if sharding.ShardIndex != nil {
+		return *sharding.ShardIndex, nil
+	}
+	if sharding.Shards <= 1 {
+		return 0, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the hostname: %w", err)
+	}
+
+	return shardIndexFromPodName(hostname, sharding.Shards)
+}
+
+// shardIndexFromPodName returns the ordinal of the pod name, which must be lower than the number of shards
+func shardIndexFromPodName(podName string, shards int) (int, error) {
+	separator := strings.LastIndex(podName, "-")
+	ordinal, err := strconv.Atoi(podName[separator+1:])
+	if separator < 0 || err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("the shard index is not set, and the pod name %q has no ordinal", podName)
+	}
+	if ordinal >= shards {
+		return 0, fmt.Errorf("the ordinal %d of the pod name %q is not lower than the %d shards", ordinal, podName, shards)
+	}
+
+	return ordinal, nil
+}
@@ -0,0 +1,164 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+func TestShardedInstanceManager(t *testing.T) {
+	t.Parallel()
+
+	t.Run("splits the instances between the shards", func(t *testing.T) {
+		t.Parallel()
+
+		managers := []*fakeInstanceManager{newFakeInstanceManager(), newFakeInstanceManager(), newFakeInstanceManager()}
+		for shard, manager := range managers {
+			sharded := newShardedInstanceManager(manager, len(managers), shard)
+			for i := 0; i < 30; i++ {
+				sharded.AddInstance(fmt.Sprintf("logging/logstash-%d", i), &config.LogstashInstance{})
+			}
+		}
+
+		total := 0
+		for shard, manager := range managers {
+			if len(manager.instances) == 0 {
+				t.Errorf("expected instances in shard %d", shard)
+			}
+			total += len(manager.instances)
+		}
+		if total != 30 {
+			t.Errorf("expected every instance in exactly one shard, got %d instances", total)
+		}
+	})
+
+	t.Run("monitors the instances of the acquired shard only", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		sharded := newShardedInstanceManager(manager, 2, noShard)
+		for i := 0; i < 10; i++ {
+			sharded.AddInstance(fmt.Sprintf("logging/logstash-%d", i), &config.LogstashInstance{})
+		}
+		if len(manager.instances) != 0 {
+			t.Fatalf("expected no instances without a shard, got %v", manager.instances)
+		}
+
+		sharded.setShard(1)
+		for id := range manager.instances {
+			if shardOf(id, 2) != 1 {
+				t.Errorf("expected only the instances of shard 1, got %s", id)
+			}
+		}
+		if len(manager.instances) == 0 {
+			t.Fatalf("expected the instances of shard 1")
+		}
+		if manager.replaced != 1 {
+			t.Errorf("expected the instances of the shard to be replaced at once, got %d batches", manager.replaced)
+		}
+
+		for id := range sharded.instances {
+			sharded.RemoveInstance(id)
+		}
+		if len(manager.instances) != 0 {
+			t.Errorf("expected the removed instances to be removed from the manager, got %v", manager.instances)
+		}
+	})
+
+	t.Run("removes the instances of a lost shard", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		sharded := newShardedInstanceManager(manager, 1, 0)
+		sharded.AddInstance("logging/logstash-0", &config.LogstashInstance{})
+
+		sharded.setShard(noShard)
+		if len(manager.instances) != 0 || sharded.owns("logging/logstash-0") {
+			t.Errorf("expected no instances without a shard, got %v", manager.instances)
+		}
+	})
+}
+
+func TestShardIndexFromPodName(t *testing.T) {
+	t.Parallel()
+
+	if shard, err := shardIndexFromPodName("logstash-exporter-2", 3); err != nil || shard != 2 {
+		t.Errorf("expected shard 2, got %d (%v)", shard, err)
+	}
+
+	for _, podName := range []string{"logstash-exporter-3", "logstash-exporter-7d9f8b-x2k4p", "localhost"} {
+		if _, err := shardIndexFromPodName(podName, 3); err == nil {
+			t.Errorf("expected an error for the pod name %s", podName)
+		}
+	}
+}
+
+func TestShardElection(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	leaderElection := config.LeaderElectionConfig{
+		Enabled:       true,
+		LeaseName:     "logstash-exporter",
+		LeaseDuration: 600 * time.Millisecond,
+		RenewDeadline: 400 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+
+	newReplica := func(identity string) (*shardedInstanceManager, context.CancelFunc) {
+		instances := newShardedInstanceManager(newFakeInstanceManager(), 2, noShard)
+		election := &shardElection{
+			client:    client,
+			config:    leaderElection,
+			shards:    2,
+			namespace: "monitoring",
+			identity:  identity,
+			instances: instances,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go election.run(ctx)
+		t.Cleanup(cancel)
+		return instances, cancel
+	}
+
+	shardOfReplica := func(instances *shardedInstanceManager) int {
+		instances.mu.Lock()
+		defer instances.mu.Unlock()
+		return instances.shard
+	}
+
+	waitForShards := func(condition func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the shards to be assigned")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	first, cancelFirst := newReplica("replica-a")
+	second, _ := newReplica("replica-b")
+	waitForShards(func() bool {
+		return shardOfReplica(first) != noShard && shardOfReplica(second) != noShard
+	})
+	if shardOfReplica(first) == shardOfReplica(second) {
+		t.Fatalf("expected the replicas to hold different shards, both hold %d", shardOfReplica(first))
+	}
+
+	// the standby replica takes over the shard released by the stopped replica
+	released := shardOfReplica(first)
+	standby, _ := newReplica("replica-c")
+	cancelFirst()
+	waitForShards(func() bool {
+		return shardOfReplica(standby) == released && shardOfReplica(first) == noShard
+	})
+}
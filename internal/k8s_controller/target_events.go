@@ -0,0 +1,178 @@
+package k8s_controller
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	// eventReasonTargetAdded is the reason of the event of an instance monitored by the replica
+	eventReasonTargetAdded = "TargetAdded"
+	// eventReasonTargetRemoved is the reason of the event of an instance no longer monitored by the replica
+	eventReasonTargetRemoved = "TargetRemoved"
+	// eventReasonAuthenticationFailed is the reason of the event of an instance rejecting its credentials
+	eventReasonAuthenticationFailed = "AuthenticationFailed"
+
+	// eventProbeTimeout is the timeout of the check of the credentials of an added or changed instance
+	eventProbeTimeout = 5 * time.Second
+	// maxConcurrentEventProbes limits the checks running at once, e.g. when a replica acquires a shard
+	maxConcurrentEventProbes = 8
+)
+
+// targetEventRecorder emits Kubernetes Events on the objects the monitored instances were discovered from,
+// when an instance is added to or removed from the collector manager, and when it rejects its credentials.
+// The credentials are checked when an instance is added or changed, and again at every resync period
+// while it is monitored, e.g. once its password was changed in Logstash, because the scrapes do not report them.
+type targetEventRecorder struct {
+	manager  shardManager
+	recorder record.EventRecorder
+	// objectOf returns the object the instance was discovered from, or nil if it is unknown
+	objectOf     func(id string) *corev1.ObjectReference
+	probeTimeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	probes chan struct{}
+
+	mu sync.Mutex
+	// instances are the monitored instances, guarded by mu
+	instances map[string]*config.LogstashInstance
+}
+
+func newTargetEventRecorder(manager shardManager, recorder record.EventRecorder, objectOf func(id string) *corev1.ObjectReference, resyncPeriod time.Duration) *targetEventRecorder {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &targetEventRecorder{
+		manager:      manager,
+		recorder:     recorder,
+		objectOf:     objectOf,
+		probeTimeout: eventProbeTimeout,
+		ctx:          ctx,
+		cancel:       cancel,
+		probes:       make(chan struct{}, maxConcurrentEventProbes),
+		instances:    make(map[string]*config.LogstashInstance),
+	}
+
+	if resyncPeriod > 0 {
+		go r.reprobe(resyncPeriod)
+	}
+	return r
+}
+
+// reprobe checks the credentials of the monitored instances at every period, until the recorder is stopped
+func (r *targetEventRecorder) reprobe(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		instances := make(map[string]*config.LogstashInstance, len(r.instances))
+		for id, instance := range r.instances {
+			instances[id] = instance
+		}
+		r.mu.Unlock()
+
+		for id, instance := range instances {
+			if object := r.objectOf(id); object != nil {
+				go r.probe(id, instance, object)
+			}
+		}
+	}
+}
+
+// AddInstance adds the instance to the collector manager, and checks its credentials if it is new or changed
+func (r *targetEventRecorder) AddInstance(id string, instance *config.LogstashInstance) {
+	r.manager.AddInstance(id, instance)
+	r.added(id, instance)
+}
+
+// RemoveInstance removes the instance from the collector manager
+func (r *targetEventRecorder) RemoveInstance(id string) {
+	r.manager.RemoveInstance(id)
+	r.removed(id)
+}
+
+// ReplaceInstances removes and adds the instances in the collector manager at once, e.g. when the shard changes
+func (r *targetEventRecorder) ReplaceInstances(removed []string, added map[string]*config.LogstashInstance) {
+	r.manager.ReplaceInstances(removed, added)
+
+	for _, id := range removed {
+		r.removed(id)
+	}
+	for id, instance := range added {
+		r.added(id, instance)
+	}
+}
+
+// added records the added instance, and checks its credentials if it is new or changed
+func (r *targetEventRecorder) added(id string, instance *config.LogstashInstance) {
+	r.mu.Lock()
+	previous, exists := r.instances[id]
+	r.instances[id] = instance
+	r.mu.Unlock()
+
+	object := r.objectOf(id)
+	if !exists && object != nil {
+		r.recorder.Eventf(object, corev1.EventTypeNormal, eventReasonTargetAdded,
+			"Monitoring the Logstash instance %s at %s", id, instance.Host)
+	}
+	if object != nil && (!exists || !reflect.DeepEqual(previous, instance)) {
+		go r.probe(id, instance, object)
+	}
+}
+
+// removed forgets the removed instance
+func (r *targetEventRecorder) removed(id string) {
+	r.mu.Lock()
+	_, exists := r.instances[id]
+	delete(r.instances, id)
+	r.mu.Unlock()
+
+	if object := r.objectOf(id); exists && object != nil {
+		r.recorder.Eventf(object, corev1.EventTypeNormal, eventReasonTargetRemoved,
+			"Stopped monitoring the Logstash instance %s", id)
+	}
+}
+
+// probe checks the credentials of the instance, unless it was changed or removed in the meantime
+func (r *targetEventRecorder) probe(id string, instance *config.LogstashInstance, object *corev1.ObjectReference) {
+	select {
+	case r.probes <- struct{}{}:
+		defer func() { <-r.probes }()
+	case <-r.ctx.Done():
+		return
+	}
+
+	if !r.isCurrent(id, instance) {
+		return
+	}
+
+	if result := probeInstance(r.ctx, instance, r.probeTimeout); result.authFailed && r.isCurrent(id, instance) {
+		r.recorder.Eventf(object, corev1.EventTypeWarning, eventReasonAuthenticationFailed,
+			"The Logstash instance %s at %s rejected the credentials of the exporter", id, instance.Host)
+	}
+}
+
+func (r *targetEventRecorder) isCurrent(id string, instance *config.LogstashInstance) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.instances[id] == instance
+}
+
+// stop cancels the running checks
+func (r *targetEventRecorder) stop() {
+	r.cancel()
+}
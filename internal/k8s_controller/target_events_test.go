@@ -0,0 +1,132 @@
+package k8s_controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// expectEvent waits for the next event, which must have the reason
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, reason string) {
+	t.Helper()
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, " "+reason+" ") {
+			t.Errorf("expected a %s event, got %q", reason, event)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for a %s event", reason)
+	}
+}
+
+func expectNoEvent(t *testing.T, recorder *record.FakeRecorder) {
+	t.Helper()
+
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("expected no event, got %q", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTargetEventRecorder(t *testing.T) {
+	t.Parallel()
+
+	pod := &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "logging", Name: "logstash-0"}
+	objectOf := func(id string) *corev1.ObjectReference {
+		if id == "logging/logstash-0" {
+			return pod
+		}
+		return nil
+	}
+
+	t.Run("reports the added and removed instances", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "8.15.0")
+		recorder := record.NewFakeRecorder(10)
+		manager := newFakeInstanceManager()
+		events := newTargetEventRecorder(manager, recorder, objectOf, 0)
+		t.Cleanup(events.stop)
+
+		instance := &config.LogstashInstance{Host: server.URL, BasicAuth: &config.ClientAuthConfig{Username: "monitoring", Password: "secret"}}
+		events.AddInstance("logging/logstash-0", instance)
+		expectEvent(t, recorder, eventReasonTargetAdded)
+		if manager.getInstance("logging/logstash-0") != instance {
+			t.Errorf("expected the instance to be added to the manager")
+		}
+
+		// the unchanged instance of a resync is not reported again
+		events.AddInstance("logging/logstash-0", instance)
+		expectNoEvent(t, recorder)
+
+		events.RemoveInstance("logging/logstash-0")
+		expectEvent(t, recorder, eventReasonTargetRemoved)
+		if len(manager.instances) != 0 {
+			t.Errorf("expected the instance to be removed from the manager, got %v", manager.instances)
+		}
+	})
+
+	t.Run("reports the rejected credentials", func(t *testing.T) {
+		t.Parallel()
+
+		server := newTestLogstashServer(t, "8.15.0")
+		recorder := record.NewFakeRecorder(10)
+		events := newTargetEventRecorder(newFakeInstanceManager(), recorder, objectOf, 0)
+		t.Cleanup(events.stop)
+
+		events.AddInstance("logging/logstash-0", &config.LogstashInstance{
+			Host:      server.URL,
+			BasicAuth: &config.ClientAuthConfig{Username: "monitoring", Password: "wrong"},
+		})
+		expectEvent(t, recorder, eventReasonTargetAdded)
+		expectEvent(t, recorder, eventReasonAuthenticationFailed)
+	})
+
+	t.Run("reports the credentials rejected after the instance was added", func(t *testing.T) {
+		t.Parallel()
+
+		var rejected atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rejected.Load() {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"host":"logstash","version":"8.15.0"}`))
+		}))
+		t.Cleanup(server.Close)
+
+		recorder := record.NewFakeRecorder(10)
+		events := newTargetEventRecorder(newFakeInstanceManager(), recorder, objectOf, 100*time.Millisecond)
+		t.Cleanup(events.stop)
+
+		events.AddInstance("logging/logstash-0", &config.LogstashInstance{Host: server.URL})
+		expectEvent(t, recorder, eventReasonTargetAdded)
+
+		// the password is changed in Logstash, while the instance is unchanged
+		rejected.Store(true)
+		expectEvent(t, recorder, eventReasonAuthenticationFailed)
+	})
+
+	t.Run("does not report the instances of unknown objects", func(t *testing.T) {
+		t.Parallel()
+
+		recorder := record.NewFakeRecorder(10)
+		manager := newFakeInstanceManager()
+		events := newTargetEventRecorder(manager, recorder, objectOf, 0)
+		t.Cleanup(events.stop)
+
+		events.AddInstance("logging/logstash-1", &config.LogstashInstance{Host: "http://127.0.0.1:1"})
+		events.RemoveInstance("logging/logstash-1")
+		expectNoEvent(t, recorder)
+	})
+}
@@ -0,0 +1,455 @@
+package k8s_controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	workloadKindStatefulSet = "StatefulSet"
+	workloadKindDeployment  = "Deployment"
+
+	// podWorkloadIndex indexes the pods by the namespaced name of their workload
+	podWorkloadIndex = "workload"
+
+	// the labels added to the metrics of the pods of a workload
+	workloadLabel     = "workload"
+	workloadKindLabel = "workload_kind"
+	ordinalLabel      = "ordinal"
+	nodeLabel         = "node"
+)
+
+// WorkloadResourceHandler monitors the pods of the selected StatefulSets or Deployments, found by their owner
+// references. The instances are named "<kind>/<namespace>/<workload>/<pod>", and the workload name, the ordinal
+// of StatefulSet pods and the node name are added as labels to their metrics.
+type WorkloadResourceHandler struct {
+	*BaseResourceHandler
+
+	kind     string
+	resource string
+	objType  runtime.Object
+	// podLabelSelector selects the pods created by the workloads of the kind
+	podLabelSelector string
+
+	workloadIndexers []cache.Indexer
+	podIndexers      []cache.Indexer
+
+	reconcileMu sync.Mutex
+	// workloadInstances are the instances of the pods of every workload, guarded by reconcileMu
+	workloadInstances *instanceGroups
+}
+
+// NewStatefulSetResourceHandler creates a new StatefulSet resource handler
+func NewStatefulSetResourceHandler(
+	client kubernetes.Interface,
+	instances *shardedInstanceManager,
+	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
+) ResourceHandler {
+	return newWorkloadResourceHandler(
+		newBaseResourceHandler(
+			client,
+			instances,
+			kubeConfig,
+			kubeConfig.Resources.StatefulSets,
+			secrets,
+			namespaces,
+		),
+		workloadKindStatefulSet,
+	)
+}
+
+// NewDeploymentResourceHandler creates a new Deployment resource handler
+func NewDeploymentResourceHandler(
+	client kubernetes.Interface,
+	instances *shardedInstanceManager,
+	kubeConfig config.KubernetesConfig,
+	secrets *secretWatcher,
+	namespaces *namespaceSelector,
+) ResourceHandler {
+	return newWorkloadResourceHandler(
+		newBaseResourceHandler(
+			client,
+			instances,
+			kubeConfig,
+			kubeConfig.Resources.Deployments,
+			secrets,
+			namespaces,
+		),
+		workloadKindDeployment,
+	)
+}
+
+func newWorkloadResourceHandler(base *BaseResourceHandler, kind string) *WorkloadResourceHandler {
+	handler := &WorkloadResourceHandler{
+		BaseResourceHandler: base,
+		kind:                kind,
+		workloadInstances:   newInstanceGroups(base, strings.ToLower(kind)),
+	}
+
+	switch kind {
+	case workloadKindStatefulSet:
+		handler.resource = "statefulsets"
+		handler.objType = &appsv1.StatefulSet{}
+		handler.podLabelSelector = appsv1.ControllerRevisionHashLabelKey
+	case workloadKindDeployment:
+		handler.resource = "deployments"
+		handler.objType = &appsv1.Deployment{}
+		handler.podLabelSelector = appsv1.DefaultDeploymentUniqueLabelKey
+	}
+
+	return handler
+}
+
+// Name returns the name of the resource handler
+func (h *WorkloadResourceHandler) Name() string {
+	return h.resource
+}
+
+// Start starts watching the workloads and their pods
+func (h *WorkloadResourceHandler) Start(ctx context.Context, namespaces []string) error {
+	if !h.resourceConfig.Enabled {
+		slog.Info("workload monitoring is disabled", "kind", h.kind)
+		return nil
+	}
+
+	slog.Info("starting workload monitoring",
+		"kind", h.kind,
+		"annotationPrefix", h.resourceConfig.AnnotationPrefix,
+		"labelSelector", h.resourceConfig.LabelSelector,
+		"fieldSelector", h.resourceConfig.FieldSelector,
+		"portName", h.resourceConfig.PortName,
+		"namespaces", namespaces)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Create the informers of the workloads and their pods for each namespace
+	for _, namespace := range namespaces {
+		// the selectors select the workloads whose pods are monitored
+		workloadListWatcher := cache.NewFilteredListWatchFromClient(
+			h.client.AppsV1().RESTClient(),
+			h.resource,
+			namespace,
+			h.applySelectors,
+		)
+
+		workloadInformer := cache.NewSharedIndexInformer(
+			workloadListWatcher,
+			h.objType,
+			h.config.ResyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+
+		podListWatcher := cache.NewFilteredListWatchFromClient(
+			h.client.CoreV1().RESTClient(),
+			"pods",
+			namespace,
+			func(options *metav1.ListOptions) {
+				options.LabelSelector = h.podLabelSelector
+			},
+		)
+
+		podInformer := cache.NewSharedIndexInformer(
+			podListWatcher,
+			&corev1.Pod{},
+			h.config.ResyncPeriod,
+			cache.Indexers{podWorkloadIndex: h.podWorkloadIndexFunc},
+		)
+
+		_, err := workloadInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.onObjectChange,
+			UpdateFunc: h.onWorkloadUpdate,
+			DeleteFunc: h.onObjectChange,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add event handler to %s informer: %w", h.resource, err)
+		}
+
+		_, err = podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    h.onObjectChange,
+			UpdateFunc: func(_, newObj interface{}) { h.onObjectChange(newObj) },
+			DeleteFunc: h.onObjectChange,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add event handler to pod informer: %w", err)
+		}
+
+		h.informers = append(h.informers, workloadInformer, podInformer)
+		h.stores = append(h.stores, workloadInformer.GetStore())
+		h.workloadIndexers = append(h.workloadIndexers, workloadInformer.GetIndexer())
+		h.podIndexers = append(h.podIndexers, podInformer.GetIndexer())
+	}
+
+	h.namespaces.subscribe(h.resyncWorkloads)
+
+	// Start all informers
+	for _, informer := range h.informers {
+		go informer.Run(h.stopCh)
+	}
+
+	return nil
+}
+
+// podWorkload returns the namespaced name of the workload of the handled kind owning the pod, if any.
+// The pods of a Deployment are owned by a ReplicaSet named after the Deployment and the pod template hash.
+func (h *WorkloadResourceHandler) podWorkload(pod *corev1.Pod) (types.NamespacedName, bool) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return types.NamespacedName{}, false
+	}
+
+	switch {
+	case h.kind == workloadKindStatefulSet && owner.Kind == workloadKindStatefulSet:
+		return types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, true
+	case h.kind == workloadKindDeployment && owner.Kind == "ReplicaSet":
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash == "" || !strings.HasSuffix(owner.Name, "-"+hash) {
+			return types.NamespacedName{}, false
+		}
+		return types.NamespacedName{Namespace: pod.Namespace, Name: strings.TrimSuffix(owner.Name, "-"+hash)}, true
+	}
+
+	return types.NamespacedName{}, false
+}
+
+// podWorkloadIndexFunc indexes a pod by the namespaced name of its workload
+func (h *WorkloadResourceHandler) podWorkloadIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+
+	workload, owned := h.podWorkload(pod)
+	if !owned {
+		return nil, nil
+	}
+
+	return []string{workload.String()}, nil
+}
+
+// onWorkloadUpdate is called when a workload is updated
+func (h *WorkloadResourceHandler) onWorkloadUpdate(oldObj, newObj interface{}) {
+	oldWorkload, err := meta.Accessor(oldObj)
+	if err != nil {
+		slog.Warn("unexpected type in workload update event handler (old object)", "kind", h.kind)
+		return
+	}
+
+	newWorkload, err := meta.Accessor(newObj)
+	if err != nil {
+		slog.Warn("unexpected type in workload update event handler (new object)", "kind", h.kind)
+		return
+	}
+
+	// The pods are watched separately, only the annotations of the workload matter
+	if reflect.DeepEqual(oldWorkload.GetAnnotations(), newWorkload.GetAnnotations()) {
+		return
+	}
+
+	h.onObjectChange(newObj)
+}
+
+// onObjectChange reconciles the instances of the workload of the changed workload or pod
+func (h *WorkloadResourceHandler) onObjectChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	switch object := obj.(type) {
+	case *corev1.Pod:
+		if workload, owned := h.podWorkload(object); owned {
+			h.reconcile(workload)
+		}
+	case *appsv1.StatefulSet, *appsv1.Deployment:
+		workload, _ := meta.Accessor(object)
+		h.reconcile(types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()})
+	default:
+		slog.Warn("unexpected type in workload event handler", "kind", h.kind)
+	}
+}
+
+// resyncWorkloads reconciles the instances of the workloads of a namespace which was selected or unselected
+func (h *WorkloadResourceHandler) resyncWorkloads(namespace string) {
+	workloads := make(map[types.NamespacedName]struct{})
+
+	h.reconcileMu.Lock()
+	for _, workload := range h.workloadInstances.namespaceGroups(namespace) {
+		workloads[workload] = struct{}{}
+	}
+	h.reconcileMu.Unlock()
+
+	h.mu.RLock()
+	for _, indexer := range h.workloadIndexers {
+		objects, _ := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		for _, obj := range objects {
+			if workload, err := meta.Accessor(obj); err == nil {
+				workloads[types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()}] = struct{}{}
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for workload := range workloads {
+		h.reconcile(workload)
+	}
+}
+
+// reconcile adds the new and changed instances of the running pods of the workload,
+// and removes the other instances of the workload
+func (h *WorkloadResourceHandler) reconcile(workloadName types.NamespacedName) {
+	h.reconcileMu.Lock()
+	defer h.reconcileMu.Unlock()
+
+	h.workloadInstances.apply(workloadName, h.podInstances(workloadName))
+}
+
+// podInstances returns the instances of the running pods of the workload by their IDs
+func (h *WorkloadResourceHandler) podInstances(workloadName types.NamespacedName) map[string]endpointInstance {
+	workload := h.getWorkload(workloadName)
+	if workload == nil || !h.namespaces.selected(workloadName.Namespace) {
+		return nil
+	}
+
+	// the instance of the workload holds the URL annotation and the credentials of its pods
+	_, workloadInstance, passwordRef, err := h.extractLogstashInfo(workload.GetAnnotations(), workloadName.Namespace, workloadName.String(), h.schemeURL())
+	if err != nil {
+		h.reconcileError("invalid logstash annotations", "instance", workloadName.String(), "err", err)
+		return nil
+	}
+	if workloadInstance == nil {
+		return nil
+	}
+
+	workloadURL, err := url.Parse(workloadInstance.Host)
+	if err != nil {
+		h.reconcileError("invalid logstash url", "instance", workloadName.String(), "url", workloadInstance.Host, "err", err)
+		return nil
+	}
+
+	instances := make(map[string]endpointInstance)
+	for _, pod := range h.getPods(workloadName) {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		port, found := h.podPort(pod, workloadURL)
+		if !found {
+			continue
+		}
+
+		// the IDs are prefixed with the kind of the workload, as the Services of the workload expand to "<namespace>/<service>/<pod>"
+		id := fmt.Sprintf("%s/%s/%s", strings.ToLower(h.kind), workloadName.String(), pod.Name)
+		instance := *workloadInstance
+		instance.Name = id
+		instance.Host = (&url.URL{Scheme: workloadURL.Scheme, Host: net.JoinHostPort(pod.Status.PodIP, port)}).String()
+		instance.Labels = h.podMetadataLabels(pod, h.podLabels(workloadName.Name, pod))
+		instances[id] = endpointInstance{instance: &instance, secretRefs: instanceSecretRefs{password: passwordRef}, object: objectReference("v1", "Pod", pod)}
+	}
+
+	return instances
+}
+
+// podPort returns the port of the pod, which is the container port with the configured name,
+// or the port of the URL annotation
+func (h *WorkloadResourceHandler) podPort(pod *corev1.Pod, workloadURL *url.URL) (string, bool) {
+	if h.resourceConfig.PortName != "" {
+		if port, found := containerPort(pod, h.resourceConfig.PortName); found {
+			return strconv.Itoa(int(port)), true
+		}
+	}
+
+	if workloadURL.Port() != "" {
+		return workloadURL.Port(), true
+	}
+
+	return "", false
+}
+
+// podLabels returns the labels added to the metrics of the pod of the workload
+func (h *WorkloadResourceHandler) podLabels(workloadName string, pod *corev1.Pod) map[string]string {
+	statefulSetName := ""
+	if h.kind == workloadKindStatefulSet {
+		statefulSetName = workloadName
+	}
+
+	return workloadPodLabels(h.kind, workloadName, statefulSetName, pod)
+}
+
+// workloadPodLabels returns the labels added to the metrics of the pod of a workload.
+// The ordinal is added for the pods of a StatefulSet, when its name is given.
+func workloadPodLabels(kind, workloadName, statefulSetName string, pod *corev1.Pod) map[string]string {
+	labels := map[string]string{
+		workloadLabel:     workloadName,
+		workloadKindLabel: kind,
+		nodeLabel:         pod.Spec.NodeName,
+	}
+
+	if statefulSetName != "" {
+		ordinal, exists := pod.Labels[appsv1.PodIndexLabel]
+		if !exists {
+			ordinal = strings.TrimPrefix(pod.Name, statefulSetName+"-")
+		}
+		labels[ordinalLabel] = ordinal
+	}
+
+	return labels
+}
+
+// getWorkload returns the workload from the informers, or nil if it does not exist
+func (h *WorkloadResourceHandler) getWorkload(workloadName types.NamespacedName) metav1.Object {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, indexer := range h.workloadIndexers {
+		obj, exists, err := indexer.GetByKey(workloadName.String())
+		if err != nil || !exists {
+			continue
+		}
+		if workload, err := meta.Accessor(obj); err == nil {
+			return workload
+		}
+	}
+
+	return nil
+}
+
+// getPods returns the pods of the workload from the informers
+func (h *WorkloadResourceHandler) getPods(workloadName types.NamespacedName) []*corev1.Pod {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var pods []*corev1.Pod
+	for _, indexer := range h.podIndexers {
+		objects, err := indexer.ByIndex(podWorkloadIndex, workloadName.String())
+		if err != nil {
+			continue
+		}
+		for _, obj := range objects {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	return pods
+}
@@ -0,0 +1,182 @@
+package k8s_controller
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestWorkloadHandler creates a handler with stores filled by the test instead of informers
+func newTestWorkloadHandler(manager *fakeInstanceManager, kind string) *WorkloadResourceHandler {
+	kubeConfig := newTestKubernetesConfig()
+	resourceConfig := kubeConfig.Resources.StatefulSets
+	resourceConfig.PortName = "http-api"
+	resourceConfig.Scheme = "http"
+	client := fake.NewSimpleClientset()
+
+	handler := newWorkloadResourceHandler(newBaseResourceHandler(client, manager, kubeConfig,
+		resourceConfig, newSecretWatcher(client, manager, 0), nil), kind)
+	handler.workloadIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})}
+	handler.podIndexers = []cache.Indexer{cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{podWorkloadIndex: handler.podWorkloadIndexFunc})}
+
+	return handler
+}
+
+func newTestWorkloadPod(name, node string, owner metav1.OwnerReference, labels map[string]string) *corev1.Pod {
+	controller := true
+	owner.Controller = &controller
+
+	pod := newTestPod("logging", name, nil)
+	pod.Labels = labels
+	pod.OwnerReferences = []metav1.OwnerReference{owner}
+	pod.Spec.NodeName = node
+	return pod
+}
+
+func TestWorkloadResourceHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("adds the running pods of a statefulset with their ordinal and node", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestWorkloadHandler(manager, workloadKindStatefulSet)
+		owner := metav1.OwnerReference{Kind: workloadKindStatefulSet, Name: "logstash"}
+
+		_ = handler.workloadIndexers[0].Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}})
+		_ = handler.podIndexers[0].Add(newTestWorkloadPod("logstash-0", "node-a", owner,
+			map[string]string{appsv1.PodIndexLabel: "0"}))
+		pending := newTestWorkloadPod("logstash-1", "node-b", owner, nil)
+		pending.Status.Phase = corev1.PodPending
+		_ = handler.podIndexers[0].Add(pending)
+		handler.reconcile(types.NamespacedName{Namespace: "logging", Name: "logstash"})
+
+		if len(manager.instances) != 1 {
+			t.Fatalf("expected the instance of the running pod, got %v", manager.instances)
+		}
+		instance := manager.getInstance("statefulset/logging/logstash/logstash-0")
+		if instance == nil || instance.Host != "http://10.0.0.1:9600" {
+			t.Fatalf("expected the instance of the pod, got %+v", instance)
+		}
+		expected := map[string]string{"workload": "logstash", "workload_kind": "StatefulSet", "ordinal": "0", "node": "node-a"}
+		for name, value := range expected {
+			if instance.Labels[name] != value {
+				t.Errorf("expected label %s to be %q, got %q", name, value, instance.Labels[name])
+			}
+		}
+
+		// the ordinal falls back to the pod name suffix
+		pending.Status.Phase = corev1.PodRunning
+		_ = handler.podIndexers[0].Update(pending)
+		handler.onObjectChange(pending)
+
+		instance = manager.getInstance("statefulset/logging/logstash/logstash-1")
+		if instance == nil || instance.Labels["ordinal"] != "1" {
+			t.Errorf("expected the instance of the started pod with its ordinal, got %+v", instance)
+		}
+	})
+
+	t.Run("copies the configured pod labels without overriding the workload labels", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestWorkloadHandler(manager, workloadKindStatefulSet)
+		handler.resourceConfig.PodLabels = []string{"team", "node"}
+		owner := metav1.OwnerReference{Kind: workloadKindStatefulSet, Name: "logstash"}
+
+		_ = handler.workloadIndexers[0].Add(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}})
+		_ = handler.podIndexers[0].Add(newTestWorkloadPod("logstash-0", "node-a", owner,
+			map[string]string{"team": "data", "node": "pool-1"}))
+		handler.reconcile(types.NamespacedName{Namespace: "logging", Name: "logstash"})
+
+		instance := manager.getInstance("statefulset/logging/logstash/logstash-0")
+		if instance == nil || instance.Labels["team"] != "data" || instance.Labels["node"] != "node-a" {
+			t.Errorf("expected the team label of the pod and the node of the workload labels, got %+v", instance)
+		}
+	})
+
+	t.Run("finds the pods of a deployment through their replicaset", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestWorkloadHandler(manager, workloadKindDeployment)
+		owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "logstash-5d8f9c"}
+
+		_ = handler.workloadIndexers[0].Add(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "logging",
+			Name:        "logstash",
+			Annotations: map[string]string{"logstash-exporter.io/url": "https://logstash:9601"},
+		}})
+		pod := newTestWorkloadPod("logstash-5d8f9c-x2x9z", "node-a", owner,
+			map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5d8f9c"})
+		pod.Spec.Containers[0].Ports = nil
+		_ = handler.podIndexers[0].Add(pod)
+		handler.onObjectChange(pod)
+
+		instance := manager.getInstance("deployment/logging/logstash/logstash-5d8f9c-x2x9z")
+		if instance == nil || instance.Host != "https://10.0.0.1:9601" {
+			t.Fatalf("expected the instance of the annotated deployment, got %+v", instance)
+		}
+		if _, exists := instance.Labels["ordinal"]; exists || instance.Labels["workload_kind"] != "Deployment" {
+			t.Errorf("expected the labels of a deployment pod, got %v", instance.Labels)
+		}
+	})
+
+	t.Run("does not share the instances of the endpoint slices of the workload", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		workloadHandler := newTestWorkloadHandler(manager, workloadKindStatefulSet)
+		sliceHandler := newTestEndpointSliceHandler(manager)
+		serviceName := types.NamespacedName{Namespace: "logging", Name: "logstash"}
+
+		// the StatefulSet and its Service have the same name, as usual
+		statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}}
+		_ = workloadHandler.workloadIndexers[0].Add(statefulSet)
+		_ = workloadHandler.podIndexers[0].Add(newTestWorkloadPod("logstash-0", "node-a",
+			metav1.OwnerReference{Kind: workloadKindStatefulSet, Name: "logstash"}, nil))
+		workloadHandler.reconcile(serviceName)
+
+		_ = sliceHandler.serviceIndexers[0].Add(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}})
+		_ = sliceHandler.sliceIndexers[0].Add(newTestEndpointSlice("logstash-abc", newTestEndpoint("10.0.0.1", "logstash-0", true)))
+		sliceHandler.reconcile(serviceName)
+
+		if len(manager.instances) != 2 {
+			t.Fatalf("expected an instance of each handler, got %v", manager.instances)
+		}
+
+		_ = workloadHandler.workloadIndexers[0].Delete(statefulSet)
+		workloadHandler.onObjectChange(statefulSet)
+
+		if manager.getInstance("statefulset/logging/logstash/logstash-0") != nil || manager.getInstance("logging/logstash/logstash-0") == nil {
+			t.Errorf("expected only the instance of the statefulset to be removed, got %v", manager.instances)
+		}
+	})
+
+	t.Run("removes the instances of a deleted workload", func(t *testing.T) {
+		t.Parallel()
+
+		manager := newFakeInstanceManager()
+		handler := newTestWorkloadHandler(manager, workloadKindStatefulSet)
+
+		statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "logging", Name: "logstash"}}
+		_ = handler.workloadIndexers[0].Add(statefulSet)
+		_ = handler.podIndexers[0].Add(newTestWorkloadPod("logstash-0", "node-a",
+			metav1.OwnerReference{Kind: workloadKindStatefulSet, Name: "logstash"}, nil))
+		handler.onObjectChange(statefulSet)
+
+		_ = handler.workloadIndexers[0].Delete(statefulSet)
+		handler.onObjectChange(cache.DeletedFinalStateUnknown{Key: "logging/logstash", Obj: statefulSet})
+
+		if len(manager.instances) != 0 || len(handler.workloadInstances.instances) != 0 {
+			t.Errorf("expected the instances to be removed, got %v", manager.instances)
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -24,6 +26,13 @@ func (h *SimpleDescHelper) NewDesc(name string, help string, labels ...string) *
 	return prometheus.NewDesc(prometheus.BuildFQName(h.Namespace, h.Subsystem, name), help, labels, nil)
 }
 
+// NewDescWithUnit is the same as NewDesc, but additionally declares the unit of the metric.
+// The unit is exposed by the UnitGatherer, as prometheus.Desc has no notion of units.
+func (h *SimpleDescHelper) NewDescWithUnit(name string, unit string, help string, labels ...string) *prometheus.Desc {
+	RegisterUnit(prometheus.BuildFQName(h.Namespace, h.Subsystem, name), unit)
+	return h.NewDesc(name, help, labels...)
+}
+
 // ExtractFqName extracts the fqName from a prometheus.Desc string.
 // This is useful for testing collectors.
 func ExtractFqName(metric string) (string, error) {
@@ -35,6 +44,35 @@ func ExtractFqName(metric string) (string, error) {
 	return matches[1], nil
 }
 
+// ExtractHelp extracts the help from a prometheus.Desc string.
+func ExtractHelp(metric string) (string, error) {
+	regex := regexp.MustCompile(`help:\s*("(?:[^"\\]|\\.)*")`)
+	matches := regex.FindStringSubmatch(metric)
+	if len(matches) < 2 {
+		return "", errors.New("failed to extract help from metric string")
+	}
+	return strconv.Unquote(matches[1])
+}
+
+// ExtractVariableLabels extracts the names of the variable labels from a prometheus.Desc string.
+func ExtractVariableLabels(metric string) ([]string, error) {
+	regex := regexp.MustCompile(`variableLabels:\s*\{([^}]*)\}`)
+	matches := regex.FindStringSubmatch(metric)
+	if len(matches) < 2 {
+		return nil, errors.New("failed to extract variable labels from metric string")
+	}
+	if matches[1] == "" {
+		return nil, nil
+	}
+
+	labels := strings.Split(matches[1], ",")
+	for i, label := range labels {
+		// constrained labels are printed as c(name)
+		labels[i] = strings.TrimSuffix(strings.TrimPrefix(label, "c("), ")")
+	}
+	return labels, nil
+}
+
 // ExtractValueFromMetric extracts the value from a prometheus.Metric object.
 // It creates a custom collector and registry, registers the given metric, and then collects
 // the metric value using the registry.
@@ -59,6 +97,11 @@ type SimpleMetricsHelper struct {
 	Channel       chan<- prometheus.Metric
 	Labels        []string
 	DefaultLabels []string
+
+	// CreatedTimestamp is attached to every counter created by the helper,
+	// allowing OpenMetrics consumers to detect counter resets.
+	// Zero value means that no created timestamp is attached.
+	CreatedTimestamp time.Time
 }
 
 func (mh *SimpleMetricsHelper) getMergedLabels() []string {
@@ -69,7 +112,14 @@ func (mh *SimpleMetricsHelper) getMergedLabels() []string {
 // optional Labels could be specified through property setter
 func (mh *SimpleMetricsHelper) NewFloatMetric(desc *prometheus.Desc, metricType prometheus.ValueType, value float64) {
 	mergedLabels := mh.getMergedLabels()
-	metric := prometheus.MustNewConstMetric(desc, metricType, value, mergedLabels...)
+
+	var metric prometheus.Metric
+	if metricType == prometheus.CounterValue && !mh.CreatedTimestamp.IsZero() {
+		metric = prometheus.MustNewConstMetricWithCreatedTimestamp(desc, metricType, value, mh.CreatedTimestamp, mergedLabels...)
+	} else {
+		metric = prometheus.MustNewConstMetric(desc, metricType, value, mergedLabels...)
+	}
+
 	mh.Channel <- metric
 }
 
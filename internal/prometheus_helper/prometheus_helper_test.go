@@ -3,6 +3,7 @@ package prometheus_helper
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
 
@@ -59,6 +60,55 @@ func TestExtractFqdnName(t *testing.T) {
 	})
 }
 
+func TestExtractHelp(t *testing.T) {
+	t.Run("should properly extract help from valid metric description", func(t *testing.T) {
+		desc := prometheus.NewDesc("metric", `help with "quotes"`, nil, nil)
+
+		help, err := ExtractHelp(desc.String())
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if help != `help with "quotes"` {
+			t.Errorf("incorrect help, got %s", help)
+		}
+	})
+
+	t.Run("should return error if metric description is invalid", func(t *testing.T) {
+		_, err := ExtractHelp("invalid metric description")
+		if err == nil {
+			t.Errorf("expected error but got nil")
+		}
+	})
+}
+
+func TestExtractVariableLabels(t *testing.T) {
+	t.Run("should properly extract variable labels from valid metric description", func(t *testing.T) {
+		helper := &SimpleDescHelper{Namespace: "logstash_exporter", Subsystem: "test"}
+
+		labels, err := ExtractVariableLabels(helper.NewDesc("metric", "help", "pipeline").String())
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !slices.Equal(labels, []string{"pipeline", "hostname", "instance_name"}) {
+			t.Errorf("incorrect labels, got %v", labels)
+		}
+	})
+
+	t.Run("should return no labels for a metric without variable labels", func(t *testing.T) {
+		labels, err := ExtractVariableLabels(prometheus.NewDesc("metric", "help", nil, nil).String())
+		if err != nil || len(labels) != 0 {
+			t.Errorf("expected no labels, got %v, %v", labels, err)
+		}
+	})
+
+	t.Run("should return error if metric description is invalid", func(t *testing.T) {
+		_, err := ExtractVariableLabels("invalid metric description")
+		if err == nil {
+			t.Errorf("expected error but got nil")
+		}
+	})
+}
+
 type badMetricStub struct{}
 
 func (m *badMetricStub) Desc() *prometheus.Desc {
@@ -212,6 +262,38 @@ func TestSimpleMetricsHelper(t *testing.T) {
 		}
 	})
 
+	t.Run("should attach created timestamp to counters only", func(t *testing.T) {
+		metricDesc := prometheus.NewDesc("test_metric", "test metric help", nil, nil)
+		createdTimestamp := time.Unix(42, 0)
+
+		ch := make(chan prometheus.Metric, 2)
+
+		helper := &SimpleMetricsHelper{
+			Channel:          ch,
+			Labels:           []string{},
+			CreatedTimestamp: createdTimestamp,
+		}
+		helper.NewFloatMetric(metricDesc, prometheus.CounterValue, 1)
+		helper.NewFloatMetric(metricDesc, prometheus.GaugeValue, 1)
+
+		close(ch)
+
+		var counter, gauge dto.Metric
+		if err := (<-ch).Write(&counter); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := (<-ch).Write(&gauge); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !counter.GetCounter().GetCreatedTimestamp().AsTime().Equal(createdTimestamp) {
+			t.Errorf("expected created timestamp %v, got %v", createdTimestamp, counter.GetCounter().GetCreatedTimestamp().AsTime())
+		}
+		if gauge.GetGauge() == nil {
+			t.Errorf("expected gauge metric")
+		}
+	})
+
 	t.Run("should create timestamp metric", func(t *testing.T) {
 		metricName := "test_metric"
 		metricDesc := prometheus.NewDesc(metricName, "test metric help", nil, nil)
@@ -0,0 +1,57 @@
+package prometheus_helper
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Units that can be declared on metrics, following the OpenMetrics base units.
+const (
+	UnitSeconds = "seconds"
+	UnitBytes   = "bytes"
+)
+
+var declaredUnits sync.Map
+
+// RegisterUnit declares the unit of the metric with the given fqName.
+// The unit is only declared if the metric name ends with it (ignoring the "_total" suffix),
+// as OpenMetrics requires the unit to be a suffix of the metric name.
+func RegisterUnit(fqName string, unit string) {
+	if !strings.HasSuffix(strings.TrimSuffix(fqName, "_total"), "_"+unit) {
+		return
+	}
+
+	declaredUnits.Store(fqName, unit)
+}
+
+// GetUnit returns the unit declared for the metric with the given fqName.
+func GetUnit(fqName string) (string, bool) {
+	unit, ok := declaredUnits.Load(fqName)
+	if !ok {
+		return "", false
+	}
+
+	return unit.(string), true
+}
+
+// UnitGatherer wraps a prometheus.Gatherer and sets the unit
+// of every gathered metric family that has a declared unit.
+type UnitGatherer struct {
+	prometheus.Gatherer
+}
+
+// Gather implements prometheus.Gatherer
+func (g UnitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	metricFamilies, err := g.Gatherer.Gather()
+
+	for _, metricFamily := range metricFamilies {
+		if unit, ok := GetUnit(metricFamily.GetName()); ok {
+			metricFamily.Unit = &unit
+		}
+	}
+
+	return metricFamilies, err
+}
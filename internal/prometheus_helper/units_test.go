@@ -0,0 +1,77 @@
+package prometheus_helper
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterUnit(t *testing.T) {
+	t.Run("should register unit matching the metric name suffix", func(t *testing.T) {
+		RegisterUnit("units_test_memory_bytes", UnitBytes)
+		RegisterUnit("units_test_duration_seconds_total", UnitSeconds)
+
+		unit, ok := GetUnit("units_test_memory_bytes")
+		if !ok || unit != UnitBytes {
+			t.Errorf("expected unit %s, got %s", UnitBytes, unit)
+		}
+
+		unit, ok = GetUnit("units_test_duration_seconds_total")
+		if !ok || unit != UnitSeconds {
+			t.Errorf("expected unit %s, got %s", UnitSeconds, unit)
+		}
+	})
+
+	t.Run("should ignore unit not matching the metric name suffix", func(t *testing.T) {
+		RegisterUnit("units_test_uptime_millis", UnitSeconds)
+
+		if unit, ok := GetUnit("units_test_uptime_millis"); ok {
+			t.Errorf("expected no unit, got %s", unit)
+		}
+	})
+}
+
+func TestUnitGatherer(t *testing.T) {
+	helper := &SimpleDescHelper{Namespace: "units_test", Subsystem: "gatherer"}
+	withUnit := helper.NewDescWithUnit("heap_bytes", UnitBytes, "help")
+	withoutUnit := helper.NewDesc("threads_count", "help")
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&constCollector{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(withUnit, prometheus.GaugeValue, 1, "host", "name"),
+		prometheus.MustNewConstMetric(withoutUnit, prometheus.GaugeValue, 1, "host", "name"),
+	}})
+
+	metricFamilies, err := UnitGatherer{Gatherer: registry}.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	units := make(map[string]string)
+	for _, metricFamily := range metricFamilies {
+		units[metricFamily.GetName()] = metricFamily.GetUnit()
+	}
+
+	if units["units_test_gatherer_heap_bytes"] != UnitBytes {
+		t.Errorf("expected unit %s, got %q", UnitBytes, units["units_test_gatherer_heap_bytes"])
+	}
+	if units["units_test_gatherer_threads_count"] != "" {
+		t.Errorf("expected no unit, got %q", units["units_test_gatherer_threads_count"])
+	}
+}
+
+type constCollector struct {
+	metrics []prometheus.Metric
+}
+
+func (c *constCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range c.metrics {
+		ch <- metric.Desc()
+	}
+}
+
+func (c *constCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+}
@@ -0,0 +1,123 @@
+package push
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+	"github.com/kuskoman/logstash-exporter/pkg/tls"
+)
+
+// OTLPSink exports the metrics to an OpenTelemetry collector with OTLP over HTTP or gRPC
+type OTLPSink struct {
+	protocol  string
+	exporter  sdkmetric.Exporter
+	startTime time.Time
+}
+
+// NewOTLPSink creates a new OTLPSink from the configuration
+func NewOTLPSink(ctx context.Context, cfg *config.OTLPConfig) (*OTLPSink, error) {
+	headers, err := getOTLPHeaders(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var exporter sdkmetric.Exporter
+	switch cfg.Protocol {
+	case config.OTLPProtocolGRPC:
+		options := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpointURL(cfg.URL),
+			otlpmetricgrpc.WithHeaders(headers),
+			otlpmetricgrpc.WithTimeout(cfg.Timeout),
+		}
+		if cfg.TLSConfig != nil {
+			tlsConfig, err := tls.ConfigureClientTLS(cfg.TLSConfig.CAFile, cfg.TLSConfig.ServerName, cfg.TLSConfig.InsecureSkipVerify)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, options...)
+	default:
+		options := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpointURL(cfg.URL),
+			otlpmetrichttp.WithHeaders(headers),
+			otlpmetrichttp.WithTimeout(cfg.Timeout),
+		}
+		if cfg.TLSConfig != nil {
+			tlsConfig, err := tls.ConfigureClientTLS(cfg.TLSConfig.CAFile, cfg.TLSConfig.ServerName, cfg.TLSConfig.InsecureSkipVerify)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		}
+		exporter, err = otlpmetrichttp.New(ctx, options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &OTLPSink{
+		protocol:  cfg.Protocol,
+		exporter:  exporter,
+		startTime: time.Now(),
+	}, nil
+}
+
+// getOTLPHeaders returns the configured headers together with the authorization header
+func getOTLPHeaders(cfg *config.OTLPConfig) (map[string]string, error) {
+	headers := make(map[string]string, len(cfg.Headers)+1)
+	for name, value := range cfg.Headers {
+		headers[name] = value
+	}
+
+	if cfg.BasicAuth != nil {
+		password, err := cfg.BasicAuth.GetPassword()
+		if err != nil {
+			return nil, err
+		}
+		encodedCredentials := base64.StdEncoding.EncodeToString([]byte(cfg.BasicAuth.Username + ":" + password))
+		headers["Authorization"] = "Basic " + encodedCredentials
+	}
+
+	token, err := cfg.GetBearerToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	return headers, nil
+}
+
+func (s *OTLPSink) Name() string {
+	return fmt.Sprintf("otlp/%s", s.protocol)
+}
+
+// Push exports the metrics of every Logstash instance as a separate resource.
+// Counters without a created timestamp use the start of the exporter as their start time.
+func (s *OTLPSink) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	var errs []error
+	for _, resourceMetrics := range familiesToResourceMetrics(families, timestamp, s.startTime) {
+		if err := s.exporter.Export(ctx, resourceMetrics); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shutdown flushes and closes the connection to the collector
+func (s *OTLPSink) Shutdown(ctx context.Context) error {
+	return s.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,261 @@
+package push
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+func logstashFamilies(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	events := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "logstash_test_events", Help: "events"}, []string{"pipeline", "hostname", "instance_name"})
+	events.WithLabelValues("main", "http://first:9600", "first").Add(10)
+	events.WithLabelValues("main", "http://second:9600", "second").Add(20)
+	scrapes := prometheus.NewGauge(prometheus.GaugeOpts{Name: "logstash_test_exporter_gauge", Help: "exporter"})
+	scrapes.Set(1)
+	registry.MustRegister(events, scrapes)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	return families
+}
+
+func getResourceAttribute(resourceMetrics *metricdata.ResourceMetrics, key string) string {
+	value, _ := resourceMetrics.Resource.Set().Value(attribute.Key(key))
+	return value.AsString()
+}
+
+func TestFamiliesToResourceMetrics(t *testing.T) {
+	t.Parallel()
+
+	families := logstashFamilies(t)
+	timestamp := time.Now()
+	startTime := timestamp.Add(-time.Hour)
+
+	resourceMetrics := familiesToResourceMetrics(families, timestamp, startTime)
+
+	if len(resourceMetrics) != 3 {
+		t.Fatalf("expected 3 resources, got %d", len(resourceMetrics))
+	}
+
+	instances := make(map[string]*metricdata.ResourceMetrics)
+	for _, rm := range resourceMetrics {
+		instances[getResourceAttribute(rm, "instance_name")] = rm
+	}
+
+	first, ok := instances["first"]
+	if !ok {
+		t.Fatalf("expected a resource for the first instance")
+	}
+	if getResourceAttribute(first, "hostname") != "http://first:9600" || getResourceAttribute(first, "service.name") != logstashServiceName {
+		t.Errorf("unexpected resource attributes: %v", first.Resource.Attributes())
+	}
+
+	metrics := first.ScopeMetrics[0].Metrics
+	if len(metrics) != 1 || metrics[0].Name != "logstash_test_events" {
+		t.Fatalf("expected a single events metric, got %v", metrics)
+	}
+
+	sum, ok := metrics[0].Data.(metricdata.Sum[float64])
+	if !ok || !sum.IsMonotonic || sum.Temporality != metricdata.CumulativeTemporality {
+		t.Fatalf("expected a cumulative monotonic sum, got %#v", metrics[0].Data)
+	}
+	dataPoint := sum.DataPoints[0]
+	// the created timestamp of the counter takes precedence over the start time of the exporter
+	if dataPoint.Value != 10 || dataPoint.StartTime.Equal(startTime) || dataPoint.StartTime.After(timestamp) || !dataPoint.Time.Equal(timestamp) {
+		t.Errorf("unexpected data point: %#v", dataPoint)
+	}
+	if pipeline, _ := dataPoint.Attributes.Value("pipeline"); pipeline.AsString() != "main" || dataPoint.Attributes.Len() != 1 {
+		t.Errorf("expected only the pipeline attribute, got %v", dataPoint.Attributes.ToSlice())
+	}
+
+	exporter, ok := instances[""]
+	if !ok || getResourceAttribute(exporter, "service.name") != exporterServiceName {
+		t.Fatalf("expected the exporter metrics in a separate resource")
+	}
+	if _, ok := exporter.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]); !ok {
+		t.Errorf("expected a gauge, got %#v", exporter.ScopeMetrics[0].Metrics[0].Data)
+	}
+}
+
+func TestToExplicitBuckets(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_histogram", Help: "test", Buckets: []float64{1, 5}})
+	for _, value := range []float64{0.5, 0.7, 3, 10} {
+		histogram.Observe(value)
+	}
+	registry.MustRegister(histogram)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	bounds, bucketCounts := toExplicitBuckets(families[0].GetMetric()[0].GetHistogram())
+
+	expectedBounds := []float64{1, 5}
+	expectedCounts := []uint64{2, 1, 1}
+	if len(bounds) != len(expectedBounds) || bounds[0] != expectedBounds[0] || bounds[1] != expectedBounds[1] {
+		t.Errorf("expected bounds %v, got %v", expectedBounds, bounds)
+	}
+	if len(bucketCounts) != len(expectedCounts) {
+		t.Fatalf("expected bucket counts %v, got %v", expectedCounts, bucketCounts)
+	}
+	for i := range expectedCounts {
+		if bucketCounts[i] != expectedCounts[i] {
+			t.Errorf("expected bucket counts %v, got %v", expectedCounts, bucketCounts)
+		}
+	}
+}
+
+func TestOTLPSinkHTTP(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var authorization string
+	var requests []*collectormetrics.ExportMetricsServiceRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+			return
+		}
+
+		request := &collectormetrics.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("failed to unmarshal request: %v", err)
+			return
+		}
+
+		mu.Lock()
+		authorization = r.Header.Get("Authorization")
+		requests = append(requests, request)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink, err := NewOTLPSink(context.Background(), &config.OTLPConfig{
+		PushClientConfig: config.PushClientConfig{
+			URL:              server.URL + "/v1/metrics",
+			Timeout:          time.Second,
+			HTTPClientConfig: config.HTTPClientConfig{BearerToken: "secret"},
+		},
+		Protocol: config.OTLPProtocolHTTP,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer func() { _ = sink.Shutdown(context.Background()) }()
+
+	if err := sink.Push(context.Background(), logstashFamilies(t), time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(requests) != 3 {
+		t.Fatalf("expected a request per resource, got %d", len(requests))
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("expected bearer token, got %q", authorization)
+	}
+
+	resourceMetrics := requests[0].GetResourceMetrics()[0]
+	metric := resourceMetrics.GetScopeMetrics()[0].GetMetrics()[0]
+	if metric.GetName() != "logstash_test_events" || metric.GetSum() == nil {
+		t.Errorf("expected the events sum, got %v", metric)
+	}
+}
+
+type metricsServiceServer struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+	headers  []metadata.MD
+}
+
+func (s *metricsServiceServer) Export(ctx context.Context, request *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, request)
+	s.headers = append(s.headers, md)
+
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPSinkGRPC(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	service := &metricsServiceServer{}
+	grpcServer := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(grpcServer, service)
+	go func() { _ = grpcServer.Serve(listener) }()
+	defer grpcServer.Stop()
+
+	sink, err := NewOTLPSink(context.Background(), &config.OTLPConfig{
+		PushClientConfig: config.PushClientConfig{
+			URL:              "http://" + listener.Addr().String(),
+			Timeout:          5 * time.Second,
+			HTTPClientConfig: config.HTTPClientConfig{BasicAuth: &config.ClientAuthConfig{Username: "user", Password: "pass"}},
+		},
+		Protocol: config.OTLPProtocolGRPC,
+		Headers:  map[string]string{"x-tenant": "logstash"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer func() { _ = sink.Shutdown(context.Background()) }()
+
+	if err := sink.Push(context.Background(), logstashFamilies(t), time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if len(service.requests) != 3 {
+		t.Fatalf("expected a request per resource, got %d", len(service.requests))
+	}
+	headers := service.headers[0]
+	if tenant := headers.Get("x-tenant"); len(tenant) != 1 || tenant[0] != "logstash" {
+		t.Errorf("expected the configured header, got %v", tenant)
+	}
+	if auth := headers.Get("authorization"); len(auth) != 1 || auth[0] != "Basic dXNlcjpwYXNz" {
+		t.Errorf("expected basic auth header, got %v", auth)
+	}
+}
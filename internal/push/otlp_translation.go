@@ -0,0 +1,203 @@
+package push
+
+import (
+	"math"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	// otlpScopeName is the instrumentation scope of the exported metrics
+	otlpScopeName = "github.com/kuskoman/logstash-exporter"
+
+	logstashServiceName = "logstash"
+	exporterServiceName = "logstash-exporter"
+)
+
+// resourceLabels are the labels identifying the Logstash instance of a metric.
+// They are moved from the metric attributes to the resource attributes.
+var resourceLabels = []string{"hostname", "instance_name"}
+
+// ucumUnits maps the units declared by the collectors to their UCUM codes used by OpenTelemetry
+var ucumUnits = map[string]string{
+	prometheus_helper.UnitSeconds: "s",
+	prometheus_helper.UnitBytes:   "By",
+}
+
+// resourceMetricsBuilder accumulates the metrics of a single resource
+type resourceMetricsBuilder struct {
+	resource *resource.Resource
+	metrics  []metricdata.Metrics
+	index    map[string]int
+}
+
+// familiesToResourceMetrics translates the gathered metric families into OpenTelemetry metrics.
+// The metrics of every Logstash instance are exported as a separate resource,
+// with the hostname and instance_name labels as resource attributes.
+// The metrics of the exporter itself are exported as the "logstash-exporter" service.
+func familiesToResourceMetrics(families []*dto.MetricFamily, timestamp time.Time, startTime time.Time) []*metricdata.ResourceMetrics {
+	var builders []*resourceMetricsBuilder
+	buildersByResource := make(map[attribute.Distinct]*resourceMetricsBuilder)
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			res, attributes := splitResourceAttributes(metric.GetLabel())
+
+			builder, ok := buildersByResource[res.Equivalent()]
+			if !ok {
+				builder = &resourceMetricsBuilder{resource: res, index: make(map[string]int)}
+				buildersByResource[res.Equivalent()] = builder
+				builders = append(builders, builder)
+			}
+
+			pointTime := timestamp
+			if metric.TimestampMs != nil {
+				pointTime = time.UnixMilli(metric.GetTimestampMs())
+			}
+
+			builder.appendDataPoint(family, metric, attributes, startTime, pointTime)
+		}
+	}
+
+	resourceMetrics := make([]*metricdata.ResourceMetrics, len(builders))
+	for i, builder := range builders {
+		resourceMetrics[i] = &metricdata.ResourceMetrics{
+			Resource: builder.resource,
+			ScopeMetrics: []metricdata.ScopeMetrics{{
+				Scope:   instrumentation.Scope{Name: otlpScopeName, Version: config.Version},
+				Metrics: builder.metrics,
+			}},
+		}
+	}
+
+	return resourceMetrics
+}
+
+// splitResourceAttributes splits the labels of a metric into the resource it belongs to and its own attributes
+func splitResourceAttributes(labels []*dto.LabelPair) (*resource.Resource, attribute.Set) {
+	var resourceAttributes, metricAttributes []attribute.KeyValue
+
+	for _, labelPair := range labels {
+		isResourceLabel := false
+		for _, resourceLabel := range resourceLabels {
+			if labelPair.GetName() == resourceLabel {
+				isResourceLabel = true
+				break
+			}
+		}
+
+		keyValue := attribute.String(labelPair.GetName(), labelPair.GetValue())
+		if isResourceLabel {
+			resourceAttributes = append(resourceAttributes, keyValue)
+		} else {
+			metricAttributes = append(metricAttributes, keyValue)
+		}
+	}
+
+	serviceName := exporterServiceName
+	if len(resourceAttributes) > 0 {
+		serviceName = logstashServiceName
+	}
+	resourceAttributes = append(resourceAttributes, attribute.String("service.name", serviceName))
+
+	return resource.NewSchemaless(resourceAttributes...), attribute.NewSet(metricAttributes...)
+}
+
+// appendDataPoint appends the metric as a data point of the OpenTelemetry metric of its family
+func (builder *resourceMetricsBuilder) appendDataPoint(family *dto.MetricFamily, metric *dto.Metric, attributes attribute.Set, startTime time.Time, pointTime time.Time) {
+	i, ok := builder.index[family.GetName()]
+	if !ok {
+		unit, _ := prometheus_helper.GetUnit(family.GetName())
+		builder.metrics = append(builder.metrics, metricdata.Metrics{
+			Name:        family.GetName(),
+			Description: family.GetHelp(),
+			Unit:        ucumUnits[unit],
+		})
+		i = len(builder.metrics) - 1
+		builder.index[family.GetName()] = i
+	}
+	otelMetric := &builder.metrics[i]
+
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		counter := metric.GetCounter()
+		if counter.GetCreatedTimestamp() != nil {
+			startTime = counter.GetCreatedTimestamp().AsTime()
+		}
+		sum, _ := otelMetric.Data.(metricdata.Sum[float64])
+		sum.Temporality = metricdata.CumulativeTemporality
+		sum.IsMonotonic = true
+		sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+			Attributes: attributes, StartTime: startTime, Time: pointTime, Value: counter.GetValue(),
+		})
+		otelMetric.Data = sum
+	case dto.MetricType_SUMMARY:
+		summary := metric.GetSummary()
+		if summary.GetCreatedTimestamp() != nil {
+			startTime = summary.GetCreatedTimestamp().AsTime()
+		}
+		quantiles := make([]metricdata.QuantileValue, len(summary.GetQuantile()))
+		for j, quantile := range summary.GetQuantile() {
+			quantiles[j] = metricdata.QuantileValue{Quantile: quantile.GetQuantile(), Value: quantile.GetValue()}
+		}
+		otelSummary, _ := otelMetric.Data.(metricdata.Summary)
+		otelSummary.DataPoints = append(otelSummary.DataPoints, metricdata.SummaryDataPoint{
+			Attributes: attributes, StartTime: startTime, Time: pointTime,
+			Count: summary.GetSampleCount(), Sum: summary.GetSampleSum(), QuantileValues: quantiles,
+		})
+		otelMetric.Data = otelSummary
+	case dto.MetricType_HISTOGRAM:
+		histogram := metric.GetHistogram()
+		if histogram.GetCreatedTimestamp() != nil {
+			startTime = histogram.GetCreatedTimestamp().AsTime()
+		}
+		bounds, bucketCounts := toExplicitBuckets(histogram)
+		otelHistogram, _ := otelMetric.Data.(metricdata.Histogram[float64])
+		otelHistogram.Temporality = metricdata.CumulativeTemporality
+		otelHistogram.DataPoints = append(otelHistogram.DataPoints, metricdata.HistogramDataPoint[float64]{
+			Attributes: attributes, StartTime: startTime, Time: pointTime,
+			Count: histogram.GetSampleCount(), Sum: histogram.GetSampleSum(), Bounds: bounds, BucketCounts: bucketCounts,
+		})
+		otelMetric.Data = otelHistogram
+	default:
+		value := metric.GetGauge().GetValue()
+		if family.GetType() == dto.MetricType_UNTYPED {
+			value = metric.GetUntyped().GetValue()
+		}
+		gauge, _ := otelMetric.Data.(metricdata.Gauge[float64])
+		gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+			Attributes: attributes, Time: pointTime, Value: value,
+		})
+		otelMetric.Data = gauge
+	}
+}
+
+// toExplicitBuckets converts the cumulative Prometheus buckets into the bounds
+// and the per-bucket counts of an OpenTelemetry explicit bucket histogram
+func toExplicitBuckets(histogram *dto.Histogram) ([]float64, []uint64) {
+	var bounds []float64
+	var bucketCounts []uint64
+	var previousCount uint64
+
+	for _, bucket := range histogram.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		bounds = append(bounds, bucket.GetUpperBound())
+		bucketCounts = append(bucketCounts, bucket.GetCumulativeCount()-previousCount)
+		previousCount = bucket.GetCumulativeCount()
+	}
+
+	// the last bucket of OpenTelemetry histograms is unbounded
+	bucketCounts = append(bucketCounts, histogram.GetSampleCount()-previousCount)
+
+	return bounds, bucketCounts
+}
@@ -0,0 +1,170 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+	"github.com/kuskoman/logstash-exporter/pkg/tls"
+)
+
+// Sink is a remote endpoint the collected metrics are pushed to
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+	// Push sends the metric families, collected at the given timestamp, to the sink
+	Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error
+}
+
+// shutdowner is implemented by the sinks holding connections that have to be closed
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Pusher periodically gathers the metrics and pushes them to all configured sinks.
+// It is used instead of being scraped when no Prometheus can reach the exporter.
+type Pusher struct {
+	gatherer prometheus.Gatherer
+	interval time.Duration
+	sinks    []Sink
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPusher creates a new Pusher gathering the metrics from the gatherer every interval
+func NewPusher(gatherer prometheus.Gatherer, interval time.Duration, sinks ...Sink) *Pusher {
+	return &Pusher{
+		gatherer: gatherer,
+		interval: interval,
+		sinks:    sinks,
+	}
+}
+
+// NewSinks creates the sinks enabled in the push configuration
+func NewSinks(ctx context.Context, cfg *config.PushConfig) ([]Sink, error) {
+	var sinks []Sink
+
+	if cfg.RemoteWrite != nil {
+		sink, err := NewRemoteWriteSink(cfg.RemoteWrite)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote_write sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.OTLP != nil {
+		sink, err := NewOTLPSink(ctx, cfg.OTLP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.Pushgateway != nil {
+		sink, err := NewPushgatewaySink(cfg.Pushgateway)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pushgateway sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// Start starts pushing the metrics in a separate goroutine, until Stop is called
+func (p *Pusher) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pushCtx, cancel := context.WithTimeout(ctx, p.interval)
+				err := p.PushOnce(pushCtx)
+				cancel()
+				if err != nil {
+					slog.Error("failed to push metrics", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops pushing the metrics, waits for the in-flight push to finish and shuts down the sinks
+func (p *Pusher) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel == nil {
+		return nil
+	}
+
+	p.cancel()
+	p.cancel = nil
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var errs []error
+	for _, sink := range p.sinks {
+		if s, ok := sink.(shutdowner); ok {
+			if err := s.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PushOnce gathers the metrics and pushes them to all sinks
+func (p *Pusher) PushOnce(ctx context.Context) error {
+	timestamp := time.Now()
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		// the gatherer returns the successfully gathered families along with the error
+		slog.Warn("error while gathering metrics to push", "error", err)
+	}
+
+	var errs []error
+	for _, sink := range p.sinks {
+		pushStart := time.Now()
+		err := sink.Push(ctx, families, timestamp)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		slog.Debug("pushed metrics", "sink", sink.Name(), "families", len(families), "duration", time.Since(pushStart))
+	}
+
+	return errors.Join(errs...)
+}
+
+// newHTTPClient creates the HTTP client used by a sink to push the metrics
+func newHTTPClient(cfg *config.PushClientConfig) (*http.Client, error) {
+	return tls.ConfigureHTTPClient(&cfg.HTTPClientConfig, cfg.Timeout)
+}
@@ -0,0 +1,128 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+type mockSink struct {
+	mu       sync.Mutex
+	pushes   int
+	families int
+	err      error
+}
+
+func (m *mockSink) Name() string {
+	return "mock"
+}
+
+func (m *mockSink) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pushes++
+	m.families = len(families)
+	return m.err
+}
+
+func (m *mockSink) pushCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pushes
+}
+
+func newTestGatherer(t *testing.T) prometheus.Gatherer {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test"})
+	registry.MustRegister(gauge)
+	return registry
+}
+
+func TestPushOnce(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pushes to all sinks", func(t *testing.T) {
+		t.Parallel()
+
+		first, second := &mockSink{}, &mockSink{}
+		pusher := NewPusher(newTestGatherer(t), time.Minute, first, second)
+
+		if err := pusher.PushOnce(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, sink := range []*mockSink{first, second} {
+			if sink.pushCount() != 1 || sink.families != 1 {
+				t.Errorf("expected a single push of 1 family, got %d pushes of %d families", sink.pushCount(), sink.families)
+			}
+		}
+	})
+
+	t.Run("returns errors of failing sinks", func(t *testing.T) {
+		t.Parallel()
+
+		failing, working := &mockSink{err: errors.New("push failed")}, &mockSink{}
+		pusher := NewPusher(newTestGatherer(t), time.Minute, failing, working)
+
+		if err := pusher.PushOnce(context.Background()); err == nil {
+			t.Errorf("expected an error")
+		}
+		if working.pushCount() != 1 {
+			t.Errorf("expected the working sink to be pushed to despite the failure")
+		}
+	})
+}
+
+func TestPusherStartStop(t *testing.T) {
+	t.Parallel()
+
+	sink := &mockSink{}
+	pusher := NewPusher(newTestGatherer(t), 10*time.Millisecond, sink)
+
+	pusher.Start(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for sink.pushCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := pusher.Stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pushes := sink.pushCount()
+	if pushes < 2 {
+		t.Fatalf("expected at least 2 pushes, got %d", pushes)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if sink.pushCount() != pushes {
+		t.Errorf("expected no pushes after stopping")
+	}
+}
+
+func TestNewSinks(t *testing.T) {
+	t.Parallel()
+
+	sinks, err := NewSinks(context.Background(), &config.PushConfig{})
+	if err != nil || len(sinks) != 0 {
+		t.Errorf("expected no sinks, got %v (err: %v)", sinks, err)
+	}
+
+	sinks, err = NewSinks(context.Background(), &config.PushConfig{RemoteWrite: &config.RemoteWriteConfig{
+		PushClientConfig: config.PushClientConfig{URL: "http://localhost:9090/api/v1/write"},
+	}})
+	if err != nil || len(sinks) != 1 || sinks[0].Name() != "remote_write" {
+		t.Errorf("expected a remote_write sink, got %v (err: %v)", sinks, err)
+	}
+}
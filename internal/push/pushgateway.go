@@ -0,0 +1,214 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	pushgateway "github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	// upMetricName tells whether the Logstash API of an instance responded to the last collection
+	upMetricName = "logstash_info_up"
+	// statsMetricPrefix is the prefix of the metrics collected from the node stats of an instance
+	statsMetricPrefix = "logstash_stats_"
+
+	// instanceGroupingLabel identifies the Logstash instance in the grouping key
+	instanceGroupingLabel = "instance"
+)
+
+// instanceSnapshot holds the metrics of the last collection in which a Logstash instance was up
+type instanceSnapshot struct {
+	name     string
+	families []*dto.MetricFamily
+}
+
+// PushgatewaySink pushes the final metrics of short-lived Logstash runs to a Pushgateway.
+// The metrics of every instance are kept while its API responds and pushed once it stops responding,
+// so that batch jobs finishing between two scrapes are still recorded.
+type PushgatewaySink struct {
+	httpClient *http.Client
+	url        string
+	job        string
+	grouping   map[string]string
+
+	mu        sync.Mutex
+	snapshots map[string]*instanceSnapshot
+}
+
+// NewPushgatewaySink creates a new PushgatewaySink from the configuration
+func NewPushgatewaySink(cfg *config.PushgatewayConfig) (*PushgatewaySink, error) {
+	httpClient, err := newHTTPClient(&cfg.PushClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushgatewaySink{
+		httpClient: httpClient,
+		url:        cfg.URL,
+		job:        cfg.Job,
+		grouping:   cfg.Grouping,
+		snapshots:  make(map[string]*instanceSnapshot),
+	}, nil
+}
+
+func (s *PushgatewaySink) Name() string {
+	return "pushgateway"
+}
+
+// Push stores the metrics of the instances that are up,
+// and pushes the stored metrics of the instances that stopped responding
+func (s *PushgatewaySink) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instancesUp := GetInstancesUp(families)
+
+	for hostname, name := range instancesUp {
+		s.snapshots[hostname] = &instanceSnapshot{name: name, families: filterInstanceFamilies(families, hostname)}
+	}
+
+	var errs []error
+	for hostname, snapshot := range s.snapshots {
+		if _, up := instancesUp[hostname]; up {
+			continue
+		}
+
+		slog.Info("logstash instance stopped responding, pushing its final metrics", "instance", hostname, "job", s.job)
+		if err := s.pushSnapshot(ctx, hostname, snapshot); err != nil {
+			// the snapshot is kept and pushed again on the next collection
+			errs = append(errs, err)
+			continue
+		}
+		delete(s.snapshots, hostname)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shutdown pushes the stored metrics of the instances that are still up,
+// so that they are not lost when the exporter stops before Logstash
+func (s *PushgatewaySink) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for hostname, snapshot := range s.snapshots {
+		if err := s.pushSnapshot(ctx, hostname, snapshot); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(s.snapshots, hostname)
+	}
+
+	return errors.Join(errs...)
+}
+
+// pushSnapshot replaces the metrics of the instance's group in the Pushgateway
+func (s *PushgatewaySink) pushSnapshot(ctx context.Context, hostname string, snapshot *instanceSnapshot) error {
+	instance := snapshot.name
+	if instance == "" {
+		instance = hostname
+	}
+
+	pusher := pushgateway.New(s.url, s.job).
+		Client(s.httpClient).
+		Grouping(instanceGroupingLabel, instance).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return snapshot.families, nil
+		}))
+	for name, value := range s.grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+
+	if err := pusher.PushContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics of %s: %w", hostname, err)
+	}
+
+	return nil
+}
+
+// GetInstancesUp maps the hostname of every Logstash instance which responded to the collection to its name.
+// An instance is up if it reported logstash_info_up as 1, and its node stats were collected as well.
+func GetInstancesUp(families []*dto.MetricFamily) map[string]string {
+	instances := make(map[string]string)
+	statsCollected := make(map[string]bool)
+
+	for _, family := range families {
+		switch {
+		case family.GetName() == upMetricName:
+			for _, metric := range family.GetMetric() {
+				if metric.GetGauge().GetValue() != 1 {
+					continue
+				}
+
+				hostname, name := getInstanceLabels(metric)
+				instances[hostname] = name
+			}
+		case strings.HasPrefix(family.GetName(), statsMetricPrefix):
+			for _, metric := range family.GetMetric() {
+				hostname, _ := getInstanceLabels(metric)
+				statsCollected[hostname] = true
+			}
+		}
+	}
+
+	for hostname := range instances {
+		if !statsCollected[hostname] {
+			delete(instances, hostname)
+		}
+	}
+
+	return instances
+}
+
+// getInstanceLabels returns the hostname and instance_name labels of a metric
+func getInstanceLabels(metric *dto.Metric) (hostname string, name string) {
+	for _, labelPair := range metric.GetLabel() {
+		switch labelPair.GetName() {
+		case "hostname":
+			hostname = labelPair.GetValue()
+		case "instance_name":
+			name = labelPair.GetValue()
+		}
+	}
+	return hostname, name
+}
+
+// filterInstanceFamilies returns the metric families reduced to the metrics of a single Logstash instance
+func filterInstanceFamilies(families []*dto.MetricFamily, hostname string) []*dto.MetricFamily {
+	var filtered []*dto.MetricFamily
+
+	for _, family := range families {
+		var metrics []*dto.Metric
+		for _, metric := range family.GetMetric() {
+			if metricHostname, _ := getInstanceLabels(metric); metricHostname == hostname {
+				metrics = append(metrics, metric)
+			}
+		}
+
+		if len(metrics) == 0 {
+			continue
+		}
+
+		filtered = append(filtered, &dto.MetricFamily{
+			Name:   family.Name,
+			Help:   family.Help,
+			Type:   family.Type,
+			Unit:   family.Unit,
+			Metric: metrics,
+		})
+	}
+
+	return filtered
+}
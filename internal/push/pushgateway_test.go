@@ -0,0 +1,226 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+type pushgatewayRequest struct {
+	method   string
+	path     string
+	families map[string]*dto.MetricFamily
+}
+
+type pushgatewayReceiver struct {
+	mu       sync.Mutex
+	requests []pushgatewayRequest
+}
+
+func newPushgatewayReceiver(t *testing.T) (*pushgatewayReceiver, *httptest.Server) {
+	t.Helper()
+
+	receiver := &pushgatewayReceiver{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families := make(map[string]*dto.MetricFamily)
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			family := &dto.MetricFamily{}
+			if err := decoder.Decode(family); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("failed to decode request body: %v", err)
+				}
+				break
+			}
+			families[family.GetName()] = family
+		}
+
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, pushgatewayRequest{method: r.Method, path: r.URL.Path, families: families})
+		receiver.mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return receiver, server
+}
+
+func (r *pushgatewayReceiver) getRequests() []pushgatewayRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]pushgatewayRequest(nil), r.requests...)
+}
+
+// instanceFamilies returns the gathered metrics of a single Logstash instance
+func instanceFamilies(t *testing.T, up float64, eventsOut float64) []*dto.MetricFamily {
+	t.Helper()
+
+	labels := prometheus.Labels{"hostname": "http://batch:9600", "instance_name": "batch"}
+	registry := prometheus.NewRegistry()
+
+	upGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: upMetricName, Help: "up"}, []string{"hostname", "instance_name"})
+	upGauge.With(labels).Set(up)
+	registry.MustRegister(upGauge)
+
+	if up == 1 {
+		events := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "logstash_stats_events_out", Help: "events"}, []string{"hostname", "instance_name"})
+		events.With(labels).Set(eventsOut)
+		registry.MustRegister(events)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	return families
+}
+
+func TestPushgatewaySink(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pushes the last metrics when the instance stops responding", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newPushgatewayReceiver(t)
+		sink, err := NewPushgatewaySink(&config.PushgatewayConfig{
+			PushClientConfig: config.PushClientConfig{URL: server.URL, Timeout: time.Second},
+			Job:              "import",
+			Grouping:         map[string]string{"env": "prod"},
+		})
+		if err != nil {
+			t.Fatalf("failed to create sink: %v", err)
+		}
+
+		for _, eventsOut := range []float64{10, 20} {
+			if err := sink.Push(context.Background(), instanceFamilies(t, 1, eventsOut), time.Now()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if requests := receiver.getRequests(); len(requests) != 0 {
+			t.Fatalf("expected no pushes while the instance is up, got %d", len(requests))
+		}
+
+		if err := sink.Push(context.Background(), instanceFamilies(t, 0, 0), time.Now()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		requests := receiver.getRequests()
+		if len(requests) != 1 {
+			t.Fatalf("expected a single push, got %d", len(requests))
+		}
+		request := requests[0]
+		if request.method != http.MethodPut {
+			t.Errorf("expected the group to be replaced with PUT, got %s", request.method)
+		}
+		// the order of the grouping labels in the path is not deterministic
+		if !strings.HasPrefix(request.path, "/metrics/job/import/") || !strings.Contains(request.path, "/instance/batch") || !strings.Contains(request.path, "/env/prod") {
+			t.Errorf("unexpected path: %s", request.path)
+		}
+		events, ok := request.families["logstash_stats_events_out"]
+		if !ok || events.GetMetric()[0].GetGauge().GetValue() != 20 {
+			t.Errorf("expected the last collected metrics to be pushed, got %v", request.families)
+		}
+
+		if err := sink.Push(context.Background(), instanceFamilies(t, 0, 0), time.Now()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests := receiver.getRequests(); len(requests) != 1 {
+			t.Errorf("expected the final metrics to be pushed only once, got %d pushes", len(requests))
+		}
+	})
+
+	t.Run("pushes the metrics of running instances on shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newPushgatewayReceiver(t)
+		sink, err := NewPushgatewaySink(&config.PushgatewayConfig{
+			PushClientConfig: config.PushClientConfig{URL: server.URL, Timeout: time.Second},
+			Job:              "import",
+		})
+		if err != nil {
+			t.Fatalf("failed to create sink: %v", err)
+		}
+
+		if err := sink.Push(context.Background(), instanceFamilies(t, 1, 10), time.Now()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := sink.Shutdown(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if requests := receiver.getRequests(); len(requests) != 1 || requests[0].path != "/metrics/job/import/instance/batch" {
+			t.Errorf("expected a single push of the running instance, got %v", requests)
+		}
+	})
+
+	t.Run("keeps the metrics when the push fails", func(t *testing.T) {
+		t.Parallel()
+
+		sink, err := NewPushgatewaySink(&config.PushgatewayConfig{
+			PushClientConfig: config.PushClientConfig{URL: "http://127.0.0.1:1", Timeout: time.Second},
+			Job:              "import",
+		})
+		if err != nil {
+			t.Fatalf("failed to create sink: %v", err)
+		}
+
+		if err := sink.Push(context.Background(), instanceFamilies(t, 1, 10), time.Now()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := sink.Push(context.Background(), instanceFamilies(t, 0, 0), time.Now()); err == nil {
+			t.Fatalf("expected an error")
+		}
+		if len(sink.snapshots) != 1 {
+			t.Errorf("expected the snapshot to be kept for the next push")
+		}
+	})
+}
+
+func TestGetInstancesUp(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports the instances whose node info and node stats were collected", func(t *testing.T) {
+		t.Parallel()
+
+		instances := GetInstancesUp(instanceFamilies(t, 1, 10))
+		if name, up := instances["http://batch:9600"]; !up || name != "batch" {
+			t.Errorf("expected the instance to be up, got %v", instances)
+		}
+	})
+
+	t.Run("does not report the instances whose node stats failed", func(t *testing.T) {
+		t.Parallel()
+
+		var families []*dto.MetricFamily
+		for _, family := range instanceFamilies(t, 1, 10) {
+			if family.GetName() == upMetricName {
+				families = append(families, family)
+			}
+		}
+
+		if instances := GetInstancesUp(families); len(instances) != 0 {
+			t.Errorf("expected no instance to be up, got %v", instances)
+		}
+	})
+
+	t.Run("does not report the instances which are down", func(t *testing.T) {
+		t.Parallel()
+
+		if instances := GetInstancesUp(instanceFamilies(t, 0, 0)); len(instances) != 0 {
+			t.Errorf("expected no instance to be up, got %v", instances)
+		}
+	})
+}
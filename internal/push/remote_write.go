@@ -0,0 +1,201 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const (
+	remoteWriteVersion = "0.1.0"
+	maxErrorBodyLength = 256
+)
+
+// unrecoverableError is returned when the receiver rejected the request,
+// so sending it again would fail the same way
+type unrecoverableError struct {
+	err error
+}
+
+func (e *unrecoverableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unrecoverableError) Unwrap() error {
+	return e.err
+}
+
+func isUnrecoverable(err error) bool {
+	var target *unrecoverableError
+	return errors.As(err, &target)
+}
+
+// RemoteWriteSink ships the metrics with the Prometheus remote_write protocol.
+// Failed requests are retried, and if a WAL is configured, the requests that still
+// could not be delivered are stored on disk and replayed before the next push.
+type RemoteWriteSink struct {
+	url          string
+	client       *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+	wal          *wal
+}
+
+// NewRemoteWriteSink creates a new RemoteWriteSink from the configuration
+func NewRemoteWriteSink(cfg *config.RemoteWriteConfig) (*RemoteWriteSink, error) {
+	client, err := newHTTPClient(&cfg.PushClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &RemoteWriteSink{
+		url:          cfg.URL,
+		client:       client,
+		maxRetries:   cfg.GetMaxRetries(),
+		retryBackoff: cfg.RetryBackoff,
+		maxBackoff:   cfg.MaxBackoff,
+	}
+
+	if cfg.WAL != nil {
+		sink.wal, err = openWAL(cfg.WAL.Directory, cfg.WAL.MaxSizeInBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sink, nil
+}
+
+func (s *RemoteWriteSink) Name() string {
+	return "remote_write"
+}
+
+// Push sends the metric families as a single remote_write request
+func (s *RemoteWriteSink) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	series := familiesToTimeSeries(families, timestamp.UnixMilli())
+	payload := snappy.Encode(nil, encodeWriteRequest(series))
+
+	if s.wal != nil {
+		if err := s.replayWAL(ctx); err != nil {
+			// the receiver is still unavailable, queue the request behind the stored ones to keep the order of samples
+			return errors.Join(err, s.wal.append(payload))
+		}
+	}
+
+	err := s.send(ctx, payload)
+	if err == nil {
+		return nil
+	}
+
+	if s.wal != nil && !isUnrecoverable(err) {
+		slog.Warn("remote write failed, storing the request in the WAL", "error", err)
+		return errors.Join(err, s.wal.append(payload))
+	}
+
+	return err
+}
+
+// replayWAL sends the stored requests, from the oldest to the newest.
+// It stops at the first request that could not be delivered.
+func (s *RemoteWriteSink) replayWAL(ctx context.Context) error {
+	segments, err := s.wal.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		payload, err := s.wal.read(segment)
+		if err != nil {
+			return err
+		}
+
+		err = s.send(ctx, payload)
+		if err != nil && !isUnrecoverable(err) {
+			return fmt.Errorf("failed to replay WAL segment %s: %w", segment, err)
+		}
+		if err != nil {
+			slog.Error("remote write receiver rejected a request from the WAL, dropping it", "segment", segment, "error", err)
+		} else {
+			slog.Debug("replayed request from the WAL", "segment", segment)
+		}
+
+		if err := s.wal.remove(segment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send sends the payload, retrying with an exponential backoff on recoverable errors
+func (s *RemoteWriteSink) send(ctx context.Context, payload []byte) error {
+	backoff := s.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := s.sendOnce(ctx, payload)
+		if err == nil || isUnrecoverable(err) || attempt >= s.maxRetries {
+			return err
+		}
+
+		slog.Debug("remote write failed, retrying", "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = s.nextBackoff(backoff)
+	}
+}
+
+// nextBackoff doubles the backoff, capped by the maximum backoff if one is configured
+func (s *RemoteWriteSink) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if s.maxBackoff > 0 && backoff > s.maxBackoff {
+		return s.maxBackoff
+	}
+	return backoff
+}
+
+func (s *RemoteWriteSink) sendOnce(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return &unrecoverableError{err: err}
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "logstash-exporter/"+config.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength))
+	err = fmt.Errorf("remote write receiver returned %s: %s", resp.Status, bytes.TrimSpace(body))
+
+	// client errors, apart from rate limiting, will not be fixed by retrying
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return &unrecoverableError{err: err}
+	}
+
+	return err
+}
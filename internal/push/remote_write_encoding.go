@@ -0,0 +1,178 @@
+package push
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const metricNameLabel = "__name__"
+
+// Field numbers of the remote_write protobuf messages, see prompb/remote.proto and prompb/types.proto
+const (
+	writeRequestTimeseriesField = 1
+	timeSeriesLabelsField       = 1
+	timeSeriesSamplesField      = 2
+	labelNameField              = 1
+	labelValueField             = 2
+	sampleValueField            = 1
+	sampleTimestampField        = 2
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+// timeSeries is a single sample of a series, as sent by the remote_write protocol
+type timeSeries struct {
+	labels      []label
+	value       float64
+	timestampMs int64
+}
+
+// Sample is a single sample of a metric family, flattened the same way it is represented in the text exposition format
+type Sample struct {
+	Name        string
+	Labels      map[string]string
+	Value       float64
+	TimestampMs int64
+}
+
+// FlattenFamilies flattens the metric families into samples.
+// Summaries and histograms are split into their quantile/bucket, sum and count series,
+// the same way they are represented in the text exposition format.
+// Metrics without an explicit timestamp get the given timestamp.
+func FlattenFamilies(families []*dto.MetricFamily, timestampMs int64) []Sample {
+	var samples []Sample
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel()))
+			for _, labelPair := range metric.GetLabel() {
+				labels[labelPair.GetName()] = labelPair.GetValue()
+			}
+
+			ts := timestampMs
+			if metric.TimestampMs != nil {
+				ts = metric.GetTimestampMs()
+			}
+
+			appendSample := func(suffix string, value float64, extraLabel string, extraValue float64) {
+				sampleLabels := labels
+				if extraLabel != "" {
+					sampleLabels = make(map[string]string, len(labels)+1)
+					for labelName, labelValue := range labels {
+						sampleLabels[labelName] = labelValue
+					}
+					sampleLabels[extraLabel] = FormatFloat(extraValue)
+				}
+				samples = append(samples, Sample{Name: name + suffix, Labels: sampleLabels, Value: value, TimestampMs: ts})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				appendSample("", metric.GetCounter().GetValue(), "", 0)
+			case dto.MetricType_GAUGE:
+				appendSample("", metric.GetGauge().GetValue(), "", 0)
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					appendSample("", quantile.GetValue(), "quantile", quantile.GetQuantile())
+				}
+				appendSample("_sum", summary.GetSampleSum(), "", 0)
+				appendSample("_count", float64(summary.GetSampleCount()), "", 0)
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				hasInfBucket := false
+				for _, bucket := range histogram.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						hasInfBucket = true
+					}
+					appendSample("_bucket", float64(bucket.GetCumulativeCount()), "le", bucket.GetUpperBound())
+				}
+				if !hasInfBucket {
+					appendSample("_bucket", float64(histogram.GetSampleCount()), "le", math.Inf(1))
+				}
+				appendSample("_sum", histogram.GetSampleSum(), "", 0)
+				appendSample("_count", float64(histogram.GetSampleCount()), "", 0)
+			default:
+				appendSample("", metric.GetUntyped().GetValue(), "", 0)
+			}
+		}
+	}
+
+	return samples
+}
+
+// familiesToTimeSeries flattens the metric families into the series of the remote_write protocol,
+// with the labels sorted by name as required by the protocol
+func familiesToTimeSeries(families []*dto.MetricFamily, timestampMs int64) []timeSeries {
+	samples := FlattenFamilies(families, timestampMs)
+	series := make([]timeSeries, len(samples))
+
+	for i, sample := range samples {
+		labels := make([]label, 0, len(sample.Labels)+1)
+		labels = append(labels, label{name: metricNameLabel, value: sample.Name})
+		for name, value := range sample.Labels {
+			labels = append(labels, label{name: name, value: value})
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+		series[i] = timeSeries{labels: labels, value: sample.Value, timestampMs: sample.TimestampMs}
+	}
+
+	return series
+}
+
+// FormatFloat formats the value as in the text exposition format
+func FormatFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// encodeWriteRequest encodes the series as a remote_write WriteRequest protobuf message.
+// The message is small enough to be encoded by hand, which avoids depending on
+// the whole Prometheus server module for its generated types.
+func encodeWriteRequest(series []timeSeries) []byte {
+	var request []byte
+
+	for _, s := range series {
+		var encodedSeries []byte
+		for _, l := range s.labels {
+			var encodedLabel []byte
+			encodedLabel = protowire.AppendTag(encodedLabel, labelNameField, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, l.name)
+			encodedLabel = protowire.AppendTag(encodedLabel, labelValueField, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, l.value)
+
+			encodedSeries = protowire.AppendTag(encodedSeries, timeSeriesLabelsField, protowire.BytesType)
+			encodedSeries = protowire.AppendBytes(encodedSeries, encodedLabel)
+		}
+
+		var encodedSample []byte
+		encodedSample = protowire.AppendTag(encodedSample, sampleValueField, protowire.Fixed64Type)
+		encodedSample = protowire.AppendFixed64(encodedSample, math.Float64bits(s.value))
+		encodedSample = protowire.AppendTag(encodedSample, sampleTimestampField, protowire.VarintType)
+		encodedSample = protowire.AppendVarint(encodedSample, uint64(s.timestampMs))
+
+		encodedSeries = protowire.AppendTag(encodedSeries, timeSeriesSamplesField, protowire.BytesType)
+		encodedSeries = protowire.AppendBytes(encodedSeries, encodedSample)
+
+		request = protowire.AppendTag(request, writeRequestTimeseriesField, protowire.BytesType)
+		request = protowire.AppendBytes(request, encodedSeries)
+	}
+
+	return request
+}
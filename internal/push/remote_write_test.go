@@ -0,0 +1,431 @@
+package push
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// remoteWriteReceiver is a minimal remote_write endpoint recording the received series
+type remoteWriteReceiver struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []*http.Request
+	series   [][]timeSeries
+	statuses []int
+}
+
+func newRemoteWriteReceiver(t *testing.T, statuses ...int) (*remoteWriteReceiver, *httptest.Server) {
+	receiver := &remoteWriteReceiver{t: t, statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	return receiver, server
+}
+
+func (r *remoteWriteReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	compressed, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Errorf("failed to read request body: %v", err)
+		return
+	}
+	payload, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		r.t.Errorf("failed to decompress request body: %v", err)
+		return
+	}
+	r.series = append(r.series, decodeWriteRequest(r.t, payload))
+}
+
+func (r *remoteWriteReceiver) receivedSeries() [][]timeSeries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.series
+}
+
+func (r *remoteWriteReceiver) requestCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func consumeMessage(t *testing.T, message []byte, handleField func(number protowire.Number, value []byte, fixed uint64, varint uint64)) {
+	t.Helper()
+
+	for len(message) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			t.Fatalf("failed to decode tag: %v", protowire.ParseError(n))
+		}
+		message = message[n:]
+
+		switch fieldType {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				t.Fatalf("failed to decode bytes: %v", protowire.ParseError(n))
+			}
+			handleField(number, value, 0, 0)
+			message = message[n:]
+		case protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(message)
+			if n < 0 {
+				t.Fatalf("failed to decode fixed64: %v", protowire.ParseError(n))
+			}
+			handleField(number, nil, value, 0)
+			message = message[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(message)
+			if n < 0 {
+				t.Fatalf("failed to decode varint: %v", protowire.ParseError(n))
+			}
+			handleField(number, nil, 0, value)
+			message = message[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", fieldType)
+		}
+	}
+}
+
+func decodeWriteRequest(t *testing.T, payload []byte) []timeSeries {
+	var series []timeSeries
+
+	consumeMessage(t, payload, func(_ protowire.Number, encodedSeries []byte, _ uint64, _ uint64) {
+		var s timeSeries
+		consumeMessage(t, encodedSeries, func(number protowire.Number, value []byte, _ uint64, _ uint64) {
+			switch number {
+			case timeSeriesLabelsField:
+				var l label
+				consumeMessage(t, value, func(number protowire.Number, value []byte, _ uint64, _ uint64) {
+					if number == labelNameField {
+						l.name = string(value)
+					} else {
+						l.value = string(value)
+					}
+				})
+				s.labels = append(s.labels, l)
+			case timeSeriesSamplesField:
+				consumeMessage(t, value, func(number protowire.Number, _ []byte, fixed uint64, varint uint64) {
+					if number == sampleValueField {
+						s.value = math.Float64frombits(fixed)
+					} else {
+						s.timestampMs = int64(varint)
+					}
+				})
+			}
+		})
+		series = append(series, s)
+	})
+
+	return series
+}
+
+func seriesName(s timeSeries) string {
+	for _, l := range s.labels {
+		if l.name == metricNameLabel {
+			return l.name + "=" + l.value
+		}
+	}
+	return ""
+}
+
+func testFamilies(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "logstash_test_gauge", Help: "test"}, []string{"pipeline"})
+	gauge.WithLabelValues("main").Set(42)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "logstash_test_summary", Help: "test", Objectives: map[float64]float64{0.5: 0.05}})
+	summary.Observe(1)
+	registry.MustRegister(gauge, summary)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	return families
+}
+
+func newTestRemoteWriteSink(t *testing.T, url string, modify func(*config.RemoteWriteConfig)) *RemoteWriteSink {
+	t.Helper()
+
+	maxRetries := 2
+	cfg := &config.RemoteWriteConfig{
+		PushClientConfig: config.PushClientConfig{URL: url, Timeout: time.Second},
+		MaxRetries:       &maxRetries,
+		RetryBackoff:     time.Millisecond,
+	}
+	if modify != nil {
+		modify(cfg)
+	}
+
+	sink, err := NewRemoteWriteSink(cfg)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	return sink
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.UnixMilli(1700000000000)
+
+	t.Run("sends the series as snappy compressed protobuf", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t)
+		sink := newTestRemoteWriteSink(t, server.URL, nil)
+
+		if err := sink.Push(context.Background(), testFamilies(t), timestamp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		request := receiver.requests[0]
+		if request.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("expected snappy content encoding, got %q", request.Header.Get("Content-Encoding"))
+		}
+		if request.Header.Get("X-Prometheus-Remote-Write-Version") != remoteWriteVersion {
+			t.Errorf("expected remote write version header, got %q", request.Header.Get("X-Prometheus-Remote-Write-Version"))
+		}
+
+		received := receiver.receivedSeries()[0]
+		names := make([]string, len(received))
+		for i, s := range received {
+			names[i] = seriesName(s)
+			if s.timestampMs != timestamp.UnixMilli() {
+				t.Errorf("expected timestamp %d, got %d", timestamp.UnixMilli(), s.timestampMs)
+			}
+		}
+
+		expectedNames := []string{
+			"__name__=logstash_test_gauge",
+			"__name__=logstash_test_summary",
+			"__name__=logstash_test_summary_sum",
+			"__name__=logstash_test_summary_count",
+		}
+		if strings.Join(names, ",") != strings.Join(expectedNames, ",") {
+			t.Errorf("expected series %v, got %v", expectedNames, names)
+		}
+
+		gauge := received[0]
+		if gauge.value != 42 {
+			t.Errorf("expected gauge value 42, got %f", gauge.value)
+		}
+		if len(gauge.labels) != 2 || gauge.labels[1] != (label{name: "pipeline", value: "main"}) {
+			t.Errorf("expected gauge labels to be sorted and include the pipeline, got %v", gauge.labels)
+		}
+	})
+
+	t.Run("uses basic auth", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t)
+		sink := newTestRemoteWriteSink(t, server.URL, func(cfg *config.RemoteWriteConfig) {
+			cfg.BasicAuth = &config.ClientAuthConfig{Username: "user", Password: "pass"}
+		})
+
+		if err := sink.Push(context.Background(), testFamilies(t), timestamp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		username, password, ok := receiver.requests[0].BasicAuth()
+		if !ok || username != "user" || password != "pass" {
+			t.Errorf("expected basic auth credentials, got %q:%q", username, password)
+		}
+	})
+
+	t.Run("uses bearer auth", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t)
+		sink := newTestRemoteWriteSink(t, server.URL, func(cfg *config.RemoteWriteConfig) {
+			cfg.BearerToken = "secret"
+		})
+
+		if err := sink.Push(context.Background(), testFamilies(t), timestamp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if authorization := receiver.requests[0].Header.Get("Authorization"); authorization != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q", authorization)
+		}
+	})
+
+	t.Run("retries recoverable errors", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK)
+		sink := newTestRemoteWriteSink(t, server.URL, nil)
+
+		if err := sink.Push(context.Background(), testFamilies(t), timestamp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if receiver.requestCount() != 3 {
+			t.Errorf("expected 3 requests, got %d", receiver.requestCount())
+		}
+	})
+
+	t.Run("does not retry when the retries are disabled", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t, http.StatusInternalServerError, http.StatusOK)
+		sink := newTestRemoteWriteSink(t, server.URL, func(cfg *config.RemoteWriteConfig) {
+			maxRetries := 0
+			cfg.MaxRetries = &maxRetries
+		})
+
+		if err := sink.Push(context.Background(), testFamilies(t), timestamp); err == nil {
+			t.Fatalf("expected an error")
+		}
+		if receiver.requestCount() != 1 {
+			t.Errorf("expected 1 request, got %d", receiver.requestCount())
+		}
+	})
+
+	t.Run("caps the backoff", func(t *testing.T) {
+		t.Parallel()
+
+		sink := newTestRemoteWriteSink(t, "http://localhost", func(cfg *config.RemoteWriteConfig) {
+			cfg.RetryBackoff = time.Second
+			cfg.MaxBackoff = 3 * time.Second
+		})
+
+		if backoff := sink.nextBackoff(time.Second); backoff != 2*time.Second {
+			t.Errorf("expected the backoff to be doubled, got %s", backoff)
+		}
+		if backoff := sink.nextBackoff(2 * time.Second); backoff != 3*time.Second {
+			t.Errorf("expected the backoff to be capped, got %s", backoff)
+		}
+	})
+
+	t.Run("does not retry rejected requests", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t, http.StatusBadRequest)
+		sink := newTestRemoteWriteSink(t, server.URL, func(cfg *config.RemoteWriteConfig) {
+			cfg.WAL = &config.WALConfig{Directory: t.TempDir(), MaxSizeInBytes: 1024 * 1024}
+		})
+
+		err := sink.Push(context.Background(), testFamilies(t), timestamp)
+		if !isUnrecoverable(err) {
+			t.Fatalf("expected an unrecoverable error, got %v", err)
+		}
+		if receiver.requestCount() != 1 {
+			t.Errorf("expected 1 request, got %d", receiver.requestCount())
+		}
+
+		segments, _ := sink.wal.segments()
+		if len(segments) != 0 {
+			t.Errorf("expected rejected request not to be stored in the WAL, got %v", segments)
+		}
+	})
+
+	t.Run("stores undelivered requests in the WAL and replays them in order", func(t *testing.T) {
+		t.Parallel()
+
+		receiver, server := newRemoteWriteReceiver(t,
+			http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+		)
+		sink := newTestRemoteWriteSink(t, server.URL, func(cfg *config.RemoteWriteConfig) {
+			cfg.WAL = &config.WALConfig{Directory: t.TempDir(), MaxSizeInBytes: 1024 * 1024}
+		})
+
+		if err := sink.Push(context.Background(), testFamilies(t), timestamp); err == nil {
+			t.Fatalf("expected an error while the receiver is unavailable")
+		}
+
+		segments, _ := sink.wal.segments()
+		if len(segments) != 1 {
+			t.Fatalf("expected the request to be stored in the WAL, got %v", segments)
+		}
+
+		secondTimestamp := timestamp.Add(time.Minute)
+		if err := sink.Push(context.Background(), testFamilies(t), secondTimestamp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		received := receiver.receivedSeries()
+		if len(received) != 2 {
+			t.Fatalf("expected 2 delivered requests, got %d", len(received))
+		}
+		if received[0][0].timestampMs != timestamp.UnixMilli() || received[1][0].timestampMs != secondTimestamp.UnixMilli() {
+			t.Errorf("expected the stored request to be replayed first")
+		}
+
+		segments, _ = sink.wal.segments()
+		if len(segments) != 0 {
+			t.Errorf("expected the WAL to be empty after the replay, got %v", segments)
+		}
+	})
+}
+
+func TestFamiliesToTimeSeriesHistogram(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_histogram", Help: "test", Buckets: []float64{1}})
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+	registry.MustRegister(histogram)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	series := familiesToTimeSeries(families, 0)
+
+	expected := []string{
+		"test_histogram_bucket{le=1} 1",
+		"test_histogram_bucket{le=+Inf} 2",
+		"test_histogram_sum{} 2.5",
+		"test_histogram_count{} 2",
+	}
+	if len(series) != len(expected) {
+		t.Fatalf("expected %d series, got %d", len(expected), len(series))
+	}
+
+	for i, s := range series {
+		var name string
+		var labels []string
+		for _, l := range s.labels {
+			if l.name == metricNameLabel {
+				name = l.value
+			} else {
+				labels = append(labels, l.name+"="+l.value)
+			}
+		}
+		formatted := name + "{" + strings.Join(labels, ",") + "} " + FormatFloat(s.value)
+		if formatted != expected[i] {
+			t.Errorf("expected series %q, got %q", expected[i], formatted)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package push
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const walSegmentSuffix = ".wal"
+
+// wal is a bounded on-disk write-ahead log of the requests that could not be delivered.
+// Every request is stored in a separate segment file, named after its sequence number,
+// so that the requests can be replayed in the order they were created.
+// When the size of the log exceeds the limit, the oldest segments are dropped.
+type wal struct {
+	directory      string
+	maxSizeInBytes int64
+
+	mu          sync.Mutex
+	nextSegment uint64
+}
+
+// openWAL opens the write-ahead log in the directory, creating the directory if needed
+func openWAL(directory string, maxSizeInBytes int64) (*wal, error) {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	w := &wal{directory: directory, maxSizeInBytes: maxSizeInBytes}
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		last, _ := parseSegmentNumber(segments[len(segments)-1])
+		w.nextSegment = last + 1
+	}
+
+	return w, nil
+}
+
+// append stores the payload as the newest segment and drops the oldest segments
+// if the log exceeds its maximum size
+func (w *wal) append(payload []byte) error {
+	if int64(len(payload)) > w.maxSizeInBytes {
+		return fmt.Errorf("request of %d bytes exceeds the maximum WAL size of %d bytes", len(payload), w.maxSizeInBytes)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name := fmt.Sprintf("%020d%s", w.nextSegment, walSegmentSuffix)
+	w.nextSegment++
+
+	// write to a temporary file first, so that a crash never leaves a partial segment
+	tmpPath := filepath.Join(w.directory, name+".tmp")
+	if err := os.WriteFile(tmpPath, payload, 0o600); err != nil {
+		return fmt.Errorf("failed to write WAL segment: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(w.directory, name)); err != nil {
+		return fmt.Errorf("failed to write WAL segment: %w", err)
+	}
+
+	return w.truncate()
+}
+
+// truncate drops the oldest segments until the log fits in its maximum size
+func (w *wal) truncate() error {
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	sizes := make([]int64, len(segments))
+	var totalSize int64
+	for i, segment := range segments {
+		info, err := os.Stat(filepath.Join(w.directory, segment))
+		if err != nil {
+			return fmt.Errorf("failed to stat WAL segment: %w", err)
+		}
+		sizes[i] = info.Size()
+		totalSize += sizes[i]
+	}
+
+	for i := 0; totalSize > w.maxSizeInBytes && i < len(segments); i++ {
+		slog.Warn("WAL size limit exceeded, dropping the oldest request", "segment", segments[i], "maxSizeInBytes", w.maxSizeInBytes)
+		if err := os.Remove(filepath.Join(w.directory, segments[i])); err != nil {
+			return fmt.Errorf("failed to remove WAL segment: %w", err)
+		}
+		totalSize -= sizes[i]
+	}
+
+	return nil
+}
+
+// segments returns the names of the stored segments, from the oldest to the newest
+func (w *wal) segments() ([]string, error) {
+	entries, err := os.ReadDir(w.directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL directory: %w", err)
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := parseSegmentNumber(entry.Name()); ok {
+			segments = append(segments, entry.Name())
+		}
+	}
+
+	// the names are zero-padded, so the lexical order is the order of creation
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// read returns the payload stored in the segment
+func (w *wal) read(segment string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(w.directory, segment))
+}
+
+// remove deletes the segment from the log
+func (w *wal) remove(segment string) error {
+	return os.Remove(filepath.Join(w.directory, segment))
+}
+
+func parseSegmentNumber(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, walSegmentSuffix) {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentSuffix), 10, 64)
+	return number, err == nil
+}
@@ -0,0 +1,102 @@
+package push
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWAL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("keeps the order of the segments across reopening", func(t *testing.T) {
+		t.Parallel()
+
+		directory := t.TempDir()
+		w, err := openWAL(directory, 1024)
+		if err != nil {
+			t.Fatalf("failed to open WAL: %v", err)
+		}
+
+		for _, payload := range []string{"first", "second"} {
+			if err := w.append([]byte(payload)); err != nil {
+				t.Fatalf("failed to append: %v", err)
+			}
+		}
+
+		reopened, err := openWAL(directory, 1024)
+		if err != nil {
+			t.Fatalf("failed to reopen WAL: %v", err)
+		}
+		if err := reopened.append([]byte("third")); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+
+		segments, err := reopened.segments()
+		if err != nil {
+			t.Fatalf("failed to list segments: %v", err)
+		}
+
+		var payloads [][]byte
+		for _, segment := range segments {
+			payload, err := reopened.read(segment)
+			if err != nil {
+				t.Fatalf("failed to read segment: %v", err)
+			}
+			payloads = append(payloads, payload)
+		}
+
+		expected := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+		if len(payloads) != len(expected) {
+			t.Fatalf("expected %d segments, got %d", len(expected), len(payloads))
+		}
+		for i := range expected {
+			if !bytes.Equal(payloads[i], expected[i]) {
+				t.Errorf("expected segment %d to be %q, got %q", i, expected[i], payloads[i])
+			}
+		}
+	})
+
+	t.Run("drops the oldest segments when exceeding the size limit", func(t *testing.T) {
+		t.Parallel()
+
+		w, err := openWAL(t.TempDir(), 10)
+		if err != nil {
+			t.Fatalf("failed to open WAL: %v", err)
+		}
+
+		for _, payload := range []string{"aaaa", "bbbb", "cccc"} {
+			if err := w.append([]byte(payload)); err != nil {
+				t.Fatalf("failed to append: %v", err)
+			}
+		}
+
+		segments, err := w.segments()
+		if err != nil {
+			t.Fatalf("failed to list segments: %v", err)
+		}
+		if len(segments) != 2 {
+			t.Fatalf("expected 2 segments, got %d", len(segments))
+		}
+
+		payload, err := w.read(segments[0])
+		if err != nil {
+			t.Fatalf("failed to read segment: %v", err)
+		}
+		if string(payload) != "bbbb" {
+			t.Errorf("expected the oldest segment to be dropped, got %q", payload)
+		}
+	})
+
+	t.Run("rejects payloads larger than the limit", func(t *testing.T) {
+		t.Parallel()
+
+		w, err := openWAL(t.TempDir(), 2)
+		if err != nil {
+			t.Fatalf("failed to open WAL: %v", err)
+		}
+
+		if err := w.append([]byte("too large")); err == nil {
+			t.Errorf("expected an error for a payload exceeding the limit")
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+)
+
+// getMetricsHandler returns a handler exposing metrics gathered by the default registry.
+// OpenMetrics is used if the scraper negotiates it, in which case created timestamps
+// and declared units are exposed as well. Other formats are handled by promhttp.
+func getMetricsHandler() http.Handler {
+	gatherer := prometheus_helper.UnitGatherer{Gatherer: prometheus.DefaultGatherer}
+
+	promHandler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: true,
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		if format.FormatType() != expfmt.TypeOpenMetrics {
+			promHandler.ServeHTTP(w, r)
+			return
+		}
+
+		serveOpenMetrics(w, gatherer, format)
+	})
+
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+}
+
+// serveOpenMetrics writes the gathered metrics in the OpenMetrics format.
+// It exists because promhttp does not allow enabling the unit metadata.
+func serveOpenMetrics(w http.ResponseWriter, gatherer prometheus.Gatherer, format expfmt.Format) {
+	metricFamilies, err := gatherer.Gather()
+	if err != nil {
+		slog.Error("error gathering metrics", "err", err)
+		http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(format))
+
+	encoder := expfmt.NewEncoder(w, format, expfmt.WithCreatedLines(), expfmt.WithUnit())
+	for _, metricFamily := range metricFamilies {
+		if err := encoder.Encode(metricFamily); err != nil {
+			slog.Error("error encoding metric family", "name", metricFamily.GetName(), "err", err)
+			return
+		}
+	}
+
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("error closing metrics encoder", "err", err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+)
+
+func TestGetMetricsHandler(t *testing.T) {
+	prometheus_helper.RegisterUnit("server_test_metrics_memory_bytes", prometheus_helper.UnitBytes)
+	collector := prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "server_test_metrics_memory_bytes", Help: "Memory used."}, func() float64 { return 1 })
+
+	prometheus.MustRegister(collector)
+	defer prometheus.Unregister(collector)
+
+	t.Run("should expose OpenMetrics with units when negotiated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+		rr := httptest.NewRecorder()
+
+		getMetricsHandler().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/openmetrics-text") {
+			t.Errorf("unexpected content type: %s", contentType)
+		}
+
+		body := rr.Body.String()
+		if !strings.Contains(body, "# UNIT server_test_metrics_memory_bytes bytes") {
+			t.Errorf("expected unit metadata in body, got:\n%s", body)
+		}
+		if !strings.HasSuffix(body, "# EOF\n") {
+			t.Errorf("expected body to end with EOF marker")
+		}
+	})
+
+	t.Run("should fall back to text format", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		rr := httptest.NewRecorder()
+
+		getMetricsHandler().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if format := expfmt.ResponseFormat(rr.Result().Header); format.FormatType() != expfmt.TypeTextPlain {
+			t.Errorf("unexpected format: %s", format)
+		}
+		if !strings.Contains(rr.Body.String(), "server_test_metrics_memory_bytes 1") {
+			t.Errorf("expected metric in body")
+		}
+	})
+}
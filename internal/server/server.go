@@ -5,21 +5,19 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-
 	"github.com/kuskoman/logstash-exporter/pkg/config"
 	customtls "github.com/kuskoman/logstash-exporter/pkg/tls"
 )
 
 // NewAppServer creates a new http server with the given host and port
 // and registers the prometheus handler and the healthcheck handler
-// to the server's mux. The prometheus handler is managed under the
-// hood by the prometheus client library.
+// to the server's mux. The prometheus handler negotiates the exposition
+// format, preferring OpenMetrics when the scraper supports it.
 func NewAppServer(cfg *config.Config) *http.Server {
 	logstashUrls := convertInstancesToUrls(cfg.Logstash.Instances)
 
 	mux := http.NewServeMux()
-	handler := promhttp.Handler()
+	handler := getMetricsHandler()
 
 	// Configure basic authentication if enabled
 	if cfg.Server.BasicAuth != nil {
@@ -7,7 +7,9 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/kuskoman/logstash-exporter/internal/discovery"
 	"github.com/kuskoman/logstash-exporter/internal/k8s_controller"
+	"github.com/kuskoman/logstash-exporter/internal/push"
 	"github.com/kuskoman/logstash-exporter/internal/server"
 	"github.com/kuskoman/logstash-exporter/pkg/collector_manager"
 	"github.com/kuskoman/logstash-exporter/pkg/config"
@@ -59,6 +61,7 @@ func (sm *StartupManager) startPrometheus(cfg *config.Config) {
 	collectorManager := collector_manager.NewCollectorManager(
 		cfg.Logstash.Instances,
 		cfg.Logstash.HttpTimeout,
+		cfg.Metrics,
 	)
 
 	sm.prometheusCollector = collectorManager
@@ -79,6 +82,81 @@ func (sm *StartupManager) startPrometheus(cfg *config.Config) {
 	}
 }
 
+// startDiscovery starts the service discoveries of the instances, if any
+func (sm *StartupManager) startDiscovery(cfg *config.Config) {
+	if !cfg.Logstash.HasDiscovery() {
+		slog.Debug("service discovery is disabled")
+		return
+	}
+
+	collectorMgr, ok := sm.prometheusCollector.(*collector_manager.CollectorManager)
+	if !ok {
+		slog.Error("collector is not a CollectorManager, cannot start service discovery")
+		return
+	}
+
+	discoveries, err := discovery.NewDiscoveries(&cfg.Logstash, collectorMgr)
+	if err != nil {
+		slog.Error("failed to create service discoveries", "error", err)
+		return
+	}
+
+	slog.Info("starting service discovery", "discoveries", len(discoveries))
+	for _, d := range discoveries {
+		if err := d.Start(context.Background()); err != nil {
+			slog.Error("failed to start service discovery", "error", err)
+			continue
+		}
+		sm.discoveries = append(sm.discoveries, d)
+	}
+}
+
+// shutdownDiscovery stops the service discoveries
+func (sm *StartupManager) shutdownDiscovery() {
+	if len(sm.discoveries) == 0 {
+		slog.Debug("service discovery is not running")
+		return
+	}
+
+	slog.Info("stopping service discovery")
+	for _, d := range sm.discoveries {
+		d.Stop()
+	}
+	sm.discoveries = nil
+}
+
+// startPush starts pushing the metrics to the configured sinks, if any
+func (sm *StartupManager) startPush(cfg *config.Config) {
+	if !cfg.Push.IsEnabled() {
+		slog.Debug("push mode is disabled")
+		return
+	}
+
+	sinks, err := push.NewSinks(context.Background(), &cfg.Push)
+	if err != nil {
+		slog.Error("failed to create push sinks", "error", err)
+		return
+	}
+
+	slog.Info("starting push mode", "interval", cfg.Push.Interval, "sinks", len(sinks))
+	sm.pusher = push.NewPusher(prometheus.DefaultGatherer, cfg.Push.Interval, sinks...)
+	sm.pusher.Start(context.Background())
+}
+
+// shutdownPush stops pushing the metrics
+func (sm *StartupManager) shutdownPush(ctx context.Context) {
+	if sm.pusher == nil {
+		slog.Debug("pusher is nil")
+		return
+	}
+
+	slog.Info("stopping push mode")
+	if err := sm.pusher.Stop(ctx); err != nil {
+		slog.Error("failed to stop pushing metrics", "error", err)
+	}
+	sm.pusher = nil
+}
+
 // startServer initializes and starts the HTTP server
 func (sm *StartupManager) startServer(cfg *config.Config) {
 	slog.Debug("creating new app server instance", "config", fmt.Sprintf("%+v", cfg.Server))
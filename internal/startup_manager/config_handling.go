@@ -35,6 +35,8 @@ func (sm *StartupManager) Reload(ctx context.Context) error {
 
 		slog.Info("config has changed, reloading server")
 
+		sm.shutdownPush(ctx)
+		sm.shutdownDiscovery()
 		sm.shutdownPrometheus()
 		err := sm.shutdownServer(ctx)
 		if err != nil {
@@ -42,6 +44,8 @@ func (sm *StartupManager) Reload(ctx context.Context) error {
 		}
 
 		sm.startPrometheus(cfg)
+		sm.startDiscovery(cfg)
+		sm.startPush(cfg)
 		sm.startServer(cfg)
 
 		slog.Info("application reloaded")
@@ -25,6 +25,7 @@ func NewConfigManager(configPath string) *ConfigManager {
 
 // LoadAndCompareConfig loads the configuration and compares it with the current one.
 // If the configuration has changed, it returns true, otherwise false.
+// An invalid configuration is rejected with an error, and the current one is kept.
 func (cc *ConfigManager) LoadAndCompareConfig(ctx context.Context) (bool, error) {
 	slog.Debug("loading and comparing config")
 	cc.mutex.Lock()
@@ -35,6 +36,10 @@ func (cc *ConfigManager) LoadAndCompareConfig(ctx context.Context) (bool, error)
 		return false, err
 	}
 
+	if err := newConfig.Validate(); err != nil {
+		return false, fmt.Errorf("invalid config: %w", err)
+	}
+
 	if cc.currentConfig == nil || !cc.currentConfig.Equals(newConfig) {
 		cc.currentConfig = newConfig
 		slog.Debug("config has changed", "newConfig", fmt.Sprintf("%+v", newConfig))
@@ -128,6 +128,52 @@ server:
 			t.Error("expected config to not be marked as changed on error")
 		}
 	})
+
+	t.Run("keeps the current config when the new one fails validation", func(t *testing.T) {
+		// Do not run in parallel
+
+		validConfigContent := `
+server:
+  port: 8080
+`
+		invalidConfigContent := `
+server:
+  port: 8080
+logstash:
+  instances:
+    - url: "localhost:9600"
+`
+		validConfigPath := file_utils.CreateTempFile(t, validConfigContent)
+		invalidConfigPath := file_utils.CreateTempFile(t, invalidConfigContent)
+		defer file_utils.RemoveFile(t, validConfigPath)
+		defer file_utils.RemoveFile(t, invalidConfigPath)
+
+		cc := NewConfigManager(invalidConfigPath)
+		if _, err := cc.LoadAndCompareConfig(ctx); err == nil {
+			t.Fatal("expected the invalid initial config to be rejected")
+		}
+		if cc.GetCurrentConfig() != nil {
+			t.Errorf("expected no config to be loaded, got %+v", cc.GetCurrentConfig())
+		}
+
+		cc.configPath = validConfigPath
+		if _, err := cc.LoadAndCompareConfig(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		currentConfig := cc.GetCurrentConfig()
+
+		cc.configPath = invalidConfigPath
+		changed, err := cc.LoadAndCompareConfig(ctx)
+		if err == nil {
+			t.Fatal("expected the invalid config to be rejected")
+		}
+		if changed {
+			t.Error("expected config to not be marked as changed on a validation error")
+		}
+		if cc.GetCurrentConfig() != currentConfig {
+			t.Error("expected the current config to be kept")
+		}
+	})
 }
 
 func TestConfigComparator_GetCurrentConfig(t *testing.T) {
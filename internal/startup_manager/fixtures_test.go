@@ -18,7 +18,7 @@ func createValidConfigFile(t *testing.T) string {
 	configContent := `
 logstash:
   instances:
-    - host: http://localhost:9600
+    - url: http://localhost:9600
       name: logstash-test
   httpTimeout: 2s
 server:
@@ -138,7 +138,7 @@ func TestReloadWithFileChange(t *testing.T) {
 		initialConfig := `
 logstash:
   instances:
-    - host: http://localhost:9600
+    - url: http://localhost:9600
       name: initial
   httpTimeout: 2s
 server:
@@ -171,9 +171,9 @@ logging:
 		updatedConfig := `
 logstash:
   instances:
-    - host: http://localhost:9600
+    - url: http://localhost:9600
       name: updated
-    - host: http://localhost:9601
+    - url: http://localhost:9601
       name: second
   httpTimeout: 3s
 server:
@@ -309,4 +309,49 @@ func TestHandleConfigChange(t *testing.T) {
 			t.Errorf("expected reload error %v to be propagated, got %v", reloadError, err)
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestConfigWatcherWithIncludes(t *testing.T) {
+	t.Run("should_detect_files_created_in_the_directory_of_an_include_pattern", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "config.yml")
+		includeDir := filepath.Join(dir, "conf.d")
+
+		if err := os.Mkdir(includeDir, 0755); err != nil {
+			t.Fatalf("failed to create include directory: %v", err)
+		}
+		if err := os.WriteFile(configPath, []byte("include:\n  - conf.d/*.yml\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		listenerCalled := make(chan struct{}, 1)
+		watcher, err := newConfigWatcher(configPath, func() error {
+			listenerCalled <- struct{}{}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to create config watcher: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		readyCh, err := watcher.Watch(ctx)
+		if err != nil {
+			t.Fatalf("failed to watch config: %v", err)
+		}
+		<-readyCh
+
+		includedConfig := "logstash:\n  instances:\n    - url: http://localhost:9600\n"
+		if err := os.WriteFile(filepath.Join(includeDir, "team.yml"), []byte(includedConfig), 0644); err != nil {
+			t.Fatalf("failed to write included config: %v", err)
+		}
+
+		select {
+		case <-listenerCalled:
+			// Success
+		case <-time.After(testTimeout):
+			t.Errorf("expected listener to be called for the included file, but it wasn't")
+		}
+	})
+}
@@ -8,9 +8,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/kuskoman/logstash-exporter/internal/discovery"
 	"github.com/kuskoman/logstash-exporter/internal/file_watcher"
 	"github.com/kuskoman/logstash-exporter/internal/flags"
 	"github.com/kuskoman/logstash-exporter/internal/k8s_controller"
+	"github.com/kuskoman/logstash-exporter/internal/push"
 	"github.com/kuskoman/logstash-exporter/pkg/config"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -40,6 +42,8 @@ type StartupManager struct {
 	watcher              *file_watcher.FileWatcher
 	prometheusCollector  prometheus.Collector
 	kubernetesController *k8s_controller.Controller
+	pusher               *push.Pusher
+	discoveries          []discovery.Discovery
 	serverErrorChan      chan error
 	withController       bool
 }
@@ -55,7 +59,7 @@ func NewStartupManager(configPath string, flagsCfg *flags.FlagsConfig) (*Startup
 		withController:  false,
 	}
 
-	watcher, err := file_watcher.NewFileWatcher(configPath, sm.handleConfigChange)
+	watcher, err := newConfigWatcher(configPath, sm.handleConfigChange)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +80,7 @@ func NewStartupManagerWithController(configPath string, flagsCfg *flags.FlagsCon
 		withController:  true,
 	}
 
-	watcher, err := file_watcher.NewFileWatcher(configPath, sm.handleConfigChange)
+	watcher, err := newConfigWatcher(configPath, sm.handleConfigChange)
 	if err != nil {
 		return nil, err
 	}
@@ -127,6 +131,8 @@ func (sm *StartupManager) Initialize(ctx context.Context) error {
 
 	slog.Debug("starting application components")
 	sm.startPrometheus(cfg)
+	sm.startDiscovery(cfg)
+	sm.startPush(cfg)
 	
 	if sm.withController {
 		sm.startKubernetesController(cfg)
@@ -164,7 +170,36 @@ func (sm *StartupManager) Shutdown(ctx context.Context) error {
 		sm.shutdownKubernetesController(ctx)
 	}
 
+	sm.shutdownPush(ctx)
+	sm.shutdownDiscovery()
 	sm.shutdownPrometheus()
 
 	return nil
 }
+
+// newConfigWatcher watches every file of the configuration,
+// i.e. the files of the config directory, or the config file and its included files.
+// The directories of the include patterns are watched as well, for included files created later.
+func newConfigWatcher(configPath string, listeners ...func() error) (*file_watcher.FileWatcher, error) {
+	watcher, err := file_watcher.NewFileSetWatcher(func() ([]string, error) {
+		return config.ResolveConfigFiles(configPath)
+	}, listeners...)
+	if err != nil {
+		return nil, err
+	}
+
+	includeDirs, err := config.IncludeDirectories(configPath)
+	if err != nil {
+		_ = watcher.Stop()
+		return nil, err
+	}
+
+	for _, dir := range includeDirs {
+		// a missing directory is not an error, as the pattern might match no file on purpose
+		if err := watcher.AddDirectory(dir); err != nil {
+			slog.Warn("failed to watch the directory of an include pattern", "dir", dir, "err", err)
+		}
+	}
+
+	return watcher, nil
+}
@@ -268,7 +268,7 @@ func TestNewStartupManager(t *testing.T) {
 		configContent := `
 logstash:
   instances:
-    - host: http://localhost:9600
+    - url: http://localhost:9600
 server:
   host: 0.0.0.0
   port: 8080
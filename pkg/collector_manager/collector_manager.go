@@ -2,7 +2,9 @@ package collector_manager
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"reflect"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/kuskoman/logstash-exporter/internal/collectors/nodeinfo"
 	"github.com/kuskoman/logstash-exporter/internal/collectors/nodestats"
 	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
 	"github.com/kuskoman/logstash-exporter/pkg/config"
 	"github.com/kuskoman/logstash-exporter/pkg/tls"
 )
@@ -27,85 +30,163 @@ type CollectorManager struct {
 	collectors      map[string]Collector
 	scrapeDurations *prometheus.SummaryVec
 	httpTimeout     time.Duration
+	metricsConfig   config.MetricsConfig
+	v1Translator    *v1CompatibilityTranslator
+	derivedSamples  *nodeStatsSamples
+	stallDetector   *nodestats.StallDetector
 	mu              sync.RWMutex
 	instancesMap    map[string]*config.LogstashInstance // Used for dynamic instance management
+	// metricFilters are the compiled metric filters of the instances, compiled when the instances are added
+	metricFilters map[string]*metricFilter
 }
 
 func getClientsForEndpoints(instances []*config.LogstashInstance, timeout time.Duration) []logstash_client.Client {
 	clients := make([]logstash_client.Client, len(instances))
 
 	for i, instance := range instances {
-		var client logstash_client.Client
-		var err error
-
-		// Create an HTTP client based on the instance configuration
-		httpClient, err := tls.ConfigureHTTPClientFromLogstashInstance(instance, timeout)
+		client, err := NewInstanceClient(instance, timeout)
 		if err != nil {
-			slog.Error("Failed to configure TLS client", "error", err)
+			slog.Error("Failed to configure client", "error", err)
 			// Fall back to standard client
 			client = logstash_client.NewClient(instance.Host, instance.Name)
-			clients[i] = client
-			continue
 		}
+		clients[i] = client
+	}
+
+	return clients
+}
+
+// NewInstanceClient creates a client of the Logstash instance, with its TLS and basic auth configuration
+func NewInstanceClient(instance *config.LogstashInstance, timeout time.Duration) (logstash_client.Client, error) {
+	// Create an HTTP client based on the instance configuration
+	httpClient, err := tls.ConfigureHTTPClientFromLogstashInstance(instance, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TLS client: %w", err)
+	}
 
-		// If there's basic auth configuration, add it
-		if instance.BasicAuth != nil {
-			password, err := instance.BasicAuth.GetPassword()
-			if err != nil {
-				slog.Error("Failed to get authentication password", "error", err)
-				// Continue with a standard client as fallback
-				client = logstash_client.NewClient(instance.Host, instance.Name)
-				clients[i] = client
-				continue
-			}
-
-			// Add basic auth to the HTTP client
-			httpClient = tls.ConfigureBasicAuth(httpClient, instance.BasicAuth.Username, password)
+	// If there's basic auth configuration, add it
+	if instance.BasicAuth != nil {
+		password, err := instance.BasicAuth.GetPassword()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get authentication password: %w", err)
 		}
 
-		// Create a client with the configured HTTP client
-		client = logstash_client.NewClientWithHTTPClient(instance.Host, httpClient, instance.Name)
-		clients[i] = client
+		// Add basic auth to the HTTP client
+		httpClient = tls.ConfigureBasicAuth(httpClient, instance.BasicAuth.Username, password)
 	}
 
-	return clients
+	// Create a client with the configured HTTP client
+	return logstash_client.NewClientWithHTTPClient(instance.Host, httpClient, instance.Name), nil
 }
 
-// NewCollectorManager creates a new CollectorManager with the provided logstash instances and http timeout
-func NewCollectorManager(instances []*config.LogstashInstance, timeout time.Duration) *CollectorManager {
+// NewCollectorManager creates a new CollectorManager with the provided logstash instances, http timeout
+// and configuration of the exported metrics
+func NewCollectorManager(instances []*config.LogstashInstance, timeout time.Duration, metricsConfig config.MetricsConfig) *CollectorManager {
 	// Build the instance map
 	instancesMap := make(map[string]*config.LogstashInstance)
+	metricFilters := make(map[string]*metricFilter)
 	for _, instance := range instances {
-		instanceID := instance.Name
-		if instanceID == "" {
-			instanceID = instance.Host
+		instancesMap[instance.ID()] = instance
+		if filter := compileMetricFilter(instance.ID(), instance); filter != nil {
+			metricFilters[instance.ID()] = filter
 		}
-		instancesMap[instanceID] = instance
 	}
 
-	clients := getClientsForEndpoints(instances, timeout)
+	var derivedSamples *nodeStatsSamples
+	if metricsConfig.Derived {
+		derivedSamples = newNodeStatsSamples()
+	}
 
-	collectors := getCollectors(clients)
+	var stallDetector *nodestats.StallDetector
+	if window := metricsConfig.GetStallDetectionWindow(); window > 0 {
+		stallDetector = nodestats.NewStallDetector(window)
+	}
+
+	collectors := getCollectors(instancesMap, metricFilters, timeout, metricsConfig, derivedSamples, stallDetector)
 
 	scrapeDurations := getScrapeDurationsCollector()
 	prometheus.Unregister(version.NewCollector("logstash_exporter"))
 	prometheus.MustRegister(version.NewCollector("logstash_exporter"))
 
+	var v1Translator *v1CompatibilityTranslator
+	if metricsConfig.V1Compatibility != "" {
+		v1Translator = newV1CompatibilityTranslator(metricsConfig.V1Compatibility, metricsConfig)
+	}
+
 	return &CollectorManager{
 		collectors:      collectors,
 		scrapeDurations: scrapeDurations,
 		httpTimeout:     timeout,
+		metricsConfig:   metricsConfig,
+		v1Translator:    v1Translator,
+		derivedSamples:  derivedSamples,
+		stallDetector:   stallDetector,
 		instancesMap:    instancesMap,
+		metricFilters:   metricFilters,
 	}
 }
 
-func getCollectors(clients []logstash_client.Client) map[string]Collector {
+// getCollectors creates the collectors of the instances. The state kept across scrapes, like the derived samples
+// and the progress of the pipelines, is owned by the CollectorManager and observes the node stats fetched by the collectors.
+// The instances with labels or a metric filter get collectors of their own, which label and filter their metrics.
+func getCollectors(instances map[string]*config.LogstashInstance, filters map[string]*metricFilter, timeout time.Duration, metricsConfig config.MetricsConfig, derivedSamples *nodeStatsSamples, stallDetector *nodestats.StallDetector) map[string]Collector {
+	var observers []nodestats.NodeStatsObserver
+	if derivedSamples != nil {
+		observers = append(observers, newDerivedMetricsCollector(derivedSamples))
+	}
+	if stallDetector != nil {
+		observers = append(observers, stallDetector)
+	}
+
+	labels := getInstanceLabels(instances, filters)
+
+	var nodeinfoCollectors, nodestatsCollectors collectorGroup
+	var unlabeledInstances []*config.LogstashInstance
+	for id, instance := range instances {
+		instanceLabels, labeled := labels[id]
+		if !labeled {
+			unlabeledInstances = append(unlabeledInstances, instance)
+			continue
+		}
+
+		clients := getClientsForEndpoints([]*config.LogstashInstance{instance}, timeout)
+		nodeinfoCollectors = append(nodeinfoCollectors, &labeledCollector{nodeinfo.NewNodeinfoCollector(clients), instanceLabels})
+		nodestatsCollectors = append(nodestatsCollectors, &labeledCollector{nodestats.NewNodestatsCollector(clients, metricsConfig, observers...), instanceLabels})
+	}
+
 	collectors := make(map[string]Collector)
-	collectors["nodeinfo"] = nodeinfo.NewNodeinfoCollector(clients)
-	collectors["nodestats"] = nodestats.NewNodestatsCollector(clients)
+	clients := getClientsForEndpoints(unlabeledInstances, timeout)
+	if len(nodeinfoCollectors) == 0 {
+		collectors["nodeinfo"] = nodeinfo.NewNodeinfoCollector(clients)
+		collectors["nodestats"] = nodestats.NewNodestatsCollector(clients, metricsConfig, observers...)
+		return collectors
+	}
+
+	if len(clients) > 0 {
+		nodeinfoCollectors = append(nodeinfoCollectors, nodeinfo.NewNodeinfoCollector(clients))
+		nodestatsCollectors = append(nodestatsCollectors, nodestats.NewNodestatsCollector(clients, metricsConfig, observers...))
+	}
+	collectors["nodeinfo"] = nodeinfoCollectors
+	collectors["nodestats"] = nodestatsCollectors
 	return collectors
 }
 
+// rebuildCollectors regenerates the collectors with the current instances.
+// It must be called with the mutex held.
+func (manager *CollectorManager) rebuildCollectors() {
+	manager.collectors = getCollectors(manager.instancesMap, manager.metricFilters, manager.httpTimeout, manager.metricsConfig, manager.derivedSamples, manager.stallDetector)
+}
+
+// forgetEndpoint removes the state kept across scrapes for the endpoint of a removed or changed instance
+func (manager *CollectorManager) forgetEndpoint(endpoint string) {
+	if manager.derivedSamples != nil {
+		manager.derivedSamples.remove(endpoint)
+	}
+	if manager.stallDetector != nil {
+		manager.stallDetector.Remove(endpoint)
+	}
+}
+
 // Collect executes all collectors and sends the collected metrics to the provided channel.
 // It also sends the duration of the collection to the scrapeDurations collector.
 func (manager *CollectorManager) Collect(ch chan<- prometheus.Metric) {
@@ -120,6 +201,21 @@ func (manager *CollectorManager) Collect(ch chan<- prometheus.Metric) {
 	}
 	manager.mu.RUnlock()
 
+	if manager.v1Translator != nil {
+		collectedCh := make(chan prometheus.Metric)
+		translationDone := make(chan struct{})
+		go func(out chan<- prometheus.Metric) {
+			manager.v1Translator.translate(collectedCh, out)
+			close(translationDone)
+		}(ch)
+
+		defer func() {
+			close(collectedCh)
+			<-translationDone
+		}()
+		ch = collectedCh
+	}
+
 	waitGroup := sync.WaitGroup{}
 	waitGroup.Add(len(collectors))
 	for name, collector := range collectors {
@@ -166,6 +262,11 @@ func getScrapeDurationsCollector() *prometheus.SummaryVec {
 		[]string{"collector", "result"},
 	)
 
+	prometheus_helper.RegisterUnit(
+		prometheus.BuildFQName(config.PrometheusNamespace, "exporter", "scrape_duration_seconds"),
+		prometheus_helper.UnitSeconds,
+	)
+
 	return scrapeDurations
 }
 
@@ -174,44 +275,75 @@ func (manager *CollectorManager) AddInstance(id string, instance *config.Logstas
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	// Check if already exists
-	if _, exists := manager.instancesMap[id]; exists {
-		slog.Debug("instance already exists, updating", "id", id)
-	}
+	manager.addInstance(id, instance)
+	manager.rebuildCollectors()
+}
 
-	// Add to instance map
-	manager.instancesMap[id] = instance
+// RemoveInstance removes a Logstash instance from monitoring
+func (manager *CollectorManager) RemoveInstance(id string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
 
-	// Regenerate collectors with updated instances
-	var instances []*config.LogstashInstance
-	for _, inst := range manager.instancesMap {
-		instances = append(instances, inst)
+	if manager.removeInstance(id) {
+		manager.rebuildCollectors()
 	}
-
-	clients := getClientsForEndpoints(instances, manager.httpTimeout)
-	manager.collectors = getCollectors(clients)
 }
 
-// RemoveInstance removes a Logstash instance from monitoring
-func (manager *CollectorManager) RemoveInstance(id string) {
+// ReplaceInstances removes and adds Logstash instances with a single regeneration of the collectors,
+// so that a scrape collects either the previous or the new instances
+func (manager *CollectorManager) ReplaceInstances(removed []string, added map[string]*config.LogstashInstance) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
+	for _, id := range removed {
+		manager.removeInstance(id)
+	}
+	for id, instance := range added {
+		manager.addInstance(id, instance)
+	}
+
+	manager.rebuildCollectors()
+}
+
+// addInstance adds or updates the instance, without regenerating the collectors.
+// It must be called with the mutex held.
+func (manager *CollectorManager) addInstance(id string, instance *config.LogstashInstance) {
+	// Check if already exists
+	previous, exists := manager.instancesMap[id]
+	if exists {
+		slog.Debug("instance already exists, updating", "id", id)
+		if previous.Host != instance.Host {
+			manager.forgetEndpoint(previous.Host)
+		}
+	}
+
+	// The metric filter is compiled once, and kept while it is unchanged
+	if !exists || !reflect.DeepEqual(previous.MetricFilter, instance.MetricFilter) {
+		if filter := compileMetricFilter(id, instance); filter != nil {
+			manager.metricFilters[id] = filter
+		} else {
+			delete(manager.metricFilters, id)
+		}
+	}
+
+	// Add to instance map
+	manager.instancesMap[id] = instance
+}
+
+// removeInstance removes the instance without regenerating the collectors, and returns false if it does not exist.
+// It must be called with the mutex held.
+func (manager *CollectorManager) removeInstance(id string) bool {
 	// Check if exists
-	if _, exists := manager.instancesMap[id]; !exists {
+	instance, exists := manager.instancesMap[id]
+	if !exists {
 		slog.Debug("instance does not exist, nothing to remove", "id", id)
-		return
+		return false
 	}
 
 	// Remove from instance map
 	delete(manager.instancesMap, id)
+	delete(manager.metricFilters, id)
 
-	// Regenerate collectors with updated instances
-	var instances []*config.LogstashInstance
-	for _, inst := range manager.instancesMap {
-		instances = append(instances, inst)
-	}
-
-	clients := getClientsForEndpoints(instances, manager.httpTimeout)
-	manager.collectors = getCollectors(clients)
+	manager.forgetEndpoint(instance.Host)
+	return true
 }
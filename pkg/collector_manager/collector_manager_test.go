@@ -55,7 +55,7 @@ func TestNewCollectorManager(t *testing.T) {
 		mockEndpoints := []*config.LogstashInstance{endpoint1, endpoint2}
 		
 		// Execute
-		cm := NewCollectorManager(mockEndpoints, httpTimeout)
+		cm := NewCollectorManager(mockEndpoints, httpTimeout, config.MetricsConfig{})
 
 		// Verify
 		if cm == nil {
@@ -137,6 +137,30 @@ func TestCollect(t *testing.T) {
 			t.Errorf("expected metric description to be %q, got %q", expectedDesc, desc.String())
 		}
 	})
+
+	t.Run("should_drop_unmapped_metrics_in_v1_only_mode", func(t *testing.T) {
+		t.Parallel()
+
+		// Setup
+		cm := &CollectorManager{
+			collectors: map[string]Collector{
+				"mock": newMockCollector(false),
+			},
+			scrapeDurations: getScrapeDurationsCollector(),
+			v1Translator:    newV1CompatibilityTranslator(config.V1CompatibilityOnly, config.MetricsConfig{}),
+		}
+
+		ch := make(chan prometheus.Metric, 1)
+
+		// Execute
+		cm.Collect(ch)
+		close(ch)
+
+		// Verify
+		if metric, ok := <-ch; ok {
+			t.Errorf("expected no metric to be sent to the channel, got %v", metric.Desc())
+		}
+	})
 }
 
 func TestDescribe(t *testing.T) {
@@ -167,3 +191,59 @@ func TestDescribe(t *testing.T) {
 		t.Errorf("expected metric description to be %q, got %q", expectedDesc, desc.String())
 	}
 }
+
+func TestCollectorManagerStallDetector(t *testing.T) {
+	t.Parallel()
+
+	t.Run("keeps the stall detector when instances change", func(t *testing.T) {
+		t.Parallel()
+
+		cm := NewCollectorManager(nil, httpTimeout, config.MetricsConfig{})
+		stallDetector := cm.stallDetector
+		if stallDetector == nil {
+			t.Fatalf("expected the stall detection to be enabled by default")
+		}
+
+		cm.AddInstance("logstash", &config.LogstashInstance{Host: "http://localhost:9600"})
+		cm.RemoveInstance("logstash")
+		if cm.stallDetector != stallDetector {
+			t.Errorf("expected the stall detector to survive the regeneration of collectors")
+		}
+	})
+
+	t.Run("disables the stall detection with a window of 0", func(t *testing.T) {
+		t.Parallel()
+
+		window := time.Duration(0)
+		cm := NewCollectorManager(nil, httpTimeout, config.MetricsConfig{StallDetectionWindow: &window})
+		if cm.stallDetector != nil {
+			t.Errorf("expected the stall detection to be disabled")
+		}
+	})
+}
+
+func TestCollectorManagerReplaceInstances(t *testing.T) {
+	t.Parallel()
+
+	cm := NewCollectorManager([]*config.LogstashInstance{
+		{Host: "http://a:9600", Name: "a"},
+		{Host: "http://b:9600", Name: "b"},
+	}, httpTimeout, config.MetricsConfig{})
+
+	cm.ReplaceInstances([]string{"a", "missing"}, map[string]*config.LogstashInstance{
+		"c": {Host: "http://c:9600", Name: "c", MetricFilter: &config.MetricFilterConfig{Include: []string{"logstash_info_.*"}}},
+	})
+
+	if _, exists := cm.instancesMap["a"]; exists {
+		t.Errorf("expected instance a to be removed")
+	}
+	if len(cm.instancesMap) != 2 || cm.instancesMap["b"] == nil || cm.instancesMap["c"] == nil {
+		t.Errorf("expected instances b and c, got %v", cm.instancesMap)
+	}
+	if cm.metricFilters["c"] == nil {
+		t.Errorf("expected the metric filter of the added instance to be compiled")
+	}
+	if _, grouped := cm.collectors["nodestats"].(collectorGroup); !grouped {
+		t.Errorf("expected the collectors to be rebuilt with the filtered instance")
+	}
+}
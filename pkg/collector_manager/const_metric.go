@@ -0,0 +1,41 @@
+package collector_manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newConstMetric creates a copy of the collected metric with a different desc and label values,
+// keeping its value, type, and timestamps
+func newConstMetric(desc *prometheus.Desc, dtoMetric *dto.Metric, labelValues []string) (prometheus.Metric, error) {
+	var metric prometheus.Metric
+	var err error
+
+	switch {
+	case dtoMetric.Counter != nil:
+		counter := dtoMetric.GetCounter()
+		if counter.CreatedTimestamp != nil {
+			metric, err = prometheus.NewConstMetricWithCreatedTimestamp(desc, prometheus.CounterValue, counter.GetValue(), counter.GetCreatedTimestamp().AsTime(), labelValues...)
+		} else {
+			metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, counter.GetValue(), labelValues...)
+		}
+	case dtoMetric.Gauge != nil:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, dtoMetric.GetGauge().GetValue(), labelValues...)
+	case dtoMetric.Untyped != nil:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, dtoMetric.GetUntyped().GetValue(), labelValues...)
+	default:
+		return nil, fmt.Errorf("unsupported metric type of %s", desc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if dtoMetric.TimestampMs != nil {
+		metric = prometheus.NewMetricWithTimestamp(time.UnixMilli(dtoMetric.GetTimestampMs()), metric)
+	}
+
+	return metric, nil
+}
@@ -0,0 +1,203 @@
+package collector_manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const derivedSubsystem = "derived"
+
+// derivedMetricsPerPipeline is the maximum number of derived metrics of a pipeline
+const derivedMetricsPerPipeline = 6
+
+// derivedMinimumWindow is the minimum time between the two node stats samples the derived metrics are computed from.
+// The node stats fetched sooner, e.g. by a second Prometheus or by the pusher, export the previously computed metrics,
+// so that the rates are not computed over windows too short to be meaningful.
+const derivedMinimumWindow = 5 * time.Second
+
+// nodeStatsSample is a node stats response together with the moment it was fetched
+type nodeStatsSample struct {
+	timestamp time.Time
+	stats     *responses.NodeStatsResponse
+}
+
+// derivedState is the node stats sample the derived metrics of an instance were last computed at,
+// together with the computed metrics
+type derivedState struct {
+	sample  nodeStatsSample
+	metrics []prometheus.Metric
+}
+
+// nodeStatsSamples keeps the derived state of every instance.
+// It is owned by the CollectorManager, so that the samples survive
+// the regeneration of collectors when instances are added or removed.
+type nodeStatsSamples struct {
+	mu     sync.Mutex
+	states map[string]derivedState
+}
+
+func newNodeStatsSamples() *nodeStatsSamples {
+	return &nodeStatsSamples{states: make(map[string]derivedState)}
+}
+
+// observe records the fetched sample of the endpoint and returns the derived metrics to export.
+// The metrics are computed by derive from the previous sample, unless it was fetched less than
+// derivedMinimumWindow before, in which case the previously computed metrics are returned.
+func (s *nodeStatsSamples) observe(endpoint string, current nodeStatsSample, derive func(previous, current nodeStatsSample) []prometheus.Metric) []prometheus.Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[endpoint]
+	if !ok {
+		// rates can be computed starting from the second sample
+		s.states[endpoint] = derivedState{sample: current}
+		return nil
+	}
+
+	if current.timestamp.Sub(state.sample.timestamp) < derivedMinimumWindow {
+		return state.metrics
+	}
+
+	state = derivedState{sample: current, metrics: derive(state.sample, current)}
+	s.states[endpoint] = state
+	return state.metrics
+}
+
+// remove forgets the derived state of the endpoint
+func (s *nodeStatsSamples) remove(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, endpoint)
+}
+
+// DerivedMetricsCollector computes rates and ratios from the difference between
+// two node stats responses of an instance. The results are exported as gauges,
+// for consumers that are not able to compute them with PromQL, like a Pushgateway or an OTLP sink.
+// It observes the node stats fetched by the NodestatsCollector, so it does not query Logstash itself.
+type DerivedMetricsCollector struct {
+	samples *nodeStatsSamples
+
+	PipelineEventsInPerSecond     *prometheus.Desc
+	PipelineEventsOutPerSecond    *prometheus.Desc
+	PipelineEventLatencySeconds   *prometheus.Desc
+	PipelineFilterDropRatio       *prometheus.Desc
+	PipelineOutputFailureRatio    *prometheus.Desc
+	PipelineDeadLetterQueueGrowth *prometheus.Desc
+}
+
+func newDerivedMetricsCollector(samples *nodeStatsSamples) *DerivedMetricsCollector {
+	descHelper := prometheus_helper.SimpleDescHelper{Namespace: config.PrometheusNamespace, Subsystem: derivedSubsystem}
+	return &DerivedMetricsCollector{
+		samples: samples,
+
+		PipelineEventsInPerSecond: descHelper.NewDesc("pipeline_events_in_per_second",
+			"Number of events received by the pipeline per second since the previous sample.", "pipeline"),
+		PipelineEventsOutPerSecond: descHelper.NewDesc("pipeline_events_out_per_second",
+			"Number of events emitted by the pipeline per second since the previous sample.", "pipeline"),
+		PipelineEventLatencySeconds: descHelper.NewDescWithUnit("pipeline_event_latency_seconds", prometheus_helper.UnitSeconds,
+			"Average time spent by an event in the pipeline since the previous sample.", "pipeline"),
+		PipelineFilterDropRatio: descHelper.NewDesc("pipeline_filter_drop_ratio",
+			"Ratio of filtered events that were dropped before reaching the outputs since the previous sample.", "pipeline"),
+		PipelineOutputFailureRatio: descHelper.NewDesc("pipeline_output_failure_ratio",
+			"Ratio of documents that the outputs failed to send since the previous sample.", "pipeline"),
+		PipelineDeadLetterQueueGrowth: descHelper.NewDesc("pipeline_dead_letter_queue_growth_bytes_per_second",
+			"Growth of the dead letter queue in bytes per second since the previous sample.", "pipeline"),
+	}
+}
+
+// ObserveNodeStats sends the derived metrics of the node stats fetched by the NodestatsCollector
+func (c *DerivedMetricsCollector) ObserveNodeStats(client logstash_client.Client, nodeStats *responses.NodeStatsResponse, ch chan<- prometheus.Metric) {
+	endpoint := client.GetEndpoint()
+	current := nodeStatsSample{timestamp: time.Now(), stats: nodeStats}
+
+	metrics := c.samples.observe(endpoint, current, func(previous, current nodeStatsSample) []prometheus.Metric {
+		derivedCh := make(chan prometheus.Metric, len(current.stats.Pipelines)*derivedMetricsPerPipeline)
+		metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: derivedCh, DefaultLabels: []string{endpoint, client.Name()}}
+		c.collectDerivedMetrics(previous, current, &metricsHelper)
+		close(derivedCh)
+
+		metrics := make([]prometheus.Metric, 0, len(derivedCh))
+		for metric := range derivedCh {
+			metrics = append(metrics, metric)
+		}
+		return metrics
+	})
+
+	for _, metric := range metrics {
+		ch <- metric
+	}
+}
+
+func (c *DerivedMetricsCollector) collectDerivedMetrics(previous, current nodeStatsSample, metricsHelper *prometheus_helper.SimpleMetricsHelper) {
+	elapsedSeconds := current.timestamp.Sub(previous.timestamp).Seconds()
+	if elapsedSeconds <= 0 {
+		return
+	}
+
+	for pipelineId, currentPipeline := range current.stats.Pipelines {
+		previousPipeline, ok := previous.stats.Pipelines[pipelineId]
+		if !ok {
+			continue
+		}
+
+		// a reload of the pipeline resets its counters
+		if previousPipeline.EphemeralID != currentPipeline.EphemeralID {
+			continue
+		}
+
+		metricsHelper.Labels = []string{pipelineId}
+		c.collectPipelineMetrics(&previousPipeline, &currentPipeline, elapsedSeconds, metricsHelper)
+	}
+}
+
+func (c *DerivedMetricsCollector) collectPipelineMetrics(previous, current *responses.SinglePipelineResponse, elapsedSeconds float64, metricsHelper *prometheus_helper.SimpleMetricsHelper) {
+	eventsIn := current.Events.In - previous.Events.In
+	eventsFiltered := current.Events.Filtered - previous.Events.Filtered
+	eventsOut := current.Events.Out - previous.Events.Out
+	eventsDuration := current.Events.DurationInMillis - previous.Events.DurationInMillis
+
+	if eventsIn < 0 || eventsFiltered < 0 || eventsOut < 0 || eventsDuration < 0 {
+		// counters were reset, e.g. by a restart of Logstash
+		return
+	}
+
+	metricsHelper.NewFloatMetric(c.PipelineEventsInPerSecond, prometheus.GaugeValue, float64(eventsIn)/elapsedSeconds)
+	metricsHelper.NewFloatMetric(c.PipelineEventsOutPerSecond, prometheus.GaugeValue, float64(eventsOut)/elapsedSeconds)
+
+	if eventsOut > 0 {
+		metricsHelper.NewFloatMetric(c.PipelineEventLatencySeconds, prometheus.GaugeValue, float64(eventsDuration)/1000/float64(eventsOut))
+	}
+
+	if eventsFiltered > 0 && eventsFiltered >= eventsOut {
+		metricsHelper.NewFloatMetric(c.PipelineFilterDropRatio, prometheus.GaugeValue, float64(eventsFiltered-eventsOut)/float64(eventsFiltered))
+	}
+
+	successes, failures := sumOutputDocuments(current)
+	previousSuccesses, previousFailures := sumOutputDocuments(previous)
+	successes -= previousSuccesses
+	failures -= previousFailures
+	if successes >= 0 && failures >= 0 && successes+failures > 0 {
+		metricsHelper.NewFloatMetric(c.PipelineOutputFailureRatio, prometheus.GaugeValue, float64(failures)/float64(successes+failures))
+	}
+
+	deadLetterQueueGrowth := current.DeadLetterQueue.QueueSizeInBytes - previous.DeadLetterQueue.QueueSizeInBytes
+	metricsHelper.NewFloatMetric(c.PipelineDeadLetterQueueGrowth, prometheus.GaugeValue, float64(deadLetterQueueGrowth)/elapsedSeconds)
+}
+
+// sumOutputDocuments returns the number of documents successfully sent
+// and the number of documents that failed to be sent by all outputs of the pipeline
+func sumOutputDocuments(pipeline *responses.SinglePipelineResponse) (successes int, failures int) {
+	for _, output := range pipeline.Plugins.Outputs {
+		successes += output.Documents.Successes
+		failures += output.Documents.NonRetryableFailures
+	}
+	return successes, failures
+}
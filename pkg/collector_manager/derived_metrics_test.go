@@ -0,0 +1,273 @@
+package collector_manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kuskoman/logstash-exporter/internal/collectors/nodestats"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+type sequenceMockClient struct {
+	responses []*responses.NodeStatsResponse
+}
+
+func (m *sequenceMockClient) GetNodeInfo(ctx context.Context) (*responses.NodeInfoResponse, error) {
+	return nil, nil
+}
+
+func (m *sequenceMockClient) GetNodeStats(ctx context.Context) (*responses.NodeStatsResponse, error) {
+	if len(m.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	response := m.responses[0]
+	m.responses = m.responses[1:]
+	return response, nil
+}
+
+func (m *sequenceMockClient) GetEndpoint() string {
+	return "http://localhost:9600"
+}
+
+func (m *sequenceMockClient) Name() string {
+	return "sequence"
+}
+
+func newPipelineStats(t *testing.T, in, filtered, out, durationInMillis, dlqBytes int64, successes, failures int) responses.SinglePipelineResponse {
+	t.Helper()
+
+	pipelineJson := fmt.Sprintf(`{
+		"ephemeral_id": "ephemeral",
+		"events": {"in": %d, "filtered": %d, "out": %d, "duration_in_millis": %d},
+		"dead_letter_queue": {"queue_size_in_bytes": %d},
+		"plugins": {"outputs": [{"id": "output", "documents": {"successes": %d, "non_retryable_failures": %d}}]}
+	}`, in, filtered, out, durationInMillis, dlqBytes, successes, failures)
+
+	var pipeline responses.SinglePipelineResponse
+	if err := json.Unmarshal([]byte(pipelineJson), &pipeline); err != nil {
+		t.Fatalf("failed to unmarshal pipeline stats: %v", err)
+	}
+	return pipeline
+}
+
+func collectDerivedValues(t *testing.T, previous, current nodeStatsSample) map[string]float64 {
+	t.Helper()
+
+	collector := newDerivedMetricsCollector(newNodeStatsSamples())
+	ch := make(chan prometheus.Metric, 100)
+	metricsHelper := prometheus_helper.SimpleMetricsHelper{Channel: ch, DefaultLabels: []string{"endpoint", "name"}}
+	collector.collectDerivedMetrics(previous, current, &metricsHelper)
+	close(ch)
+
+	values := make(map[string]float64)
+	for metric := range ch {
+		fqName, err := prometheus_helper.ExtractFqName(metric.Desc().String())
+		if err != nil {
+			t.Fatalf("failed to extract fqName: %v", err)
+		}
+		value, err := prometheus_helper.ExtractValueFromMetric(metric)
+		if err != nil {
+			t.Fatalf("failed to extract value of %s: %v", fqName, err)
+		}
+		values[fqName] = value
+	}
+	return values
+}
+
+func TestCollectDerivedMetrics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	t.Run("computes rates and ratios between samples", func(t *testing.T) {
+		t.Parallel()
+
+		previous := nodeStatsSample{timestamp: now, stats: &responses.NodeStatsResponse{
+			Pipelines: map[string]responses.SinglePipelineResponse{
+				"main": newPipelineStats(t, 1000, 1000, 900, 5000, 100, 900, 0),
+			},
+		}}
+		current := nodeStatsSample{timestamp: now.Add(10 * time.Second), stats: &responses.NodeStatsResponse{
+			Pipelines: map[string]responses.SinglePipelineResponse{
+				"main": newPipelineStats(t, 2000, 2000, 1700, 9000, 600, 1690, 10),
+			},
+		}}
+
+		values := collectDerivedValues(t, previous, current)
+
+		expected := map[string]float64{
+			"logstash_derived_pipeline_events_in_per_second":                      100,
+			"logstash_derived_pipeline_events_out_per_second":                     80,
+			"logstash_derived_pipeline_event_latency_seconds":                     0.005,
+			"logstash_derived_pipeline_filter_drop_ratio":                         0.2,
+			"logstash_derived_pipeline_output_failure_ratio":                      0.0125,
+			"logstash_derived_pipeline_dead_letter_queue_growth_bytes_per_second": 50,
+		}
+
+		if len(values) != len(expected) {
+			t.Errorf("expected %d metrics, got %d: %v", len(expected), len(values), values)
+		}
+		for name, expectedValue := range expected {
+			value, ok := values[name]
+			if !ok {
+				t.Errorf("expected metric %s to be collected", name)
+				continue
+			}
+			if math.Abs(value-expectedValue) > 1e-9 {
+				t.Errorf("expected %s to be %f, got %f", name, expectedValue, value)
+			}
+		}
+	})
+
+	t.Run("skips pipelines with reset counters", func(t *testing.T) {
+		t.Parallel()
+
+		previous := nodeStatsSample{timestamp: now, stats: &responses.NodeStatsResponse{
+			Pipelines: map[string]responses.SinglePipelineResponse{
+				"main": newPipelineStats(t, 1000, 1000, 900, 5000, 100, 900, 0),
+			},
+		}}
+		current := nodeStatsSample{timestamp: now.Add(10 * time.Second), stats: &responses.NodeStatsResponse{
+			Pipelines: map[string]responses.SinglePipelineResponse{
+				"main": newPipelineStats(t, 10, 10, 10, 10, 0, 10, 0),
+			},
+		}}
+
+		values := collectDerivedValues(t, previous, current)
+		if len(values) != 0 {
+			t.Errorf("expected no metrics after a counter reset, got %v", values)
+		}
+	})
+
+	t.Run("skips reloaded pipelines", func(t *testing.T) {
+		t.Parallel()
+
+		reloadedPipeline := newPipelineStats(t, 2000, 2000, 1700, 9000, 600, 1690, 10)
+		reloadedPipeline.EphemeralID = "reloaded"
+
+		previous := nodeStatsSample{timestamp: now, stats: &responses.NodeStatsResponse{
+			Pipelines: map[string]responses.SinglePipelineResponse{
+				"main": newPipelineStats(t, 1000, 1000, 900, 5000, 100, 900, 0),
+			},
+		}}
+		current := nodeStatsSample{timestamp: now.Add(10 * time.Second), stats: &responses.NodeStatsResponse{
+			Pipelines: map[string]responses.SinglePipelineResponse{
+				"main": reloadedPipeline,
+			},
+		}}
+
+		values := collectDerivedValues(t, previous, current)
+		if len(values) != 0 {
+			t.Errorf("expected no metrics for a reloaded pipeline, got %v", values)
+		}
+	})
+}
+
+// countDerivedMetrics returns the number of derived metrics in the channel, and drains it
+func countDerivedMetrics(t *testing.T, ch chan prometheus.Metric) int {
+	t.Helper()
+
+	count := 0
+	for len(ch) > 0 {
+		metric := <-ch
+		fqName, err := prometheus_helper.ExtractFqName(metric.Desc().String())
+		if err != nil {
+			t.Fatalf("failed to extract fqName: %v", err)
+		}
+		if strings.HasPrefix(fqName, "logstash_derived_") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDerivedMetricsCollector_ObserveNodeStats(t *testing.T) {
+	t.Parallel()
+
+	stats := &responses.NodeStatsResponse{
+		Pipelines: map[string]responses.SinglePipelineResponse{
+			"main": newPipelineStats(t, 1000, 1000, 900, 5000, 100, 900, 0),
+		},
+	}
+	// every scrape fetches the node stats once, shared by the nodestats and the derived metrics
+	client := &sequenceMockClient{responses: []*responses.NodeStatsResponse{stats, stats, stats}}
+	samples := newNodeStatsSamples()
+	collector := nodestats.NewNodestatsCollector([]logstash_client.Client{client}, config.MetricsConfig{}, newDerivedMetricsCollector(samples))
+
+	ch := make(chan prometheus.Metric, 1000)
+
+	if err := collector.Collect(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := countDerivedMetrics(t, ch); count != 0 {
+		t.Errorf("expected no derived metrics after the first fetch, got %d", count)
+	}
+
+	// a fetch within the minimum window, e.g. of a second scraper, does not compute the rates
+	if err := collector.Collect(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := countDerivedMetrics(t, ch); count != 0 {
+		t.Errorf("expected no derived metrics within the minimum window, got %d", count)
+	}
+
+	samples.mu.Lock()
+	state := samples.states[client.GetEndpoint()]
+	state.sample.timestamp = state.sample.timestamp.Add(-derivedMinimumWindow)
+	samples.states[client.GetEndpoint()] = state
+	samples.mu.Unlock()
+
+	if err := collector.Collect(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := countDerivedMetrics(t, ch); count == 0 {
+		t.Errorf("expected derived metrics after the minimum window")
+	}
+
+	if err := collector.Collect(context.Background(), ch); err == nil {
+		t.Errorf("expected an error when node stats cannot be fetched")
+	}
+}
+
+func TestNodeStatsSamples_Observe(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	samples := newNodeStatsSamples()
+	derivations := 0
+	derive := func(previous, current nodeStatsSample) []prometheus.Metric {
+		derivations++
+		return []prometheus.Metric{prometheus.MustNewConstMetric(
+			prometheus.NewDesc("derived", "derived", nil, nil), prometheus.GaugeValue, current.timestamp.Sub(previous.timestamp).Seconds())}
+	}
+
+	if metrics := samples.observe("endpoint", nodeStatsSample{timestamp: now}, derive); metrics != nil {
+		t.Errorf("expected no metrics for the first sample, got %v", metrics)
+	}
+
+	metrics := samples.observe("endpoint", nodeStatsSample{timestamp: now.Add(10 * time.Second)}, derive)
+	if len(metrics) != 1 || derivations != 1 {
+		t.Fatalf("expected the metrics to be derived from the second sample, got %v", metrics)
+	}
+
+	cached := samples.observe("endpoint", nodeStatsSample{timestamp: now.Add(11 * time.Second)}, derive)
+	if len(cached) != 1 || cached[0] != metrics[0] || derivations != 1 {
+		t.Errorf("expected the previous metrics within the minimum window, got %v", cached)
+	}
+
+	samples.remove("endpoint")
+	if metrics := samples.observe("endpoint", nodeStatsSample{timestamp: now.Add(20 * time.Second)}, derive); metrics != nil {
+		t.Errorf("expected no metrics after the endpoint was removed, got %v", metrics)
+	}
+}
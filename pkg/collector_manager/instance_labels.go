@@ -0,0 +1,228 @@
+package collector_manager
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// instanceLabels are the labels and the metric filter of an instance, resolved when its collectors are built
+type instanceLabels struct {
+	// names are the sorted names of the labels of all instances. The labels that the instance
+	// does not have are added with an empty value, so that every metric family has the same label names.
+	names []string
+	// values are the labels of the instance
+	values map[string]string
+	filter *metricFilter
+
+	// descs are the labeled descs of the collected metrics, by their original descs
+	descs sync.Map
+}
+
+// labeledDesc is the desc of the metrics of an instance, with the labels of the instance
+type labeledDesc struct {
+	// desc is nil if the metrics are dropped by the metric filter of the instance
+	desc *prometheus.Desc
+	// labelPairs are the labels of the instance which are not collected from Logstash
+	labelPairs []*dto.LabelPair
+}
+
+// compileMetricFilter returns the compiled metric filter of the instance, or nil if it has none.
+// An invalid filter is logged and ignored, so that all the metrics of the instance are exported.
+func compileMetricFilter(id string, instance *config.LogstashInstance) *metricFilter {
+	if instance.MetricFilter == nil {
+		return nil
+	}
+
+	filter, err := newMetricFilter(instance.MetricFilter)
+	if err != nil {
+		slog.Error("ignoring the invalid metric filter of instance", "instance", id, "err", err)
+		return nil
+	}
+	return filter
+}
+
+// getInstanceLabels returns the labels and the compiled metric filters of the instances by their IDs,
+// or nil if no instance has labels or a metric filter. If any instance has labels,
+// every instance is returned, as the instances without labels get empty ones.
+func getInstanceLabels(instances map[string]*config.LogstashInstance, filters map[string]*metricFilter) map[string]*instanceLabels {
+	labels := make(map[string]*instanceLabels)
+	names := make(map[string]bool)
+
+	for id, instance := range instances {
+		filter := filters[id]
+		if filter != nil || len(instance.Labels) > 0 {
+			labels[id] = &instanceLabels{values: instance.Labels, filter: filter}
+		}
+		for name := range instance.Labels {
+			names[name] = true
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	if len(names) == 0 {
+		return labels
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	for id, instance := range instances {
+		if _, exists := labels[id]; !exists {
+			labels[id] = &instanceLabels{values: instance.Labels}
+		}
+		labels[id].names = sortedNames
+	}
+
+	return labels
+}
+
+// labelMetric returns the metric with the labels of its instance, or nil if the metric filter of the instance drops it
+func (labels *instanceLabels) labelMetric(metric prometheus.Metric) (prometheus.Metric, error) {
+	desc, err := labels.getDesc(metric.Desc())
+	if err != nil {
+		return nil, err
+	}
+	if desc.desc == nil {
+		return nil, nil
+	}
+	if len(desc.labelPairs) == 0 {
+		return metric, nil
+	}
+
+	return &labeledMetric{Metric: metric, desc: desc.desc, labelPairs: desc.labelPairs}, nil
+}
+
+// getDesc returns the labeled desc of the metrics with the given desc. It is resolved
+// on the first collection of a metric, as the descs of the collectors do not change.
+func (labels *instanceLabels) getDesc(desc *prometheus.Desc) (*labeledDesc, error) {
+	if cached, ok := labels.descs.Load(desc); ok {
+		return cached.(*labeledDesc), nil
+	}
+
+	descString := desc.String()
+	fqName, err := prometheus_helper.ExtractFqName(descString)
+	if err != nil {
+		return nil, err
+	}
+
+	if labels.filter != nil && !labels.filter.keep(fqName) {
+		cached, _ := labels.descs.LoadOrStore(desc, &labeledDesc{})
+		return cached.(*labeledDesc), nil
+	}
+
+	variableLabels, err := prometheus_helper.ExtractVariableLabels(descString)
+	if err != nil {
+		return nil, err
+	}
+
+	// the labels collected from Logstash take precedence over the labels of the instance
+	constLabels := make(prometheus.Labels)
+	var labelPairs []*dto.LabelPair
+	for _, name := range labels.names {
+		if slices.Contains(variableLabels, name) {
+			continue
+		}
+		value := labels.values[name]
+		constLabels[name] = value
+		labelPairs = append(labelPairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+
+	labeled := &labeledDesc{desc: desc}
+	if len(labelPairs) > 0 {
+		help, err := prometheus_helper.ExtractHelp(descString)
+		if err != nil {
+			return nil, err
+		}
+		labeled = &labeledDesc{desc: prometheus.NewDesc(fqName, help, variableLabels, constLabels), labelPairs: labelPairs}
+	}
+
+	cached, _ := labels.descs.LoadOrStore(desc, labeled)
+	return cached.(*labeledDesc), nil
+}
+
+// labeledMetric is a collected metric with the labels of its instance
+type labeledMetric struct {
+	prometheus.Metric
+	desc       *prometheus.Desc
+	labelPairs []*dto.LabelPair
+}
+
+func (metric *labeledMetric) Desc() *prometheus.Desc {
+	return metric.desc
+}
+
+func (metric *labeledMetric) Write(out *dto.Metric) error {
+	if err := metric.Metric.Write(out); err != nil {
+		return err
+	}
+
+	out.Label = append(out.Label, metric.labelPairs...)
+	slices.SortFunc(out.Label, func(a, b *dto.LabelPair) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	return nil
+}
+
+// labeledCollector sends the metrics of the collector of an instance with the labels of the instance
+type labeledCollector struct {
+	collector Collector
+	labels    *instanceLabels
+}
+
+func (collector *labeledCollector) Collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	collected := make(chan prometheus.Metric)
+	labelingDone := make(chan struct{})
+	go func() {
+		for metric := range collected {
+			labeledMetric, err := collector.labels.labelMetric(metric)
+			if err != nil {
+				slog.Error("failed to add instance labels to metric", "desc", metric.Desc(), "err", err)
+				continue
+			}
+			if labeledMetric != nil {
+				ch <- labeledMetric
+			}
+		}
+		close(labelingDone)
+	}()
+
+	err := collector.collector.Collect(ctx, collected)
+	close(collected)
+	<-labelingDone
+	return err
+}
+
+// collectorGroup runs the collectors of the same kind, built for different instances, as one collector
+type collectorGroup []Collector
+
+func (group collectorGroup) Collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	errs := make([]error, len(group))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(group))
+	for i, collector := range group {
+		go func(i int, collector Collector) {
+			errs[i] = collector.Collect(ctx, ch)
+			wg.Done()
+		}(i, collector)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
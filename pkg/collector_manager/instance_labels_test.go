@@ -0,0 +1,184 @@
+package collector_manager
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+func TestGetInstanceLabels(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should return nil without labels", func(t *testing.T) {
+		t.Parallel()
+
+		instances := map[string]*config.LogstashInstance{"a": {Host: "http://a:9600"}}
+		if labels := getInstanceLabels(instances, nil); labels != nil {
+			t.Errorf("expected nil, got %v", labels)
+		}
+	})
+
+	t.Run("should return the sorted label names of all instances", func(t *testing.T) {
+		t.Parallel()
+
+		instances := map[string]*config.LogstashInstance{
+			"a": {Host: "http://a:9600", Labels: map[string]string{"team": "a", "env": "prod"}},
+			"b": {Host: "http://b:9600", Labels: map[string]string{"zone": "eu"}},
+			"c": {Host: "http://c:9600"},
+		}
+
+		labels := getInstanceLabels(instances, nil)
+		if len(labels) != 3 || !slices.Equal(labels["c"].names, []string{"env", "team", "zone"}) {
+			t.Fatalf("unexpected labels: %v", labels)
+		}
+		if labels["b"].values["zone"] != "eu" {
+			t.Errorf("expected the labels of instance b, got %v", labels["b"].values)
+		}
+	})
+
+	t.Run("should key the labels by the instance IDs", func(t *testing.T) {
+		t.Parallel()
+
+		instances := map[string]*config.LogstashInstance{
+			"a": {Host: "http://logstash:9600", Labels: map[string]string{"team": "a"}},
+			"b": {Host: "http://logstash:9600", Labels: map[string]string{"team": "b"}},
+		}
+
+		labels := getInstanceLabels(instances, nil)
+		if labels["a"].values["team"] != "a" || labels["b"].values["team"] != "b" {
+			t.Errorf("expected the labels of both instances, got %v", labels)
+		}
+	})
+}
+
+func TestInstanceLabelsLabelMetric(t *testing.T) {
+	t.Parallel()
+
+	descHelper := prometheus_helper.SimpleDescHelper{Namespace: "logstash", Subsystem: "stats_pipeline"}
+	instanceDesc := descHelper.NewDesc("events_in", "Number of events that have been inputted into this pipeline.", "pipeline")
+
+	labels := getInstanceLabels(map[string]*config.LogstashInstance{
+		"a": {Host: "http://a:9600", Labels: map[string]string{"team": "a", "pipeline": "ignored"}},
+		"b": {Host: "http://b:9600"},
+	}, nil)
+
+	labelMetric := func(t *testing.T, labels *instanceLabels, metric prometheus.Metric) map[string]string {
+		t.Helper()
+
+		labeledMetric, err := labels.labelMetric(metric)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var dtoMetric dto.Metric
+		if err := labeledMetric.Write(&dtoMetric); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if dtoMetric.GetCounter().GetValue() != 42 {
+			t.Errorf("expected the value to be preserved, got %v", dtoMetric.GetCounter().GetValue())
+		}
+		if !slices.IsSortedFunc(dtoMetric.GetLabel(), func(a, b *dto.LabelPair) int {
+			return strings.Compare(a.GetName(), b.GetName())
+		}) {
+			t.Errorf("expected the labels to be sorted, got %v", dtoMetric.GetLabel())
+		}
+
+		result := make(map[string]string)
+		for _, label := range dtoMetric.GetLabel() {
+			result[label.GetName()] = label.GetValue()
+		}
+		return result
+	}
+
+	t.Run("should add the labels of the instance", func(t *testing.T) {
+		t.Parallel()
+
+		result := labelMetric(t, labels["a"], prometheus.MustNewConstMetric(instanceDesc, prometheus.CounterValue, 42, "main", "http://a:9600", "a"))
+		if result["team"] != "a" || result["pipeline"] != "main" {
+			t.Errorf("unexpected labels: %v", result)
+		}
+	})
+
+	t.Run("should add empty labels to instances without them", func(t *testing.T) {
+		t.Parallel()
+
+		result := labelMetric(t, labels["b"], prometheus.MustNewConstMetric(instanceDesc, prometheus.CounterValue, 42, "main", "http://b:9600", "b"))
+		if value, ok := result["team"]; ok && value != "" {
+			t.Errorf("expected an empty team label, got %v", result)
+		}
+	})
+
+	t.Run("should reuse the labeled desc", func(t *testing.T) {
+		t.Parallel()
+
+		first, err := labels["a"].labelMetric(prometheus.MustNewConstMetric(instanceDesc, prometheus.CounterValue, 1, "main", "http://a:9600", "a"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		second, err := labels["a"].labelMetric(prometheus.MustNewConstMetric(instanceDesc, prometheus.CounterValue, 2, "other", "http://a:9600", "a"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if first.Desc() != second.Desc() {
+			t.Errorf("expected the labeled desc to be cached")
+		}
+	})
+}
+
+type staticCollector []prometheus.Metric
+
+func (collector staticCollector) Collect(_ context.Context, ch chan<- prometheus.Metric) error {
+	for _, metric := range collector {
+		ch <- metric
+	}
+	return nil
+}
+
+func TestLabeledCollector(t *testing.T) {
+	t.Parallel()
+
+	descHelper := prometheus_helper.SimpleDescHelper{Namespace: "logstash", Subsystem: "info"}
+	upDesc := descHelper.NewDesc("up", "A metric that returns 1 if the node is up, 0 otherwise.")
+
+	// both instances run on the same host, e.g. behind a service with two ports
+	labels := getInstanceLabels(map[string]*config.LogstashInstance{
+		"a": {Host: "http://logstash:9600", Name: "a", Labels: map[string]string{"team": "a"}},
+		"b": {Host: "http://logstash:9600", Name: "b", Labels: map[string]string{"team": "b"}},
+	}, nil)
+
+	group := collectorGroup{
+		&labeledCollector{staticCollector{prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1, "http://logstash:9600", "a")}, labels["a"]},
+		&labeledCollector{staticCollector{prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1, "http://logstash:9600", "b")}, labels["b"]},
+	}
+
+	ch := make(chan prometheus.Metric, 2)
+	if err := group.Collect(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(ch)
+
+	teams := make(map[string]string)
+	for metric := range ch {
+		var dtoMetric dto.Metric
+		if err := metric.Write(&dtoMetric); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		labels := make(map[string]string)
+		for _, label := range dtoMetric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		teams[labels["instance_name"]] = labels["team"]
+	}
+
+	if teams["a"] != "a" || teams["b"] != "b" {
+		t.Errorf("expected the labels of each instance, got %v", teams)
+	}
+}
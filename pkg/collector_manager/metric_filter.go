@@ -0,0 +1,59 @@
+package collector_manager
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// metricFilter selects the exported metrics of an instance by their names
+type metricFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newMetricFilter compiles the expressions of the filter, anchored to match the whole metric name
+func newMetricFilter(filterConfig *config.MetricFilterConfig) (*metricFilter, error) {
+	compile := func(expressions []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(expressions))
+		for _, expression := range expressions {
+			re, err := regexp.Compile("^(?:" + expression + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	include, err := compile(filterConfig.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compile(filterConfig.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metricFilter{include: include, exclude: exclude}, nil
+}
+
+// keep returns true if the metric is included and not excluded
+func (filter *metricFilter) keep(name string) bool {
+	if len(filter.include) > 0 && !matchesAny(filter.include, name) {
+		return false
+	}
+
+	return !matchesAny(filter.exclude, name)
+}
+
+func matchesAny(expressions []*regexp.Regexp, name string) bool {
+	for _, re := range expressions {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
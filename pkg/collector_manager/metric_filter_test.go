@@ -0,0 +1,105 @@
+package collector_manager
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+func TestMetricFilter(t *testing.T) {
+	t.Parallel()
+
+	filter, err := newMetricFilter(&config.MetricFilterConfig{
+		Include: []string{"logstash_stats_pipeline_.*", "logstash_info_.*"},
+		Exclude: []string{".*_plugin_.*"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, expected := range map[string]bool{
+		"logstash_stats_pipeline_events_in":        true,
+		"logstash_info_node":                       true,
+		"logstash_stats_pipeline_plugin_events_in": false,
+		"logstash_stats_jvm_mem_heap_used_bytes":   false,
+		"prefix_logstash_info_node":                false,
+	} {
+		if filter.keep(name) != expected {
+			t.Errorf("expected keep(%s) to be %v", name, expected)
+		}
+	}
+
+	if _, err := newMetricFilter(&config.MetricFilterConfig{Exclude: []string{"("}}); err == nil {
+		t.Errorf("expected an error for an invalid expression")
+	}
+}
+
+func TestInstanceLabelsMetricFilter(t *testing.T) {
+	t.Parallel()
+
+	descHelper := prometheus_helper.SimpleDescHelper{Namespace: "logstash", Subsystem: "stats_pipeline"}
+	eventsDesc := descHelper.NewDesc("events_in", "Number of events that have been inputted into this pipeline.", "pipeline")
+
+	instances := map[string]*config.LogstashInstance{
+		"a": {Host: "http://a:9600", MetricFilter: &config.MetricFilterConfig{Exclude: []string{"logstash_stats_pipeline_.*"}}},
+		"b": {Host: "http://b:9600"},
+	}
+	labels := getInstanceLabels(instances, map[string]*metricFilter{"a": compileMetricFilter("a", instances["a"])})
+	if labels["a"] == nil {
+		t.Fatalf("expected the metric filter to be collected")
+	}
+	if _, exists := labels["b"]; exists {
+		t.Errorf("expected the instance without labels and metric filter to be left out")
+	}
+
+	filtered := prometheus.MustNewConstMetric(eventsDesc, prometheus.CounterValue, 42, "main", "http://a:9600", "a")
+	if metric, err := labels["a"].labelMetric(filtered); err != nil || metric != nil {
+		t.Errorf("expected the metric of instance a to be dropped, got %v, %v", metric, err)
+	}
+}
+
+func TestCollectorManagerMetricFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("compiles the metric filter of an instance once", func(t *testing.T) {
+		t.Parallel()
+
+		cm := NewCollectorManager(nil, httpTimeout, config.MetricsConfig{})
+		cm.AddInstance("a", &config.LogstashInstance{Host: "http://a:9600", MetricFilter: &config.MetricFilterConfig{Include: []string{"logstash_info_.*"}}})
+		filter := cm.metricFilters["a"]
+		if filter == nil {
+			t.Fatalf("expected the metric filter to be compiled")
+		}
+
+		// the instance is added again with the same filter, e.g. when its credentials are rotated
+		cm.AddInstance("a", &config.LogstashInstance{Host: "http://a:9600", MetricFilter: &config.MetricFilterConfig{Include: []string{"logstash_info_.*"}}})
+		cm.AddInstance("b", &config.LogstashInstance{Host: "http://b:9600"})
+		if cm.metricFilters["a"] != filter {
+			t.Errorf("expected the compiled metric filter to be kept")
+		}
+
+		cm.AddInstance("a", &config.LogstashInstance{Host: "http://a:9600", MetricFilter: &config.MetricFilterConfig{Exclude: []string{"logstash_info_.*"}}})
+		if cm.metricFilters["a"] == filter || cm.metricFilters["a"].keep("logstash_info_node") {
+			t.Errorf("expected the changed metric filter to be compiled")
+		}
+
+		cm.RemoveInstance("a")
+		if _, exists := cm.metricFilters["a"]; exists {
+			t.Errorf("expected the metric filter of the removed instance to be dropped")
+		}
+	})
+
+	t.Run("ignores an invalid metric filter", func(t *testing.T) {
+		t.Parallel()
+
+		cm := NewCollectorManager([]*config.LogstashInstance{
+			{Host: "http://a:9600", MetricFilter: &config.MetricFilterConfig{Exclude: []string{"("}}},
+		}, httpTimeout, config.MetricsConfig{})
+		if len(cm.metricFilters) != 0 {
+			t.Errorf("expected the invalid metric filter to be ignored, got %v", cm.metricFilters)
+		}
+	})
+}
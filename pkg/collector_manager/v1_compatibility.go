@@ -0,0 +1,271 @@
+package collector_manager
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+// v1DroppedLabels are the labels added in V2, which are not part of the V1 label sets
+var v1DroppedLabels = []string{"instance_name"}
+
+// v1MetricNames are the names of the metrics exported by V1, which the "v2" naming scheme kept.
+// They are checked against scripts/snapshots/metric_names.txt, so every metric exported by default
+// has to be either listed here or in v2OnlyMetricNames.
+var v1MetricNames = map[string]bool{
+	"logstash_info_build":                                             true,
+	"logstash_info_node":                                              true,
+	"logstash_info_pipeline_batch_delay":                              true,
+	"logstash_info_pipeline_batch_size":                               true,
+	"logstash_info_pipeline_workers":                                  true,
+	"logstash_info_status":                                            true,
+	"logstash_info_up":                                                true,
+	"logstash_stats_events_duration_millis":                           true,
+	"logstash_stats_events_filtered":                                  true,
+	"logstash_stats_events_in":                                        true,
+	"logstash_stats_events_out":                                       true,
+	"logstash_stats_events_queue_push_duration_millis":                true,
+	"logstash_stats_flow_filter_current":                              true,
+	"logstash_stats_flow_filter_lifetime":                             true,
+	"logstash_stats_flow_input_current":                               true,
+	"logstash_stats_flow_input_lifetime":                              true,
+	"logstash_stats_flow_output_current":                              true,
+	"logstash_stats_flow_output_lifetime":                             true,
+	"logstash_stats_flow_queue_backpressure_current":                  true,
+	"logstash_stats_flow_queue_backpressure_lifetime":                 true,
+	"logstash_stats_flow_worker_concurrency_current":                  true,
+	"logstash_stats_flow_worker_concurrency_lifetime":                 true,
+	"logstash_stats_jvm_gc_collection_count":                          true,
+	"logstash_stats_jvm_gc_collection_time_millis_total":              true,
+	"logstash_stats_jvm_mem_heap_committed_bytes":                     true,
+	"logstash_stats_jvm_mem_heap_max_bytes":                           true,
+	"logstash_stats_jvm_mem_heap_used_bytes":                          true,
+	"logstash_stats_jvm_mem_heap_used_percent":                        true,
+	"logstash_stats_jvm_mem_non_heap_committed_bytes":                 true,
+	"logstash_stats_jvm_mem_pool_committed_bytes":                     true,
+	"logstash_stats_jvm_mem_pool_max_bytes":                           true,
+	"logstash_stats_jvm_mem_pool_peak_max_bytes":                      true,
+	"logstash_stats_jvm_mem_pool_peak_used_bytes":                     true,
+	"logstash_stats_jvm_mem_pool_used_bytes":                          true,
+	"logstash_stats_jvm_threads_count":                                true,
+	"logstash_stats_jvm_threads_peak_count":                           true,
+	"logstash_stats_jvm_uptime_millis":                                true,
+	"logstash_stats_pipeline_dead_letter_queue_dropped_events":        true,
+	"logstash_stats_pipeline_dead_letter_queue_expired_events":        true,
+	"logstash_stats_pipeline_dead_letter_queue_max_size_in_bytes":     true,
+	"logstash_stats_pipeline_dead_letter_queue_size_in_bytes":         true,
+	"logstash_stats_pipeline_events_duration":                         true,
+	"logstash_stats_pipeline_events_filtered":                         true,
+	"logstash_stats_pipeline_events_in":                               true,
+	"logstash_stats_pipeline_events_out":                              true,
+	"logstash_stats_pipeline_events_queue_push_duration":              true,
+	"logstash_stats_pipeline_flow_filter_current":                     true,
+	"logstash_stats_pipeline_flow_filter_lifetime":                    true,
+	"logstash_stats_pipeline_flow_input_current":                      true,
+	"logstash_stats_pipeline_flow_input_lifetime":                     true,
+	"logstash_stats_pipeline_flow_output_current":                     true,
+	"logstash_stats_pipeline_flow_output_lifetime":                    true,
+	"logstash_stats_pipeline_flow_queue_backpressure_current":         true,
+	"logstash_stats_pipeline_flow_queue_backpressure_lifetime":        true,
+	"logstash_stats_pipeline_flow_worker_concurrency_current":         true,
+	"logstash_stats_pipeline_flow_worker_concurrency_lifetime":        true,
+	"logstash_stats_pipeline_flow_worker_utilization_current":         true,
+	"logstash_stats_pipeline_flow_worker_utilization_lifetime":        true,
+	"logstash_stats_pipeline_plugin_bulk_requests_errors":             true,
+	"logstash_stats_pipeline_plugin_bulk_requests_responses":          true,
+	"logstash_stats_pipeline_plugin_documents_non_retryable_failures": true,
+	"logstash_stats_pipeline_plugin_documents_successes":              true,
+	"logstash_stats_pipeline_plugin_events_duration":                  true,
+	"logstash_stats_pipeline_plugin_events_in":                        true,
+	"logstash_stats_pipeline_plugin_events_out":                       true,
+	"logstash_stats_pipeline_plugin_events_queue_push_duration":       true,
+	"logstash_stats_pipeline_queue_events_count":                      true,
+	"logstash_stats_pipeline_queue_events_queue_size":                 true,
+	"logstash_stats_pipeline_queue_max_size_in_bytes":                 true,
+	"logstash_stats_pipeline_reloads_failures":                        true,
+	"logstash_stats_pipeline_reloads_last_failure_timestamp":          true,
+	"logstash_stats_pipeline_reloads_last_success_timestamp":          true,
+	"logstash_stats_pipeline_reloads_successes":                       true,
+	"logstash_stats_pipeline_up":                                      true,
+	"logstash_stats_process_cpu_load_average_15m":                     true,
+	"logstash_stats_process_cpu_load_average_1m":                      true,
+	"logstash_stats_process_cpu_load_average_5m":                      true,
+	"logstash_stats_process_cpu_percent":                              true,
+	"logstash_stats_process_cpu_total_millis":                         true,
+	"logstash_stats_process_max_file_descriptors":                     true,
+	"logstash_stats_process_mem_total_virtual":                        true,
+	"logstash_stats_process_open_file_descriptors":                    true,
+	"logstash_stats_queue_events_count":                               true,
+	"logstash_stats_reload_failures":                                  true,
+	"logstash_stats_reload_successes":                                 true,
+}
+
+// v2OnlyMetricNames are the metrics exported by default which were added after V1,
+// and are therefore not exported in the "only" mode
+var v2OnlyMetricNames = map[string]bool{
+	"logstash_stats_pipeline_stalled": true,
+}
+
+// v1Rename is the V1 counterpart of a metric renamed since V1
+type v1Rename struct {
+	name string
+	// help is the help of the V1 metric, as the help of the renamed metric refers to its new unit
+	help string
+	// scale converts the value to the unit of V1, e.g. seconds to milliseconds
+	scale     float64
+	valueType prometheus.ValueType
+}
+
+// v1RenamedMetrics maps the metrics of the "v3" naming scheme to their V1 names, units and types
+var v1RenamedMetrics = map[string]v1Rename{
+	"logstash_stats_events_duration_seconds_total":                            {"logstash_stats_events_duration_millis", "Duration of events processing in milliseconds.", 1000, prometheus.GaugeValue},
+	"logstash_stats_events_filtered_total":                                    {"logstash_stats_events_filtered", "Number of events filtered out.", 1, prometheus.GaugeValue},
+	"logstash_stats_events_in_total":                                          {"logstash_stats_events_in", "Number of events received.", 1, prometheus.GaugeValue},
+	"logstash_stats_events_out_total":                                         {"logstash_stats_events_out", "Number of events out.", 1, prometheus.GaugeValue},
+	"logstash_stats_events_queue_push_duration_seconds_total":                 {"logstash_stats_events_queue_push_duration_millis", "Duration of events push to queue in milliseconds.", 1000, prometheus.GaugeValue},
+	"logstash_stats_jvm_gc_collection_time_seconds_total":                     {"logstash_stats_jvm_gc_collection_time_millis_total", "Total time spent running garbage collection for a given JVM memory pool.", 1000, prometheus.CounterValue},
+	"logstash_stats_jvm_uptime_seconds":                                       {"logstash_stats_jvm_uptime_millis", "Uptime of the JVM in milliseconds.", 1000, prometheus.GaugeValue},
+	"logstash_stats_pipeline_events_duration_seconds_total":                   {"logstash_stats_pipeline_events_duration", "Time needed to process event.", 1000, prometheus.GaugeValue},
+	"logstash_stats_pipeline_events_filtered_total":                           {"logstash_stats_pipeline_events_filtered", "", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_events_in_total":                                 {"logstash_stats_pipeline_events_in", "", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_events_out_total":                                {"logstash_stats_pipeline_events_out", "", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_events_queue_push_duration_seconds_total":        {"logstash_stats_pipeline_events_queue_push_duration", "Time needed to push event to queue.", 1000, prometheus.GaugeValue},
+	"logstash_stats_pipeline_plugin_events_duration_seconds_total":            {"logstash_stats_pipeline_plugin_events_duration", "Time spent processing events in this plugin.", 1000, prometheus.CounterValue},
+	"logstash_stats_pipeline_plugin_events_in_total":                          {"logstash_stats_pipeline_plugin_events_in", "", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_plugin_events_out_total":                         {"logstash_stats_pipeline_plugin_events_out", "", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_plugin_events_queue_push_duration_seconds_total": {"logstash_stats_pipeline_plugin_events_queue_push_duration", "Time spent pushing events into the input queue.", 1000, prometheus.GaugeValue},
+	"logstash_stats_pipeline_queue_events":                                    {"logstash_stats_pipeline_queue_events_count", "Number of events in the queue.", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_reloads_failures_total":                          {"logstash_stats_pipeline_reloads_failures", "", 1, prometheus.CounterValue},
+	"logstash_stats_pipeline_reloads_successes_total":                         {"logstash_stats_pipeline_reloads_successes", "", 1, prometheus.CounterValue},
+	"logstash_stats_process_cpu_seconds_total":                                {"logstash_stats_process_cpu_total_millis", "Total CPU time used by the process.", 1000, prometheus.CounterValue},
+}
+
+// v1CompatibilityTranslator translates the collected metrics to their V1 names and label sets
+type v1CompatibilityTranslator struct {
+	mode string
+	// translateRenamed is false if the collectors already export the V1 names, along with the "v3" names
+	translateRenamed bool
+	descs            sync.Map
+}
+
+func newV1CompatibilityTranslator(mode string, metricsConfig config.MetricsConfig) *v1CompatibilityTranslator {
+	return &v1CompatibilityTranslator{mode: mode, translateRenamed: !metricsConfig.IsV2NamingEnabled()}
+}
+
+// translate reads metrics from the input channel and sends them to the output channel
+// until the input channel is closed. In the "only" mode, metrics are sent only under their V1 names,
+// and metrics without a V1 counterpart are dropped. In the "also" mode, all metrics are sent
+// unchanged, and the metrics renamed since V1 are additionally sent under their V1 names.
+func (translator *v1CompatibilityTranslator) translate(in <-chan prometheus.Metric, out chan<- prometheus.Metric) {
+	for metric := range in {
+		if translator.mode == config.V1CompatibilityAlso {
+			out <- metric
+		}
+
+		v1Metric, err := translator.translateMetric(metric)
+		if err != nil {
+			slog.Error("failed to translate metric to v1", "desc", metric.Desc(), "err", err)
+			continue
+		}
+
+		if v1Metric != nil {
+			out <- v1Metric
+		}
+	}
+}
+
+// translateMetric returns the V1 counterpart of the metric, or nil if it should not be sent
+func (translator *v1CompatibilityTranslator) translateMetric(metric prometheus.Metric) (prometheus.Metric, error) {
+	descString := metric.Desc().String()
+	fqName, err := prometheus_helper.ExtractFqName(descString)
+	if err != nil {
+		return nil, err
+	}
+
+	rename, renamed := v1RenamedMetrics[fqName]
+	switch {
+	case renamed && translator.translateRenamed:
+	case v1MetricNames[fqName] && translator.mode == config.V1CompatibilityOnly:
+		// the V1 name is kept, only the label set is translated
+		rename = v1Rename{name: fqName}
+	default:
+		// the metric has no V1 counterpart, or it was already sent under its V1 name
+		return nil, nil
+	}
+
+	var dtoMetric dto.Metric
+	if err := metric.Write(&dtoMetric); err != nil {
+		return nil, err
+	}
+
+	var labelNames, labelValues []string
+	for _, label := range dtoMetric.GetLabel() {
+		if slices.Contains(v1DroppedLabels, label.GetName()) {
+			continue
+		}
+		labelNames = append(labelNames, label.GetName())
+		labelValues = append(labelValues, label.GetValue())
+	}
+
+	help := rename.help
+	if help == "" {
+		if help, err = prometheus_helper.ExtractHelp(descString); err != nil {
+			return nil, err
+		}
+	}
+
+	desc := translator.getDesc(rename.name, help, labelNames)
+
+	if rename.scale == 0 {
+		return newConstMetric(desc, &dtoMetric, labelValues)
+	}
+
+	return newRenamedV1Metric(desc, &dtoMetric, rename, labelValues)
+}
+
+// newRenamedV1Metric creates the V1 counterpart of a renamed metric, with the value in the unit and type of V1
+func newRenamedV1Metric(desc *prometheus.Desc, dtoMetric *dto.Metric, rename v1Rename, labelValues []string) (prometheus.Metric, error) {
+	var value float64
+	switch {
+	case dtoMetric.Counter != nil:
+		value = dtoMetric.GetCounter().GetValue()
+	case dtoMetric.Gauge != nil:
+		value = dtoMetric.GetGauge().GetValue()
+	default:
+		return nil, fmt.Errorf("unsupported metric type of %s", desc)
+	}
+
+	// the V1 values are whole milliseconds, converted back from the seconds without rounding errors
+	value = math.Round(value*rename.scale*1000) / 1000
+
+	metric, err := prometheus.NewConstMetric(desc, rename.valueType, value, labelValues...)
+	if err != nil {
+		return nil, err
+	}
+	if dtoMetric.TimestampMs != nil {
+		metric = prometheus.NewMetricWithTimestamp(time.UnixMilli(dtoMetric.GetTimestampMs()), metric)
+	}
+
+	return metric, nil
+}
+
+// getDesc returns a cached prometheus.Desc for the given name and label names
+func (translator *v1CompatibilityTranslator) getDesc(name string, help string, labelNames []string) *prometheus.Desc {
+	key := name + "{" + strings.Join(labelNames, ",") + "}"
+	if desc, ok := translator.descs.Load(key); ok {
+		return desc.(*prometheus.Desc)
+	}
+
+	desc, _ := translator.descs.LoadOrStore(key, prometheus.NewDesc(name, help, labelNames, nil))
+	return desc.(*prometheus.Desc)
+}
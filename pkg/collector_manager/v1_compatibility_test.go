@@ -0,0 +1,239 @@
+package collector_manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kuskoman/logstash-exporter/internal/collectors/nodestats"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/logstash_client"
+	"github.com/kuskoman/logstash-exporter/internal/fetcher/responses"
+	"github.com/kuskoman/logstash-exporter/internal/prometheus_helper"
+	"github.com/kuskoman/logstash-exporter/pkg/config"
+)
+
+const metricNamesSnapshot = "../../scripts/snapshots/metric_names.txt"
+
+func TestV1MetricNamesMatchSnapshot(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.Open(metricNamesSnapshot)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %v", err)
+	}
+	defer file.Close()
+
+	var snapshotNames []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "logstash_exporter_") {
+			continue
+		}
+		snapshotNames = append(snapshotNames, name)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+
+	for _, name := range snapshotNames {
+		if !v1MetricNames[name] && !v2OnlyMetricNames[name] {
+			t.Errorf("metric %s from the snapshot is neither a v1 metric nor listed as added after v1", name)
+		}
+	}
+
+	for name := range v1MetricNames {
+		if !slices.Contains(snapshotNames, name) {
+			t.Errorf("v1 metric %s is not in the snapshot", name)
+		}
+	}
+
+	for name, rename := range v1RenamedMetrics {
+		if !v1MetricNames[rename.name] {
+			t.Errorf("metric %s is renamed to %s, which is not a v1 metric", name, rename.name)
+		}
+	}
+}
+
+func TestV1CompatibilityTranslator(t *testing.T) {
+	t.Parallel()
+
+	descHelper := prometheus_helper.SimpleDescHelper{Namespace: "logstash", Subsystem: "stats_pipeline"}
+	mappedDesc := descHelper.NewDesc("events_in", "Number of events that have been inputted into this pipeline.", "pipeline")
+	unmappedDesc := descHelper.NewDesc("v1_translator_test_unmapped", "Not mapped.", "pipeline")
+	createdTimestamp := time.Unix(1000, 0)
+
+	translate := func(t *testing.T, mode string, metrics ...prometheus.Metric) []prometheus.Metric {
+		in := make(chan prometheus.Metric, len(metrics))
+		out := make(chan prometheus.Metric, len(metrics)*2)
+		for _, metric := range metrics {
+			in <- metric
+		}
+		close(in)
+
+		newV1CompatibilityTranslator(mode, config.MetricsConfig{}).translate(in, out)
+		close(out)
+
+		var result []prometheus.Metric
+		for metric := range out {
+			result = append(result, metric)
+		}
+		return result
+	}
+
+	t.Run("should drop v2 labels and unmapped metrics in only mode", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := translate(t, config.V1CompatibilityOnly,
+			prometheus.MustNewConstMetricWithCreatedTimestamp(mappedDesc, prometheus.CounterValue, 42, createdTimestamp, "main", "http://localhost:9600", "instance"),
+			prometheus.MustNewConstMetric(unmappedDesc, prometheus.GaugeValue, 1, "main", "http://localhost:9600", "instance"),
+		)
+
+		if len(metrics) != 1 {
+			t.Fatalf("expected 1 metric, got %d", len(metrics))
+		}
+
+		fqName, err := prometheus_helper.ExtractFqName(metrics[0].Desc().String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fqName != "logstash_stats_pipeline_events_in" {
+			t.Errorf("unexpected metric name: %s", fqName)
+		}
+
+		var dtoMetric dto.Metric
+		if err := metrics[0].Write(&dtoMetric); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var labelNames []string
+		for _, label := range dtoMetric.GetLabel() {
+			labelNames = append(labelNames, label.GetName())
+		}
+		if !slices.Equal(labelNames, []string{"hostname", "pipeline"}) {
+			t.Errorf("unexpected labels: %v", labelNames)
+		}
+		if dtoMetric.GetCounter().GetValue() != 42 {
+			t.Errorf("unexpected value: %f", dtoMetric.GetCounter().GetValue())
+		}
+		if !dtoMetric.GetCounter().GetCreatedTimestamp().AsTime().Equal(createdTimestamp) {
+			t.Errorf("expected created timestamp to be preserved")
+		}
+	})
+
+	t.Run("should pass metrics with unchanged names through in also mode", func(t *testing.T) {
+		t.Parallel()
+
+		original := prometheus.MustNewConstMetric(mappedDesc, prometheus.CounterValue, 42, "main", "http://localhost:9600", "instance")
+		unmapped := prometheus.MustNewConstMetric(unmappedDesc, prometheus.GaugeValue, 1, "main", "http://localhost:9600", "instance")
+		metrics := translate(t, config.V1CompatibilityAlso, original, unmapped)
+
+		if len(metrics) != 2 || metrics[0] != original || metrics[1] != unmapped {
+			t.Errorf("expected metrics to be passed through unchanged, got %v", metrics)
+		}
+	})
+	t.Run("should drop the metrics added after v1 in only mode", func(t *testing.T) {
+		t.Parallel()
+
+		stalledDesc := descHelper.NewDesc("stalled", "Whether the pipeline is stalled.", "pipeline")
+		metrics := translate(t, config.V1CompatibilityOnly,
+			prometheus.MustNewConstMetric(stalledDesc, prometheus.GaugeValue, 0, "main", "http://localhost:9600", "instance"))
+
+		if len(metrics) != 0 {
+			t.Errorf("expected the stalled metric to be dropped, got %v", metrics)
+		}
+	})
+}
+
+func TestV1CompatibilityRenamedMetrics(t *testing.T) {
+	t.Parallel()
+
+	fixture, err := os.ReadFile("../../fixtures/node_stats.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	nodeStats := &responses.NodeStatsResponse{}
+	if err := json.Unmarshal(fixture, nodeStats); err != nil {
+		t.Fatalf("failed to unmarshal node stats: %v", err)
+	}
+
+	collect := func(t *testing.T, metricsConfig config.MetricsConfig) map[string]*dto.MetricFamily {
+		t.Helper()
+
+		client := &sequenceMockClient{responses: []*responses.NodeStatsResponse{nodeStats}}
+		manager := &CollectorManager{
+			collectors: map[string]Collector{
+				"nodestats": nodestats.NewNodestatsCollector([]logstash_client.Client{client}, metricsConfig),
+			},
+			scrapeDurations: getScrapeDurationsCollector(),
+			httpTimeout:     httpTimeout,
+			metricsConfig:   metricsConfig,
+			v1Translator:    newV1CompatibilityTranslator(metricsConfig.V1Compatibility, metricsConfig),
+			instancesMap:    map[string]*config.LogstashInstance{},
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(manager)
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+
+		byName := make(map[string]*dto.MetricFamily)
+		for _, family := range families {
+			byName[family.GetName()] = family
+		}
+		return byName
+	}
+
+	t.Run("should also export the v3 metrics under their v1 names and units", func(t *testing.T) {
+		t.Parallel()
+
+		families := collect(t, config.MetricsConfig{Naming: config.MetricsNamingV3, V1Compatibility: config.V1CompatibilityAlso})
+
+		if _, exists := families["logstash_stats_jvm_uptime_seconds"]; !exists {
+			t.Errorf("expected the v3 name to be exported")
+		}
+		uptime, exists := families["logstash_stats_jvm_uptime_millis"]
+		if !exists {
+			t.Fatalf("expected the v1 name to be exported")
+		}
+		if value := uptime.GetMetric()[0].GetGauge().GetValue(); value != 56226 {
+			t.Errorf("expected the uptime in milliseconds, got %f", value)
+		}
+		for _, label := range uptime.GetMetric()[0].GetLabel() {
+			if label.GetName() == "instance_name" {
+				t.Errorf("expected the v1 label set, got %v", uptime.GetMetric()[0].GetLabel())
+			}
+		}
+
+		cpu, exists := families["logstash_stats_process_cpu_total_millis"]
+		if !exists || cpu.GetType() != dto.MetricType_COUNTER {
+			t.Errorf("expected the v1 cpu time counter, got %v", cpu)
+		}
+	})
+
+	t.Run("should export only the v1 names", func(t *testing.T) {
+		t.Parallel()
+
+		families := collect(t, config.MetricsConfig{Naming: config.MetricsNamingV3, V1Compatibility: config.V1CompatibilityOnly})
+
+		for name := range families {
+			if !v1MetricNames[name] && !strings.HasPrefix(name, "logstash_exporter_") {
+				t.Errorf("expected only v1 metrics, got %s", name)
+			}
+		}
+		for _, name := range []string{"logstash_stats_events_in", "logstash_stats_pipeline_events_in", "logstash_stats_pipeline_reloads_successes", "logstash_stats_pipeline_plugin_events_out"} {
+			if _, exists := families[name]; !exists {
+				t.Errorf("expected the renamed counter under its v1 name %s", name)
+			}
+		}
+	})
+}
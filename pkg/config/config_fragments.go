@@ -0,0 +1,301 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configFileExtensions are the extensions of the fragments loaded from a configuration directory
+var configFileExtensions = []string{".yml", ".yaml"}
+
+// ResolveConfigFiles returns the configuration files in the order they are merged.
+// If the location is a directory, these are all of its YAML files, sorted by name.
+// Otherwise, these are the file itself followed by the files matching its include patterns,
+// each pattern sorted by name, in the order of the patterns.
+func ResolveConfigFiles(location string) ([]string, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return resolveConfigDirectory(location)
+	}
+
+	return resolveIncludes(location)
+}
+
+// resolveConfigDirectory returns the YAML files of the directory sorted by name
+func resolveConfigDirectory(directory string) ([]string, error) {
+	var files []string
+	for _, extension := range configFileExtensions {
+		matches, err := filepath.Glob(filepath.Join(directory, "*"+extension))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration files (%v) found in directory %s", configFileExtensions, directory)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// IncludeDirectories returns the directories of the include patterns of the configuration file,
+// which are watched for files matching the patterns later on. A configuration directory has none.
+func IncludeDirectories(location string) ([]string, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	patterns, err := includePatterns(location)
+	if err != nil {
+		return nil, err
+	}
+
+	directories := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		directories = append(directories, filepath.Dir(pattern))
+	}
+
+	return directories, nil
+}
+
+// includePatterns returns the include patterns of the configuration file.
+// Relative patterns are resolved against the directory of the configuration file.
+func includePatterns(location string) ([]string, error) {
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	// invalid files are reported when they are decoded, only the include key is needed here
+	var includes struct {
+		Include []string `yaml:"include"`
+	}
+	_ = yaml.Unmarshal(data, &includes)
+
+	patterns := make([]string, 0, len(includes.Include))
+	for _, pattern := range includes.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(location), pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// resolveIncludes returns the configuration file followed by the files matching its include patterns
+func resolveIncludes(location string) ([]string, error) {
+	patterns, err := includePatterns(location)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{location}
+	seen := map[string]bool{filepath.Clean(location): true}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			if seen[filepath.Clean(match)] {
+				continue
+			}
+			seen[filepath.Clean(match)] = true
+			files = append(files, match)
+		}
+	}
+
+	return files, nil
+}
+
+// FileError is an error in one of the files of a configuration split into multiple files
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// deprecationWarning is a deprecated key found in one of the configuration files
+type deprecationWarning struct {
+	file    string
+	message string
+}
+
+// readConfigFile reads the configuration file, expanding the environment variable references
+func readConfigFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return expandEnv(data)
+}
+
+// loadConfigFiles loads and merges the configuration files resolved from the location.
+// Every file is decoded on its own first, so that the errors are reported with the file and the line.
+// The files are then merged in order: mappings are merged recursively, the logstash instances
+// are concatenated, and any other value is overridden by the files loaded later.
+// The deprecated keys of all files are returned along with the configuration.
+func loadConfigFiles(location string, allowUnknownKeys bool) (*Config, []deprecationWarning, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := ResolveConfigFiles(location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a single file is loaded as is, with the errors reported as before the support of multiple files
+	wrapError := func(file string, err error) error {
+		if len(files) == 1 {
+			return err
+		}
+		return &FileError{File: file, Err: err}
+	}
+
+	var deprecations []deprecationWarning
+	var merged map[interface{}]interface{}
+	instanceFiles := make(map[string]string)
+
+	for i, file := range files {
+		data, err := readConfigFile(file)
+		if err != nil {
+			return nil, nil, wrapError(file, err)
+		}
+
+		fragment, err := decodeConfig(data, allowUnknownKeys)
+		if err != nil {
+			return nil, nil, wrapError(file, err)
+		}
+
+		if len(fragment.Include) > 0 && info.IsDir() {
+			return nil, nil, wrapError(file, errors.New("include is not supported in the files of a configuration directory"))
+		}
+		if len(fragment.Include) > 0 && i > 0 {
+			return nil, nil, wrapError(file, errors.New("include is only supported in the main configuration file"))
+		}
+
+		for _, message := range findDeprecatedKeys(data) {
+			deprecations = append(deprecations, deprecationWarning{file: file, message: message})
+		}
+
+		fragment.handleLegacyServersProperty()
+		for _, instance := range fragment.Logstash.Instances {
+			if otherFile, ok := instanceFiles[instance.ID()]; ok {
+				return nil, nil, wrapError(file, fmt.Errorf("duplicate logstash instance %s, already defined in %s", instance.ID(), otherFile))
+			}
+			instanceFiles[instance.ID()] = file
+		}
+
+		if len(files) == 1 {
+			return fragment, deprecations, nil
+		}
+
+		var fragmentMap map[interface{}]interface{}
+		if err := yaml.Unmarshal(data, &fragmentMap); err != nil {
+			return nil, nil, wrapError(file, err)
+		}
+		merged = mergeYAML(merged, fragmentMap, nil)
+	}
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the unknown keys were already handled for every file
+	config, err := decodeConfig(data, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.handleLegacyServersProperty()
+
+	return config, deprecations, nil
+}
+
+// concatenatedKeys are the paths of the lists that are concatenated instead of being overridden
+var concatenatedKeys = [][]string{
+	{"logstash", "instances"},
+	{"logstash", "servers"},
+	{"logstash", "file_sd_configs"},
+	{"logstash", "dns_sd_configs"},
+	{"logstash", "http_sd_configs"},
+}
+
+// mergeYAML merges the src mapping into dst, see loadConfigFiles for the rules
+func mergeYAML(dst, src map[interface{}]interface{}, path []string) map[interface{}]interface{} {
+	if dst == nil {
+		dst = make(map[interface{}]interface{}, len(src))
+	}
+
+	for key, srcValue := range src {
+		keyPath := append(append([]string(nil), path...), fmt.Sprint(key))
+		dstValue, exists := dst[key]
+
+		dstMap, dstIsMap := dstValue.(map[interface{}]interface{})
+		srcMap, srcIsMap := srcValue.(map[interface{}]interface{})
+		dstList, dstIsList := dstValue.([]interface{})
+		srcList, srcIsList := srcValue.([]interface{})
+
+		switch {
+		case exists && dstIsMap && srcIsMap:
+			dst[key] = mergeYAML(dstMap, srcMap, keyPath)
+		case exists && dstIsList && srcIsList && isConcatenatedKey(keyPath):
+			dst[key] = append(dstList, srcList...)
+		default:
+			dst[key] = srcValue
+		}
+	}
+
+	return dst
+}
+
+func isConcatenatedKey(path []string) bool {
+	for _, concatenatedKey := range concatenatedKeys {
+		if len(concatenatedKey) != len(path) {
+			continue
+		}
+
+		matches := true
+		for i := range path {
+			if path[i] != concatenatedKey[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
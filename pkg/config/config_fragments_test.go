@@ -0,0 +1,242 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFiles writes the files, given by their paths relative to the returned directory
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		location := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(location), 0o700); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(location, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+
+	return dir
+}
+
+func instanceHosts(config *Config) []string {
+	hosts := make([]string, len(config.Logstash.Instances))
+	for i, instance := range config.Logstash.Instances {
+		hosts[i] = instance.Host
+	}
+	return hosts
+}
+
+func TestResolveConfigFiles(t *testing.T) {
+	t.Parallel()
+
+	t.Run("resolves the yaml files of a directory sorted by name", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"20-team-b.yaml": "", "10-team-a.yml": "", "README.md": "",
+		})
+
+		files, err := ResolveConfigFiles(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{filepath.Join(dir, "10-team-a.yml"), filepath.Join(dir, "20-team-b.yaml")}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("expected %v, got %v", expected, files)
+		}
+	})
+
+	t.Run("returns an error for a directory without configuration files", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := ResolveConfigFiles(t.TempDir()); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+
+	t.Run("resolves the included files in the order of the patterns", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"config.yml":        "include:\n  - teams/*.yml\n  - extra.yml\n  - config.yml\n",
+			"teams/b.yml":       "",
+			"teams/a.yml":       "",
+			"extra.yml":         "",
+			"teams/ignored.txt": "",
+		})
+
+		files, err := ResolveConfigFiles(filepath.Join(dir, "config.yml"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			filepath.Join(dir, "config.yml"),
+			filepath.Join(dir, "teams", "a.yml"),
+			filepath.Join(dir, "teams", "b.yml"),
+			filepath.Join(dir, "extra.yml"),
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("expected %v, got %v", expected, files)
+		}
+	})
+}
+
+func TestIncludeDirectories(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns the directories of the include patterns", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"config.yml": "include:\n  - conf.d/*.yml\n  - /etc/exporter/*.yml\n",
+		})
+
+		directories, err := IncludeDirectories(filepath.Join(dir, "config.yml"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{filepath.Join(dir, "conf.d"), "/etc/exporter"}
+		if !reflect.DeepEqual(directories, expected) {
+			t.Errorf("expected %v, got %v", expected, directories)
+		}
+	})
+
+	t.Run("returns no directories for a configuration directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{"config.yml": ""})
+
+		directories, err := IncludeDirectories(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(directories) != 0 {
+			t.Errorf("expected no directories, got %v", directories)
+		}
+	})
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	t.Parallel()
+
+	t.Run("merges the files of a directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"00-base.yml":   "logstash:\n  httpTimeout: 5s\n  instances:\n    - url: http://base:9600\nserver:\n  port: 9000\n  host: 127.0.0.1\n",
+			"10-team-a.yml": "logstash:\n  instances:\n    - url: http://team-a:9600\n      name: team-a\n",
+			"20-team-b.yml": "logstash:\n  servers:\n    - url: http://team-b:9600\nserver:\n  port: 9100\n",
+		})
+
+		config, deprecations, err := loadConfigFiles(dir, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expectedHosts := []string{"http://base:9600", "http://team-a:9600", "http://team-b:9600"}
+		if !reflect.DeepEqual(instanceHosts(config), expectedHosts) {
+			t.Errorf("expected instances %v, got %v", expectedHosts, instanceHosts(config))
+		}
+		if config.Logstash.HttpTimeout != 5*time.Second {
+			t.Errorf("expected the timeout of the base file, got %v", config.Logstash.HttpTimeout)
+		}
+		if config.Server.Port != 9100 || config.Server.Host != "127.0.0.1" {
+			t.Errorf("expected the server config to be merged, got %+v", config.Server)
+		}
+		if len(deprecations) != 1 || deprecations[0].file != filepath.Join(dir, "20-team-b.yml") {
+			t.Errorf("expected the deprecated key of the team b file, got %v", deprecations)
+		}
+	})
+
+	t.Run("merges the included files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"config.yml":   "include:\n  - conf.d/*.yml\nlogstash:\n  instances:\n    - url: http://main:9600\n",
+			"conf.d/a.yml": "logstash:\n  instances:\n    - url: http://a:9600\n",
+		})
+
+		config, _, err := loadConfigFiles(filepath.Join(dir, "config.yml"), false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expectedHosts := []string{"http://main:9600", "http://a:9600"}
+		if !reflect.DeepEqual(instanceHosts(config), expectedHosts) {
+			t.Errorf("expected instances %v, got %v", expectedHosts, instanceHosts(config))
+		}
+	})
+
+	t.Run("rejects duplicate instances", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"a.yml": "logstash:\n  instances:\n    - url: http://a:9600\n      name: shared\n",
+			"b.yml": "logstash:\n  instances:\n    - url: http://b:9600\n      name: shared\n",
+		})
+
+		_, _, err := loadConfigFiles(dir, false)
+		if err == nil || !strings.Contains(err.Error(), "duplicate logstash instance shared") || !strings.Contains(err.Error(), "a.yml") {
+			t.Errorf("expected a duplicate instance error naming both files, got %v", err)
+		}
+	})
+
+	t.Run("rejects include in fragments", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"config.yml":   "include:\n  - fragment.yml\n",
+			"fragment.yml": "include:\n  - other.yml\n",
+		})
+
+		if _, _, err := loadConfigFiles(filepath.Join(dir, "config.yml"), false); err == nil {
+			t.Errorf("expected an error for the nested include")
+		}
+	})
+
+	t.Run("rejects include in the files of a configuration directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"10-main.yml": "include:\n  - ../other.yml\n",
+			"20-team.yml": "logstash:\n  instances:\n    - url: http://team:9600\n",
+		})
+
+		_, _, err := loadConfigFiles(dir, false)
+		if err == nil || !strings.Contains(err.Error(), "10-main.yml") {
+			t.Errorf("expected an include error naming the first file, got %v", err)
+		}
+	})
+
+	t.Run("reports unknown keys with the file", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeConfigFiles(t, map[string]string{
+			"a.yml": "logstash:\n  instances:\n    - url: http://a:9600\n",
+			"b.yml": "logstash:\n  instances:\n    - url: http://b:9600\n      nmae: b\n",
+		})
+
+		_, _, err := loadConfigFiles(dir, false)
+
+		var fileError *FileError
+		if !errors.As(err, &fileError) || fileError.File != filepath.Join(dir, "b.yml") {
+			t.Fatalf("expected an error of b.yml, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "line 4: field nmae not found") {
+			t.Errorf("expected the line of the unknown key, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// deprecatedKey is a key of the configuration file that is still supported, but should be replaced
+type deprecatedKey struct {
+	path        []string
+	replacement string
+}
+
+// deprecatedKeys are reported with their line numbers when the configuration file is loaded
+var deprecatedKeys = []deprecatedKey{
+	{path: []string{"logstash", "servers"}, replacement: "logstash.instances"},
+}
+
+// decodeConfig decodes the configuration, rejecting keys that do not match any configuration field.
+// If allowUnknownKeys is set, the unknown keys are logged and ignored instead.
+func decodeConfig(data []byte, allowUnknownKeys bool) (*Config, error) {
+	var config Config
+	err := yaml.UnmarshalStrict(data, &config)
+
+	var typeError *yaml.TypeError
+	if err != nil && allowUnknownKeys && errors.As(err, &typeError) {
+		for _, message := range typeError.Errors {
+			slog.Warn("ignoring unknown key in the config", "error", message)
+		}
+
+		// the errors other than unknown keys are returned by the non-strict decoding as well
+		config = Config{}
+		err = yaml.Unmarshal(data, &config)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// GetDeprecatedKeys returns a message, with the line number, for every deprecated key of the configuration file.
+func GetDeprecatedKeys(location string) ([]string, error) {
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return findDeprecatedKeys(data), nil
+}
+
+// findDeprecatedKeys returns a message for every deprecated key of the configuration,
+// formatted like the unknown key errors of the YAML decoder
+func findDeprecatedKeys(data []byte) []string {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &document); err != nil || len(document.Content) == 0 {
+		// invalid documents are reported by the decoding of the configuration
+		return nil
+	}
+
+	var deprecations []string
+	for _, deprecated := range deprecatedKeys {
+		if keyNode := findKeyNode(document.Content[0], deprecated.path); keyNode != nil {
+			deprecations = append(deprecations, fmt.Sprintf("line %d: field %s is deprecated, use %s instead",
+				keyNode.Line, strings.Join(deprecated.path, "."), deprecated.replacement))
+		}
+	}
+
+	return deprecations
+}
+
+// findKeyNode returns the node of the key at the path of nested mappings, or nil if it is not present
+func findKeyNode(node *yamlv3.Node, path []string) *yamlv3.Node {
+	if node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	// the content of a mapping node alternates between the keys and their values
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			return key
+		}
+		return findKeyNode(value, path[1:])
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("logstash:\n  instances:\n    - url: http://localhost:9600\n      tls_confg:\n        insecure_skip_verify: true\n  httpTimeout: 3s\n")
+
+	t.Run("rejects unknown keys with their lines", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := decodeConfig(data, false)
+		if err == nil || !strings.Contains(err.Error(), "line 4: field tls_confg not found") {
+			t.Fatalf("expected an unknown key error, got %v", err)
+		}
+	})
+
+	t.Run("ignores unknown keys when allowed", func(t *testing.T) {
+		t.Parallel()
+
+		config, err := decodeConfig(data, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.Logstash.HttpTimeout != 3*time.Second || config.Logstash.Instances[0].Host != "http://localhost:9600" {
+			t.Errorf("expected the known keys to be decoded, got %+v", config.Logstash)
+		}
+	})
+
+	t.Run("returns other errors when unknown keys are allowed", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := decodeConfig([]byte("server:\n  port: not-a-number\n"), true); err == nil {
+			t.Errorf("expected an error for the invalid value")
+		}
+	})
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	location := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(location, []byte("logstash:\n  httptimeout: 3s\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := loadConfig(location)
+	if err == nil || !strings.Contains(err.Error(), allowUnknownKeysEnv) {
+		t.Errorf("expected the error to mention the escape hatch, got %v", err)
+	}
+}
+
+func TestFindDeprecatedKeys(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports deprecated keys with their lines", func(t *testing.T) {
+		t.Parallel()
+
+		data := []byte("server:\n  port: 9198\nlogstash:\n  servers:\n    - url: http://localhost:9600\n")
+
+		deprecations := findDeprecatedKeys(data)
+		if len(deprecations) != 1 || deprecations[0] != "line 4: field logstash.servers is deprecated, use logstash.instances instead" {
+			t.Errorf("unexpected deprecations: %v", deprecations)
+		}
+	})
+
+	t.Run("ignores keys of the same name elsewhere", func(t *testing.T) {
+		t.Parallel()
+
+		data := []byte("servers: []\nlogstash:\n  instances:\n    - url: http://localhost:9600\n")
+
+		if deprecations := findDeprecatedKeys(data); len(deprecations) != 0 {
+			t.Errorf("expected no deprecations, got %v", deprecations)
+		}
+	})
+}
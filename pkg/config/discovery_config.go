@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDNSSDType             = DNSRecordTypeSRV
+	defaultDNSSDRefreshInterval  = 30 * time.Second
+	defaultDiscoveryScheme       = "http"
+	defaultHTTPSDRefreshInterval = 60 * time.Second
+	defaultHTTPSDTimeout         = 10 * time.Second
+)
+
+const (
+	// DNSRecordTypeSRV resolves the hosts and ports of the instances from SRV records
+	DNSRecordTypeSRV = "SRV"
+	// DNSRecordTypeA resolves the IPv4 addresses of the instances, listening on a fixed port
+	DNSRecordTypeA = "A"
+	// DNSRecordTypeAAAA resolves the IPv6 addresses of the instances, listening on a fixed port
+	DNSRecordTypeAAAA = "AAAA"
+)
+
+// reservedLabelNames are the labels set by the exporter itself on the metrics of every instance
+var reservedLabelNames = []string{"hostname", "instance_name"}
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// DiscoveredInstanceConfig configures the HTTP client of every instance found by a service discovery.
+type DiscoveredInstanceConfig struct {
+	// TLS configuration for the HTTP client
+	TLSConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+
+	// Basic authentication for the HTTP client
+	BasicAuth *ClientAuthConfig `yaml:"basic_auth,omitempty"`
+}
+
+// FileSDConfig configures the discovery of instances from target files,
+// in the format of the Prometheus file_sd_configs.
+type FileSDConfig struct {
+	// Files are the paths, or glob patterns, of the JSON or YAML target files.
+	Files []string `yaml:"files"`
+
+	DiscoveredInstanceConfig `yaml:",inline"`
+}
+
+// DNSSDConfig configures the discovery of instances by periodically resolving DNS names,
+// e.g. of a Consul service.
+type DNSSDConfig struct {
+	// Names are the DNS names to resolve.
+	Names []string `yaml:"names"`
+
+	// Type is the type of the queried records.
+	// One of: "SRV" (default), "A", "AAAA"
+	Type string `yaml:"type"`
+
+	// Port of the instances, required for A and AAAA records.
+	Port int `yaml:"port,omitempty"`
+
+	// Scheme of the URLs of the instances.
+	// One of: "http" (default), "https"
+	Scheme string `yaml:"scheme"`
+
+	// RefreshInterval is the time between consecutive resolutions of the names.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	DiscoveredInstanceConfig `yaml:",inline"`
+}
+
+// HTTPSDConfig configures the discovery of instances by periodically polling an endpoint
+// returning target groups in the format of the Prometheus HTTP service discovery.
+type HTTPSDConfig struct {
+	// URL of the endpoint returning the target groups.
+	URL string `yaml:"url"`
+
+	// RefreshInterval is the time between consecutive requests to the endpoint.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Timeout is the timeout of a single request to the endpoint.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// HTTPClient configures the TLS and the authentication of the requests to the endpoint.
+	HTTPClient HTTPClientConfig `yaml:"http_client,omitempty"`
+
+	DiscoveredInstanceConfig `yaml:",inline"`
+
+	// AuthProfiles are the client configurations selectable by the target groups
+	// with the __auth_profile__ label, replacing the default one of the discovery.
+	AuthProfiles map[string]*DiscoveredInstanceConfig `yaml:"auth_profiles,omitempty"`
+}
+
+// HasDiscovery returns true if any service discovery of the instances is configured.
+func (c *LogstashConfig) HasDiscovery() bool {
+	return len(c.FileSDConfigs) > 0 || len(c.DNSSDConfigs) > 0 || len(c.HTTPSDConfigs) > 0
+}
+
+// ValidateLabels validates the names of the labels added to the metrics of an instance.
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if strings.HasPrefix(name, "__") {
+			return fmt.Errorf("label name %q is reserved for internal use", name)
+		}
+		for _, reserved := range reservedLabelNames {
+			if name == reserved {
+				return fmt.Errorf("label %q is reserved", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SanitizeLabelName turns a key, such as the key of a Kubernetes label, into a valid label name,
+// replacing the invalid characters with underscores, e.g. "app.kubernetes.io/instance" into "app_kubernetes_io_instance".
+func SanitizeLabelName(key string) string {
+	name := invalidLabelNameChars.ReplaceAllString(key, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// ValidateDiscoveredInstance validates the HTTP client configuration of the discovered instances.
+func (c *DiscoveredInstanceConfig) ValidateDiscoveredInstance() error {
+	if c.TLSConfig != nil {
+		if err := c.TLSConfig.ValidateTLSClientConfig(); err != nil {
+			return fmt.Errorf("invalid tls_config: %w", err)
+		}
+	}
+
+	if c.BasicAuth != nil {
+		if err := c.BasicAuth.ValidateClientAuth(); err != nil {
+			return fmt.Errorf("invalid basic_auth: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateFileSD validates the file service discovery configuration.
+func (c *FileSDConfig) ValidateFileSD() error {
+	if len(c.Files) == 0 {
+		return fmt.Errorf("at least one file must be specified")
+	}
+
+	for _, pattern := range c.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+	}
+
+	return c.ValidateDiscoveredInstance()
+}
+
+// ValidateDNSSD validates the DNS service discovery configuration.
+func (c *DNSSDConfig) ValidateDNSSD() error {
+	if len(c.Names) == 0 {
+		return fmt.Errorf("at least one name must be specified")
+	}
+
+	switch c.Type {
+	case "", DNSRecordTypeSRV:
+		if c.Port != 0 {
+			return fmt.Errorf("port is resolved from the SRV records and must not be specified")
+		}
+	case DNSRecordTypeA, DNSRecordTypeAAAA:
+		if c.Port < 1 || c.Port > 65535 {
+			return fmt.Errorf("port must be between 1 and 65535 for %s records, got %d", c.Type, c.Port)
+		}
+	default:
+		return fmt.Errorf("unknown record type %q, expected one of: %s, %s, %s", c.Type, DNSRecordTypeSRV, DNSRecordTypeA, DNSRecordTypeAAAA)
+	}
+
+	switch c.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unknown scheme %q, expected one of: http, https", c.Scheme)
+	}
+
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval must not be negative, got %s", c.RefreshInterval)
+	}
+
+	return c.ValidateDiscoveredInstance()
+}
+
+// ValidateHTTPSD validates the HTTP service discovery configuration.
+func (c *HTTPSDConfig) ValidateHTTPSD() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+
+	parsedURL, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https, got %q", parsedURL.Scheme)
+	}
+
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval must not be negative, got %s", c.RefreshInterval)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", c.Timeout)
+	}
+
+	if c.HTTPClient.TLSConfig != nil {
+		if err := c.HTTPClient.TLSConfig.ValidateTLSClientConfig(); err != nil {
+			return fmt.Errorf("invalid http_client.tls_config: %w", err)
+		}
+	}
+
+	if err := c.HTTPClient.ValidateHTTPClient(); err != nil {
+		return fmt.Errorf("invalid http_client: %w", err)
+	}
+
+	for name, profile := range c.AuthProfiles {
+		if profile == nil {
+			return fmt.Errorf("auth profile %q is empty", name)
+		}
+		if err := profile.ValidateDiscoveredInstance(); err != nil {
+			return fmt.Errorf("invalid auth profile %q: %w", name, err)
+		}
+	}
+
+	return c.ValidateDiscoveredInstance()
+}
+
+// mergeDiscoveryWithDefault sets the default values of the service discovery configuration
+func mergeDiscoveryWithDefault(logstash *LogstashConfig) {
+	for _, dnsSDConfig := range logstash.DNSSDConfigs {
+		if dnsSDConfig.Type == "" {
+			dnsSDConfig.Type = defaultDNSSDType
+		}
+		if dnsSDConfig.Scheme == "" {
+			dnsSDConfig.Scheme = defaultDiscoveryScheme
+		}
+		if dnsSDConfig.RefreshInterval == 0 {
+			dnsSDConfig.RefreshInterval = defaultDNSSDRefreshInterval
+		}
+	}
+
+	for _, httpSDConfig := range logstash.HTTPSDConfigs {
+		if httpSDConfig.RefreshInterval == 0 {
+			httpSDConfig.RefreshInterval = defaultHTTPSDRefreshInterval
+		}
+		if httpSDConfig.Timeout == 0 {
+			httpSDConfig.Timeout = defaultHTTPSDTimeout
+		}
+	}
+}
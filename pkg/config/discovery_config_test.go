@@ -0,0 +1,130 @@
+package config
+
+import "testing"
+
+func TestValidateLabels(t *testing.T) {
+	t.Parallel()
+
+	if err := ValidateLabels(map[string]string{"team": "a", "env_1": "prod"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"1team", "team-a", "__meta", "hostname", "instance_name"} {
+		if err := ValidateLabels(map[string]string{name: "x"}); err == nil {
+			t.Errorf("expected an error for label %q", name)
+		}
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	t.Parallel()
+
+	for key, expected := range map[string]string{
+		"team":                       "team",
+		"app.kubernetes.io/instance": "app_kubernetes_io_instance",
+		"2fa-enabled":                "_2fa_enabled",
+	} {
+		if name := SanitizeLabelName(key); name != expected {
+			t.Errorf("expected %q for %q, got %q", expected, key, name)
+		}
+	}
+}
+
+func TestValidateFileSD(t *testing.T) {
+	t.Parallel()
+
+	valid := FileSDConfig{Files: []string{"/etc/targets/*.json"}}
+	if err := valid.ValidateFileSD(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for name, invalid := range map[string]FileSDConfig{
+		"no files":        {},
+		"invalid pattern": {Files: []string{"/etc/targets/[.json"}},
+		"invalid auth":    {Files: []string{"targets.json"}, DiscoveredInstanceConfig: DiscoveredInstanceConfig{BasicAuth: &ClientAuthConfig{}}},
+	} {
+		if err := invalid.ValidateFileSD(); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestValidateDNSSD(t *testing.T) {
+	t.Parallel()
+
+	for name, valid := range map[string]DNSSDConfig{
+		"srv": {Names: []string{"logstash.service.consul"}},
+		"a":   {Names: []string{"logstash.example.com"}, Type: DNSRecordTypeA, Port: 9600, Scheme: "https"},
+	} {
+		if err := valid.ValidateDNSSD(); err != nil {
+			t.Errorf("unexpected error for %s: %v", name, err)
+		}
+	}
+
+	for name, invalid := range map[string]DNSSDConfig{
+		"no names":        {},
+		"srv with port":   {Names: []string{"logstash"}, Port: 9600},
+		"a without port":  {Names: []string{"logstash"}, Type: DNSRecordTypeA},
+		"unknown type":    {Names: []string{"logstash"}, Type: "MX"},
+		"unknown scheme":  {Names: []string{"logstash"}, Scheme: "ftp"},
+		"negative period": {Names: []string{"logstash"}, RefreshInterval: -1},
+	} {
+		if err := invalid.ValidateDNSSD(); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestValidateHTTPSD(t *testing.T) {
+	t.Parallel()
+
+	for name, valid := range map[string]HTTPSDConfig{
+		"url only": {URL: "http://cmdb.example.com/targets"},
+		"auth profiles": {
+			URL:          "https://cmdb.example.com/targets",
+			HTTPClient:   HTTPClientConfig{BearerToken: "token"},
+			AuthProfiles: map[string]*DiscoveredInstanceConfig{"secured": {BasicAuth: &ClientAuthConfig{Username: "user", Password: "secret"}}},
+		},
+	} {
+		if err := valid.ValidateHTTPSD(); err != nil {
+			t.Errorf("unexpected error for %s: %v", name, err)
+		}
+	}
+
+	for name, invalid := range map[string]HTTPSDConfig{
+		"no url":           {},
+		"unknown scheme":   {URL: "ftp://cmdb.example.com"},
+		"negative period":  {URL: "http://cmdb", RefreshInterval: -1},
+		"negative timeout": {URL: "http://cmdb", Timeout: -1},
+		"conflicting auth": {URL: "http://cmdb", HTTPClient: HTTPClientConfig{BearerToken: "a", BearerTokenFile: "b"}},
+		"empty profile":    {URL: "http://cmdb", AuthProfiles: map[string]*DiscoveredInstanceConfig{"empty": nil}},
+		"invalid profile":  {URL: "http://cmdb", AuthProfiles: map[string]*DiscoveredInstanceConfig{"bad": {BasicAuth: &ClientAuthConfig{}}}},
+	} {
+		if err := invalid.ValidateHTTPSD(); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestMergeDiscoveryWithDefault(t *testing.T) {
+	t.Parallel()
+
+	config := mergeWithDefault(&Config{Logstash: LogstashConfig{
+		DNSSDConfigs:  []*DNSSDConfig{{Names: []string{"logstash.service.consul"}}},
+		HTTPSDConfigs: []*HTTPSDConfig{{URL: "http://cmdb.example.com/targets"}},
+	}})
+
+	if len(config.Logstash.Instances) != 0 {
+		t.Errorf("expected no default instance with service discovery, got %v", config.Logstash.Instances)
+	}
+
+	dnsSDConfig := config.Logstash.DNSSDConfigs[0]
+	if dnsSDConfig.Type != DNSRecordTypeSRV || dnsSDConfig.Scheme != "http" || dnsSDConfig.RefreshInterval != defaultDNSSDRefreshInterval {
+		t.Errorf("expected the defaults to be set, got %+v", dnsSDConfig)
+	}
+
+	httpSDConfig := config.Logstash.HTTPSDConfigs[0]
+	if httpSDConfig.RefreshInterval != defaultHTTPSDRefreshInterval || httpSDConfig.Timeout != defaultHTTPSDTimeout {
+		t.Errorf("expected the defaults to be set, got %+v", httpSDConfig)
+	}
+}
@@ -1,7 +1,14 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 func getEnvWithDefault(key string, defaultValue string) string {
@@ -11,3 +18,82 @@ func getEnvWithDefault(key string, defaultValue string) string {
 	}
 	return value
 }
+
+// envReferencePattern matches the ${VAR} and ${VAR:-default} references, and the escaped $${VAR}
+var envReferencePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the environment variable references in the values of the configuration file.
+// ${VAR} is replaced with the value of VAR, which must be set, and ${VAR:-default}
+// with the value of VAR, or the default if VAR is unset or empty.
+// $${VAR} is kept as a literal ${VAR}. Comments are not expanded.
+// The references are expanded in the decoded scalars, so that the values cannot change the structure
+// of the document, e.g. with a # or a quote, and the document is encoded again if any value changed.
+func expandEnv(data []byte) ([]byte, error) {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &document); err != nil {
+		// invalid documents are reported by the decoding of the configuration
+		return data, nil
+	}
+
+	var errs []error
+	if !expandNode(&document, &errs) {
+		return data, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// expandNode expands the references in the scalars of the node and its children,
+// returning whether any scalar contained a reference
+func expandNode(node *yamlv3.Node, errs *[]error) bool {
+	expanded := false
+	for _, child := range node.Content {
+		if expandNode(child, errs) {
+			expanded = true
+		}
+	}
+
+	if node.Kind != yamlv3.ScalarNode || !envReferencePattern.MatchString(node.Value) {
+		return expanded
+	}
+
+	node.Value = envReferencePattern.ReplaceAllStringFunc(node.Value, func(reference string) string {
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+
+		match := envReferencePattern.FindStringSubmatch(reference)
+		name, hasDefault, defaultValue := match[1], match[2] != "", match[3]
+
+		value, isSet := os.LookupEnv(name)
+		if hasDefault && value == "" {
+			return defaultValue
+		}
+		if !isSet {
+			*errs = append(*errs, fmt.Errorf("line %d: environment variable %s is not set", node.Line, name))
+		}
+		return value
+	})
+
+	// the tag of a plain scalar is resolved again from the expanded value, so that e.g. a port
+	// is still decoded as a number, while values that are not valid plain scalars are quoted
+	if node.Style == 0 {
+		node.Tag = ""
+	}
+
+	return true
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +28,113 @@ func TestGetEnvWithDefault(t *testing.T) {
 		}
 	})
 }
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("TEST_EXPAND_URL", "http://logstash:9600")
+	t.Setenv("TEST_EXPAND_PASSWORD", "secret")
+	t.Setenv("TEST_EXPAND_EMPTY", "")
+
+	t.Run("should expand references", func(t *testing.T) {
+		data := []byte(`logstash:
+  instances:
+    - url: "${TEST_EXPAND_URL}"
+      basic_auth:
+        username: "${TEST_EXPAND_UNSET:-logstash}"
+        password: "${TEST_EXPAND_PASSWORD}"
+      tls_config:
+        ca_file: "${TEST_EXPAND_EMPTY:-/etc/ssl/ca.pem}"
+        server_name: "$${TEST_EXPAND_URL}"
+# ${TEST_EXPAND_COMMENTED_OUT}
+`)
+
+		expanded, err := expandEnv(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, expected := range []string{
+			`url: "http://logstash:9600"`,
+			`username: "logstash"`,
+			`password: "secret"`,
+			`ca_file: "/etc/ssl/ca.pem"`,
+			`server_name: "${TEST_EXPAND_URL}"`,
+			`# ${TEST_EXPAND_COMMENTED_OUT}`,
+		} {
+			if !strings.Contains(string(expanded), expected) {
+				t.Errorf("expected %q in the expanded config:\n%s", expected, expanded)
+			}
+		}
+	})
+
+	t.Run("should return an error for unset variables", func(t *testing.T) {
+		data := []byte("logstash:\n  instances:\n    - url: ${TEST_EXPAND_UNSET}\n      name: ${TEST_EXPAND_EMPTY}\n")
+
+		_, err := expandEnv(data)
+		if err == nil || !strings.Contains(err.Error(), "line 3: environment variable TEST_EXPAND_UNSET is not set") {
+			t.Fatalf("expected an error for the unset variable, got %v", err)
+		}
+		if strings.Contains(err.Error(), "TEST_EXPAND_EMPTY") {
+			t.Errorf("expected set but empty variables to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("should keep the structure of the document for values with yaml syntax", func(t *testing.T) {
+		values := []string{"abc #1", "*alias", "&anchor", "!tag", "%directive", "key: value", `with "quotes"`, "it's", "- item"}
+
+		for _, value := range values {
+			t.Setenv("TEST_EXPAND_SPECIAL", value)
+
+			location := filepath.Join(t.TempDir(), "config.yml")
+			data := "logstash:\n  instances:\n    - url: http://logstash:9600\n" +
+				"      name: ${TEST_EXPAND_SPECIAL}\n" +
+				"      basic_auth:\n        username: 'user ${TEST_EXPAND_SPECIAL}'\n        password: \"${TEST_EXPAND_SPECIAL}\"\n"
+			if err := os.WriteFile(location, []byte(data), 0o600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			config, err := loadConfig(location)
+			if err != nil {
+				t.Errorf("unexpected error for %q: %v", value, err)
+				continue
+			}
+
+			instance := config.Logstash.Instances[0]
+			if instance.Name != value || instance.BasicAuth.Username != "user "+value || instance.BasicAuth.Password != value {
+				t.Errorf("expected %q to be expanded as is, got name %q, username %q and password %q",
+					value, instance.Name, instance.BasicAuth.Username, instance.BasicAuth.Password)
+			}
+		}
+	})
+
+	t.Run("should decode the expanded plain values with the type of the field", func(t *testing.T) {
+		t.Setenv("TEST_EXPAND_PORT", "9198")
+
+		location := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(location, []byte("server:\n  port: ${TEST_EXPAND_PORT}\n"), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		config, err := loadConfig(location)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.Server.Port != 9198 {
+			t.Errorf("expected the port to be expanded, got %d", config.Server.Port)
+		}
+	})
+
+	t.Run("should expand the config file before decoding", func(t *testing.T) {
+		location := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(location, []byte("logstash:\n  instances:\n    - url: ${TEST_EXPAND_URL}\n"), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		config, err := loadConfig(location)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.Logstash.Instances[0].Host != "http://logstash:9600" {
+			t.Errorf("expected the url to be expanded, got %s", config.Logstash.Instances[0].Host)
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
@@ -21,8 +24,14 @@ const (
 	defaultHttpInsecure   = false
 )
 
+const allowUnknownKeysEnv = "EXPORTER_ALLOW_UNKNOWN_KEYS"
+
 var (
 	ExporterConfigLocation = getEnvWithDefault("EXPORTER_CONFIG_LOCATION", defaultConfigLocation)
+
+	// AllowUnknownKeys makes the exporter ignore, with a warning, the keys of the configuration file
+	// that do not match any configuration field, e.g. of configuration files written for newer versions.
+	AllowUnknownKeys = getEnvWithDefault(allowUnknownKeysEnv, "false") == "true"
 )
 
 // LogstashInstance represents individual Logstash server configuration
@@ -35,6 +44,30 @@ type LogstashInstance struct {
 
 	// Basic authentication for the HTTP client
 	BasicAuth *ClientAuthConfig `yaml:"basic_auth,omitempty"`
+
+	// Labels are added to all metrics of the instance
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// MetricFilter selects the exported metrics of the instance, all metrics if nil
+	MetricFilter *MetricFilterConfig `yaml:"metric_filter,omitempty"`
+}
+
+// MetricFilterConfig selects the exported metrics of an instance by their names.
+// The regular expressions must match the whole metric name.
+type MetricFilterConfig struct {
+	// Include keeps only the metrics matching one of the expressions, all metrics if empty
+	Include []string `yaml:"include,omitempty"`
+
+	// Exclude drops the metrics matching one of the expressions, after Include
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// ID returns the identifier of the instance, which is its name, or its URL if it has no name
+func (instance *LogstashInstance) ID() string {
+	if instance.Name != "" {
+		return instance.Name
+	}
+	return instance.Host
 }
 
 // TLSClientConfig configures TLS for the HTTP client connecting to Logstash.
@@ -42,6 +75,9 @@ type TLSClientConfig struct {
 	// CAFile is the path to the certificate authority file for custom certificates.
 	CAFile string `yaml:"ca_file,omitempty"`
 
+	// CA is the PEM encoded certificate authority, used instead of CAFile.
+	CA string `yaml:"ca,omitempty"`
+
 	// ServerName is used to verify the hostname on the certificate.
 	ServerName string `yaml:"server_name,omitempty"`
 
@@ -56,6 +92,15 @@ type LogstashConfig struct {
 
 	Instances   []*LogstashInstance `yaml:"instances"`
 	HttpTimeout time.Duration       `yaml:"httpTimeout"`
+
+	// FileSDConfigs discover additional instances from target files, updated without a reload
+	FileSDConfigs []*FileSDConfig `yaml:"file_sd_configs,omitempty"`
+
+	// DNSSDConfigs discover additional instances from DNS records, updated without a reload
+	DNSSDConfigs []*DNSSDConfig `yaml:"dns_sd_configs,omitempty"`
+
+	// HTTPSDConfigs discover additional instances from HTTP endpoints, updated without a reload
+	HTTPSDConfigs []*HTTPSDConfig `yaml:"http_sd_configs,omitempty"`
 }
 
 // ServerConfig represents the server configuration
@@ -156,7 +201,13 @@ type Config struct {
 	Logstash   LogstashConfig   `yaml:"logstash"`
 	Server     ServerConfig     `yaml:"server"`
 	Logging    LoggingConfig    `yaml:"logging"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Push       PushConfig       `yaml:"push"`
 	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+
+	// Include is a list of glob patterns of configuration files merged into this one,
+	// relative patterns are resolved against the directory of this file
+	Include []string `yaml:"include,omitempty"`
 }
 
 func (config *Config) Equals(other *Config) bool {
@@ -164,30 +215,55 @@ func (config *Config) Equals(other *Config) bool {
 }
 
 // handleLegacyServersProperty handles the deprecated 'servers' property.
-// This method will log a warning and append the legacy servers to the new 'instances' property.
+// This method will append the legacy servers to the new 'instances' property,
+// the deprecation itself is reported when the configuration file is loaded.
 func (config *Config) handleLegacyServersProperty() {
 	if len(config.Logstash.LegacyServers) > 0 {
-		slog.Warn("The 'servers' property is deprecated, please use 'instances' instead", "servers", fmt.Sprintf("%v", config.Logstash.LegacyServers))
 		config.Logstash.Instances = append(config.Logstash.Instances, config.Logstash.LegacyServers...)
 	}
 }
 
-// loadConfig loads the configuration from the YAML file.
+// loadConfig loads the configuration from the YAML file, or the directory of YAML files,
+// expanding the environment variable references and merging the included files.
+// Unknown keys are rejected, unless AllowUnknownKeys is set, and deprecated keys are logged.
 func loadConfig(location string) (*Config, error) {
-	data, err := os.ReadFile(location)
+	config, deprecations, err := loadConfigFiles(location, AllowUnknownKeys)
 	if err != nil {
+		if isUnknownKeyError(err) {
+			return nil, fmt.Errorf("%w\nset %s=true to ignore unknown keys", err, allowUnknownKeysEnv)
+		}
 		return nil, err
 	}
 
-	var config Config
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		return nil, err
+	for _, deprecation := range deprecations {
+		slog.Warn("deprecated key in the config", "location", deprecation.file, "warning", deprecation.message)
+	}
+
+	return config, nil
+}
+
+// isUnknownKeyError returns true if the error reports keys that do not match any configuration field,
+// as opposed to values of the wrong type
+func isUnknownKeyError(err error) bool {
+	var typeError *yaml.TypeError
+	if !errors.As(err, &typeError) {
+		return false
+	}
+
+	for _, message := range typeError.Errors {
+		if strings.Contains(message, " not found in type ") {
+			return true
+		}
 	}
 
-	config.handleLegacyServersProperty()
+	return false
+}
 
-	return &config, nil
+// loadConfigStrict loads the configuration like loadConfig, but returns an error
+// for keys that do not match any configuration field, regardless of AllowUnknownKeys.
+func loadConfigStrict(location string) (*Config, error) {
+	config, _, err := loadConfigFiles(location, false)
+	return config, err
 }
 
 // mergeWithDefault merges the loaded configuration with the default configuration values.
@@ -211,7 +287,8 @@ func mergeWithDefault(config *Config) *Config {
 		config.Logging.Format = defaultLogFormat
 	}
 
-	if len(config.Logstash.Instances) == 0 {
+	// the instances may be only discovered, in which case there is no default instance
+	if len(config.Logstash.Instances) == 0 && !config.Logstash.HasDiscovery() {
 		slog.Debug("using default logstash server", "url", defaultLogstashURL)
 		config.Logstash.Instances = append(config.Logstash.Instances, &LogstashInstance{
 			Host: defaultLogstashURL,
@@ -223,6 +300,23 @@ func mergeWithDefault(config *Config) *Config {
 		config.Logstash.HttpTimeout = defaultHttpTimeout
 	}
 
+	if config.Metrics.Naming == "" {
+		slog.Debug("using default metrics naming", "naming", defaultMetricsNaming)
+		config.Metrics.Naming = defaultMetricsNaming
+	}
+
+	if config.Metrics.StallDetectionWindow == nil {
+		slog.Debug("using default stall detection window", "window", defaultStallDetectionWindow)
+		window := defaultStallDetectionWindow
+		config.Metrics.StallDetectionWindow = &window
+	}
+
+	mergeDiscoveryWithDefault(&config.Logstash)
+
+	if config.Push.IsEnabled() {
+		mergePushWithDefault(&config.Push)
+	}
+
 	// Set default Kubernetes configuration
 	defaultK8sConfig := DefaultKubernetesConfig()
 	if config.Kubernetes.ResyncPeriod == 0 {
@@ -240,6 +334,20 @@ func mergeWithDefault(config *Config) *Config {
 	if config.Kubernetes.LogstashPasswordAnnotation == "" {
 		config.Kubernetes.LogstashPasswordAnnotation = defaultK8sConfig.LogstashPasswordAnnotation
 	}
+	if config.Kubernetes.LogstashPasswordSecretAnnotation == "" {
+		config.Kubernetes.LogstashPasswordSecretAnnotation = defaultK8sConfig.LogstashPasswordSecretAnnotation
+	}
+	mergeResourceWithDefault(&config.Kubernetes.Resources.Pods)
+	mergeResourceWithDefault(&config.Kubernetes.Resources.Services)
+	mergeResourceWithDefault(&config.Kubernetes.Resources.EndpointSlices)
+	mergeResourceWithDefault(&config.Kubernetes.Resources.StatefulSets)
+	mergeResourceWithDefault(&config.Kubernetes.Resources.Deployments)
+	mergeResourceWithDefault(&config.Kubernetes.Resources.Logstashes)
+	mergeResourceWithDefault(&config.Kubernetes.Resources.LogstashTargets)
+	mergeLeaderElectionWithDefault(&config.Kubernetes.LeaderElection)
+	if config.Kubernetes.Sharding.Shards == 0 {
+		config.Kubernetes.Sharding.Shards = defaultK8sConfig.Sharding.Shards
+	}
 
 	return config
 }
@@ -255,6 +363,17 @@ func GetConfig(location string) (*Config, error) {
 	return mergedConfig, nil
 }
 
+// GetConfigStrict is like GetConfig, but rejects unknown keys in the configuration file.
+func GetConfigStrict(location string) (*Config, error) {
+	config, err := loadConfigStrict(location)
+	if err != nil {
+		return nil, err
+	}
+
+	mergedConfig := mergeWithDefault(config)
+	return mergedConfig, nil
+}
+
 // GetUsers returns a map of username to password for basic authentication.
 func (c *BasicAuthConfig) GetUsers() (map[string]string, error) {
 	// If Users map is provided, use it
@@ -320,11 +439,8 @@ func (c *BasicAuthConfig) ValidateBasicAuth() error {
 func (c *ServerConfig) ValidateServerTLS() error {
 	// Check TLS configuration
 	if c.TLSConfig != nil {
-		if c.TLSConfig.CertFile == "" {
-			return fmt.Errorf("cert_file must be specified when TLS is enabled")
-		}
-		if c.TLSConfig.KeyFile == "" {
-			return fmt.Errorf("key_file must be specified when TLS is enabled")
+		if err := c.TLSConfig.ValidateTLSServerConfig(); err != nil {
+			return err
 		}
 	}
 
@@ -336,14 +452,23 @@ func (c *ServerConfig) ValidateServerTLS() error {
 	return nil
 }
 
+// ValidateTLSServerConfig validates that the certificate and the key of the server are specified.
+func (c *TLSServerConfig) ValidateTLSServerConfig() error {
+	if c.CertFile == "" {
+		return fmt.Errorf("cert_file must be specified when TLS is enabled")
+	}
+	if c.KeyFile == "" {
+		return fmt.Errorf("key_file must be specified when TLS is enabled")
+	}
+
+	return nil
+}
+
 // ValidateClientTLS validates the client TLS configuration for a Logstash instance.
 func (instance *LogstashInstance) ValidateClientTLS() error {
 	if instance.TLSConfig != nil {
-		// If CAFile is specified, make sure it exists
-		if instance.TLSConfig.CAFile != "" {
-			if _, err := os.Stat(instance.TLSConfig.CAFile); os.IsNotExist(err) {
-				return fmt.Errorf("CA file %s does not exist", instance.TLSConfig.CAFile)
-			}
+		if err := instance.TLSConfig.ValidateTLSClientConfig(); err != nil {
+			return err
 		}
 	}
 
@@ -355,21 +480,129 @@ func (instance *LogstashInstance) ValidateClientTLS() error {
 	return nil
 }
 
+// ValidateTLSClientConfig validates that the CA file, if specified, exists.
+func (c *TLSClientConfig) ValidateTLSClientConfig() error {
+	if c.CAFile != "" && c.CA != "" {
+		return fmt.Errorf("at most one of ca_file and ca must be specified")
+	}
+
+	if c.CAFile != "" {
+		if _, err := os.Stat(c.CAFile); os.IsNotExist(err) {
+			return fmt.Errorf("CA file %s does not exist", c.CAFile)
+		}
+	}
+
+	return nil
+}
+
+// ValidateMetricFilter validates the regular expressions of the metric filter.
+func (c *MetricFilterConfig) ValidateMetricFilter() error {
+	for _, expression := range append(append([]string{}, c.Include...), c.Exclude...) {
+		if _, err := regexp.Compile(expression); err != nil {
+			return fmt.Errorf("invalid expression %q: %w", expression, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateURL validates that the URL of a Logstash instance is an absolute HTTP(S) URL.
+func (instance *LogstashInstance) ValidateURL() error {
+	if instance.Host == "" {
+		return fmt.Errorf("url must be specified")
+	}
+
+	parsedURL, err := url.Parse(instance.Host)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", instance.Host, err)
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("url %q must use the http or https scheme", instance.Host)
+	}
+
+	if parsedURL.Host == "" {
+		return fmt.Errorf("url %q has no host", instance.Host)
+	}
+
+	return nil
+}
+
+// FieldError is a validation error of a single configuration field.
+type FieldError struct {
+	// Field is the path of the invalid field, e.g. "logstash.instances[0].basic_auth".
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
 // Validate validates the entire configuration.
 func (config *Config) Validate() error {
-	// Validate server TLS configuration
-	if err := config.Server.ValidateServerTLS(); err != nil {
-		return fmt.Errorf("invalid server TLS configuration: %w", err)
+	return errors.Join(config.ValidateAll()...)
+}
+
+// ValidateAll validates the entire configuration and returns all found errors,
+// each of them a FieldError with the path of the invalid field.
+// The configuration is expected to be merged with the defaults, as returned by GetConfig.
+func (config *Config) ValidateAll() []error {
+	var errs []error
+	addError := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, &FieldError{Field: field, Err: err})
+		}
+	}
+
+	if config.Server.Port < 1 || config.Server.Port > 65535 {
+		addError("server.port", fmt.Errorf("must be between 1 and 65535, got %d", config.Server.Port))
+	}
+	if config.Server.TLSConfig != nil {
+		addError("server.tls_server_config", config.Server.TLSConfig.ValidateTLSServerConfig())
+	}
+	if config.Server.BasicAuth != nil {
+		addError("server.basic_auth", config.Server.BasicAuth.ValidateBasicAuth())
+	}
+
+	if _, err := getSlogLogger(config.Logging.Level, config.Logging.Format); err != nil {
+		addError("logging", err)
 	}
 
-	// Validate each Logstash instance
 	for i, instance := range config.Logstash.Instances {
-		if err := instance.ValidateClientTLS(); err != nil {
-			return fmt.Errorf("invalid Logstash instance %d TLS configuration: %w", i, err)
+		field := fmt.Sprintf("logstash.instances[%d]", i)
+		addError(field+".url", instance.ValidateURL())
+		if instance.TLSConfig != nil {
+			addError(field+".tls_config", instance.TLSConfig.ValidateTLSClientConfig())
+		}
+		if instance.BasicAuth != nil {
+			addError(field+".basic_auth", instance.BasicAuth.ValidateClientAuth())
+		}
+		addError(field+".labels", ValidateLabels(instance.Labels))
+		if instance.MetricFilter != nil {
+			addError(field+".metric_filter", instance.MetricFilter.ValidateMetricFilter())
 		}
 	}
 
-	return nil
+	for i, fileSDConfig := range config.Logstash.FileSDConfigs {
+		addError(fmt.Sprintf("logstash.file_sd_configs[%d]", i), fileSDConfig.ValidateFileSD())
+	}
+	for i, dnsSDConfig := range config.Logstash.DNSSDConfigs {
+		addError(fmt.Sprintf("logstash.dns_sd_configs[%d]", i), dnsSDConfig.ValidateDNSSD())
+	}
+	for i, httpSDConfig := range config.Logstash.HTTPSDConfigs {
+		addError(fmt.Sprintf("logstash.http_sd_configs[%d]", i), httpSDConfig.ValidateHTTPSD())
+	}
+
+	addError("metrics", config.Metrics.ValidateMetrics())
+	addError("push", config.Push.ValidatePush())
+	addError("kubernetes", config.Kubernetes.ValidateKubernetes())
+
+	return errs
 }
 
 // GetPassword returns the password for basic authentication.
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -52,6 +56,39 @@ func TestLoadConfig(t *testing.T) {
 			t.Fatal("expected config to be nil")
 		}
 	})
+
+	t.Run("suggests ignoring unknown keys", func(t *testing.T) {
+		t.Parallel()
+
+		location := filepath.Join(t.TempDir(), "config.yml")
+		content := "logstash:\n  instances:\n    - url: http://localhost:9600\n  httpTimout: 3s\n"
+		if err := os.WriteFile(location, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		_, err := loadConfig(location)
+		if err == nil || !strings.Contains(err.Error(), allowUnknownKeysEnv) {
+			t.Fatalf("expected the error to mention %s, got %v", allowUnknownKeysEnv, err)
+		}
+	})
+
+	t.Run("does not suggest ignoring unknown keys for type errors", func(t *testing.T) {
+		t.Parallel()
+
+		location := filepath.Join(t.TempDir(), "config.yml")
+		content := "server:\n  port: not-a-port\n"
+		if err := os.WriteFile(location, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		_, err := loadConfig(location)
+		if err == nil {
+			t.Fatal("expected error, got none")
+		}
+		if strings.Contains(err.Error(), allowUnknownKeysEnv) {
+			t.Errorf("expected the error not to mention %s, got %v", allowUnknownKeysEnv, err)
+		}
+	})
 }
 
 func TestConfigEquals(t *testing.T) {
@@ -215,6 +252,12 @@ func TestMergeWithDefault(t *testing.T) {
 		if mergedConfig.Logstash.HttpTimeout != defaultHttpTimeout {
 			t.Errorf("expected http timeout to be %v, got %v", defaultHttpTimeout, mergedConfig.Logstash.HttpTimeout)
 		}
+		if mergedConfig.Metrics.Naming != defaultMetricsNaming {
+			t.Errorf("expected metrics naming to be %v, got %v", defaultMetricsNaming, mergedConfig.Metrics.Naming)
+		}
+		if window := mergedConfig.Metrics.GetStallDetectionWindow(); window != defaultStallDetectionWindow {
+			t.Errorf("expected stall detection window to be %v, got %v", defaultStallDetectionWindow, window)
+		}
 	})
 
 	t.Run("merge with nil config", func(t *testing.T) {
@@ -325,3 +368,96 @@ func TestGetConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestGetConfigStrict(t *testing.T) {
+	t.Run("returns valid config", func(t *testing.T) {
+		config, err := GetConfigStrict("../../fixtures/valid_config.yml")
+		if err != nil {
+			t.Fatalf("got an error %v", err)
+		}
+		if config == nil {
+			t.Fatal("expected config to be non-nil")
+		}
+	})
+
+	t.Run("returns error for unknown keys", func(t *testing.T) {
+		location := filepath.Join(t.TempDir(), "config.yml")
+		content := "logstash:\n  instances:\n    - url: http://localhost:9600\n  httpTimout: 3s\n"
+		if err := os.WriteFile(location, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		_, err := GetConfigStrict(location)
+		if err == nil || !strings.Contains(err.Error(), "line 4: field httpTimout not found") {
+			t.Fatalf("expected an unknown key error, got %v", err)
+		}
+	})
+}
+
+func TestValidateAll(t *testing.T) {
+	t.Run("returns no errors for a valid config", func(t *testing.T) {
+		config := mergeWithDefault(nil)
+		if errs := config.ValidateAll(); len(errs) != 0 {
+			t.Errorf("expected no errors, got %v", errs)
+		}
+	})
+
+	t.Run("returns an error per invalid field", func(t *testing.T) {
+		config := mergeWithDefault(&Config{
+			Server: ServerConfig{TLSConfig: &TLSServerConfig{CertFile: "cert.pem"}},
+			Logstash: LogstashConfig{Instances: []*LogstashInstance{
+				{Host: "http://localhost:9600"},
+				{Host: "localhost:9600", BasicAuth: &ClientAuthConfig{Username: "user"}},
+				{
+					Host:         "https://localhost:9600",
+					TLSConfig:    &TLSClientConfig{CAFile: "ca.pem", CA: "-----BEGIN CERTIFICATE-----"},
+					MetricFilter: &MetricFilterConfig{Exclude: []string{"logstash_(info"}},
+				},
+			}},
+			Kubernetes: KubernetesConfig{Enabled: true},
+		})
+
+		errs := config.ValidateAll()
+
+		expectedFields := []string{
+			"server.tls_server_config",
+			"logstash.instances[1].url",
+			"logstash.instances[1].basic_auth",
+			"logstash.instances[2].tls_config",
+			"logstash.instances[2].metric_filter",
+			"kubernetes",
+		}
+		if len(errs) != len(expectedFields) {
+			t.Fatalf("expected %d errors, got %v", len(expectedFields), errs)
+		}
+		for i, field := range expectedFields {
+			var fieldError *FieldError
+			if !errors.As(errs[i], &fieldError) || fieldError.Field != field {
+				t.Errorf("expected an error of %s, got %v", field, errs[i])
+			}
+		}
+
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected Validate to return the errors")
+		}
+	})
+
+	t.Run("validates the port after the defaults are merged", func(t *testing.T) {
+		if errs := mergeWithDefault(&Config{}).ValidateAll(); len(errs) != 0 {
+			t.Errorf("expected the default port to be valid, got %v", errs)
+		}
+
+		for _, port := range []int{-1, 65536} {
+			config := mergeWithDefault(&Config{Server: ServerConfig{Port: port}})
+			errs := config.ValidateAll()
+			var fieldError *FieldError
+			if len(errs) != 1 || !errors.As(errs[0], &fieldError) || fieldError.Field != "server.port" {
+				t.Errorf("expected an error of server.port for the port %d, got %v", port, errs)
+			}
+		}
+
+		if errs := (&Config{}).ValidateAll(); len(errs) == 0 {
+			t.Errorf("expected an error for the port 0 of a config not merged with the defaults")
+		}
+	})
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"fmt"
+	"os"
 	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
+const defaultResourceScheme = "http"
+
 // ResourceConfig represents the configuration for monitoring a specific type of Kubernetes resource
 type ResourceConfig struct {
 	// Enable monitoring this resource type
@@ -11,6 +18,62 @@ type ResourceConfig struct {
 	
 	// AnnotationPrefix is the prefix used for annotations that the controller will watch
 	AnnotationPrefix string `yaml:"annotationPrefix"`
+
+	// LabelSelector restricts the watched resources to those matching the selector, e.g. "app=logstash"
+	LabelSelector string `yaml:"labelSelector,omitempty"`
+
+	// FieldSelector restricts the watched resources to those matching the selector, e.g. "status.phase=Running"
+	FieldSelector string `yaml:"fieldSelector,omitempty"`
+
+	// PortName is the name of the container port (pods) or service port (services) of the Logstash API.
+	// Resources with a port of this name are monitored without the URL annotation.
+	PortName string `yaml:"portName,omitempty"`
+
+	// Scheme of the URLs built from the named port, "http" by default
+	Scheme string `yaml:"scheme,omitempty"`
+
+	// PodLabels are the labels of the monitored pods copied onto the metrics of their instances,
+	// named after the label keys sanitised to valid Prometheus label names, e.g. "app_kubernetes_io_instance"
+	PodLabels []string `yaml:"podLabels,omitempty"`
+
+	// PodAnnotations are the annotations of the monitored pods copied onto the metrics of their instances,
+	// named like the pod labels
+	PodAnnotations []string `yaml:"podAnnotations,omitempty"`
+
+	// InsecureSkipVerify skips the verification of the API certificates of the ECK Logstash resources,
+	// which are otherwise verified with the certificate authority of ECK. Only supported by logstashes.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// LeaderElectionConfig configures the Lease-based leader election of the controller replicas
+type LeaderElectionConfig struct {
+	// Enable leader election, so that only the replica holding the Lease of a shard monitors its instances
+	Enabled bool `yaml:"enabled"`
+
+	// LeaseName is the name of the Lease, suffixed with "-<shard>" when the instances are sharded
+	LeaseName string `yaml:"leaseName"`
+
+	// LeaseNamespace is the namespace of the Leases, the namespace of the controller pod by default
+	LeaseNamespace string `yaml:"leaseNamespace,omitempty"`
+
+	// LeaseDuration is the duration after which a Lease that is not renewed can be acquired by another replica
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+
+	// RenewDeadline is the duration during which the holder of a Lease retries renewing it before giving it up
+	RenewDeadline time.Duration `yaml:"renewDeadline"`
+
+	// RetryPeriod is the interval between the attempts to acquire or renew a Lease
+	RetryPeriod time.Duration `yaml:"retryPeriod"`
+}
+
+// ShardingConfig configures the split of the discovered instances between the controller replicas
+type ShardingConfig struct {
+	// Shards is the number of shards, each of them monitored by one replica
+	Shards int `yaml:"shards"`
+
+	// ShardIndex is the shard of the replica without leader election,
+	// the ordinal of the pod name by default, e.g. 2 for "logstash-exporter-2"
+	ShardIndex *int `yaml:"shardIndex,omitempty"`
 }
 
 // KubernetesConfig holds configuration for the Kubernetes controller
@@ -21,6 +84,9 @@ type KubernetesConfig struct {
 	// Namespaces to watch, empty for all namespaces
 	Namespaces []string `yaml:"namespaces,omitempty"`
 
+	// NamespaceSelector restricts the watched namespaces to those with labels matching the selector
+	NamespaceSelector string `yaml:"namespaceSelector,omitempty"`
+
 	// ResourceTypes defines which types of Kubernetes resources to monitor
 	Resources struct {
 		// Pods configuration
@@ -28,6 +94,22 @@ type KubernetesConfig struct {
 		
 		// Services configuration
 		Services ResourceConfig `yaml:"services"`
+
+		// EndpointSlices configuration, monitoring every ready endpoint of the selected services
+		EndpointSlices ResourceConfig `yaml:"endpointSlices"`
+
+		// StatefulSets configuration, monitoring the pods of the selected StatefulSets
+		StatefulSets ResourceConfig `yaml:"statefulSets"`
+
+		// Deployments configuration, monitoring the pods of the selected Deployments
+		Deployments ResourceConfig `yaml:"deployments"`
+
+		// Logstashes configuration, monitoring the pods of the Logstash custom resources managed by
+		// Elastic Cloud on Kubernetes (ECK), which require no annotations
+		Logstashes ResourceConfig `yaml:"logstashes"`
+
+		// LogstashTargets configuration, monitoring the targets declared by the LogstashTarget custom resources
+		LogstashTargets ResourceConfig `yaml:"logstashTargets"`
 	} `yaml:"resources"`
 
 	// ResyncPeriod is the period for resynchronizing the cache
@@ -45,8 +127,18 @@ type KubernetesConfig struct {
 	// LogstashPasswordAnnotation is the annotation that contains the password for logstash authentication
 	LogstashPasswordAnnotation string `yaml:"logstashPasswordAnnotation,omitempty"`
 
+	// LogstashPasswordSecretAnnotation is the annotation that references the password for logstash authentication,
+	// as "<secret-name>/<key>" of a Secret in the namespace of the annotated resource
+	LogstashPasswordSecretAnnotation string `yaml:"logstashPasswordSecretAnnotation,omitempty"`
+
 	// KubeConfig is the path to the kubeconfig file
 	KubeConfig string `yaml:"kubeConfig,omitempty"`
+
+	// LeaderElection configures the election of the replicas monitoring the instances
+	LeaderElection LeaderElectionConfig `yaml:"leaderElection"`
+
+	// Sharding configures the split of the discovered instances between the replicas
+	Sharding ShardingConfig `yaml:"sharding"`
 }
 
 // DefaultKubernetesConfig returns the default Kubernetes controller configuration
@@ -58,6 +150,14 @@ func DefaultKubernetesConfig() KubernetesConfig {
 		LogstashURLAnnotation:   "logstash-exporter.io/url",
 		LogstashUsernameAnnotation: "logstash-exporter.io/username",
 		LogstashPasswordAnnotation: "logstash-exporter.io/password",
+		LogstashPasswordSecretAnnotation: "logstash-exporter.io/password-secret",
+		LeaderElection: LeaderElectionConfig{
+			LeaseName:     "logstash-exporter",
+			LeaseDuration: 15 * time.Second,
+			RenewDeadline: 10 * time.Second,
+			RetryPeriod:   2 * time.Second,
+		},
+		Sharding: ShardingConfig{Shards: 1},
 	}
 	
 	// Default resource configurations
@@ -70,6 +170,226 @@ func DefaultKubernetesConfig() KubernetesConfig {
 		Enabled:         false,
 		AnnotationPrefix: "logstash-exporter.io",
 	}
+
+	config.Resources.EndpointSlices = ResourceConfig{
+		Enabled:          false,
+		AnnotationPrefix: "logstash-exporter.io",
+	}
+
+	config.Resources.StatefulSets = ResourceConfig{
+		Enabled:          false,
+		AnnotationPrefix: "logstash-exporter.io",
+	}
+
+	config.Resources.Deployments = ResourceConfig{
+		Enabled:          false,
+		AnnotationPrefix: "logstash-exporter.io",
+	}
+
+	config.Resources.Logstashes = ResourceConfig{
+		Enabled:          false,
+		AnnotationPrefix: "logstash-exporter.io",
+	}
+
+	config.Resources.LogstashTargets = ResourceConfig{
+		Enabled:          false,
+		AnnotationPrefix: "logstash-exporter.io",
+	}
 	
 	return config
-}
\ No newline at end of file
+}
+
+// ValidateKubernetes validates the Kubernetes controller configuration, if it is enabled
+func (c *KubernetesConfig) ValidateKubernetes() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if !c.Resources.Pods.Enabled && !c.Resources.Services.Enabled && !c.Resources.EndpointSlices.Enabled &&
+		!c.Resources.StatefulSets.Enabled && !c.Resources.Deployments.Enabled &&
+		!c.Resources.Logstashes.Enabled && !c.Resources.LogstashTargets.Enabled {
+		return fmt.Errorf("at least one of the pods, services, endpointSlices, statefulSets, deployments, logstashes and logstashTargets resources must be enabled")
+	}
+
+	if c.ResyncPeriod < 0 {
+		return fmt.Errorf("resyncPeriod must not be negative, got %s", c.ResyncPeriod)
+	}
+
+	if c.ScrapeInterval < 0 {
+		return fmt.Errorf("scrapeInterval must not be negative, got %s", c.ScrapeInterval)
+	}
+
+	if c.LogstashURLAnnotation == "" {
+		return fmt.Errorf("logstashURLAnnotation must be specified")
+	}
+
+	if _, err := labels.Parse(c.NamespaceSelector); err != nil {
+		return fmt.Errorf("invalid namespaceSelector: %w", err)
+	}
+
+	if err := c.Resources.Pods.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid pods configuration: %w", err)
+	}
+
+	if err := c.Resources.Services.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid services configuration: %w", err)
+	}
+
+	if err := c.Resources.EndpointSlices.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid endpointSlices configuration: %w", err)
+	}
+
+	if err := c.Resources.StatefulSets.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid statefulSets configuration: %w", err)
+	}
+
+	if err := c.Resources.Deployments.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid deployments configuration: %w", err)
+	}
+
+	if err := c.Resources.Logstashes.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid logstashes configuration: %w", err)
+	}
+
+	if err := c.Resources.LogstashTargets.ValidateResource(); err != nil {
+		return fmt.Errorf("invalid logstashTargets configuration: %w", err)
+	}
+
+	// the options are rejected on the resource types whose handlers ignore them
+	for _, resource := range []struct {
+		name               string
+		config             *ResourceConfig
+		podMetadata        bool
+		insecureSkipVerify bool
+	}{
+		{"pods", &c.Resources.Pods, true, false},
+		{"services", &c.Resources.Services, false, false},
+		{"endpointSlices", &c.Resources.EndpointSlices, false, false},
+		{"statefulSets", &c.Resources.StatefulSets, true, false},
+		{"deployments", &c.Resources.Deployments, true, false},
+		{"logstashes", &c.Resources.Logstashes, true, true},
+		{"logstashTargets", &c.Resources.LogstashTargets, false, false},
+	} {
+		if !resource.podMetadata && (len(resource.config.PodLabels) > 0 || len(resource.config.PodAnnotations) > 0) {
+			return fmt.Errorf("invalid %s configuration: podLabels and podAnnotations are only supported by the pods, statefulSets, deployments and logstashes resources", resource.name)
+		}
+		if !resource.insecureSkipVerify && resource.config.InsecureSkipVerify {
+			return fmt.Errorf("invalid %s configuration: insecureSkipVerify is only supported by the logstashes resource", resource.name)
+		}
+	}
+
+	if c.KubeConfig != "" {
+		if _, err := os.Stat(c.KubeConfig); err != nil {
+			return fmt.Errorf("kubeConfig %s is not readable: %w", c.KubeConfig, err)
+		}
+	}
+
+	if err := c.LeaderElection.ValidateLeaderElection(); err != nil {
+		return fmt.Errorf("invalid leaderElection configuration: %w", err)
+	}
+
+	if err := c.Sharding.ValidateSharding(); err != nil {
+		return fmt.Errorf("invalid sharding configuration: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateLeaderElection validates the Lease name and durations, if leader election is enabled
+func (c *LeaderElectionConfig) ValidateLeaderElection() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.LeaseName == "" {
+		return fmt.Errorf("leaseName must be specified")
+	}
+
+	if c.RetryPeriod <= 0 {
+		return fmt.Errorf("retryPeriod must be positive, got %s", c.RetryPeriod)
+	}
+
+	// the attempts to renew the Lease are jittered by up to 20% of retryPeriod
+	if c.RenewDeadline <= c.RetryPeriod*6/5 {
+		return fmt.Errorf("renewDeadline must be greater than 1.2 times retryPeriod, got %s", c.RenewDeadline)
+	}
+
+	if c.LeaseDuration <= c.RenewDeadline {
+		return fmt.Errorf("leaseDuration must be greater than renewDeadline, got %s", c.LeaseDuration)
+	}
+
+	return nil
+}
+
+// ValidateSharding validates the number of shards and the shard of the replica
+func (c *ShardingConfig) ValidateSharding() error {
+	if c.Shards < 1 {
+		return fmt.Errorf("shards must be at least 1, got %d", c.Shards)
+	}
+
+	if c.ShardIndex != nil && (*c.ShardIndex < 0 || *c.ShardIndex >= c.Shards) {
+		return fmt.Errorf("shardIndex must be between 0 and %d, got %d", c.Shards-1, *c.ShardIndex)
+	}
+
+	return nil
+}
+
+// ValidateResource validates the selectors and the port discovery of a resource type
+func (c *ResourceConfig) ValidateResource() error {
+	if _, err := labels.Parse(c.LabelSelector); err != nil {
+		return fmt.Errorf("invalid labelSelector: %w", err)
+	}
+
+	if _, err := fields.ParseSelector(c.FieldSelector); err != nil {
+		return fmt.Errorf("invalid fieldSelector: %w", err)
+	}
+
+	switch c.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unknown scheme %q, expected one of: http, https", c.Scheme)
+	}
+
+	// the label and annotation keys must not be copied onto the same metric label
+	metricLabels := make(map[string]string)
+	for _, key := range append(append([]string{}, c.PodLabels...), c.PodAnnotations...) {
+		if key == "" {
+			return fmt.Errorf("podLabels and podAnnotations must not contain empty keys")
+		}
+
+		name := SanitizeLabelName(key)
+		if other, exists := metricLabels[name]; exists {
+			return fmt.Errorf("the pod metadata keys %q and %q are both copied onto the %q label", other, key, name)
+		}
+		if err := ValidateLabels(map[string]string{name: ""}); err != nil {
+			return fmt.Errorf("invalid pod metadata key %q: %w", key, err)
+		}
+		metricLabels[name] = key
+	}
+
+	return nil
+}
+
+// mergeLeaderElectionWithDefault sets the default Lease name and durations
+func mergeLeaderElectionWithDefault(leaderElection *LeaderElectionConfig) {
+	defaults := DefaultKubernetesConfig().LeaderElection
+	if leaderElection.LeaseName == "" {
+		leaderElection.LeaseName = defaults.LeaseName
+	}
+	if leaderElection.LeaseDuration == 0 {
+		leaderElection.LeaseDuration = defaults.LeaseDuration
+	}
+	if leaderElection.RenewDeadline == 0 {
+		leaderElection.RenewDeadline = defaults.RenewDeadline
+	}
+	if leaderElection.RetryPeriod == 0 {
+		leaderElection.RetryPeriod = defaults.RetryPeriod
+	}
+}
+
+// mergeResourceWithDefault sets the default values of a resource type configuration
+func mergeResourceWithDefault(resource *ResourceConfig) {
+	if resource.Scheme == "" {
+		resource.Scheme = defaultResourceScheme
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import "testing"
+
+func TestValidateKubernetes(t *testing.T) {
+	t.Parallel()
+
+	newConfig := func() KubernetesConfig {
+		config := DefaultKubernetesConfig()
+		config.Enabled = true
+		return config
+	}
+
+	valid := newConfig()
+	valid.NamespaceSelector = "team=logging"
+	valid.Resources.Pods.LabelSelector = "app.kubernetes.io/name=logstash"
+	valid.Resources.Pods.FieldSelector = "status.phase=Running"
+	valid.Resources.Pods.PortName = "http-api"
+	valid.Resources.Pods.PodLabels = []string{"app.kubernetes.io/instance", "team"}
+	valid.Resources.Pods.PodAnnotations = []string{"example.com/owner"}
+	if err := valid.ValidateKubernetes(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	sharded := newConfig()
+	sharded.LeaderElection.Enabled = true
+	sharded.Sharding.Shards = 3
+	if err := sharded.ValidateKubernetes(); err != nil {
+		t.Errorf("unexpected error for the sharded controller: %v", err)
+	}
+
+	eck := newConfig()
+	eck.Resources.Logstashes.Enabled = true
+	eck.Resources.Logstashes.PodLabels = []string{"team"}
+	eck.Resources.Logstashes.InsecureSkipVerify = true
+	eck.Resources.Deployments.PodAnnotations = []string{"example.com/owner"}
+	if err := eck.ValidateKubernetes(); err != nil {
+		t.Errorf("unexpected error for the pod metadata of the logstashes resource: %v", err)
+	}
+
+	workloads := newConfig()
+	workloads.Resources.Pods.Enabled = false
+	workloads.Resources.StatefulSets.Enabled = true
+	if err := workloads.ValidateKubernetes(); err != nil {
+		t.Errorf("unexpected error for the statefulsets resource: %v", err)
+	}
+
+	for name, modify := range map[string]func(*KubernetesConfig){
+		"namespace selector": func(c *KubernetesConfig) { c.NamespaceSelector = "team in (" },
+		"label selector":     func(c *KubernetesConfig) { c.Resources.Pods.LabelSelector = "app=" + "!" },
+		"field selector":     func(c *KubernetesConfig) { c.Resources.Services.FieldSelector = "metadata.name" },
+		"scheme":             func(c *KubernetesConfig) { c.Resources.Pods.Scheme = "ftp" },
+		"workload selector":  func(c *KubernetesConfig) { c.Resources.Deployments.LabelSelector = "app in (" },
+		"shards":             func(c *KubernetesConfig) { c.Sharding.Shards = 0 },
+		"pod label":          func(c *KubernetesConfig) { c.Resources.Pods.PodLabels = []string{"__meta"} },
+		"service pod labels": func(c *KubernetesConfig) { c.Resources.Services.PodLabels = []string{"team"} },
+		"endpoint slice pod annotations": func(c *KubernetesConfig) {
+			c.Resources.EndpointSlices.PodAnnotations = []string{"example.com/owner"}
+		},
+		"logstash target pod labels": func(c *KubernetesConfig) { c.Resources.LogstashTargets.PodLabels = []string{"team"} },
+		"pod insecure skip verify":   func(c *KubernetesConfig) { c.Resources.Pods.InsecureSkipVerify = true },
+		"pod metadata keys": func(c *KubernetesConfig) {
+			c.Resources.Pods.PodLabels = []string{"app.kubernetes.io/instance"}
+			c.Resources.Pods.PodAnnotations = []string{"app-kubernetes-io/instance"}
+		},
+		"shard index": func(c *KubernetesConfig) {
+			shardIndex := 2
+			c.Sharding = ShardingConfig{Shards: 2, ShardIndex: &shardIndex}
+		},
+		"lease durations": func(c *KubernetesConfig) {
+			c.LeaderElection.Enabled = true
+			c.LeaderElection.RenewDeadline = c.LeaderElection.LeaseDuration
+		},
+	} {
+		invalid := newConfig()
+		modify(&invalid)
+		if err := invalid.ValidateKubernetes(); err == nil {
+			t.Errorf("expected an error for the invalid %s", name)
+		}
+	}
+}
+
+func TestMergeResourceWithDefault(t *testing.T) {
+	t.Parallel()
+
+	config := mergeWithDefault(&Config{Kubernetes: KubernetesConfig{
+		Resources: DefaultKubernetesConfig().Resources,
+	}})
+	config.Kubernetes.Resources.Services.Scheme = "https"
+	mergeResourceWithDefault(&config.Kubernetes.Resources.Services)
+
+	if config.Kubernetes.Resources.Pods.Scheme != "http" || config.Kubernetes.Resources.Services.Scheme != "https" {
+		t.Errorf("expected the default scheme only for pods, got %+v", config.Kubernetes.Resources)
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// MetricsNamingV2 is the metric naming scheme used since the V2 release
+	MetricsNamingV2 = "v2"
+	// MetricsNamingV3 is the Prometheus-conventional naming scheme,
+	// exporting durations in seconds and monotonic values as counters
+	MetricsNamingV3 = "v3"
+)
+
+const defaultMetricsNaming = MetricsNamingV2
+
+const defaultStallDetectionWindow = 5 * time.Minute
+
+const (
+	// V1CompatibilityAlso exports the metrics renamed since V1 also under their V1 names
+	V1CompatibilityAlso = "also"
+	// V1CompatibilityOnly exports the metrics only under their V1 names and label sets
+	V1CompatibilityOnly = "only"
+)
+
+// MetricsConfig configures the metrics exported by the collectors
+type MetricsConfig struct {
+	// Naming is the naming scheme of the exported metrics.
+	// One of: "v2" (default), "v3"
+	Naming string `yaml:"naming"`
+
+	// LegacyNames makes the "v3" naming scheme also export the metrics under their "v2" names.
+	// This is meant to be used during the migration of dashboards and alerts.
+	LegacyNames bool `yaml:"legacy_names,omitempty"`
+
+	// V1Compatibility makes the collectors emit the metric names and label sets of the V1 exporter,
+	// so that the binary can be upgraded before the dashboards.
+	// One of: "" (disabled, default), "also", "only"
+	V1Compatibility string `yaml:"v1_compatibility,omitempty"`
+
+	// Derived enables exporting rates and ratios computed from two consecutive node stats samples as gauges,
+	// for consumers that cannot compute them with PromQL.
+	Derived bool `yaml:"derived,omitempty"`
+
+	// StallDetectionWindow is the time after which a pipeline is reported as stalled
+	// if it keeps receiving or queueing events without emitting any.
+	// Defaults to 5m, 0 disables the detection.
+	StallDetectionWindow *time.Duration `yaml:"stall_detection_window,omitempty"`
+}
+
+// GetStallDetectionWindow returns the configured stall detection window, or the default one if it is not set.
+// A window of 0 means the detection is disabled.
+func (c *MetricsConfig) GetStallDetectionWindow() time.Duration {
+	if c.StallDetectionWindow == nil {
+		return defaultStallDetectionWindow
+	}
+	return *c.StallDetectionWindow
+}
+
+// IsV2NamingEnabled returns true if the metrics should be exported under their "v2" names.
+func (c *MetricsConfig) IsV2NamingEnabled() bool {
+	return c.Naming != MetricsNamingV3 || c.LegacyNames
+}
+
+// IsV3NamingEnabled returns true if the metrics should be exported under their "v3" names.
+func (c *MetricsConfig) IsV3NamingEnabled() bool {
+	return c.Naming == MetricsNamingV3
+}
+
+// ValidateMetrics validates the metrics configuration.
+func (c *MetricsConfig) ValidateMetrics() error {
+	switch c.Naming {
+	case "", MetricsNamingV2, MetricsNamingV3:
+	default:
+		return fmt.Errorf("unknown naming scheme %q, expected one of: %s, %s", c.Naming, MetricsNamingV2, MetricsNamingV3)
+	}
+
+	if window := c.GetStallDetectionWindow(); window < 0 {
+		return fmt.Errorf("stall_detection_window must not be negative, got %s", window)
+	}
+
+	switch c.V1Compatibility {
+	case "", V1CompatibilityAlso, V1CompatibilityOnly:
+	default:
+		return fmt.Errorf("unknown v1_compatibility mode %q, expected one of: %s, %s", c.V1Compatibility, V1CompatibilityAlso, V1CompatibilityOnly)
+	}
+
+	return nil
+}
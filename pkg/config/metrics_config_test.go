@@ -0,0 +1,99 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricsConfigNaming(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		config    MetricsConfig
+		expectV2  bool
+		expectV3  bool
+		expectErr bool
+	}{
+		{name: "empty naming", config: MetricsConfig{}, expectV2: true, expectV3: false},
+		{name: "v2 naming", config: MetricsConfig{Naming: MetricsNamingV2}, expectV2: true, expectV3: false},
+		{name: "v2 naming ignores legacy names", config: MetricsConfig{Naming: MetricsNamingV2, LegacyNames: true}, expectV2: true, expectV3: false},
+		{name: "v3 naming", config: MetricsConfig{Naming: MetricsNamingV3}, expectV2: false, expectV3: true},
+		{name: "v3 naming with legacy names", config: MetricsConfig{Naming: MetricsNamingV3, LegacyNames: true}, expectV2: true, expectV3: true},
+		{name: "unknown naming", config: MetricsConfig{Naming: "v4"}, expectV2: true, expectV3: false, expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if enabled := testCase.config.IsV2NamingEnabled(); enabled != testCase.expectV2 {
+				t.Errorf("expected v2 naming enabled to be %v, got %v", testCase.expectV2, enabled)
+			}
+			if enabled := testCase.config.IsV3NamingEnabled(); enabled != testCase.expectV3 {
+				t.Errorf("expected v3 naming enabled to be %v, got %v", testCase.expectV3, enabled)
+			}
+
+			err := testCase.config.ValidateMetrics()
+			if (err != nil) != testCase.expectErr {
+				t.Errorf("expected error to be %v, got %v", testCase.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestMetricsConfigV1Compatibility(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		config    MetricsConfig
+		expectErr bool
+	}{
+		{name: "disabled", config: MetricsConfig{}},
+		{name: "also mode", config: MetricsConfig{V1Compatibility: V1CompatibilityAlso}},
+		{name: "only mode", config: MetricsConfig{V1Compatibility: V1CompatibilityOnly}},
+		{name: "only mode with v3 legacy names", config: MetricsConfig{Naming: MetricsNamingV3, LegacyNames: true, V1Compatibility: V1CompatibilityOnly}},
+		{name: "only mode with v3 names", config: MetricsConfig{Naming: MetricsNamingV3, V1Compatibility: V1CompatibilityOnly}},
+		{name: "unknown mode", config: MetricsConfig{V1Compatibility: "sometimes"}, expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := testCase.config.ValidateMetrics()
+			if (err != nil) != testCase.expectErr {
+				t.Errorf("expected error to be %v, got %v", testCase.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestMetricsConfigStallDetectionWindow(t *testing.T) {
+	t.Parallel()
+
+	window := -time.Minute
+	config := MetricsConfig{StallDetectionWindow: &window}
+	if err := config.ValidateMetrics(); err == nil {
+		t.Errorf("expected an error for a negative stall detection window")
+	}
+
+	window = time.Minute
+	if err := config.ValidateMetrics(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// an explicit window of 0 disables the detection instead of being replaced by the default
+	window = 0
+	if err := config.ValidateMetrics(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if config.GetStallDetectionWindow() != 0 {
+		t.Errorf("expected the stall detection to be disabled, got %v", config.GetStallDetectionWindow())
+	}
+
+	if window := (&MetricsConfig{}).GetStallDetectionWindow(); window != defaultStallDetectionWindow {
+		t.Errorf("expected the default stall detection window, got %v", window)
+	}
+}
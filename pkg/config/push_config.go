@@ -0,0 +1,293 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPushInterval      = 15 * time.Second
+	defaultPushTimeout       = 10 * time.Second
+	defaultPushMaxRetries    = 3
+	defaultPushRetryBackoff  = time.Second
+	defaultPushMaxBackoff    = 30 * time.Second
+	defaultWALMaxSizeInBytes = 64 * 1024 * 1024
+	defaultOTLPProtocol      = OTLPProtocolHTTP
+	defaultPushgatewayJob    = "logstash"
+)
+
+const (
+	// OTLPProtocolHTTP exports the metrics with OTLP over HTTP, encoded as protobuf
+	OTLPProtocolHTTP = "http"
+	// OTLPProtocolGRPC exports the metrics with OTLP over gRPC
+	OTLPProtocolGRPC = "grpc"
+)
+
+// PushConfig configures pushing the collected metrics to remote endpoints,
+// for Logstash instances that cannot be scraped, e.g. because they are behind NAT.
+type PushConfig struct {
+	// Interval is the time between consecutive collections of the metrics.
+	Interval time.Duration `yaml:"interval"`
+
+	// RemoteWrite configures shipping the metrics with the Prometheus remote_write protocol.
+	RemoteWrite *RemoteWriteConfig `yaml:"remote_write,omitempty"`
+
+	// OTLP configures exporting the metrics to an OpenTelemetry collector.
+	OTLP *OTLPConfig `yaml:"otlp,omitempty"`
+
+	// Pushgateway configures pushing the final metrics of short-lived Logstash runs to a Pushgateway.
+	Pushgateway *PushgatewayConfig `yaml:"pushgateway,omitempty"`
+}
+
+// PushClientConfig configures the HTTP client used to push the metrics.
+type PushClientConfig struct {
+	// URL is the endpoint the metrics are pushed to.
+	URL string `yaml:"url"`
+
+	// Timeout is the timeout of a single push request.
+	Timeout time.Duration `yaml:"timeout"`
+
+	HTTPClientConfig `yaml:",inline"`
+}
+
+// HTTPClientConfig configures the TLS and the authentication of an HTTP client
+// connecting to an endpoint other than Logstash.
+type HTTPClientConfig struct {
+	// TLS configuration for the HTTP client
+	TLSConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+
+	// Basic authentication for the HTTP client
+	BasicAuth *ClientAuthConfig `yaml:"basic_auth,omitempty"`
+
+	// BearerToken is sent in the Authorization header.
+	BearerToken string `yaml:"bearer_token,omitempty"`
+
+	// BearerTokenFile is the path to a file containing the bearer token.
+	// This is mutually exclusive with BearerToken.
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+}
+
+// RemoteWriteConfig configures the Prometheus remote_write sink.
+type RemoteWriteConfig struct {
+	PushClientConfig `yaml:",inline"`
+
+	// MaxRetries is the number of retries of a failed request before it is written to the WAL.
+	// Defaults to 3, 0 disables the retries.
+	MaxRetries *int `yaml:"max_retries,omitempty"`
+
+	// RetryBackoff is the initial delay between retries, doubled after every retry.
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+
+	// WAL configures the on-disk buffer of the requests that could not be delivered.
+	WAL *WALConfig `yaml:"wal,omitempty"`
+}
+
+// WALConfig configures the on-disk write-ahead log of the undelivered requests.
+type WALConfig struct {
+	// Directory is where the undelivered requests are stored.
+	Directory string `yaml:"directory"`
+
+	// MaxSizeInBytes bounds the size of the WAL, the oldest requests are dropped first.
+	MaxSizeInBytes int64 `yaml:"max_size_in_bytes"`
+}
+
+// GetMaxRetries returns the configured number of retries, or the default one if it is not set.
+func (c *RemoteWriteConfig) GetMaxRetries() int {
+	if c.MaxRetries == nil {
+		return defaultPushMaxRetries
+	}
+	return *c.MaxRetries
+}
+
+// OTLPConfig configures the OpenTelemetry OTLP sink.
+type OTLPConfig struct {
+	PushClientConfig `yaml:",inline"`
+
+	// Protocol is the transport of OTLP.
+	// One of: "http" (default), "grpc"
+	Protocol string `yaml:"protocol"`
+
+	// Headers are sent with every export request.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// PushgatewayConfig configures the Pushgateway sink.
+type PushgatewayConfig struct {
+	PushClientConfig `yaml:",inline"`
+
+	// Job is the value of the job label of the pushed metrics.
+	Job string `yaml:"job"`
+
+	// Grouping are additional labels of the grouping key.
+	// The instance label is always added, set to the name of the Logstash instance.
+	Grouping map[string]string `yaml:"grouping,omitempty"`
+}
+
+// IsEnabled returns true if any push sink is configured.
+func (c *PushConfig) IsEnabled() bool {
+	return c.RemoteWrite != nil || c.OTLP != nil || c.Pushgateway != nil
+}
+
+// ValidatePush validates the push configuration.
+func (c *PushConfig) ValidatePush() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	if c.Interval < 0 {
+		return fmt.Errorf("interval must not be negative, got %s", c.Interval)
+	}
+
+	if c.RemoteWrite != nil {
+		if err := c.RemoteWrite.ValidatePushClient(); err != nil {
+			return fmt.Errorf("invalid remote_write configuration: %w", err)
+		}
+
+		if c.RemoteWrite.GetMaxRetries() < 0 {
+			return fmt.Errorf("invalid remote_write configuration: max_retries must not be negative")
+		}
+
+		if c.RemoteWrite.RetryBackoff < 0 || c.RemoteWrite.MaxBackoff < 0 {
+			return fmt.Errorf("invalid remote_write configuration: retry_backoff and max_backoff must not be negative")
+		}
+
+		if c.RemoteWrite.MaxBackoff > 0 && c.RemoteWrite.MaxBackoff < c.RemoteWrite.RetryBackoff {
+			return fmt.Errorf("invalid remote_write configuration: max_backoff %s must not be smaller than retry_backoff %s",
+				c.RemoteWrite.MaxBackoff, c.RemoteWrite.RetryBackoff)
+		}
+
+		if c.RemoteWrite.WAL != nil && c.RemoteWrite.WAL.Directory == "" {
+			return fmt.Errorf("invalid remote_write configuration: wal directory must be specified")
+		}
+
+		if c.RemoteWrite.WAL != nil && c.RemoteWrite.WAL.MaxSizeInBytes <= 0 {
+			return fmt.Errorf("invalid remote_write configuration: wal max_size_in_bytes must be greater than 0, got %d",
+				c.RemoteWrite.WAL.MaxSizeInBytes)
+		}
+	}
+
+	if c.OTLP != nil {
+		if err := c.OTLP.ValidatePushClient(); err != nil {
+			return fmt.Errorf("invalid otlp configuration: %w", err)
+		}
+
+		switch c.OTLP.Protocol {
+		case "", OTLPProtocolHTTP, OTLPProtocolGRPC:
+		default:
+			return fmt.Errorf("invalid otlp configuration: unknown protocol %q, expected one of: %s, %s", c.OTLP.Protocol, OTLPProtocolHTTP, OTLPProtocolGRPC)
+		}
+	}
+
+	if c.Pushgateway != nil {
+		if err := c.Pushgateway.ValidatePushClient(); err != nil {
+			return fmt.Errorf("invalid pushgateway configuration: %w", err)
+		}
+
+		for name := range c.Pushgateway.Grouping {
+			if name == "job" || name == "instance" {
+				return fmt.Errorf("invalid pushgateway configuration: grouping label %q is reserved", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidatePushClient validates the HTTP client configuration of a push sink.
+func (c *PushClientConfig) ValidatePushClient() error {
+	if c.URL == "" {
+		return fmt.Errorf("url must be specified")
+	}
+
+	if _, err := url.ParseRequestURI(c.URL); err != nil {
+		return fmt.Errorf("invalid url %q: %w", c.URL, err)
+	}
+
+	return c.ValidateHTTPClient()
+}
+
+// ValidateHTTPClient validates the authentication of the HTTP client.
+func (c *HTTPClientConfig) ValidateHTTPClient() error {
+	if c.BasicAuth != nil {
+		if err := c.BasicAuth.ValidateClientAuth(); err != nil {
+			return err
+		}
+	}
+
+	if c.BearerToken != "" && c.BearerTokenFile != "" {
+		return fmt.Errorf("bearer_token and bearer_token_file are mutually exclusive")
+	}
+
+	if c.BasicAuth != nil && (c.BearerToken != "" || c.BearerTokenFile != "") {
+		return fmt.Errorf("basic_auth and bearer token are mutually exclusive")
+	}
+
+	return nil
+}
+
+// GetBearerToken returns the bearer token, or an empty string if none is configured.
+func (c *HTTPClientConfig) GetBearerToken() (string, error) {
+	if c.BearerToken != "" {
+		return c.BearerToken, nil
+	}
+
+	if c.BearerTokenFile != "" {
+		content, err := os.ReadFile(c.BearerTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read bearer token file: %w", err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	return "", nil
+}
+
+// mergePushWithDefault sets the default values of the configured push sinks.
+func mergePushWithDefault(push *PushConfig) {
+	if push.Interval == 0 {
+		push.Interval = defaultPushInterval
+	}
+
+	if push.RemoteWrite != nil {
+		if push.RemoteWrite.Timeout == 0 {
+			push.RemoteWrite.Timeout = defaultPushTimeout
+		}
+		if push.RemoteWrite.MaxRetries == nil {
+			maxRetries := defaultPushMaxRetries
+			push.RemoteWrite.MaxRetries = &maxRetries
+		}
+		if push.RemoteWrite.RetryBackoff == 0 {
+			push.RemoteWrite.RetryBackoff = defaultPushRetryBackoff
+		}
+		if push.RemoteWrite.MaxBackoff == 0 {
+			push.RemoteWrite.MaxBackoff = max(defaultPushMaxBackoff, push.RemoteWrite.RetryBackoff)
+		}
+		if push.RemoteWrite.WAL != nil && push.RemoteWrite.WAL.MaxSizeInBytes == 0 {
+			push.RemoteWrite.WAL.MaxSizeInBytes = defaultWALMaxSizeInBytes
+		}
+	}
+
+	if push.OTLP != nil {
+		if push.OTLP.Timeout == 0 {
+			push.OTLP.Timeout = defaultPushTimeout
+		}
+		if push.OTLP.Protocol == "" {
+			push.OTLP.Protocol = defaultOTLPProtocol
+		}
+	}
+
+	if push.Pushgateway != nil {
+		if push.Pushgateway.Timeout == 0 {
+			push.Pushgateway.Timeout = defaultPushTimeout
+		}
+		if push.Pushgateway.Job == "" {
+			push.Pushgateway.Job = defaultPushgatewayJob
+		}
+	}
+}
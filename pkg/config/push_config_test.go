@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidatePush(t *testing.T) {
+	t.Parallel()
+
+	validClient := PushClientConfig{URL: "http://localhost:9090/api/v1/write"}
+
+	testCases := []struct {
+		name      string
+		config    PushConfig
+		expectErr bool
+	}{
+		{name: "disabled", config: PushConfig{}},
+		{name: "remote write", config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: validClient}}},
+		{name: "missing url", config: PushConfig{RemoteWrite: &RemoteWriteConfig{}}, expectErr: true},
+		{name: "invalid url", config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: PushClientConfig{URL: "not a url"}}}, expectErr: true},
+		{
+			name: "bearer token and file",
+			config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: PushClientConfig{
+				URL: validClient.URL, HTTPClientConfig: HTTPClientConfig{BearerToken: "token", BearerTokenFile: "/token"},
+			}}},
+			expectErr: true,
+		},
+		{
+			name: "basic auth and bearer token",
+			config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: PushClientConfig{
+				URL: validClient.URL, HTTPClientConfig: HTTPClientConfig{BearerToken: "token", BasicAuth: &ClientAuthConfig{Username: "user", Password: "pass"}},
+			}}},
+			expectErr: true,
+		},
+		{name: "otlp", config: PushConfig{OTLP: &OTLPConfig{PushClientConfig: validClient, Protocol: OTLPProtocolGRPC}}},
+		{name: "otlp unknown protocol", config: PushConfig{OTLP: &OTLPConfig{PushClientConfig: validClient, Protocol: "udp"}}, expectErr: true},
+		{name: "pushgateway", config: PushConfig{Pushgateway: &PushgatewayConfig{PushClientConfig: validClient, Grouping: map[string]string{"env": "prod"}}}},
+		{name: "pushgateway reserved grouping label", config: PushConfig{Pushgateway: &PushgatewayConfig{PushClientConfig: validClient, Grouping: map[string]string{"instance": "a"}}}, expectErr: true},
+		{name: "wal without directory", config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: validClient, WAL: &WALConfig{MaxSizeInBytes: 1024}}}, expectErr: true},
+		{name: "wal without size", config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: validClient, WAL: &WALConfig{Directory: "/tmp/wal", MaxSizeInBytes: -1}}}, expectErr: true},
+		{name: "max backoff below retry backoff", config: PushConfig{RemoteWrite: &RemoteWriteConfig{PushClientConfig: validClient, RetryBackoff: time.Minute, MaxBackoff: time.Second}}, expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := testCase.config.ValidatePush()
+			if (err != nil) != testCase.expectErr {
+				t.Errorf("expected error to be %v, got %v", testCase.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestMergePushWithDefault(t *testing.T) {
+	t.Parallel()
+
+	push := PushConfig{RemoteWrite: &RemoteWriteConfig{WAL: &WALConfig{Directory: "/tmp/wal"}}, OTLP: &OTLPConfig{}, Pushgateway: &PushgatewayConfig{}}
+	mergePushWithDefault(&push)
+
+	if push.Interval != defaultPushInterval {
+		t.Errorf("expected interval to be %v, got %v", defaultPushInterval, push.Interval)
+	}
+	if push.RemoteWrite.Timeout != defaultPushTimeout {
+		t.Errorf("expected timeout to be %v, got %v", defaultPushTimeout, push.RemoteWrite.Timeout)
+	}
+	if push.RemoteWrite.GetMaxRetries() != defaultPushMaxRetries {
+		t.Errorf("expected max retries to be %v, got %v", defaultPushMaxRetries, push.RemoteWrite.GetMaxRetries())
+	}
+	if push.RemoteWrite.MaxBackoff != defaultPushMaxBackoff {
+		t.Errorf("expected max backoff to be %v, got %v", defaultPushMaxBackoff, push.RemoteWrite.MaxBackoff)
+	}
+	if push.RemoteWrite.WAL.MaxSizeInBytes != defaultWALMaxSizeInBytes {
+		t.Errorf("expected WAL size to be %v, got %v", defaultWALMaxSizeInBytes, push.RemoteWrite.WAL.MaxSizeInBytes)
+	}
+	if push.OTLP.Protocol != defaultOTLPProtocol {
+		t.Errorf("expected otlp protocol to be %v, got %v", defaultOTLPProtocol, push.OTLP.Protocol)
+	}
+	if push.Pushgateway.Job != defaultPushgatewayJob {
+		t.Errorf("expected pushgateway job to be %v, got %v", defaultPushgatewayJob, push.Pushgateway.Job)
+	}
+}
+
+func TestMergePushWithDefaultKeepsDisabledRetries(t *testing.T) {
+	t.Parallel()
+
+	maxRetries := 0
+	push := PushConfig{RemoteWrite: &RemoteWriteConfig{MaxRetries: &maxRetries}}
+	mergePushWithDefault(&push)
+
+	if push.RemoteWrite.GetMaxRetries() != 0 {
+		t.Errorf("expected the explicit max_retries of 0 to be kept, got %v", push.RemoteWrite.GetMaxRetries())
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	t.Parallel()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	client := HTTPClientConfig{BearerTokenFile: tokenFile}
+	token, err := client.GetBearerToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "file-token" {
+		t.Errorf("expected token to be %q, got %q", "file-token", token)
+	}
+}
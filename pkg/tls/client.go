@@ -52,12 +52,22 @@ func ConfigureHTTPClientWithTLS(timeout time.Duration, caFile, serverName string
 func ConfigureHTTPClientFromLogstashInstance(instance *config.LogstashInstance, timeout time.Duration) (*http.Client, error) {
 	// If there's a TLS configuration, use it
 	if instance.TLSConfig != nil {
-		return ConfigureHTTPClientWithTLS(
+		httpClient, err := ConfigureHTTPClientWithTLS(
 			timeout,
 			instance.TLSConfig.CAFile,
 			instance.TLSConfig.ServerName,
 			instance.TLSConfig.InsecureSkipVerify,
 		)
+		if err != nil || instance.TLSConfig.CA == "" {
+			return httpClient, err
+		}
+
+		certPool, err := ParseCertificateAuthority([]byte(instance.TLSConfig.CA))
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport.(*http.Transport).TLSClientConfig.RootCAs = certPool
+		return httpClient, nil
 	}
 
 	// No TLS configuration - use default transport with default settings
@@ -67,6 +77,40 @@ func ConfigureHTTPClientFromLogstashInstance(instance *config.LogstashInstance,
 	}, nil
 }
 
+// ConfigureHTTPClient creates an HTTP client with the TLS and authentication configuration.
+func ConfigureHTTPClient(cfg *config.HTTPClientConfig, timeout time.Duration) (*http.Client, error) {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: http.DefaultTransport,
+	}
+
+	if cfg.TLSConfig != nil {
+		var err error
+		httpClient, err = ConfigureHTTPClientWithTLS(timeout, cfg.TLSConfig.CAFile, cfg.TLSConfig.ServerName, cfg.TLSConfig.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.BasicAuth != nil {
+		password, err := cfg.BasicAuth.GetPassword()
+		if err != nil {
+			return nil, err
+		}
+		httpClient = ConfigureBasicAuth(httpClient, cfg.BasicAuth.Username, password)
+	}
+
+	token, err := cfg.GetBearerToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		httpClient = ConfigureBearerAuth(httpClient, token)
+	}
+
+	return httpClient, nil
+}
+
 // ConfigureBasicAuth adds basic authentication to an HTTP client's transport.
 // This method is for single user authentication only.
 func ConfigureBasicAuth(client *http.Client, username, password string) *http.Client {
@@ -101,3 +145,33 @@ func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error
 	// Pass the request to the underlying transport
 	return t.transport.RoundTrip(req2)
 }
+
+// ConfigureBearerAuth adds bearer token authentication to an HTTP client's transport.
+func ConfigureBearerAuth(client *http.Client, token string) *http.Client {
+	if client == nil {
+		return nil
+	}
+
+	client.Transport = &bearerAuthTransport{
+		token:     token,
+		transport: client.Transport,
+	}
+
+	return client
+}
+
+// bearerAuthTransport adds a bearer token to requests.
+type bearerAuthTransport struct {
+	token     string
+	transport http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *bearerAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Clone the request to avoid modifying the original
+	req2 := req.Clone(req.Context())
+
+	req2.Header.Set("Authorization", "Bearer "+t.token)
+
+	return t.transport.RoundTrip(req2)
+}
@@ -160,6 +160,17 @@ func TestConfigureHTTPClientFromLogstashInstance(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "TLS config with inline CA",
+			instance: &config.LogstashInstance{
+				Host: TestBaseURL,
+				Name: "with-inline-ca",
+				TLSConfig: &config.TLSClientConfig{
+					CA:         GetTestCertificates(t).CAPEM,
+					ServerName: TestServerName,
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -179,8 +190,22 @@ func TestConfigureHTTPClientFromLogstashInstance(t *testing.T) {
 			if client.Timeout != timeout {
 				t.Errorf("Expected timeout %v, got %v", timeout, client.Timeout)
 			}
+
+			if tc.instance.TLSConfig != nil && tc.instance.TLSConfig.CA != "" {
+				if client.Transport.(*http.Transport).TLSClientConfig.RootCAs == nil {
+					t.Errorf("Expected the inline CA to be trusted")
+				}
+			}
 		})
 	}
+
+	_, err = ConfigureHTTPClientFromLogstashInstance(&config.LogstashInstance{
+		Host:      TestBaseURL,
+		TLSConfig: &config.TLSClientConfig{CA: "not a certificate"},
+	}, timeout)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid inline CA")
+	}
 }
 
 func TestRoundTrip(t *testing.T) {
@@ -274,6 +299,34 @@ func TestConfigureBasicAuth(t *testing.T) {
 	})
 }
 
+func TestConfigureBearerAuth(t *testing.T) {
+	t.Run("nil client", func(t *testing.T) {
+		result := ConfigureBearerAuth(nil, "token")
+		if result != nil {
+			t.Errorf("Expected nil result for nil client, got %v", result)
+		}
+	})
+
+	t.Run("sets authorization header", func(t *testing.T) {
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		client := ConfigureBearerAuth(&http.Client{Transport: http.DefaultTransport}, "token")
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		if authorization != "Bearer token" {
+			t.Errorf("Expected Authorization header to be %q, got %q", "Bearer token", authorization)
+		}
+	})
+}
+
 func TestConfigureHTTPClientWithTLS(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "tls-client-test")
 	if err != nil {
@@ -23,6 +23,11 @@ func LoadCertificateAuthority(caFile string) (*x509.CertPool, error) {
 		return nil, fmt.Errorf("failed to read CA file: %w", err)
 	}
 
+	return ParseCertificateAuthority(caData)
+}
+
+// ParseCertificateAuthority parses the PEM encoded CA certificates.
+func ParseCertificateAuthority(caData []byte) (*x509.CertPool, error) {
 	certPool := x509.NewCertPool()
 	if !certPool.AppendCertsFromPEM(caData) {
 		return nil, fmt.Errorf("failed to parse CA certificate")